@@ -9,5 +9,6 @@ vm_ID=inst-$1
 action=$2
 virsh $action $vm_ID
 sleep 1
+[ "$action" = "start" -o "$action" = "reboot" ] && ./apply_trunk.sh $1
 state=$(virsh dominfo $vm_ID | grep State | cut -d: -f2- | xargs | sed 's/shut off/shut_off/g')
 echo "|:-COMMAND-:| $(basename $0) '$1' '$state'"
@@ -0,0 +1,21 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <push_id>" && exit -1
+
+push_id=$1
+delta_data=$(cat)
+i=0
+len=$(jq length <<< $delta_data)
+while [ $i -lt $len ]; do
+    vm_mac=$(jq -r .[$i].mac_addr <<< $delta_data)
+    nic_name=tap$(echo $vm_mac | cut -d: -f4- | tr -d :)
+    if [ -n "$(iptables -S secgroup-in-$nic_name 2>/dev/null)" ]; then
+        jq -c ".[$i].delete // []" <<< $delta_data | ./apply_sg_rule.sh $nic_name delete
+        jq -c ".[$i].add // []" <<< $delta_data | ./apply_sg_rule.sh $nic_name
+    fi
+    let i=$i+1
+done
+echo "|:-COMMAND-:| `basename $0` '$push_id'"
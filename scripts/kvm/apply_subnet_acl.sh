@@ -0,0 +1,68 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 3 ] && echo "$0 <router> <vni> <network>" && exit -1
+
+router=$1
+[ "${router/router-/}" = "$router" ] && router=router-$1
+vni=$2
+network=$3
+ip netns list | grep -q $router
+[ $? -ne 0 ] && exit 0
+
+router_dir=/opt/cloudland/cache/router/$router
+chain_in=acl-in-$vni
+chain_out=acl-out-$vni
+for chain in $chain_in $chain_out; do
+    ip netns exec $router iptables -N $chain 2>/dev/null
+    ip netns exec $router iptables -F $chain
+done
+ip netns exec $router iptables -C FORWARD -d $network -j $chain_in 2>/dev/null || ip netns exec $router iptables -I FORWARD -d $network -j $chain_in
+ip netns exec $router iptables -C FORWARD -s $network -j $chain_out 2>/dev/null || ip netns exec $router iptables -I FORWARD -s $network -j $chain_out
+
+rules=$(cat)
+[ -z "$rules" -o "$rules" = "null" ] && rules='[]'
+i=0
+len=$(jq length <<< $rules)
+while [ $i -lt $len ]; do
+    action=$(jq -r .[$i].action <<< $rules)
+    direction=$(jq -r .[$i].direction <<< $rules)
+    protocol=$(jq -r .[$i].protocol <<< $rules)
+    cidr=$(jq -r .[$i].cidr <<< $rules)
+    port_min=$(jq -r .[$i].port_min <<< $rules)
+    port_max=$(jq -r .[$i].port_max <<< $rules)
+    chain=$chain_in
+    args="-s $cidr"
+    if [ "$direction" = "egress" ]; then
+        chain=$chain_out
+        args="-d $cidr"
+    fi
+    case "$protocol" in
+        "tcp"|"udp")
+            args="$args -p $protocol"
+            if [ "$port_min" -gt 0 -a "$port_max" -gt "$port_min" ]; then
+                args="$args --dport $port_min:$port_max"
+            elif [ "$port_min" -gt 0 ]; then
+                args="$args --dport $port_min"
+            fi
+            ;;
+        "icmp")
+            args="$args -p icmp"
+            ;;
+    esac
+    target=RETURN
+    [ "$action" = "deny" ] && target=DROP
+    ip netns exec $router iptables -A $chain $args -j $target
+    let i=$i+1
+done
+flowlog=$(cat $router_dir/flowlog-$vni $router_dir/flowlog 2>/dev/null | head -1)
+if [ -n "$flowlog" -a "${flowlog#* }" != "accept" ]; then
+    for chain in $chain_in $chain_out; do
+        ip netns exec $router iptables -A $chain -m limit --limit 100/s -j LOG --log-prefix "fl-${flowlog%% *}-D "
+    done
+fi
+ip netns exec $router iptables -A $chain_in -j DROP
+ip netns exec $router iptables -A $chain_out -j DROP
+ip netns exec $router iptables-save > $router_dir/iptables.save
@@ -0,0 +1,18 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <vm_ID>" && exit -1
+
+vm_ID=inst-$1
+trunk_file=$cache_dir/trunk/$vm_ID
+[ -f "$trunk_file" ] || exit 0
+
+while read sub_nic nic_name seg_id vlan; do
+    [ -d "/sys/class/net/$nic_name" ] || continue
+    ./create_link.sh $vlan
+    ip link show $sub_nic >/dev/null 2>&1 || ip link add link $nic_name name $sub_nic type vlan id $seg_id
+    ip link set $sub_nic master br$vlan
+    ip link set $sub_nic up
+done < $trunk_file
@@ -0,0 +1,28 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 5 ] && echo "$0 <vm_ID> <parent_mac> <segmentation_id> <vlan> <ip>" && exit -1
+
+vm_ID=inst-$1
+parent_mac=$2
+seg_id=$3
+vlan=$4
+ip=$5
+nic_name=tap$(echo $parent_mac | cut -d: -f4- | tr -d :)
+sub_nic=$nic_name.$seg_id
+vm_br=br$vlan
+trunk_file=$cache_dir/trunk/$vm_ID
+
+./create_link.sh $vlan
+if [ -d "/sys/class/net/$nic_name" ]; then
+    ip link show $sub_nic >/dev/null 2>&1 || ip link add link $nic_name name $sub_nic type vlan id $seg_id
+    ip link set $sub_nic master $vm_br
+    ip link set $sub_nic up
+fi
+./create_sg_chain.sh $sub_nic $ip $parent_mac
+./apply_sg_rule.sh $sub_nic
+mkdir -p $cache_dir/trunk
+sed -i "/^$sub_nic /d" $trunk_file 2>/dev/null
+echo "$sub_nic $nic_name $seg_id $vlan" >> $trunk_file
@@ -3,22 +3,59 @@
 cd $(dirname $0)
 source ../cloudrc
 
-[ $# -lt 3 ] && echo "$0 <vm_ID> <volume_ID> <volume_path>" && exit -1
+[ $# -lt 3 ] && echo "$0 <vm_ID> <volume_ID> <volume_path> [typed (yes | no)]" && exit -1
 
 vm_ID=inst-$1
 vol_ID=$2
 vol_path=$gluster_volume/$3
+typed=$4
 vol_xml=$xml_dir/$vm_ID/disk-${vol_ID}.xml
 cp $template_dir/volume.xml $vol_xml
-count=$(virsh dumpxml $vm_ID | grep -c "<disk type='network' device='disk'>")
-let letter=98+$count
+count=$(virsh dumpxml $vm_ID | grep -c "<disk type='\(network\|file\|block\)' device='disk'>")
+let letter=97+$count
 device=vd$(printf "\\$(printf '%03o' "$letter")")
-sed -i "s#VOLUME_SOURCE#$vol_path#g;s#VOLUME_TARGET#$device#g;" $vol_xml
+if [ "$typed" = "yes" ]; then
+    vol_json=$(cat)
+    backend=$(jq -r .backend <<< $vol_json)
+    source=$(jq -r '.source // empty' <<< $vol_json)
+    host=$(jq -r '.host // empty' <<< $vol_json)
+    secret=$(jq -r '.secret // empty' <<< $vol_json)
+    shareable=$(jq -r '.shareable // empty' <<< $vol_json)
+    driver=qcow2
+    [ "$backend" = "lvm" -o -n "$secret" -o "$shareable" = "true" ] && driver=raw
+    if [ "$backend" = "lvm" ]; then
+        disk_xml="<disk type='block' device='disk'><driver name='qemu' type='$driver' cache='none'/><source dev='$3'/>"
+    elif [ "$backend" = "nfs" ]; then
+        mount_volume_source $backend $source >/dev/null
+        disk_xml="<disk type='file' device='disk'><driver name='qemu' type='$driver' cache='none'/><source file='$volume_dir/$3'/>"
+    else
+        [ -n "$source" ] && vol_path=$3
+        disk_xml="<disk type='network' device='disk'><driver name='qemu' type='$driver' cache='none'/><source protocol='gluster' name='$vol_path'><host name='${host:-localhost}' port='24007'/></source>"
+    fi
+    if [ -n "$secret" ]; then
+        secret_uuid=$(uuidgen)
+        cat >$xml_dir/$vm_ID/secret-${vol_ID}.xml <<EOT
+<secret ephemeral='no' private='yes'>
+  <uuid>$secret_uuid</uuid>
+  <usage type='volume'><volume>volume-${vol_ID}</volume></usage>
+</secret>
+EOT
+        virsh secret-define $xml_dir/$vm_ID/secret-${vol_ID}.xml
+        virsh secret-set-value $secret_uuid $(echo -n "$secret" | base64)
+        disk_xml="$disk_xml<encryption format='luks'><secret type='passphrase' uuid='$secret_uuid'/></encryption>"
+    fi
+    iotune=$(jq -r '.qos // {} | to_entries | map("<\(.key)>\(.value)</\(.key)>") | join("")' <<< $vol_json)
+    [ -n "$iotune" ] && disk_xml="$disk_xml<iotune>$iotune</iotune>"
+    [ "$shareable" = "true" ] && disk_xml="$disk_xml<shareable/>"
+    echo "$disk_xml<target dev='$device' bus='virtio'/></disk>" > $vol_xml
+else
+    sed -i "s#VOLUME_SOURCE#$vol_path#g;s#VOLUME_TARGET#$device#g;" $vol_xml
+fi
 virsh attach-device $vm_ID $vol_xml --config --persistent
 if [ $? -eq 0 ]; then
     echo "|:-COMMAND-:| $(basename $0) '$1' '$vol_ID' '$device'"
 else
-    echo "|:-COMMAND-:| $(basename $0) '' '$vol_ID' ''"
+    echo "|:-COMMAND-:| $(basename $0) '$1' '$vol_ID' ''"
 fi
 vm_xml=$xml_dir/$vm_ID/$vm_ID.xml
 virsh dumpxml --security-info $vm_ID 2>/dev/null | sed "s/autoport='yes'/autoport='no'/g" > $vm_xml.dump && mv -f $vm_xml.dump $vm_xml
@@ -0,0 +1,43 @@
+#!/bin/bash
+
+# object store helpers for volume backups, source it with the store description in $store_json
+# endpoints like file:///opt/cloudland/backup use a directory shared by the hypervisors instead of s3
+
+store_endpoint=$(jq -r .endpoint <<< $store_json)
+store_bucket=$(jq -r '.bucket // empty' <<< $store_json)
+export AWS_ACCESS_KEY_ID=$(jq -r '.access_key // empty' <<< $store_json)
+export AWS_SECRET_ACCESS_KEY=$(jq -r '.secret_key // empty' <<< $store_json)
+store_dir=''
+[ "${store_endpoint:0:7}" = "file://" ] && store_dir=${store_endpoint:7}
+
+function store_put()
+{
+    src=$1
+    key=$2
+    if [ -n "$store_dir" ]; then
+        mkdir -p $(dirname $store_dir/$key) && cp -f $src $store_dir/$key
+    else
+        aws --endpoint-url $store_endpoint s3 cp --quiet $src s3://$store_bucket/$key
+    fi
+}
+
+function store_get()
+{
+    key=$1
+    dst=$2
+    if [ -n "$store_dir" ]; then
+        cp -f $store_dir/$key $dst
+    else
+        aws --endpoint-url $store_endpoint s3 cp --quiet s3://$store_bucket/$key $dst
+    fi
+}
+
+function store_rm()
+{
+    prefix=$1
+    if [ -n "$store_dir" ]; then
+        rm -rf $store_dir/$prefix
+    else
+        aws --endpoint-url $store_endpoint s3 rm --quiet --recursive s3://$store_bucket/$prefix
+    fi
+}
@@ -0,0 +1,81 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 3 ] && echo "$0 <backup_ID> <volume_path> <parent_ID> [vm_ID] [target]" && exit -1
+
+backup_ID=$1
+vol_file=$(volume_file $2)
+parent_ID=$3
+vm_ID=$4
+target=$5
+store_json=$(cat)
+source ./backup_store.sh
+chunk_size=4194304
+work_dir=$cache_tmp_dir/backup-$backup_ID
+state='error'
+bytes=0
+overlay=''
+disk=''
+
+function finish()
+{
+    # writes of the vm while it was backed up are merged back into the volume
+    if [ -n "$overlay" ]; then
+        virsh blockcommit inst-$vm_ID $disk --active --pivot --wait >/dev/null 2>&1 && rm -f $overlay
+    fi
+    rm -rf $work_dir
+    echo "|:-COMMAND-:| $(basename $0) '$backup_ID' '$bytes' '$state'"
+    exit 0
+}
+
+mkdir -p $work_dir
+if [ -n "$vm_ID" ]; then
+    # an attached volume is frozen in place by an external snapshot, the vm keeps running on the overlay
+    # volumes on gluster are network disks whose source is not the local path, so the disk is found by its target
+    disk=$(virsh domblklist inst-$vm_ID | awk -v t=$target '$1 == t {print $1}')
+    [ -z "$disk" ] && finish
+    overlay=$cache_tmp_dir/backup-$backup_ID.overlay
+    virsh snapshot-create-as inst-$vm_ID --disk-only --atomic --no-metadata --quiesce --diskspec $disk,file=$overlay >/dev/null 2>&1 || \
+        virsh snapshot-create-as inst-$vm_ID --disk-only --atomic --no-metadata --diskspec $disk,file=$overlay >/dev/null 2>&1
+    if [ $? -ne 0 ]; then
+        overlay=''
+        finish
+    fi
+fi
+# the volume is read chunk by chunk so no temporary copy of its full size is needed
+format=$(qemu-img info -U $vol_file | grep 'file format' | cut -d' ' -f3)
+size=$(qemu-img info -U --output=json $vol_file | jq -r '.["virtual-size"]')
+[ -z "$format" -o -z "$size" ] && finish
+
+# chunks unchanged since the parent backup are referenced instead of uploaded again, zero chunks are not stored at all
+declare -A parent_hash parent_holder
+if [ "$parent_ID" != "0" ]; then
+    store_get backups/$parent_ID/manifest $work_dir/parent.manifest || finish
+    while read idx hash holder; do
+        [ "${idx:0:1}" = "#" ] && continue
+        parent_hash[$idx]=$hash
+        parent_holder[$idx]=$holder
+    done < $work_dir/parent.manifest
+fi
+zero_hash=$(head -c $chunk_size /dev/zero | sha256sum | cut -d' ' -f1)
+echo "# size $size" > $work_dir/manifest
+let count=($size+$chunk_size-1)/$chunk_size
+for ((i = 0; i < count; i++)); do
+    rm -f $work_dir/chunk
+    qemu-img dd -U -f $format -O raw bs=$chunk_size skip=$i count=1 if=$vol_file of=$work_dir/chunk >/dev/null 2>&1 || finish
+    hash=$(sha256sum $work_dir/chunk | cut -d' ' -f1)
+    holder=$backup_ID
+    if [ "$hash" = "$zero_hash" ]; then
+        holder=0
+    elif [ "${parent_hash[$i]}" = "$hash" ]; then
+        holder=${parent_holder[$i]}
+    else
+        store_put $work_dir/chunk backups/$backup_ID/chunk-$i || finish
+        let bytes=$bytes+$(stat -c %s $work_dir/chunk)
+    fi
+    echo "$i $hash $holder" >> $work_dir/manifest
+done
+store_put $work_dir/manifest backups/$backup_ID/manifest && state='available'
+finish
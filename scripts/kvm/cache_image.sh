@@ -0,0 +1,23 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 2 ] && die "$0 <image_ID> <image>"
+
+ID=$1
+img_name=$2
+img_file=$image_cache/$img_name
+
+if [ ! -f "$img_file" ]; then
+    tmp_file=$cache_tmp_dir/$img_name.$$
+    mkdir -p $cache_tmp_dir
+    wget -q $image_repo/$img_name -O $tmp_file && mv -f $tmp_file $img_file
+    rm -f $tmp_file
+fi
+size=0
+if [ -f "$img_file" ]; then
+    touch $img_file
+    size=$(stat -c %s $img_file)
+fi
+echo "|:-COMMAND-:| $(basename $0) '$SCI_CLIENT_ID' '$ID' '$size'"
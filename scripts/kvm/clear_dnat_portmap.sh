@@ -0,0 +1,27 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 6 ] && die "$0 <gateway_id> <protocol> <remote_ip> <remote_ports> <instance_ip> <instance_ports> [source_cidr]"
+
+router=router-$1
+proto=$2
+remote_ip=${3%/*}
+rports=$4
+inst_ip=${5%/*}
+inst_ports=$6
+source_cidr=$7
+
+ip netns list | grep -q $router
+[ $? -ne 0 ] && exit 0
+
+router_dir=/opt/cloudland/cache/router/$router
+src_match=""
+[ -n "$source_cidr" ] && src_match="-s $source_cidr"
+to_dest=$inst_ip:$inst_ports
+if [ "${inst_ports/-/}" != "$inst_ports" ]; then
+    to_dest=$inst_ip:$inst_ports/${rports%:*}
+fi
+ip netns exec $router iptables -t nat -D PREROUTING -d $remote_ip $src_match -p $proto --dport $rports -j DNAT --to-destination $to_dest
+ip netns exec $router iptables-save > $router_dir/iptables.save
@@ -22,6 +22,7 @@ elif [ "$ext_type" = "private" ]; then
 fi
 ip netns exec $router iptables -t nat -D PREROUTING -d $ext_ip -j DNAT --to-destination $int_ip
 ip netns exec $router iptables -t mangle -D PREROUTING -s $int_net -d $ext_ip -j MARK --set-xmark 0x400
+./set_fip_qos.sh $ID $ext_type $ext_ip $int_ip <<< '{}'
 
 router_dir=/opt/cloudland/cache/router/$router
 vrrp_conf=$router_dir/keepalived.conf
@@ -0,0 +1,24 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <nat_ID>" && exit -1
+
+ID=$1
+nat=nat-$ID
+nat_dir=$cache_dir/nat/$nat
+
+subnets=$(cat)
+i=0
+n=$(jq length <<< $subnets)
+while [ $i -lt $n ]; do
+    jq -c .[$i] <<< $subnets | ./clear_nat_subnet.sh $ID
+    let i=$i+1
+done
+ip link del nx-$ID
+apply_vnic -D nx-$ID
+[ -f "$nat_dir/ext_vlan" ] && ./clear_link.sh $(cat $nat_dir/ext_vlan)
+udevadm settle
+ip netns del $nat
+rm -rf $nat_dir
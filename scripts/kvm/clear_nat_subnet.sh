@@ -0,0 +1,18 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <nat_ID>" && exit -1
+
+ID=$1
+nat=nat-$ID
+nat_dir=$cache_dir/nat/$nat
+subnet=$(cat)
+vni=$(jq -r .vni <<< $subnet)
+[ -z "$vni" ] && exit 1
+
+ip link del ln-$vni
+apply_vnic -D ln-$vni
+./clear_link.sh $vni
+rm -f $nat_dir/subnet-$vni
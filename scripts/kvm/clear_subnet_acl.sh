@@ -0,0 +1,24 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 3 ] && echo "$0 <router> <vni> <network>" && exit -1
+
+router=$1
+[ "${router/router-/}" = "$router" ] && router=router-$1
+vni=$2
+network=$3
+ip netns list | grep -q $router
+[ $? -ne 0 ] && exit 0
+
+router_dir=/opt/cloudland/cache/router/$router
+chain_in=acl-in-$vni
+chain_out=acl-out-$vni
+ip netns exec $router iptables -D FORWARD -d $network -j $chain_in 2>/dev/null
+ip netns exec $router iptables -D FORWARD -s $network -j $chain_out 2>/dev/null
+for chain in $chain_in $chain_out; do
+    ip netns exec $router iptables -F $chain 2>/dev/null
+    ip netns exec $router iptables -X $chain 2>/dev/null
+done
+ip netns exec $router iptables-save > $router_dir/iptables.save
@@ -27,6 +27,15 @@ for (( i=1; i <= $count; i++ )); do
     sidecar span log $span "Callback: clear_vnic.sh '$vif_dev'"
 done
 
+trunk_file=$cache_dir/trunk/$vm_ID
+if [ -f "$trunk_file" ]; then
+    while read sub_nic nic_name seg_id vlan; do
+        ./clear_link.sh $vlan
+        ./clear_sg_chain.sh $sub_nic
+    done < $trunk_file
+    rm -f $trunk_file
+fi
+
 rm -f ${image_dir}/${vm_ID}.*
 rm -f ${cache_dir}/meta/${vm_ID}.iso
 rm -rf $xml_dir/$vm_ID
@@ -8,4 +8,9 @@ source ../cloudrc
 vol_ID=$1
 path=$2
 
-rm -f $volume_dir/$path
+vol_file=$(volume_file $path)
+if [ -b "$vol_file" ]; then
+    lvremove -f $vol_file
+else
+    rm -f $vol_file
+fi
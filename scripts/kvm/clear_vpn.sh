@@ -0,0 +1,33 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <router> <vpn_id>" && exit -1
+
+router=$1
+[ "${router/router-/}" = "$router" ] && router=router-$1
+vpn_ID=$2
+
+router_dir=/opt/cloudland/cache/router/$router
+vpn_dir=/etc/netns/$router/ipsec.d
+notify_sh=$router_dir/notify.sh
+
+ip netns exec $router ipsec down vpn-$vpn_ID &>/dev/null
+rm -f $vpn_dir/vpn-$vpn_ID.conf $vpn_dir/vpn-$vpn_ID.secrets
+nonat_file=$router_dir/vpn-$vpn_ID.nonat
+for cidr in $(cat $nonat_file 2>/dev/null); do
+    ip netns exec $router ipset del nonat $cidr &>/dev/null
+done
+rm -f $nonat_file
+# peer cidrs shared with the remaining vpns stay out of snat
+for cidr in $(cat $router_dir/vpn-*.nonat 2>/dev/null); do
+    ip netns exec $router ipset add nonat $cidr -exist
+done
+ip netns exec $router ipset save > $router_dir/ipset.save
+if [ -z "$(ls $vpn_dir/*.conf 2>/dev/null)" ]; then
+    sed -i "\#ip netns exec $router ipsec restart#d" $notify_sh
+    ip netns exec $router ipsec stop &>/dev/null
+else
+    ip netns exec $router ipsec reload &>/dev/null
+fi
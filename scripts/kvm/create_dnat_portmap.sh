@@ -0,0 +1,30 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 7 ] && die "$0 <gateway_id> <portmap_id> <protocol> <remote_ip> <remote_ports> <instance_ip> <instance_ports> [source_cidr]"
+
+router=router-$1
+portmap_id=$2
+proto=$3
+remote_ip=${4%/*}
+rports=$5
+inst_ip=${6%/*}
+inst_ports=$7
+source_cidr=$8
+
+ip netns list | grep -q $router
+[ $? -ne 0 ] && exit 0
+
+router_dir=/opt/cloudland/cache/router/$router
+src_match=""
+[ -n "$source_cidr" ] && src_match="-s $source_cidr"
+to_dest=$inst_ip:$inst_ports
+if [ "${inst_ports/-/}" != "$inst_ports" ]; then
+    # shift the external range onto the instance range port by port
+    to_dest=$inst_ip:$inst_ports/${rports%:*}
+fi
+ip netns exec $router iptables -t nat -I PREROUTING -d $remote_ip $src_match -p $proto --dport $rports -j DNAT --to-destination $to_dest
+ip netns exec $router iptables-save > $router_dir/iptables.save
+echo "|:-COMMAND-:| `basename $0` '$portmap_id' '$remote_ip'"
@@ -2,20 +2,28 @@
 
 cd $(dirname $0)
 source ../cloudrc
+source ./image_inspect.sh
 
-[ $# -lt 3 ] && die "$0 <ID> <url> <virt_type>"
+[ $# -lt 3 ] && die "$0 <ID> <url> <virt_type> [declared_format] [convert_to]"
 
 ID=$1
 url=$2
 virt_type=$3
+declared=$4
+convert_to=$5
 
 state=error
 image=$image_cache/image-$1
 curl -s $url -o $image
-format=$(qemu-img info $image | grep 'file format' | cut -d' ' -f3)
-[ "$format" = "qcow2" -o "$format" = "raw" ] && state=available
-[ ! -s "$image" ] && state=error
-[ $virt_type = "zvm" ] && format=img
-mv $image ${image}.${format}
+if [ -s "$image" ] && inspect_image $image "$declared" "$convert_to"; then
+    state=available
+fi
+format=$image_format
+if [ "$state" = "available" ]; then
+    [ $virt_type = "zvm" ] && format=img
+    mv $image ${image}.${format}
+else
+    rm -f $image
+fi
 #sync_target /opt/cloudland/cache/image
-echo "|:-COMMAND-:| $(basename $0) '$ID' '$state' '$format'"
+echo "|:-COMMAND-:| $(basename $0) '$ID' '$state' '$format' '$image_size' '$image_vsize' '$image_md5' '$image_sha512'"
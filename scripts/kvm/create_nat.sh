@@ -0,0 +1,52 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 4 ] && echo "$0 <nat_ID> <ext_vlan> <ext_ip> <ext_gw>" && exit -1
+
+ID=$1
+nat=nat-$ID
+ext_vlan=$2
+ext_ip=$3
+ext_gw=${4%/*}
+eip=${ext_ip%/*}
+nat_dir=$cache_dir/nat/$nat
+mkdir -p $nat_dir
+
+ip netns add $nat
+ip netns exec $nat ip link set lo up
+./create_link.sh $ext_vlan
+ip link add nx-$ID type veth peer name nt-$ID
+ip link set nx-$ID up
+ip link set nx-$ID master br$ext_vlan
+ip link set nt-$ID netns $nat
+ip netns exec $nat ip link set nt-$ID mtu 1450 up
+apply_vnic -I nx-$ID
+bcast=$(ipcalc -b $ext_ip | cut -d= -f2)
+ip netns exec $nat ip addr add $ext_ip brd $bcast dev nt-$ID
+ip netns exec $nat route add default gw $ext_gw
+ip netns exec $nat arping -c 3 -I nt-$ID -s $eip $eip
+
+# SNAT only, nothing is allowed to be initiated from outside
+ip netns exec $nat iptables -A FORWARD -i nt-$ID -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+ip netns exec $nat iptables -A FORWARD -i nt-$ID -j DROP
+# attached subnets only egress through the nat, they are not routed to each other
+ip netns exec $nat iptables -A FORWARD -o nt-$ID -j ACCEPT
+ip netns exec $nat iptables -A FORWARD -j DROP
+ip netns exec $nat iptables -A INPUT -i nt-$ID -m conntrack --ctstate RELATED,ESTABLISHED -j ACCEPT
+ip netns exec $nat iptables -A INPUT -i nt-$ID -j DROP
+ip netns exec $nat iptables -t nat -A POSTROUTING -o nt-$ID -j SNAT --to-source $eip
+echo "$ext_vlan" > $nat_dir/ext_vlan
+
+subnets=$(cat)
+i=0
+n=$(jq length <<< $subnets)
+while [ $i -lt $n ]; do
+    jq -c .[$i] <<< $subnets | ./set_nat_subnet.sh $ID
+    let i=$i+1
+done
+
+ip netns exec $nat bash -c "echo 1 >/proc/sys/net/ipv4/ip_forward"
+ip netns exec $nat iptables-save > $nat_dir/iptables.save
+echo "|:-COMMAND-:| $(basename $0) '$ID' '$SCI_CLIENT_ID' 'active'"
@@ -106,6 +106,11 @@ while [ $i -lt $n ]; do
     vni=$(jq -r .[$i].vni <<< $interfaces)
     routes=$(jq -r .[$i].routes <<< $interfaces)
     ./set_gw_route.sh $router $addr $vni soft <<< $routes
+    acl=$(jq -c .[$i].acl <<< $interfaces)
+    if [ "$acl" != "null" ]; then
+        network=$(jq -r .network <<< $acl)
+        jq -c .rules <<< $acl | ./apply_subnet_acl.sh $router $vni $network
+    fi
     let i=$i+1
 done
 
@@ -33,4 +33,11 @@ apply_fw -A $chain_out -m state --state RELATED,ESTABLISHED -j RETURN
 apply_fw -A $chain_out -m state --state INVALID -j DROP
 apply_fw -A $chain_out -j DROP
 
+# chains rebuilt for an interface with a flow log get their log rules back
+flowlog=/opt/cloudland/cache/flowlog/$vnic
+if [ -f "$flowlog" ]; then
+    read flowlog_id flowlog_action <$flowlog
+    ./enable_flow_log.sh $flowlog_id $flowlog_action vnic $mac
+fi
+
 service iptables save
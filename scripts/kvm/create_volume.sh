@@ -3,12 +3,44 @@
 cd $(dirname $0)
 source ../cloudrc
 
-[ $# -lt 2 ] && echo "$0 <vol_ID> <size>" && exit -1
+[ $# -lt 2 ] && echo "$0 <vol_ID> <size> [typed (yes | no)]" && exit -1
 
 vol_ID=$1
 size=$2
+typed=$3
 state='error'
 
-qemu-img create -f qcow2 -o cluster_size=2M $volume_dir/volume-${vol_ID}.disk ${size}G
-[ $? -eq 0 ] && state='available'
-echo "|:-COMMAND-:| $(basename $0) '$vol_ID' 'volume-${vol_ID}.disk' '$state'"
+if [ "$typed" != "yes" ]; then
+    qemu-img create -f qcow2 -o cluster_size=2M $volume_dir/volume-${vol_ID}.disk ${size}G
+    [ $? -eq 0 ] && state='available'
+    echo "|:-COMMAND-:| $(basename $0) '$vol_ID' 'volume-${vol_ID}.disk' '$state'"
+    exit 0
+fi
+
+vol_json=$(cat)
+backend=$(jq -r .backend <<< $vol_json)
+source=$(jq -r '.source // empty' <<< $vol_json)
+host=$(jq -r '.host // empty' <<< $vol_json)
+secret=$(jq -r '.secret // empty' <<< $vol_json)
+shareable=$(jq -r '.shareable // empty' <<< $vol_json)
+vol_path=''
+if [ "$backend" = "lvm" ]; then
+    lvcreate -y -L ${size}G -n volume-${vol_ID} $source && vol_path=/dev/$source/volume-${vol_ID}
+else
+    dir=$(mount_volume_source $backend $source $host)
+    [ $? -eq 0 ] && vol_path=${dir:+$dir/}volume-${vol_ID}.disk
+fi
+if [ -n "$vol_path" ]; then
+    vol_file=$(volume_file $vol_path)
+    if [ -n "$secret" ]; then
+        qemu-img create --object secret,id=sec0,data=$secret -f luks -o key-secret=sec0 $vol_file ${size}G
+    elif [ "$backend" = "lvm" ]; then
+        true
+    elif [ "$shareable" = "true" ]; then
+        qemu-img create -f raw $vol_file ${size}G
+    else
+        qemu-img create -f qcow2 -o cluster_size=2M $vol_file ${size}G
+    fi
+    [ $? -eq 0 ] && state='available'
+fi
+echo "|:-COMMAND-:| $(basename $0) '$vol_ID' '$vol_path' '$state' '$SCI_CLIENT_ID'"
@@ -0,0 +1,37 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 3 ] && echo "$0 <vol_ID> <snapshot_path> <size> [typed (yes | no)]" && exit -1
+
+vol_ID=$1
+snap_file=$volume_dir/$2
+size=$3
+typed=$4
+vol_path=volume-${vol_ID}.disk
+state='error'
+
+if [ "$typed" != "yes" ]; then
+    format=$(qemu-img info $snap_file | grep 'file format' | cut -d' ' -f3)
+    qemu-img convert -f $format -O $format $snap_file $volume_dir/$vol_path
+    [ $? -eq 0 ] && state='available'
+    echo "|:-COMMAND-:| create_volume.sh '$vol_ID' '$vol_path' '$state' '$SCI_CLIENT_ID'"
+    exit 0
+fi
+
+# the snapshot has the format and the luks secret of its volume, so its bytes are copied as they are
+vol_json=$(cat)
+backend=$(jq -r .backend <<< $vol_json)
+source=$(jq -r '.source // empty' <<< $vol_json)
+host=$(jq -r '.host // empty' <<< $vol_json)
+vol_path=''
+if [ "$backend" = "lvm" ]; then
+    lvcreate -y -L ${size}G -n volume-${vol_ID} $source && vol_path=/dev/$source/volume-${vol_ID}
+    [ -n "$vol_path" ] && qemu-img convert -n -f raw -O raw $snap_file $vol_path && state='available'
+else
+    dir=$(mount_volume_source $backend $source $host)
+    [ $? -eq 0 ] && vol_path=${dir:+$dir/}volume-${vol_ID}.disk
+    [ -n "$vol_path" ] && cp --sparse=always $snap_file $(volume_file $vol_path) && state='available'
+fi
+echo "|:-COMMAND-:| create_volume.sh '$vol_ID' '$vol_path' '$state' '$SCI_CLIENT_ID'"
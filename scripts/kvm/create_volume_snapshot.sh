@@ -0,0 +1,40 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <snapshot_ID> <volume_path> [vm_ID] [quiesce (yes | no)]" && exit -1
+
+snap_ID=$1
+vol_file=$(volume_file $2)
+vm_ID=$3
+quiesce=$4
+snap_path=snapshot-${snap_ID}.disk
+state='error'
+
+if [ -n "$vm_ID" ]; then
+    vm_ID=inst-$vm_ID
+    if [ "$quiesce" = "yes" ]; then
+        virsh domfsfreeze $vm_ID
+        if [ $? -ne 0 ]; then
+            echo "|:-COMMAND-:| $(basename $0) '$snap_ID' '' '$state'"
+            exit -1
+        fi
+    else
+        virsh suspend $vm_ID
+    fi
+fi
+# the disk of a running vm is locked by qemu, it is read shared while the guest is frozen or paused
+share_opt=""
+[ -n "$vm_ID" ] && share_opt="-U"
+format=$(qemu-img info $share_opt $vol_file | grep 'file format' | cut -d' ' -f3)
+qemu-img convert $share_opt -f $format -O $format $vol_file $volume_dir/$snap_path
+[ $? -eq 0 ] && state='available'
+if [ -n "$vm_ID" ]; then
+    if [ "$quiesce" = "yes" ]; then
+        virsh domfsthaw $vm_ID
+    else
+        virsh resume $vm_ID
+    fi
+fi
+echo "|:-COMMAND-:| $(basename $0) '$snap_ID' '$snap_path' '$state'"
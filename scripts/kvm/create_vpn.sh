@@ -0,0 +1,68 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <router> <vpn_id>" && exit -1
+
+router=$1
+[ "${router/router-/}" = "$router" ] && router=router-$1
+vpn_ID=$2
+
+vpn=$(base64 -d)
+router_dir=/opt/cloudland/cache/router/$router
+vpn_dir=/etc/netns/$router/ipsec.d
+notify_sh=$router_dir/notify.sh
+mkdir -p $vpn_dir
+
+local_addr=$(jq -r .local_address <<< $vpn)
+peer_addr=$(jq -r .peer_address <<< $vpn)
+local_cidrs=$(jq -r '.local_cidrs | join(",")' <<< $vpn)
+peer_cidrs=$(jq -r '.peer_cidrs | join(",")' <<< $vpn)
+psk=$(jq -r .psk <<< $vpn)
+ike_version=$(jq -r .ike.version <<< $vpn)
+ike_proposal=$(jq -r '[.ike.encryption, .ike.integrity, .ike.dh_group] | join("-")' <<< $vpn)
+ike_lifetime=$(jq -r .ike.lifetime <<< $vpn)
+esp_proposal=$(jq -r '[.esp.encryption, .esp.integrity, .esp.pfs_group] | join("-")' <<< $vpn)
+esp_lifetime=$(jq -r .esp.lifetime <<< $vpn)
+
+cat > $vpn_dir/vpn-$vpn_ID.conf <<EOT
+conn vpn-$vpn_ID
+    keyexchange=$ike_version
+    left=$local_addr
+    leftid=$local_addr
+    leftsubnet=$local_cidrs
+    right=$peer_addr
+    rightid=$peer_addr
+    rightsubnet=$peer_cidrs
+    authby=secret
+    ike=$ike_proposal!
+    ikelifetime=${ike_lifetime}s
+    esp=$esp_proposal!
+    lifetime=${esp_lifetime}s
+    auto=start
+EOT
+echo "$local_addr $peer_addr : PSK \"$psk\"" > $vpn_dir/vpn-$vpn_ID.secrets
+chmod 600 $vpn_dir/vpn-$vpn_ID.secrets
+
+# peer cidrs of each vpn are recorded so that an update or deletion can take them out of nonat again
+nonat_file=$router_dir/vpn-$vpn_ID.nonat
+for cidr in $(cat $nonat_file 2>/dev/null); do
+    ip netns exec $router ipset del nonat $cidr &>/dev/null
+done
+echo "${peer_cidrs//,/ }" > $nonat_file
+for cidr in $(cat $router_dir/vpn-*.nonat 2>/dev/null); do
+    ip netns exec $router ipset add nonat $cidr -exist
+done
+ip netns exec $router ipset save > $router_dir/ipset.save
+
+ipsec_cmd="ip netns exec $router ipsec restart"
+sed -i "\#$ipsec_cmd#d" $notify_sh
+sed -i "/\"MASTER\")/a $ipsec_cmd" $notify_sh
+status=pending
+ip netns exec $router ip -o addr | grep -q " ${local_addr}/"
+if [ $? -eq 0 ]; then
+    eval $ipsec_cmd &>/dev/null
+    [ $? -eq 0 ] && status=active || status=error
+fi
+echo "|:-COMMAND-:| `basename $0` '$vpn_ID' '$status'"
@@ -0,0 +1,12 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <backup_ID>" && exit -1
+
+backup_ID=$1
+store_json=$(cat)
+source ./backup_store.sh
+
+store_rm backups/$backup_ID
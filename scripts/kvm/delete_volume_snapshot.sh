@@ -0,0 +1,11 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <snapshot_ID> <snapshot_path>" && exit -1
+
+snap_ID=$1
+snap_path=$2
+
+[ -n "$snap_path" ] && rm -f $volume_dir/$snap_path
@@ -0,0 +1,19 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 4 ] && echo "$0 <vm_ID> <parent_mac> <segmentation_id> <vlan>" && exit -1
+
+vm_ID=inst-$1
+parent_mac=$2
+seg_id=$3
+vlan=$4
+nic_name=tap$(echo $parent_mac | cut -d: -f4- | tr -d :)
+sub_nic=$nic_name.$seg_id
+trunk_file=$cache_dir/trunk/$vm_ID
+
+ip link show $sub_nic >/dev/null 2>&1 && ip link del $sub_nic
+./clear_link.sh $vlan
+./clear_sg_chain.sh $sub_nic
+sed -i "/^$sub_nic /d" $trunk_file 2>/dev/null
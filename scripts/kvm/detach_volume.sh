@@ -10,6 +10,11 @@ vol_ID=$2
 vol_xml=$xml_dir/$vm_ID/disk-${vol_ID}.xml
 virsh detach-device $vm_ID $vol_xml --config --persistent
 if [ $? -eq 0 ]; then
+    secret_xml=$xml_dir/$vm_ID/secret-${vol_ID}.xml
+    if [ -f "$secret_xml" ]; then
+        virsh secret-undefine $(grep -o '<uuid>.*</uuid>' $secret_xml | sed 's#</\?uuid>##g')
+        rm -f $secret_xml
+    fi
     echo "|:-COMMAND-:| $(basename $0) '$1' '$vol_ID'"
 else
     echo "|:-COMMAND-:| $(basename $0) '' '$vol_ID'"
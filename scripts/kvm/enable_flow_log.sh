@@ -0,0 +1,76 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 4 ] && echo "$0 <flowlog_id> <all|accept|drop> <vnic|subnet|gateway> <mac|router> [vni] [network]" && exit -1
+
+flowlog_id=$1
+action=$2
+type=$3
+limit="-m limit --limit 100/s"
+prefix_accept="fl-$flowlog_id-A "
+prefix_drop="fl-$flowlog_id-D "
+
+function log_drop()
+{
+    netns=$1
+    chain=$2
+    $netns iptables -S $chain >/dev/null 2>&1 || return
+    $netns iptables -D $chain $limit -j LOG --log-prefix "$prefix_drop" 2>/dev/null
+    $netns iptables -D $chain -j DROP
+    $netns iptables -A $chain $limit -j LOG --log-prefix "$prefix_drop"
+    $netns iptables -A $chain -j DROP
+}
+
+case "$type" in
+    "vnic")
+        nic_name=tap$(echo $4 | cut -d: -f4- | tr -d :)
+        flowlog_dir=/opt/cloudland/cache/flowlog
+        mkdir -p $flowlog_dir
+        echo "$flowlog_id $action" >$flowlog_dir/$nic_name
+        if [ "$action" != "drop" ]; then
+            for dir in in out; do
+                iptables -D secgroup-chain -m physdev --physdev-$dir $nic_name --physdev-is-bridged -m conntrack --ctstate NEW $limit -j LOG --log-prefix "$prefix_accept" 2>/dev/null
+                iptables -A secgroup-chain -m physdev --physdev-$dir $nic_name --physdev-is-bridged -m conntrack --ctstate NEW $limit -j LOG --log-prefix "$prefix_accept"
+            done
+        fi
+        if [ "$action" != "accept" ]; then
+            log_drop "" secgroup-in-$nic_name
+            log_drop "" secgroup-out-$nic_name
+        fi
+        service iptables save
+        ;;
+    "subnet"|"gateway")
+        router=router-$4
+        vni=$5
+        network=$6
+        ip netns list | grep -q $router
+        [ $? -ne 0 ] && exit 0
+        router_dir=/opt/cloudland/cache/router/$router
+        netns="ip netns exec $router"
+        if [ "$type" = "subnet" ]; then
+            echo "$flowlog_id $action" >$router_dir/flowlog-$vni
+            matches="-s_$network -d_$network"
+            chains="acl-in-$vni acl-out-$vni"
+        else
+            echo "$flowlog_id $action" >$router_dir/flowlog
+            matches="all"
+            chains=$($netns iptables -S | grep '^-N acl-' | cut -d' ' -f2)
+        fi
+        if [ "$action" != "drop" ]; then
+            for match in $matches; do
+                match=${match/_/ }
+                [ "$match" = "all" ] && match=""
+                $netns iptables -D FORWARD $match -m conntrack --ctstate NEW $limit -j LOG --log-prefix "$prefix_accept" 2>/dev/null
+                $netns iptables -A FORWARD $match -m conntrack --ctstate NEW $limit -j LOG --log-prefix "$prefix_accept"
+            done
+        fi
+        if [ "$action" != "accept" ]; then
+            for chain in $chains; do
+                log_drop "$netns" $chain
+            done
+        fi
+        $netns iptables-save > $router_dir/iptables.save
+        ;;
+esac
@@ -0,0 +1,14 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 1 ] && die "$0 <image> [image ...]"
+
+# only cached copies are evicted, the image repository itself must never run this
+[ "$SCI_CLIENT_ID" = "0" ] && die "Image host does not evict its repository"
+
+for img_name in "$@"; do
+    [[ "$img_name" =~ ^image-[0-9]+\.[a-z0-9]+$ ]] || continue
+    rm -f $image_cache/$img_name
+done
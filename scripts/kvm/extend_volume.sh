@@ -0,0 +1,31 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 3 ] && echo "$0 <vol_ID> <volume_path> <size> [vm_ID] [target]" && exit -1
+
+vol_ID=$1
+vol_file=$(volume_file $2)
+size=$3
+vm_ID=$4
+target=$5
+state='error'
+
+if [ -b "$vol_file" ]; then
+    lvextend -L ${size}G $vol_file
+    rc=$?
+    if [ $rc -eq 0 -a -n "$vm_ID" ]; then
+        virsh blockresize inst-$vm_ID $target ${size}G
+        rc=$?
+    fi
+elif [ -n "$vm_ID" ]; then
+    # blockresize grows the image and notifies the guest about the new capacity
+    virsh blockresize inst-$vm_ID $target ${size}G
+    rc=$?
+else
+    qemu-img resize $vol_file ${size}G
+    rc=$?
+fi
+[ $rc -eq 0 ] && state='available'
+echo "|:-COMMAND-:| $(basename $0) '$vol_ID' '$size' '$state'"
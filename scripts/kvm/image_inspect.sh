@@ -0,0 +1,66 @@
+#!/bin/bash
+
+# image inspection helpers for create_image.sh and import_image.sh, source it after cloudrc
+# accepted formats are qcow2, raw, vmdk, vhd and iso, and an image must not depend on any other file
+
+# image_format prints the format of an image file, qemu calls vhd vpc and sees an iso as raw
+function image_format()
+{
+    file=$1
+    format=$(qemu-img info --output=json $file | jq -r '.format // empty')
+    [ "$format" = "vpc" ] && format=vhd
+    if [ "$format" = "raw" ] && [ "$(dd if=$file bs=1 skip=32769 count=5 2>/dev/null)" = "CD001" ]; then
+        format=iso
+    fi
+    echo $format
+}
+
+# inspect_image checks an image against its declared format and converts it in place when convert_to is given,
+# it sets image_format, image_size, image_vsize, image_md5 and image_sha512, or prints why the image is rejected
+function inspect_image()
+{
+    file=$1
+    declared=$2
+    convert_to=$3
+    image_format=$(image_format $file)
+    case "$image_format" in
+        qcow2|raw|vmdk|vhd|iso) ;;
+        *) echo "Unsupported image format '$image_format'"; return 1;;
+    esac
+    if [ -n "$declared" -a "$declared" != "$image_format" ]; then
+        echo "Image is $image_format but declared as $declared"
+        return 1
+    fi
+    info=$(qemu-img info --output=json $file)
+    if [ -n "$(jq -r '.["backing-filename"] // empty' <<< $info)" ]; then
+        echo "Image references a backing file"
+        return 1
+    fi
+    if [ -n "$(jq -r '.["format-specific"].data["data-file"] // empty' <<< $info)" ]; then
+        echo "Image references an external data file"
+        return 1
+    fi
+    if [ "$image_format" = "vmdk" ]; then
+        for extent in $(jq -r '.["format-specific"].data.extents // [] | map(.filename) | unique | .[]' <<< $info); do
+            if [ "$(realpath -m $extent)" != "$(realpath -m $file)" ]; then
+                echo "Image references extent $extent"
+                return 1
+            fi
+        done
+    fi
+    image_vsize=$(jq -r '.["virtual-size"]' <<< $info)
+    if [ -n "$convert_to" -a "$convert_to" != "$image_format" -a "$image_format" != "iso" ]; then
+        src_format=$image_format
+        [ "$src_format" = "vhd" ] && src_format=vpc
+        if ! qemu-img convert -f $src_format -O $convert_to $file $file.$convert_to; then
+            echo "Image conversion to $convert_to failed"
+            rm -f $file.$convert_to
+            return 1
+        fi
+        mv -f $file.$convert_to $file
+        image_format=$convert_to
+    fi
+    image_size=$(stat -c %s $file)
+    image_md5=$(md5sum $file | cut -d' ' -f1)
+    image_sha512=$(sha512sum $file | cut -d' ' -f1)
+}
@@ -0,0 +1,35 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+source ./image_inspect.sh
+
+[ $# -lt 3 ] && die "$0 <ID> <url> <md5sum> [virt_type] [declared_format] [convert_to]"
+
+ID=$1
+url=$2
+checksum=$3
+virt_type=$4
+declared=$5
+convert_to=$6
+
+state=error
+format=''
+image=$image_cache/image-$1
+# the web certificate is self signed by default, trust it explicitly instead of skipping verification
+cacert=/etc/ssl/certs/cland-selfsigned.crt
+[ -f "$cacert" ] && curl_opts="--cacert $cacert"
+curl -sf $curl_opts $url -o $image
+if [ ! -s "$image" ] || [ "$(md5sum $image | cut -d' ' -f1)" != "$checksum" ]; then
+    echo "Image transfer is incomplete"
+elif inspect_image $image "$declared" "$convert_to"; then
+    state=available
+    format=$image_format
+fi
+if [ "$state" = "available" ]; then
+    [ "$virt_type" = "zvm" ] && format=img
+    mv $image ${image}.${format}
+else
+    rm -f $image
+fi
+echo "|:-COMMAND-:| $(basename $0) '$ID' '$state' '$format' '$image_size' '$image_vsize' '$image_md5' '$image_sha512'"
@@ -26,8 +26,13 @@ if [ ! -f "$vm_img" ]; then
     vm_meta=$cache_dir/meta/$vm_ID.iso
     is_vol="false"
     if [ ! -f "$image_cache/$img_name" ]; then
-        wget -q $image_repo/$img_name -O $image_cache/$img_name
+        tmp_file=$cache_tmp_dir/$img_name.$$
+        mkdir -p $cache_tmp_dir
+        wget -q $image_repo/$img_name -O $tmp_file && mv -f $tmp_file $image_cache/$img_name
+        rm -f $tmp_file
     fi
+    # the modification time tells the last use of a cached image for eviction
+    touch $image_cache/$img_name 2>/dev/null
     if [ ! -f "$image_cache/$img_name" ]; then
         echo "Image $img_name downlaod failed!"
         echo "|:-COMMAND-:| `basename $0` '$ID' '$vm_stat' '$SCI_CLIENT_ID' 'image $img_name downlaod failed!'"
@@ -73,8 +78,10 @@ while [ $i -lt $nvlan ]; do
     ip=$(jq -r .[$i].ip_address <<< $vlans)
     mac=$(jq -r .[$i].mac_address <<< $vlans)
     jq .security <<< $metadata | ./attach_nic.sh $ID $vlan $ip $mac 
+    qos=$(jq -c .[$i].qos <<< $vlans)
+    [ "$qos" != "null" ] && ./set_nic_qos.sh $ID $mac <<< $qos
     let i=$i+1
 done
 virsh start $vm_ID
-[ $? -eq 0 ] && state=running && ./replace_vnc_passwd.sh $ID
+[ $? -eq 0 ] && state=running && ./replace_vnc_passwd.sh $ID && ./apply_trunk.sh $ID
 echo "|:-COMMAND-:| $(basename $0) '$ID' '$state' '$SCI_CLIENT_ID' 'unknown'"
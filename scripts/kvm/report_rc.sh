@@ -80,6 +80,15 @@ function router_status()
     echo "$router_list" >old_router_list
 }
 
+function image_cache_status()
+{
+    old_cache_list=$(cat /opt/cloudland/run/old_image_cache_list 2>/dev/null)
+    cache_list=$(find $image_cache -maxdepth 1 -type f -name 'image-*.*' -printf '%f:%s:%T@\n' 2>/dev/null | sed -n 's/^image-\([0-9]*\)\.[^:]*:\([0-9]*\):\([0-9]*\).*/\1:\2:\3/p' | xargs)
+    [ "$cache_list" = "$old_cache_list" ] && return
+    echo "|:-COMMAND-:| image_cache.sh '$SCI_CLIENT_ID' '$cache_list'"
+    echo "$cache_list" >/opt/cloudland/run/old_image_cache_list
+}
+
 function calc_resource()
 {
     virtual_cpu=0
@@ -125,7 +134,7 @@ function calc_resource()
     old_resource_list=$(cat old_resource_list)
     resource_list="'$cpu' '$total_cpu' '$memory' '$total_memory' '$disk' '$total_disk' '$state'"
     [ "$resource_list" = "$old_resource_list" ] && return
-    echo "|:-COMMAND-:| hyper_status.sh '$SCI_CLIENT_ID' '$HOSTNAME' '$cpu' '$total_cpu' '$memory' '$total_memory' '$disk' '$total_disk' '$state' '$VIRT_TYPE' '$ZONE_NAME'"
+    echo "|:-COMMAND-:| hyper_status.sh '$SCI_CLIENT_ID' '$HOSTNAME' '$cpu' '$total_cpu' '$memory' '$total_memory' '$disk' '$total_disk' '$state' '$VIRT_TYPE' '$ZONE_NAME' '$STORAGE_BACKENDS'"
     echo "'$cpu' '$total_cpu' '$memory' '$total_memory' '$disk' '$total_disk' '$state'" >/opt/cloudland/run/old_resource_list
 }
 
@@ -143,9 +152,86 @@ function replace_vnc_passwd()
     fi
 }
 
+function flow_log()
+{
+    last_file=/opt/cloudland/run/last_flow_log
+    now=$(date +%s)
+    last=$(cat $last_file 2>/dev/null)
+    echo $now >$last_file
+    [ -z "$last" ] && return
+    flow_list=$(sudo journalctl -k --since "@$last" --until "@$now" -o short-unix 2>/dev/null | grep -E 'fl-[0-9]+-[AD]' | awk '{
+        ts = int($1)
+        id = ""; act = ""; proto = ""; src = ""; dst = ""; spt = 0; dpt = 0; len = 0
+        if (match($0, /fl-[0-9]+-[AD]/)) {
+            split(substr($0, RSTART, RLENGTH), f, "-")
+            id = f[2]; act = f[3]
+        }
+        for (i = 2; i <= NF; i++) {
+            split($i, kv, "=")
+            if (kv[1] == "SRC") src = kv[2]
+            else if (kv[1] == "DST") dst = kv[2]
+            else if (kv[1] == "PROTO") proto = kv[2]
+            else if (kv[1] == "SPT") spt = kv[2]
+            else if (kv[1] == "DPT") dpt = kv[2]
+            else if (kv[1] == "LEN" && len == 0) len = kv[2]
+        }
+        if (id == "" || src == "") next
+        key = id "," act "," proto "," src "," spt "," dst "," dpt
+        count[key]++
+        bytes[key] += len
+        if (!(key in first)) first[key] = ts
+        last[key] = ts
+    } END {
+        for (key in count) print key "," count[key] "," bytes[key] "," first[key] "," last[key]
+    }' | head -n 500 | xargs)
+    [ -n "$flow_list" ] && echo "|:-COMMAND-:| flow_log.sh '$SCI_CLIENT_ID' '$flow_list'"
+}
+
+function nat_stats()
+{
+    nat_list=""
+    for nat in $(sudo ip netns list | grep '^nat-' | cut -d' ' -f1); do
+        ID=${nat##nat-}
+        conns=$(sudo ip netns exec $nat conntrack -C 2>/dev/null)
+        [ -z "$conns" ] && conns=0
+        bytes_out=$(sudo ip netns exec $nat cat /sys/class/net/nt-$ID/statistics/tx_bytes 2>/dev/null)
+        bytes_in=$(sudo ip netns exec $nat cat /sys/class/net/nt-$ID/statistics/rx_bytes 2>/dev/null)
+        nat_list="$nat_list $ID:$conns:${bytes_out:-0}:${bytes_in:-0}"
+    done
+    nat_list=$(echo $nat_list)
+    [ -n "$nat_list" ] && echo "|:-COMMAND-:| nat_stats.sh '$SCI_CLIENT_ID' '$nat_list'"
+}
+
+function vpn_status()
+{
+    old_vpn_list=$(cat /opt/cloudland/run/old_vpn_list 2>/dev/null)
+    vpn_list=""
+    for conf in $(ls /etc/netns/router-*/ipsec.d/vpn-*.conf 2>/dev/null); do
+        router=$(echo $conf | cut -d'/' -f4)
+        vpn=$(basename $conf .conf)
+        local_addr=$(grep -m1 '^ *left=' $conf | cut -d'=' -f2)
+        # only the master router holds the local address, ipsec is restarted there on failover
+        sudo ip netns exec $router ip -o addr | grep -q " ${local_addr}/" || continue
+        status=down
+        sudo ip netns exec $router ipsec status $vpn 2>/dev/null | grep -q 'ESTABLISHED' && status=active
+        vpn_list="$vpn_list ${vpn##vpn-}:$status"
+    done
+    vpn_list=$(echo $vpn_list)
+    [ "$vpn_list" = "$old_vpn_list" ] && return
+    for vpn in $vpn_list; do
+        [[ " $old_vpn_list " =~ " $vpn " ]] && continue
+        echo "|:-COMMAND-:| create_vpn.sh '${vpn%%:*}' '${vpn##*:}'"
+    done
+    echo "$vpn_list" >/opt/cloudland/run/old_vpn_list
+}
+
 replace_vnc_passwd
 calc_resource
 probe_arp >/dev/null 2>&1
 inst_status
+image_cache_status
 vlan_status
 router_status
+nat_stats
+vpn_status
+flow_log
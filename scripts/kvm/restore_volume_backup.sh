@@ -0,0 +1,88 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <backup_ID> <vol_ID> [volume_path]" && exit -1
+
+backup_ID=$1
+vol_ID=$2
+vol_path=$3
+store_json=$(cat)
+source ./backup_store.sh
+chunk_size=4194304
+work_dir=$cache_tmp_dir/restore-$backup_ID-$vol_ID
+state='error'
+size=0
+target=''
+
+function finish()
+{
+    rm -rf $work_dir
+    [ "$state" != "available" -a "${target%.restore}" != "$target" ] && rm -f $target
+    if [ -z "$vol_path" ]; then
+        echo "|:-COMMAND-:| create_volume.sh '$vol_ID' 'volume-${vol_ID}.disk' '$state'"
+    else
+        echo "|:-COMMAND-:| $(basename $0) '$vol_ID' '$backup_ID' '$state' '$size'"
+    fi
+    exit 0
+}
+
+# chunks are written straight into the target, so no temporary copy of the full volume is staged
+function write_chunk()
+{
+    idx=$1
+    chunk=$2
+    if [ "$format" = "raw" ]; then
+        dd if=$chunk of=$target bs=$chunk_size seek=$idx conv=notrunc 2>/dev/null
+    else
+        let offset=$idx*$chunk_size
+        qemu-io -f $format -c "write -s $chunk $offset $(stat -c %s $chunk)" $target </dev/null >/dev/null
+    fi
+}
+
+mkdir -p $work_dir
+store_get backups/$backup_ID/manifest $work_dir/manifest || finish
+raw_size=$(grep '^# size ' $work_dir/manifest | cut -d' ' -f3)
+[ -z "$raw_size" ] && finish
+if [ -z "$vol_path" ]; then
+    format=qcow2
+    target=$volume_dir/volume-${vol_ID}.disk
+    qemu-img create -f $format -o cluster_size=2M $target $raw_size >/dev/null || finish
+else
+    vol_file=$(volume_file $vol_path)
+    if [ -b "$vol_file" ]; then
+        # a block device keeps its old content, so zero chunks have to be written too
+        format=raw
+        target=$vol_file
+        head -c $chunk_size /dev/zero > $work_dir/zero
+    else
+        format=$(qemu-img info $vol_file | grep 'file format' | cut -d' ' -f3)
+        target=$vol_file.restore
+        qemu-img create -f $format $target $raw_size >/dev/null || finish
+    fi
+fi
+while read idx hash holder; do
+    [ "${idx:0:1}" = "#" ] && continue
+    if [ "$holder" = "0" ]; then
+        [ -b "$target" ] && { write_chunk $idx $work_dir/zero || finish; }
+        continue
+    fi
+    store_get backups/$holder/chunk-$idx $work_dir/chunk || finish
+    [ "$(sha256sum $work_dir/chunk | cut -d' ' -f1)" != "$hash" ] && finish
+    write_chunk $idx $work_dir/chunk || finish
+done < $work_dir/manifest
+
+if [ -z "$vol_path" ]; then
+    state='available'
+    finish
+fi
+if [ -b "$target" ]; then
+    size=$(blockdev --getsize64 $target)
+else
+    mv -f $target $vol_file || finish
+    size=$raw_size
+fi
+let size=$size/1073741824
+state='available'
+finish
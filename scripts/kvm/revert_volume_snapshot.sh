@@ -0,0 +1,27 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 4 ] && echo "$0 <vol_ID> <volume_path> <snapshot_ID> <snapshot_path>" && exit -1
+
+vol_ID=$1
+vol_file=$(volume_file $2)
+snap_ID=$3
+snap_file=$volume_dir/$4
+state='error'
+
+format=$(qemu-img info $snap_file | grep 'file format' | cut -d' ' -f3)
+if [ -b "$vol_file" ]; then
+    qemu-img convert -n -f $format -O raw $snap_file $vol_file
+    [ $? -eq 0 ] && state='available'
+    echo "|:-COMMAND-:| $(basename $0) '$vol_ID' '$snap_ID' '$state'"
+    exit 0
+fi
+qemu-img convert -f $format -O $format $snap_file $vol_file.revert
+if [ $? -eq 0 ]; then
+    mv -f $vol_file.revert $vol_file && state='available'
+else
+    rm -f $vol_file.revert
+fi
+echo "|:-COMMAND-:| $(basename $0) '$vol_ID' '$snap_ID' '$state'"
@@ -0,0 +1,62 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 4 ] && echo "$0 <router> <ext_type> <ext_ip> <int_ip>" && exit -1
+
+ID=$1
+router=router-$1
+ext_type=$2
+ext_ip=${3%/*}
+int_ip=${4%/*}
+
+ip netns list | grep -q $router
+[ $? -ne 0 ] && exit 0
+if [ "$ext_type" = "public" ]; then
+    ext_dev=te-$ID
+    src_ip=$ext_ip
+elif [ "$ext_type" = "private" ]; then
+    ext_dev=ti-$ID
+    src_ip=$int_ip
+else
+    echo "Rong routing type" && exit 1
+fi
+qos=$(cat)
+ingress_rate=$(jq -r '.ingress_rate // 0' <<< $qos)
+ingress_burst=$(jq -r '.ingress_burst // 0' <<< $qos)
+egress_rate=$(jq -r '.egress_rate // 0' <<< $qos)
+egress_burst=$(jq -r '.egress_burst // 0' <<< $qos)
+dscp=$(jq -r '.dscp // -1' <<< $qos)
+[ "$ingress_burst" -eq 0 ] && ingress_burst=$(($ingress_rate/80+16))
+[ "$egress_burst" -eq 0 ] && egress_burst=$(($egress_rate/80+16))
+
+netns="ip netns exec $router"
+router_dir=/opt/cloudland/cache/router/$router
+# every floating ip owns a filter priority of the router, kept in a map so addresses never share one
+pref_file=$router_dir/fip_qos.pref
+touch $pref_file
+pref=$(awk -v ip=$ext_ip '$1 == ip {print $2}' $pref_file)
+if [ -z "$pref" ]; then
+    pref=1
+    while grep -q " $pref$" $pref_file; do
+        pref=$((pref+1))
+    done
+    [ $pref -gt 65535 ] && echo "No filter priority left on $router" && exit 1
+    echo "$ext_ip $pref" >>$pref_file
+fi
+$netns tc qdisc show dev $ext_dev | grep -q ingress || $netns tc qdisc add dev $ext_dev ingress
+$netns tc qdisc show dev $ext_dev | grep -q 'qdisc prio 1:' || $netns tc qdisc replace dev $ext_dev root handle 1: prio
+$netns tc filter del dev $ext_dev parent ffff: pref $pref 2>/dev/null
+$netns tc filter del dev $ext_dev parent 1: pref $pref 2>/dev/null
+[ "$ingress_rate" -gt 0 ] && $netns tc filter add dev $ext_dev parent ffff: pref $pref protocol ip u32 match ip dst $ext_ip/32 police rate ${ingress_rate}kbit burst ${ingress_burst}k drop flowid :1
+[ "$egress_rate" -gt 0 ] && $netns tc filter add dev $ext_dev parent 1: pref $pref protocol ip u32 match ip src $src_ip/32 police rate ${egress_rate}kbit burst ${egress_burst}k drop flowid 1:1
+if [ "$ingress_rate" -eq 0 -a "$egress_rate" -eq 0 ]; then
+    awk -v ip=$ext_ip '$1 != ip' $pref_file >$pref_file.tmp && mv $pref_file.tmp $pref_file
+fi
+
+$netns iptables -t mangle -S POSTROUTING | grep -- "-s $int_ip/32 .*DSCP" | while read rule; do
+    $netns iptables -t mangle ${rule/-A/-D}
+done
+[ "$dscp" -ge 0 ] && $netns iptables -t mangle -A POSTROUTING -s $int_ip/32 -o $ext_dev -j DSCP --set-dscp $dscp
+$netns iptables-save > $router_dir/iptables.save
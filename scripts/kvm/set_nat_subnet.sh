@@ -0,0 +1,27 @@
+#!/bin/bash
+
+cd $(dirname $0)
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <nat_ID>" && exit -1
+
+ID=$1
+nat=nat-$ID
+nat_dir=$cache_dir/nat/$nat
+subnet=$(cat)
+addr=$(jq -r .ip_address <<< $subnet)
+vni=$(jq -r .vni <<< $subnet)
+network=$(jq -r .network <<< $subnet)
+[ -z "$addr" -o -z "$vni" ] && exit 1
+
+ip netns list | grep -q "^$nat\>"
+[ $? -ne 0 ] && exit 0
+bcast=$(ipcalc -b $addr | cut -d= -f2)
+./create_link.sh $vni
+cat /proc/net/dev | grep -q "^\<ln-$vni\>"
+[ $? -ne 0 ] && ./create_veth.sh $nat ln-$vni ns-$vni
+apply_vnic -I ln-$vni
+ip netns exec $nat ip addr add $addr brd $bcast dev ns-$vni
+ip netns exec $nat arping -c 3 -I ns-$vni -s ${addr%/*} ${addr%/*}
+echo "$addr $network" > $nat_dir/subnet-$vni
+ip netns exec $nat iptables-save > $nat_dir/iptables.save
@@ -0,0 +1,31 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 2 ] && echo "$0 <vm_ID> <mac>" && exit -1
+
+vm_ID=inst-$1
+vm_mac=$2
+nic_name=tap$(echo $vm_mac | cut -d: -f4- | tr -d :)
+qos=$(cat)
+ingress_rate=$(jq -r '.ingress_rate // 0' <<< $qos)
+ingress_burst=$(jq -r '.ingress_burst // 0' <<< $qos)
+egress_rate=$(jq -r '.egress_rate // 0' <<< $qos)
+egress_burst=$(jq -r '.egress_burst // 0' <<< $qos)
+dscp=$(jq -r '.dscp // -1' <<< $qos)
+
+# libvirt takes average rate in kbyte/s while policy rate is in kbit/s, 0 clears the limit
+inbound=$(($ingress_rate/8)),,$ingress_burst
+outbound=$(($egress_rate/8)),,$egress_burst
+[ "$ingress_rate" -eq 0 ] && inbound=0
+[ "$egress_rate" -eq 0 ] && outbound=0
+virsh domiftune $vm_ID $vm_mac --inbound $inbound --outbound $outbound --config
+virsh domstate $vm_ID | grep -q running
+[ $? -eq 0 ] && virsh domiftune $vm_ID $vm_mac --inbound $inbound --outbound $outbound --live
+
+iptables -t mangle -S POSTROUTING | grep -- "--physdev-in $nic_name " | while read rule; do
+    iptables -t mangle ${rule/-A/-D}
+done
+[ "$dscp" -ge 0 ] && iptables -t mangle -A POSTROUTING -m physdev --physdev-in $nic_name --physdev-is-bridged -j DSCP --set-dscp $dscp
+service iptables save
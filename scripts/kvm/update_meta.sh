@@ -0,0 +1,32 @@
+#!/bin/bash
+
+cd `dirname $0`
+source ../cloudrc
+
+[ $# -lt 1 ] && echo "$0 <vm_ID>" && exit -1
+
+vm_ID=inst-$1
+working_dir=/tmp/$vm_ID
+latest_dir=$working_dir/openstack/latest
+meta_iso=${cache_dir}/meta/${vm_ID}.iso
+if [ ! -f "$latest_dir/meta_data.json" ]; then
+    # the working copy is gone after a reboot of the hypervisor, rebuild it from the config drive of the vm
+    if [ -f "$meta_iso" ]; then
+        mnt_dir=$(mktemp -d)
+        if mount -o loop,ro $meta_iso $mnt_dir; then
+            mkdir -p $working_dir
+            cp -r $mnt_dir/. $working_dir/
+            umount $mnt_dir
+        fi
+        rmdir $mnt_dir
+    fi
+    [ ! -f "$latest_dir/meta_data.json" ] && echo "No config drive data for $vm_ID" >&2 && exit 1
+fi
+
+vm_meta=$(cat)
+dns=$(jq -r .dns <<< $vm_meta)
+[ -z "$dns" ] && dns=$dns_server
+net_json=$(jq 'del(.userdata) | del(.vlans) | del(.keys) | del(.security) | del(.zvm) | del(.ocp) | del(.virt_type) | del(.dns)' <<< $vm_meta | jq --arg dns $dns '.services[0].type = "dns" | .services[0].address |= .+$dns')
+echo "$net_json" > $latest_dir/network_data.json
+
+mkisofs -quiet -R -V config-2 -o $meta_iso $working_dir &> /dev/null
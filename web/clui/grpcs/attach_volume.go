@@ -29,11 +29,6 @@ func AttachVolume(ctx context.Context, job *model.Job, args []string) (status st
 		log.Println("Invalid args", err)
 		return
 	}
-	_, err = strconv.Atoi(args[1])
-	if err != nil {
-		log.Println("Invalid instance ID", err)
-		return
-	}
 	volID, err := strconv.Atoi(args[2])
 	if err != nil {
 		log.Println("Invalid volume ID", err)
@@ -46,7 +41,41 @@ func AttachVolume(ctx context.Context, job *model.Job, args []string) (status st
 		log.Println("Failed to query volume", err)
 		return
 	}
-	err = db.Model(&volume).Updates(map[string]interface{}{"target": target, "status": "attached"}).Error
+	instID, err := strconv.Atoi(args[1])
+	if err != nil || target == "" {
+		// attach failed, drop the attachment which was waiting for it
+		query := db.Where("volume_id = ? and status = 'attaching'", volume.ID)
+		if instID > 0 {
+			query = query.Where("instance_id = ?", instID)
+		}
+		if err = query.Delete(&model.VolumeAttachment{}).Error; err != nil {
+			log.Println("Failed to delete volume attachment", err)
+			return
+		}
+		count := 0
+		if err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ? and status = 'attached'", volume.ID).Count(&count).Error; err != nil {
+			log.Println("Failed to count volume attachments", err)
+			return
+		}
+		if count == 0 {
+			err = db.Model(volume).Updates(map[string]interface{}{"instance_id": 0, "target": "", "status": "available"}).Error
+			if err != nil {
+				log.Println("Update volume status failed", err)
+				return
+			}
+		}
+		return
+	}
+	err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ? and instance_id = ?", volume.ID, instID).Updates(map[string]interface{}{"target": target, "status": "attached"}).Error
+	if err != nil {
+		log.Println("Update volume attachment failed", err)
+		return
+	}
+	updates := map[string]interface{}{"status": "attached"}
+	if !volume.MultiAttach {
+		updates["target"] = target
+	}
+	err = db.Model(&volume).Updates(updates).Error
 	if err != nil {
 		log.Println("Update volume status failed", err)
 		return
@@ -0,0 +1,43 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("create_dnat_portmap", CreateDnatPortmap)
+}
+
+func CreateDnatPortmap(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| create_dnat_portmap.sh 5 1.2.3.4
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 3 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	portmapID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid portmap ID", err)
+		return
+	}
+	err = db.Model(&model.Portmap{Model: model.Model{ID: int64(portmapID)}}).Updates(map[string]interface{}{"remote_address": args[2], "status": "ready"}).Error
+	if err != nil {
+		log.Println("Update portmap status failed", err)
+		return
+	}
+	return
+}
@@ -21,7 +21,7 @@ func init() {
 }
 
 func CreateImage(ctx context.Context, job *model.Job, args []string) (status string, err error) {
-	//|:-COMMAND-:| create_image.sh '5' 'available' 'qcow2'
+	//|:-COMMAND-:| create_image.sh '5' 'available' 'qcow2' '1048576' '10737418240' 'md5' 'sha512'
 	db := dbs.DB()
 	argn := len(args)
 	if argn < 4 {
@@ -40,8 +40,7 @@ func CreateImage(ctx context.Context, job *model.Job, args []string) (status str
 		log.Println("Invalid image ID", err)
 		return
 	}
-	image.Status = args[2]
-	image.Format = args[3]
+	setImageInfo(image, args)
 	err = db.Save(image).Error
 	if err != nil {
 		log.Println("Update image failed", err)
@@ -49,3 +48,31 @@ func CreateImage(ctx context.Context, job *model.Job, args []string) (status str
 	}
 	return
 }
+
+// setImageInfo applies what image inspection reported: state, format, size, virtual size, md5 and sha512
+func setImageInfo(image *model.Image, args []string) {
+	image.Status = args[2]
+	if args[3] != "" {
+		image.Format = args[3]
+	}
+	if len(args) < 8 || image.Status != "available" {
+		return
+	}
+	if size, err := strconv.ParseInt(args[4], 10, 64); err == nil {
+		image.Size = size
+	}
+	if vsize, err := strconv.ParseInt(args[5], 10, 64); err == nil {
+		// minimum disk in G which holds the virtual size
+		miniDisk := int32((vsize + 1<<30 - 1) >> 30)
+		if miniDisk > image.MiniDisk {
+			image.MiniDisk = miniDisk
+		}
+	}
+	if args[6] != "" {
+		image.Checksum = args[6]
+	}
+	if args[7] != "" {
+		image.OsHashAlgo = "sha512"
+		image.OsHashValue = args[7]
+	}
+}
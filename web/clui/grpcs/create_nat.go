@@ -0,0 +1,49 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("create_nat", CreateNat)
+}
+
+func CreateNat(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| create_nat.sh '5' '3' 'active'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	natID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid nat gateway ID", err)
+		return
+	}
+	hyperID, err := strconv.Atoi(args[2])
+	if err != nil {
+		log.Println("Invalid hyper ID", err)
+		return
+	}
+	natgw := &model.NatGateway{Model: model.Model{ID: int64(natID)}}
+	err = db.Model(natgw).Updates(map[string]interface{}{"hyper": int32(hyperID), "status": args[3]}).Error
+	if err != nil {
+		log.Println("Update nat gateway hyper failed", err)
+		return
+	}
+	return
+}
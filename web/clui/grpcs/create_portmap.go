@@ -28,7 +28,7 @@ func CreatePortmap(ctx context.Context, job *model.Job, args []string) (status s
 		log.Println("Invalid args", err)
 		return
 	}
-	err = db.Model(&model.Portmap{}).Where("remote_port = ?", args[2]).Updates(map[string]interface{}{"remote_address": args[1], "status": "ready"}).Error
+	err = db.Model(&model.Portmap{}).Where("remote_port = ? and (mode = 'tunnel' or mode is null)", args[2]).Updates(map[string]interface{}{"remote_address": args[1], "status": "ready"}).Error
 	if err != nil {
 		log.Println("Update hyper/Peer ID failed", err)
 		return
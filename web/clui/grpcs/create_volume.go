@@ -21,7 +21,7 @@ func init() {
 }
 
 func CreateVolume(ctx context.Context, job *model.Job, args []string) (status string, err error) {
-	//|:-COMMAND-:| create_volume.sh 5 /volume-12.disk available
+	//|:-COMMAND-:| create_volume.sh 5 /volume-12.disk available 3
 	db := dbs.DB()
 	argn := len(args)
 	if argn < 4 {
@@ -42,7 +42,14 @@ func CreateVolume(ctx context.Context, job *model.Job, args []string) (status st
 	}
 	path := args[2]
 	status = args[3]
-	err = db.Model(&volume).Updates(map[string]interface{}{"path": path, "status": status}).Error
+	updates := map[string]interface{}{"path": path, "status": status}
+	if argn > 4 {
+		hyperID, err := strconv.Atoi(args[4])
+		if err == nil && hyperID >= 0 {
+			updates["hyper"] = hyperID
+		}
+	}
+	err = db.Model(&volume).Updates(updates).Error
 	if err != nil {
 		log.Println("Update volume status failed", err)
 		return
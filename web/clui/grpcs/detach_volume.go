@@ -29,7 +29,7 @@ func DetachVolume(ctx context.Context, job *model.Job, args []string) (status st
 		log.Println("Invalid args", err)
 		return
 	}
-	_, err = strconv.Atoi(args[1])
+	instID, err := strconv.Atoi(args[1])
 	if err != nil {
 		log.Println("Invalid instance ID", err)
 		return
@@ -45,6 +45,21 @@ func DetachVolume(ctx context.Context, job *model.Job, args []string) (status st
 		log.Println("Failed to query volume", err)
 		return
 	}
+	err = db.Where("volume_id = ? and instance_id = ?", volume.ID, instID).Delete(&model.VolumeAttachment{}).Error
+	if err != nil {
+		log.Println("Failed to delete volume attachment", err)
+		return
+	}
+	count := 0
+	err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ?", volume.ID).Count(&count).Error
+	if err != nil {
+		log.Println("Failed to count volume attachments", err)
+		return
+	}
+	if count > 0 {
+		// a multi-attach volume still in use by other instances
+		return
+	}
 	volume.InstanceID = 0
 	volume.Target = ""
 	volume.Status = "available"
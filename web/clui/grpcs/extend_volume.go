@@ -0,0 +1,64 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("extend_volume", ExtendVolume)
+}
+
+func ExtendVolume(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| extend_volume.sh '5' '20' 'available'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	volID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid volume ID", err)
+		return
+	}
+	size, err := strconv.Atoi(args[2])
+	if err != nil {
+		log.Println("Invalid volume size", err)
+		return
+	}
+	volume := &model.Volume{Model: model.Model{ID: int64(volID)}}
+	err = db.Take(volume).Error
+	if err != nil {
+		log.Println("Failed to query volume", err)
+		return
+	}
+	status = args[3]
+	updates := map[string]interface{}{"status": "available", "pending": 0}
+	if volume.InstanceID > 0 {
+		updates["status"] = "attached"
+	}
+	if status == "available" {
+		updates["size"] = size
+	} else {
+		log.Printf("Extend volume %d to %dG failed\n", volID, size)
+	}
+	err = db.Model(volume).Updates(updates).Error
+	if err != nil {
+		log.Println("Update volume size failed", err)
+		return
+	}
+	return
+}
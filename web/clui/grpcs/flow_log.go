@@ -0,0 +1,133 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Add("flow_log", FlowLog)
+}
+
+const defaultFlowLogRecords = 10000
+
+// parseFlowRecord parses id,action,proto,src,sport,dst,dport,packets,bytes,start,end, the fields are
+// separated by commas as ipv6 addresses contain colons. Accepted flows are logged on their first packet
+// only, so packets and bytes of an accept record count connections rather than the traffic they carry.
+func parseFlowRecord(record string) (flowRecord *model.FlowLogRecord, err error) {
+	fields := strings.Split(record, ",")
+	if len(fields) != 11 {
+		err = fmt.Errorf("Invalid flow record %s", record)
+		return
+	}
+	nums := make([]int64, len(fields))
+	for _, i := range []int{0, 4, 6, 7, 8, 9, 10} {
+		nums[i], err = strconv.ParseInt(fields[i], 10, 64)
+		if err != nil {
+			log.Println("Invalid flow record field", err)
+			return
+		}
+	}
+	action := "accept"
+	if fields[1] == "D" {
+		action = "drop"
+	}
+	flowRecord = &model.FlowLogRecord{
+		FlowLogID: nums[0],
+		Action:    action,
+		Protocol:  strings.ToLower(fields[2]),
+		SrcIp:     fields[3],
+		SrcPort:   int32(nums[4]),
+		DstIp:     fields[5],
+		DstPort:   int32(nums[6]),
+		Packets:   nums[7],
+		Bytes:     nums[8],
+		StartAt:   time.Unix(nums[9], 0),
+		EndAt:     time.Unix(nums[10], 0),
+	}
+	return
+}
+
+// pruneFlowLog keeps only the latest records of a flow log so the table stays bounded
+func pruneFlowLog(flowLogID int64) (err error) {
+	db := dbs.DB()
+	maxRecords := viper.GetInt("flowlog.max_records")
+	if maxRecords <= 0 {
+		maxRecords = defaultFlowLogRecords
+	}
+	oldest := &model.FlowLogRecord{}
+	err = db.Where("flow_log_id = ?", flowLogID).Order("id desc").Offset(maxRecords).Limit(1).Take(oldest).Error
+	if err != nil {
+		err = nil
+		return
+	}
+	err = db.Where("flow_log_id = ? and id <= ?", flowLogID, oldest.ID).Delete(&model.FlowLogRecord{}).Error
+	if err != nil {
+		log.Println("Failed to prune flow log records", err)
+		return
+	}
+	return
+}
+
+func FlowLog(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| flow_log.sh '3' '5,D,TCP,10.0.0.5,41234,192.168.1.10,22,3,180,1600000000,1600000010'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 3 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	hyperID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid hypervisor ID", err)
+		return
+	}
+	flowLogs := make(map[int64]bool)
+	for _, record := range strings.Split(args[2], " ") {
+		if record == "" {
+			continue
+		}
+		flowRecord, err := parseFlowRecord(record)
+		if err != nil {
+			continue
+		}
+		enabled, ok := flowLogs[flowRecord.FlowLogID]
+		if !ok {
+			count := 0
+			db.Model(&model.FlowLog{}).Where("id = ?", flowRecord.FlowLogID).Count(&count)
+			enabled = count > 0
+			flowLogs[flowRecord.FlowLogID] = enabled
+		}
+		if !enabled {
+			log.Println("Flow log is not enabled", flowRecord.FlowLogID)
+			continue
+		}
+		flowRecord.Hyper = int32(hyperID)
+		err = db.Create(flowRecord).Error
+		if err != nil {
+			log.Println("Failed to create flow log record", err)
+			continue
+		}
+	}
+	for flowLogID, enabled := range flowLogs {
+		if enabled {
+			pruneFlowLog(flowLogID)
+		}
+	}
+	return
+}
@@ -0,0 +1,35 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package grpcs
+
+import (
+	"testing"
+)
+
+func TestParseFlowRecord(t *testing.T) {
+	record, err := parseFlowRecord("5,D,TCP,10.0.0.5,41234,192.168.1.10,22,2,120,1697712345,1697712349")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.FlowLogID != 5 || record.Action != "drop" || record.Protocol != "tcp" ||
+		record.SrcIp != "10.0.0.5" || record.SrcPort != 41234 || record.DstPort != 22 ||
+		record.Packets != 2 || record.Bytes != 120 || record.StartAt.Unix() != 1697712345 {
+		t.Fatal(record)
+	}
+	record, err = parseFlowRecord("7,A,ICMP,10.0.0.6,0,8.8.8.8,0,1,84,1697712349,1697712349")
+	if err != nil || record.Action != "accept" || record.Protocol != "icmp" {
+		t.Fatal(record, err)
+	}
+	record, err = parseFlowRecord("7,A,UDP,fd00::5,5353,ff02::fb,5353,1,76,1697712349,1697712349")
+	if err != nil || record.SrcIp != "fd00::5" || record.DstIp != "ff02::fb" || record.DstPort != 5353 {
+		t.Fatal(record, err)
+	}
+	if _, err = parseFlowRecord("7,A,ICMP,10.0.0.6"); err == nil {
+		t.Fatal("short record should fail")
+	}
+}
@@ -82,6 +82,10 @@ func HyperStatus(ctx context.Context, job *model.Job, args []string) (status str
 		virtType = args[10]
 		zoneName = args[11]
 	}
+	backends := ""
+	if argn > 12 {
+		backends = args[12]
+	}
 	zone := &model.Zone{Name: zoneName}
 	if zoneName != "" {
 		err = db.Where("name = ?", zoneName).FirstOrCreate(zone).Error
@@ -109,11 +113,15 @@ func HyperStatus(ctx context.Context, job *model.Job, args []string) (status str
 	}
 	hyper.Status = int32(hyperStatus)
 	hyper.VirtType = virtType
+	hyper.Backends = backends
 	hyper.Zone = zone
 	err = db.Save(hyper).Error
 	if err != nil {
 		log.Println("Failed to save hypervisor", err)
 		return
 	}
+	if hyper.Status == 1 {
+		go RetrySecgroupPushes(context.Background(), hyper.Hostid)
+	}
 	return
 }
@@ -0,0 +1,147 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	Add("image_cache", ImageCacheStatus)
+	Add("cache_image", CacheImage)
+}
+
+type imageCacheEntry struct {
+	ImageID  int64
+	Size     int64
+	LastUsed time.Time
+}
+
+// parseImageCacheEntry parses image_id:size:mtime
+func parseImageCacheEntry(record string) (entry *imageCacheEntry, err error) {
+	fields := strings.Split(record, ":")
+	if len(fields) != 3 {
+		err = fmt.Errorf("Invalid image cache entry %s", record)
+		return
+	}
+	nums := make([]int64, len(fields))
+	for i, field := range fields {
+		nums[i], err = strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Println("Invalid image cache field", err)
+			return
+		}
+	}
+	entry = &imageCacheEntry{ImageID: nums[0], Size: nums[1], LastUsed: time.Unix(nums[2], 0)}
+	return
+}
+
+// saveImageCache records an image cached on a hypervisor, files of unknown images are not recorded
+func saveImageCache(db *gorm.DB, hyperID int32, entry *imageCacheEntry) (err error) {
+	image := &model.Image{Model: model.Model{ID: entry.ImageID}}
+	if err = db.Take(image).Error; err != nil {
+		log.Println("Cached image not found", entry.ImageID, err)
+		return
+	}
+	err = db.Where("image_id = ? and hostid = ?", entry.ImageID, hyperID).FirstOrCreate(&model.ImageCache{ImageID: entry.ImageID, Hostid: hyperID}).Error
+	if err != nil {
+		log.Println("Failed to create image cache", err)
+		return
+	}
+	err = db.Model(&model.ImageCache{}).Where("image_id = ? and hostid = ?", entry.ImageID, hyperID).Updates(map[string]interface{}{
+		"size":      entry.Size,
+		"last_used": entry.LastUsed,
+	}).Error
+	if err != nil {
+		log.Println("Failed to update image cache", err)
+		return
+	}
+	return
+}
+
+func ImageCacheStatus(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| image_cache.sh '3' '5:1073741824:1571731870 6:52428800:1571735470'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 3 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	hyperID, err := strconv.Atoi(args[1])
+	if err != nil || hyperID < 0 {
+		log.Println("Invalid hypervisor ID", err)
+		return
+	}
+	var total int64
+	cached := []int64{}
+	for _, record := range strings.Split(args[2], " ") {
+		if record == "" {
+			continue
+		}
+		entry, err := parseImageCacheEntry(record)
+		if err != nil {
+			continue
+		}
+		total += entry.Size
+		if err = saveImageCache(db, int32(hyperID), entry); err != nil {
+			continue
+		}
+		cached = append(cached, entry.ImageID)
+	}
+	where := db.Where("hostid = ?", hyperID)
+	if len(cached) > 0 {
+		where = where.Where("image_id not in (?)", cached)
+	}
+	if err = where.Delete(&model.ImageCache{}).Error; err != nil {
+		log.Println("Failed to delete evicted image caches", err)
+		return
+	}
+	err = db.Model(&model.Resource{}).Where("hostid = ?", hyperID).Update("image_cache", total).Error
+	if err != nil {
+		log.Println("Failed to save image cache size", err)
+		return
+	}
+	return
+}
+
+func CacheImage(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| cache_image.sh '3' '5' '1073741824'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	hyperID, err := strconv.Atoi(args[1])
+	if err != nil || hyperID < 0 {
+		log.Println("Invalid hypervisor ID", err)
+		return
+	}
+	imageID, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		log.Println("Invalid image ID", err)
+		return
+	}
+	size, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Failed to cache image %d on hypervisor %d", imageID, hyperID)
+		return
+	}
+	err = saveImageCache(db, int32(hyperID), &imageCacheEntry{ImageID: imageID, Size: size, LastUsed: time.Now()})
+	return
+}
@@ -0,0 +1,27 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package grpcs
+
+import (
+	"testing"
+)
+
+func TestParseImageCacheEntry(t *testing.T) {
+	entry, err := parseImageCacheEntry("5:1073741824:1571731870")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.ImageID != 5 || entry.Size != 1073741824 || entry.LastUsed.Unix() != 1571731870 {
+		t.Fatal(entry)
+	}
+	for _, record := range []string{"5:1073741824", "x:1:2", "5:1:2:3", ""} {
+		if _, err = parseImageCacheEntry(record); err == nil {
+			t.Fatal("invalid entry should fail", record)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/spf13/viper"
+)
+
+func init() {
+	Add("import_image", ImportImage)
+}
+
+func ImportImage(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| import_image.sh '5' 'available' 'qcow2' '1048576' '10737418240' 'md5' 'sha512'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	imgID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid image ID", err)
+		return
+	}
+	image := &model.Image{Model: model.Model{ID: int64(imgID)}}
+	err = db.Take(image).Error
+	if err != nil {
+		log.Println("Invalid image ID", err)
+		return
+	}
+	setImageInfo(image, args)
+	upload := filepath.Join(viper.GetString("image.upload_dir"), fmt.Sprintf("image-%d.part", image.ID))
+	if image.Status != "available" {
+		// the staged data was not accepted, queue the image again so that the upload can be restarted
+		log.Printf("Import of image %d failed, upload must be restarted\n", image.ID)
+		image.Status = "queued"
+	}
+	err = db.Save(image).Error
+	if err != nil {
+		log.Println("Update image failed", err)
+		return
+	}
+	if err = os.Remove(upload); err != nil && !os.IsNotExist(err) {
+		log.Println("Failed to remove staged image upload", err)
+	}
+	err = nil
+	return
+}
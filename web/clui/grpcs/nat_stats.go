@@ -0,0 +1,86 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("nat_stats", NatStats)
+}
+
+type natCounter struct {
+	ID          int64
+	Connections int64
+	BytesOut    int64
+	BytesIn     int64
+}
+
+// parseNatCounter parses id:connections:bytes_out:bytes_in
+func parseNatCounter(record string) (counter *natCounter, err error) {
+	fields := strings.Split(record, ":")
+	if len(fields) != 4 {
+		err = fmt.Errorf("Invalid nat counter %s", record)
+		return
+	}
+	nums := make([]int64, len(fields))
+	for i, field := range fields {
+		nums[i], err = strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			log.Println("Invalid nat counter field", err)
+			return
+		}
+	}
+	counter = &natCounter{ID: nums[0], Connections: nums[1], BytesOut: nums[2], BytesIn: nums[3]}
+	return
+}
+
+func NatStats(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| nat_stats.sh '3' '5:120:104857600:52428800 6:0:0:0'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 3 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	hyperID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid hypervisor ID", err)
+		return
+	}
+	now := time.Now()
+	for _, record := range strings.Split(args[2], " ") {
+		if record == "" {
+			continue
+		}
+		counter, err := parseNatCounter(record)
+		if err != nil {
+			continue
+		}
+		err = db.Model(&model.NatGateway{}).Where("id = ? and hyper = ?", counter.ID, hyperID).Updates(map[string]interface{}{
+			"connections": counter.Connections,
+			"bytes_out":   counter.BytesOut,
+			"bytes_in":    counter.BytesIn,
+			"stats_at":    now,
+		}).Error
+		if err != nil {
+			log.Println("Failed to update nat gateway counters", err)
+			continue
+		}
+	}
+	return
+}
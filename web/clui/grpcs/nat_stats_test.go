@@ -0,0 +1,27 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package grpcs
+
+import (
+	"testing"
+)
+
+func TestParseNatCounter(t *testing.T) {
+	counter, err := parseNatCounter("5:120:104857600:52428800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter.ID != 5 || counter.Connections != 120 || counter.BytesOut != 104857600 || counter.BytesIn != 52428800 {
+		t.Fatal(counter)
+	}
+	for _, record := range []string{"5:120:100", "5:x:1:2", ""} {
+		if _, err = parseNatCounter(record); err == nil {
+			t.Fatal("invalid counter should fail", record)
+		}
+	}
+}
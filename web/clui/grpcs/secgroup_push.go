@@ -0,0 +1,161 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	Add("apply_sg_delta", ApplySgDelta)
+}
+
+// pushSentTimeout is how long a batch sent to a hypervisor may go unconfirmed before it is sent again
+const pushSentTimeout = 10 * time.Minute
+
+// retryingHypers holds the hypervisors whose deferred pushes are being resent
+var retryingHypers = sync.Map{}
+
+// claimPushHost atomically moves a batch from the status it was read with to status,
+// it fails to claim when another sender or the confirmation of the host got there first
+func claimPushHost(db *gorm.DB, pushHost *model.SecgroupPushHost, status string) (claimed bool, err error) {
+	query := db.Model(&model.SecgroupPushHost{}).Where("id = ? and status = ?", pushHost.ID, pushHost.Status)
+	if pushHost.Status == "sent" {
+		query = query.Where("updated_at < ?", time.Now().Add(-pushSentTimeout))
+	}
+	fields := map[string]interface{}{"status": status}
+	if status == "sent" {
+		fields["retries"] = gorm.Expr("retries + 1")
+	}
+	result := query.Updates(fields)
+	if err = result.Error; err != nil {
+		return
+	}
+	claimed = result.RowsAffected > 0
+	if claimed {
+		pushHost.Status = status
+	}
+	return
+}
+
+func sendPushHost(ctx context.Context, pushHost *model.SecgroupPushHost) (err error) {
+	db := dbs.DB()
+	hyper := &model.Hyper{}
+	err = db.Where("hostid = ?", pushHost.Hyper).Take(hyper).Error
+	if err != nil || hyper.Status != 1 {
+		log.Println("Hypervisor is offline, security group push is deferred", pushHost.Hyper)
+		_, err = claimPushHost(db, pushHost, "offline")
+		return
+	}
+	// the batch is marked sent before it is dispatched so the confirmation of the host is never overwritten
+	claimed, err := claimPushHost(db, pushHost, "sent")
+	if err != nil || !claimed {
+		return
+	}
+	control := fmt.Sprintf("inter=%d", pushHost.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/apply_sg_delta.sh '%d' <<EOF\n%s\nEOF", pushHost.ID, pushHost.Payload)
+	err = HyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Failed to send security group delta", err)
+		return db.Model(&model.SecgroupPushHost{}).Where("id = ? and status = ?", pushHost.ID, "sent").Update("status", "failed").Error
+	}
+	return
+}
+
+// SendSecgroupPush delivers the per hypervisor batches of a push which are not yet sent,
+// it is meant to run in the background so the request is not blocked by the hosts
+func SendSecgroupPush(ctx context.Context, pushID int64) {
+	db := dbs.DB()
+	pushHosts := []*model.SecgroupPushHost{}
+	err := db.Where("push_id = ? and status in (?)", pushID, []string{"pending", "offline", "failed"}).Find(&pushHosts).Error
+	if err != nil {
+		log.Println("Failed to query security group push hosts", err)
+		return
+	}
+	for _, pushHost := range pushHosts {
+		if err = sendPushHost(ctx, pushHost); err != nil {
+			log.Println("Failed to update security group push host", err)
+		}
+	}
+	err = db.Model(&model.SecgroupPush{Model: model.Model{ID: pushID}}).Where("status = ?", "pending").Update("status", "running").Error
+	if err != nil {
+		log.Println("Failed to update security group push", err)
+	}
+}
+
+// RetrySecgroupPushes resends the batches deferred for a hypervisor once it reports again and
+// the batches it never confirmed, only one retry runs for a hypervisor at a time
+func RetrySecgroupPushes(ctx context.Context, hyperID int32) {
+	if _, running := retryingHypers.LoadOrStore(hyperID, true); running {
+		return
+	}
+	defer retryingHypers.Delete(hyperID)
+	db := dbs.DB()
+	pushHosts := []*model.SecgroupPushHost{}
+	err := db.Where("hyper = ?", hyperID).Where("status in (?) or (status = 'sent' and updated_at < ?)", []string{"offline", "failed"}, time.Now().Add(-pushSentTimeout)).Order("id").Find(&pushHosts).Error
+	if err != nil {
+		log.Println("Failed to query deferred security group pushes", err)
+		return
+	}
+	for _, pushHost := range pushHosts {
+		if err = sendPushHost(ctx, pushHost); err != nil {
+			log.Println("Failed to update security group push host", err)
+		}
+	}
+}
+
+func ApplySgDelta(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| apply_sg_delta.sh '5'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 2 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	pushHostID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid security group push host ID", err)
+		return
+	}
+	pushHost := &model.SecgroupPushHost{Model: model.Model{ID: int64(pushHostID)}}
+	err = db.Take(pushHost).Error
+	if err != nil {
+		log.Println("Failed to query security group push host", err)
+		return
+	}
+	// a batch resent after a lost confirmation is counted once
+	result := db.Model(&model.SecgroupPushHost{}).Where("id = ? and status <> ?", pushHost.ID, "done").Update("status", "done")
+	if err = result.Error; err != nil {
+		log.Println("Failed to update security group push host", err)
+		return
+	}
+	if result.RowsAffected == 0 {
+		return
+	}
+	push := &model.SecgroupPush{Model: model.Model{ID: pushHost.PushID}}
+	err = db.Model(push).Update("done", gorm.Expr("done + 1")).Error
+	if err != nil {
+		log.Println("Failed to update security group push", err)
+		return
+	}
+	err = db.Model(push).Where("done >= total").Update("status", "done").Error
+	if err != nil {
+		log.Println("Failed to update security group push status", err)
+		return
+	}
+	return
+}
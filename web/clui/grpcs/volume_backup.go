@@ -0,0 +1,88 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("backup_volume", BackupVolume)
+	Add("restore_volume_backup", RestoreVolumeBackup)
+}
+
+func BackupVolume(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| backup_volume.sh '3' '15805696' 'available'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	backupID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid backup ID", err)
+		return
+	}
+	bytes, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		log.Println("Invalid backup bytes", err)
+		return
+	}
+	backup := &model.VolumeBackup{Model: model.Model{ID: int64(backupID)}}
+	err = db.Take(backup).Error
+	if err != nil {
+		log.Println("Failed to query backup", err)
+		return
+	}
+	status = args[3]
+	err = db.Model(backup).Updates(map[string]interface{}{"bytes": bytes, "status": status}).Error
+	if err != nil {
+		log.Println("Update backup status failed", err)
+		return
+	}
+	return
+}
+
+func RestoreVolumeBackup(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| restore_volume_backup.sh '5' '3' 'available' '20'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 5 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	volID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid volume ID", err)
+		return
+	}
+	size, err := strconv.Atoi(args[4])
+	if err != nil {
+		log.Println("Invalid volume size", err)
+		return
+	}
+	status = args[3]
+	updates := map[string]interface{}{"status": status}
+	if status == "available" && size > 0 {
+		updates["size"] = size
+	}
+	err = db.Model(&model.Volume{Model: model.Model{ID: int64(volID)}}).Updates(updates).Error
+	if err != nil {
+		log.Println("Update volume status failed", err)
+		return
+	}
+	return
+}
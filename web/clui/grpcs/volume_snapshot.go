@@ -0,0 +1,92 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("create_volume_snapshot", CreateVolumeSnapshot)
+	Add("revert_volume_snapshot", RevertVolumeSnapshot)
+}
+
+func CreateVolumeSnapshot(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| create_volume_snapshot.sh '3' 'snapshot-3.disk' 'available'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	snapID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid snapshot ID", err)
+		return
+	}
+	snapshot := &model.VolumeSnapshot{Model: model.Model{ID: int64(snapID)}}
+	err = db.Take(snapshot).Error
+	if err != nil {
+		log.Println("Failed to query snapshot", err)
+		return
+	}
+	status = args[3]
+	err = db.Model(snapshot).Updates(map[string]interface{}{"path": args[2], "status": status}).Error
+	if err != nil {
+		log.Println("Update snapshot status failed", err)
+		return
+	}
+	return
+}
+
+func RevertVolumeSnapshot(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| revert_volume_snapshot.sh '5' '3' 'available'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 4 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	volID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid volume ID", err)
+		return
+	}
+	snapID, err := strconv.Atoi(args[2])
+	if err != nil {
+		log.Println("Invalid snapshot ID", err)
+		return
+	}
+	snapshot := &model.VolumeSnapshot{Model: model.Model{ID: int64(snapID)}}
+	err = db.Take(snapshot).Error
+	if err != nil {
+		log.Println("Failed to query snapshot", err)
+		return
+	}
+	// a failed revert leaves the volume as it was, so it stays usable
+	status = "available"
+	updates := map[string]interface{}{"status": status}
+	if args[3] == "available" {
+		updates["size"] = snapshot.Size
+	} else {
+		log.Printf("Failed to revert volume %d to snapshot %d", volID, snapID)
+	}
+	err = db.Model(&model.Volume{Model: model.Model{ID: int64(volID)}}).Updates(updates).Error
+	if err != nil {
+		log.Println("Update volume status failed", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,48 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package grpcs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func init() {
+	Add("create_vpn", VpnStatus)
+}
+
+func VpnStatus(ctx context.Context, job *model.Job, args []string) (status string, err error) {
+	//|:-COMMAND-:| create_vpn.sh '5' 'active'
+	db := dbs.DB()
+	argn := len(args)
+	if argn < 3 {
+		err = fmt.Errorf("Wrong params")
+		log.Println("Invalid args", err)
+		return
+	}
+	vpnID, err := strconv.Atoi(args[1])
+	if err != nil {
+		log.Println("Invalid vpn ID", err)
+		return
+	}
+	query := db.Model(&model.VpnService{}).Where("id = ?", vpnID)
+	if args[2] == "pending" {
+		// the backup router reports pending, it must not hide the state reported by the master
+		query = query.Where("status <> 'active'")
+	}
+	err = query.Update("status", args[2]).Error
+	if err != nil {
+		log.Println("Update vpn status failed", err)
+		return
+	}
+	return
+}
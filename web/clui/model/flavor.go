@@ -12,12 +12,13 @@ import (
 
 type Flavor struct {
 	Model
-	Name      string `gorm:"type:varchar(128)"`
-	Cpu       int32
-	Memory    int32
-	Disk      int32
-	Swap      int32
-	Ephemeral int32
+	Name        string `gorm:"type:varchar(128)"`
+	Cpu         int32
+	Memory      int32
+	Disk        int32
+	Swap        int32
+	Ephemeral   int32
+	QosPolicyID int64
 }
 
 func init() {
@@ -12,15 +12,19 @@ import (
 
 type FloatingIp struct {
 	Model
-	FipAddress string `gorm:"type:varchar(64)"`
-	IntAddress string `gorm:"type:varchar(64)"`
-	Type       string `gorm:"type:varchar(20)"`
-	InstanceID int64
-	Instance   *Instance  `gorm:"foreignkey:InstanceID"`
-	Interface  *Interface `gorm:"foreignkey:FloatingIp"`
-	GatewayID  int64
-	Gateway    *Gateway `gorm:"foreignkey:GatewayID"`
-	IPAddress  string
+	FipAddress  string `gorm:"type:varchar(64)"`
+	IntAddress  string `gorm:"type:varchar(64)"`
+	Type        string `gorm:"type:varchar(20)"`
+	InstanceID  int64
+	Instance    *Instance  `gorm:"foreignkey:InstanceID"`
+	Interface   *Interface `gorm:"foreignkey:FloatingIp"`
+	GatewayID   int64
+	Gateway     *Gateway `gorm:"foreignkey:GatewayID"`
+	IPAddress   string
+	PoolID      int64
+	Pool        *FloatingIpPool `gorm:"foreignkey:PoolID"`
+	ZoneID      int64
+	QosPolicyID int64
 }
 
 func init() {
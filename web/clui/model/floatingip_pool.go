@@ -0,0 +1,25 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type FloatingIpPool struct {
+	Model
+	Name    string          `gorm:"type:varchar(32)"`
+	Subnets []*Subnet       `gorm:"many2many:fip_pool_subnets;"`
+	Orgs    []*Organization `gorm:"many2many:fip_pool_orgs;"`
+	Zones   []*Zone         `gorm:"many2many:fip_pool_zones;"`
+	Total   int64           `gorm:"-"`
+	Used    int64           `gorm:"-"`
+}
+
+func init() {
+	dbs.AutoMigrate(&FloatingIpPool{})
+}
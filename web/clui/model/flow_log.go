@@ -0,0 +1,43 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"time"
+
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type FlowLog struct {
+	Model
+	Name         string `gorm:"type:varchar(32)"`
+	ResourceType string `gorm:"type:varchar(16)"`
+	ResourceID   int64
+	Action       string `gorm:"type:varchar(16);default:'all'"`
+	Status       string `gorm:"type:varchar(32)"`
+}
+
+type FlowLogRecord struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt time.Time
+	FlowLogID int64 `gorm:"index"`
+	Hyper     int32
+	Action    string `gorm:"type:varchar(16)"`
+	Protocol  string `gorm:"type:varchar(8)"`
+	SrcIp     string `gorm:"type:varchar(64)"`
+	SrcPort   int32
+	DstIp     string `gorm:"type:varchar(64)"`
+	DstPort   int32
+	Packets   int64 /* new connections for accept records, the LOG rule only sees their first packet */
+	Bytes     int64
+	StartAt   time.Time `gorm:"index"`
+	EndAt     time.Time
+}
+
+func init() {
+	dbs.AutoMigrate(&FlowLog{}, &FlowLogRecord{})
+}
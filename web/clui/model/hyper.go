@@ -32,7 +32,8 @@ type Hyper struct {
 	Parentid  int32
 	Children  int32
 	Duration  int64
-	VirtType      string
+	VirtType  string
+	Backends  string `gorm:"type:varchar(128)"` /* storage backends the host can serve, comma separated */
 	ZoneID    int64
 	Zone      *Zone     `gorm:"foreignkey:ZoneID"`
 	Resource  *Resource `gorm:"foreignkey:Hostid;AssociationForeignKey:Hostid`
@@ -7,7 +7,10 @@ SPDX-License-Identifier: Apache-2.0
 package model
 
 import (
+	"context"
+
 	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/jinzhu/gorm"
 )
 
 type Image struct {
@@ -20,7 +23,7 @@ type Image struct {
 	Href           string `gorm:"type:varchar(256)"`
 	Checksum       string `gorm:"type:varchar(36)"`
 	OsHashAlgo     string `gorm:"type:varchar(36)"`
-	OsHashValue    string `gorm:"type:varchar(36)"`
+	OsHashValue    string `gorm:"type:varchar(128)"`
 	Holder         string `gorm:"type:varchar(36)"`
 	Protected      bool
 	OpenShiftLB    bool   `gorm:"default:false"`
@@ -32,8 +35,32 @@ type Image struct {
 	DiskType       string `gorm:"type:varchar(128)"`
 	VirtType       string `gorm:"type:varchar(36)"`
 	UserName       string `gorm:"type:varchar(128)"`
+	Convert        bool   `gorm:"default:false"` /* convert to the preferred format of the hypervisor on import */
+	Members        []*ImageMember `gorm:"PRELOAD:false"`
+	MemberStatus   string `gorm:"-"` /* status of the membership of the listing org in a shared image */
 }
 
 func init() {
 	dbs.AutoMigrate(&Image{})
+	gradeName := "0003-Image-0001-Modify-OsHashValue"
+	dbs.AutoUpgrade(gradeName, func(db *gorm.DB) (err error) {
+		logger, _ := startLogging(context.Background(), gradeName)
+		dbType := db.Dialect().GetName()
+		if dbType == "postgres" {
+			// sha512 hex digests do not fit the original column
+			if err = db.Model(&Image{}).ModifyColumn("os_hash_value", "varchar(128)").Error; err != nil {
+				logger.WithError(err).Debug("Error found when upgrading", gradeName)
+			}
+		}
+		return
+	})
+	gradeName = "0003-Image-0002-Default-Visibility"
+	dbs.AutoUpgrade(gradeName, func(db *gorm.DB) (err error) {
+		logger, _ := startLogging(context.Background(), gradeName)
+		// images were visible to every organization before visibility was enforced
+		if err = db.Model(&Image{}).Where("visibility = '' or visibility is null").Update("visibility", "public").Error; err != nil {
+			logger.WithError(err).Debug("Error found when upgrading", gradeName)
+		}
+		return
+	})
 }
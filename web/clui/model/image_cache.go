@@ -0,0 +1,28 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"time"
+
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type ImageCache struct {
+	ID        int64 `gorm:"primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ImageID   int64     `gorm:"unique_index:idx_image_cache_host"`
+	Image     *Image    `gorm:"foreignkey:ImageID"`
+	Hostid    int32     `gorm:"unique_index:idx_image_cache_host"`
+	Size      int64     /* bytes of the cached image file */
+	LastUsed  time.Time /* the last time the cached file was fetched or launched from */
+}
+
+func init() {
+	dbs.AutoMigrate(&ImageCache{})
+}
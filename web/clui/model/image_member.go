@@ -0,0 +1,24 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type ImageMember struct {
+	Model
+	Status     string        `gorm:"type:varchar(32)"` /* pending, accepted or rejected by the member */
+	ImageID    int64         `gorm:"index"`
+	Image      *Image        `gorm:"foreignkey:ImageID"`
+	MemberID   int64         `gorm:"index"` /* organization the image is shared with */
+	MemberInfo *Organization `gorm:"foreignkey:MemberID"`
+}
+
+func init() {
+	dbs.AutoMigrate(&ImageMember{})
+}
@@ -7,32 +7,83 @@ SPDX-License-Identifier: Apache-2.0
 package model
 
 import (
+	"context"
 	"math/rand"
+	"strings"
 	"time"
 
 	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/jinzhu/gorm"
 )
 
 type Interface struct {
 	Model
-	Name       string `gorm:"type:varchar(32)"`
-	MacAddr    string `gorm:"type:varchar(32)"`
-	Instance   int64
-	Device     int64
-	Dhcp       int64
-	FloatingIp int64
-	Subnet     int64
-	ZoneID     int64
-	Address    *Address `gorm:"foreignkey:Interface"`
-	Hyper      int32    `gorm:"default:-1"`
-	PrimaryIf  bool     `gorm:"default:false"`
-	Type       string   `gorm:"type:varchar(20)"`
-	Mtu        int32
-	Secgroups  []*SecurityGroup `gorm:"many2many:secgroup_ifaces;"`
-	AddrPairs  string           `gorm:"type:varchar(256)"`
+	Name           string `gorm:"type:varchar(32)"`
+	MacAddr        string `gorm:"type:varchar(32)"`
+	Instance       int64
+	Device         int64
+	Dhcp           int64
+	FloatingIp     int64
+	Subnet         int64
+	ZoneID         int64
+	Address        *Address `gorm:"foreignkey:Interface"`
+	Hyper          int32    `gorm:"default:-1"`
+	PrimaryIf      bool     `gorm:"default:false"`
+	Type           string   `gorm:"type:varchar(20)"`
+	Mtu            int32
+	Secgroups      []*SecurityGroup `gorm:"many2many:secgroup_ifaces;"`
+	AddrPairs      []*AddressPair   `gorm:"foreignkey:InterfaceID"`
+	QosPolicyID    int64
+	ParentID       int64 `gorm:"index"`
+	SegmentationID int32
+}
+
+type AddressPair struct {
+	Model
+	InterfaceID int64  `gorm:"index"`
+	IpAddress   string `gorm:"type:varchar(64)"`
+	MacAddr     string `gorm:"type:varchar(32)"`
 }
 
 func init() {
-	dbs.AutoMigrate(&Interface{})
+	dbs.AutoMigrate(&Interface{}, &AddressPair{})
 	rand.Seed(time.Now().UnixNano())
+	gradeName := "0002-Interface-0001-Structured-Address-Pairs"
+	dbs.AutoUpgrade(gradeName, func(db *gorm.DB) (err error) {
+		logger, _ := startLogging(context.Background(), gradeName)
+		if !db.Dialect().HasColumn("interfaces", "addr_pairs") {
+			return
+		}
+		rows, err := db.Table("interfaces").Select("id, owner, addr_pairs").Where("addr_pairs <> ''").Rows()
+		if err != nil {
+			logger.WithError(err).Debug("Error found when upgrading", gradeName)
+			return
+		}
+		pairs := []*AddressPair{}
+		for rows.Next() {
+			var id, owner int64
+			var text string
+			if err = rows.Scan(&id, &owner, &text); err != nil {
+				rows.Close()
+				return
+			}
+			for _, ap := range strings.Fields(text) {
+				pair := &AddressPair{Model: Model{Owner: owner}, InterfaceID: id, IpAddress: ap}
+				if i := strings.Index(ap, "-"); i >= 0 {
+					pair.IpAddress = ap[:i]
+					pair.MacAddr = ap[i+1:]
+				}
+				pairs = append(pairs, pair)
+			}
+		}
+		rows.Close()
+		for _, pair := range pairs {
+			if err = db.Create(pair).Error; err != nil {
+				logger.WithError(err).Debug("Error found when upgrading", gradeName)
+				return
+			}
+		}
+		err = db.Table("interfaces").Where("addr_pairs <> ''").Update("addr_pairs", "").Error
+		return
+	})
 }
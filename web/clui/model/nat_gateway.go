@@ -0,0 +1,34 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"time"
+
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type NatGateway struct {
+	Model
+	Name          string `gorm:"type:varchar(32)"`
+	Status        string `gorm:"type:varchar(32)"`
+	Hyper         int32  `gorm:"default:-1"`
+	PoolID        int64
+	Pool          *FloatingIpPool `gorm:"foreignkey:PoolID"`
+	PublicAddress string          `gorm:"type:varchar(64)"`
+	Subnets       []*Subnet       `gorm:"foreignkey:NatGatewayID"`
+	ZoneID        int64
+	Zone          *Zone `gorm:"foreignkey:ZoneID"`
+	Connections   int64 /* tracked connections at last report */
+	BytesOut      int64
+	BytesIn       int64
+	StatsAt       time.Time
+}
+
+func init() {
+	dbs.AutoMigrate(&NatGateway{})
+}
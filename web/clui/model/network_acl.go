@@ -0,0 +1,34 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type NetworkAcl struct {
+	Model
+	Name    string            `gorm:"type:varchar(32)"`
+	Rules   []*NetworkAclRule `gorm:"foreignkey:AclID"`
+	Subnets []*Subnet         `gorm:"foreignkey:AclID"`
+}
+
+type NetworkAclRule struct {
+	Model
+	AclID     int64
+	Number    int32
+	Action    string `gorm:"type:varchar(16)"`
+	Direction string `gorm:"type:varchar(16)"`
+	Protocol  string `gorm:"type:varchar(20)"`
+	Cidr      string `gorm:"type:varchar(64)"`
+	PortMin   int32  `gorm:"default:-1"`
+	PortMax   int32  `gorm:"default:-1"`
+}
+
+func init() {
+	dbs.AutoMigrate(&NetworkAcl{}, &NetworkAclRule{})
+}
@@ -0,0 +1,31 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type GatewayPeering struct {
+	Model
+	Name          string `gorm:"type:varchar(32)"`
+	Status        string `gorm:"type:varchar(32)"`
+	GatewayID     int64
+	Gateway       *Gateway `gorm:"foreignkey:GatewayID"`
+	PeerGatewayID int64
+	PeerGateway   *Gateway `gorm:"foreignkey:PeerGatewayID"`
+	PeerOwner     int64
+	PeerOwnerInfo *Organization `gorm:"-"`
+	Vni           int64
+	LocalAddr     string `gorm:"type:varchar(64)"`
+	PeerAddr      string `gorm:"type:varchar(64)"`
+	Slot          int32  `gorm:"index"` /* /30 transit link of the peering, 0 is unassigned */
+}
+
+func init() {
+	dbs.AutoMigrate(&GatewayPeering{})
+}
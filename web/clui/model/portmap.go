@@ -14,13 +14,19 @@ type Portmap struct {
 	Model
 	Name          string `gorm:"type:varchar(32)"`
 	Status        string `gorm:"type:varchar(32)"`
+	Mode          string `gorm:"type:varchar(16);default:'tunnel'"`
+	Protocol      string `gorm:"type:varchar(8);default:'tcp'"`
 	LocalPort     int32
+	LocalPortEnd  int32
 	LocalAddress  string `gorm:"type:varchar(64)"`
 	RemotePort    int32
+	RemotePortEnd int32
 	RemoteAddress string `gorm:"type:varchar(64)"`
+	SourceCidr    string `gorm:"type:varchar(64)"`
 	GatewayID     int64
 	Gateway       *Gateway `gorm:"foreignkey:GatewayID"`
 	InstanceID    int64
+	InterfaceID   int64
 }
 
 func init() {
@@ -0,0 +1,25 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type QosPolicy struct {
+	Model
+	Name         string `gorm:"type:varchar(32)"`
+	IngressRate  int32  /* kbit/s, 0 means unlimited */
+	IngressBurst int32  /* kbyte */
+	EgressRate   int32
+	EgressBurst  int32
+	Dscp         int32 `gorm:"default:-1"`
+}
+
+func init() {
+	dbs.AutoMigrate(&QosPolicy{})
+}
@@ -23,6 +23,7 @@ type Resource struct {
 	MemoryTotal int64
 	Disk        int64
 	DiskTotal   int64
+	ImageCache  int64 /* bytes of images cached on the host */
 }
 
 func init() {
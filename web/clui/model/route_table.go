@@ -0,0 +1,32 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type RouteTable struct {
+	Model
+	Name     string     `gorm:"type:varchar(32)"`
+	Routes   []*Route   `gorm:"foreignkey:RouteTableID"`
+	Subnets  []*Subnet  `gorm:"many2many:subnet_route_tables;"`
+	Gateways []*Gateway `gorm:"many2many:gateway_route_tables;"`
+}
+
+type Route struct {
+	Model
+	RouteTableID int64
+	Destination  string `gorm:"type:varchar(64)"`
+	Nexthop      string `gorm:"type:varchar(64)"`
+	AddressID    int64
+	Address      *Address `gorm:"foreignkey:AddressID"`
+}
+
+func init() {
+	dbs.AutoMigrate(&RouteTable{}, &Route{})
+}
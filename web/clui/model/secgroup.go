@@ -8,6 +8,7 @@ package model
 
 import (
 	"log"
+	"strings"
 
 	"github.com/IBM/cloudland/web/sca/dbs"
 )
@@ -39,17 +40,69 @@ func init() {
 	dbs.AutoMigrate(&SecurityGroup{}, &SecurityRule{})
 }
 
+// GetSecurityRules returns the rules of the security groups with remote groups expanded
 func GetSecurityRules(secGroups []*SecurityGroup) (securityRules []*SecurityRule, err error) {
 	db := dbs.DB()
-	securityRules = []*SecurityRule{}
+	secrules := []*SecurityRule{}
 	for _, sg := range secGroups {
-		secrules := []*SecurityRule{}
-		err = db.Model(&SecurityRule{}).Where("secgroup = ?", sg.ID).Find(&secrules).Error
+		rules := []*SecurityRule{}
+		err = db.Model(&SecurityRule{}).Where("secgroup = ?", sg.ID).Find(&rules).Error
 		if err != nil {
 			log.Println("DB failed to query security rules", err)
 			return
 		}
-		securityRules = append(securityRules, secrules...)
+		secrules = append(secrules, rules...)
+	}
+	securityRules, err = ExpandSecurityRules(secrules)
+	return
+}
+
+// ExpandSecurityRules expands a rule referencing a remote group into one rule per address
+// of the current members of that group
+func ExpandSecurityRules(secrules []*SecurityRule) (securityRules []*SecurityRule, err error) {
+	securityRules = []*SecurityRule{}
+	members := make(map[string][]string)
+	for _, rule := range secrules {
+		if rule.RemoteGroup == "" {
+			securityRules = append(securityRules, rule)
+			continue
+		}
+		addrs, ok := members[rule.RemoteGroup]
+		if !ok {
+			addrs, err = GetSecgroupAddresses(rule.RemoteGroup)
+			if err != nil {
+				return
+			}
+			members[rule.RemoteGroup] = addrs
+		}
+		for _, addr := range addrs {
+			memberRule := *rule
+			memberRule.RemoteIp = addr
+			securityRules = append(securityRules, &memberRule)
+		}
+	}
+	return
+}
+
+// GetSecgroupAddresses returns the host addresses of the interfaces in the security group
+func GetSecgroupAddresses(uuid string) (addrs []string, err error) {
+	db := dbs.DB()
+	secgroup := &SecurityGroup{}
+	err = db.Where("uuid = ?", uuid).Take(secgroup).Error
+	if err != nil {
+		log.Println("DB failed to query remote security group", err)
+		return
+	}
+	err = db.Model(secgroup).Preload("Address").Related(&secgroup.Interfaces, "Interfaces").Error
+	if err != nil {
+		log.Println("DB failed to query remote security group interfaces", err)
+		return
+	}
+	for _, iface := range secgroup.Interfaces {
+		if iface.Address == nil {
+			continue
+		}
+		addrs = append(addrs, strings.Split(iface.Address.Address, "/")[0]+"/32")
 	}
 	return
 }
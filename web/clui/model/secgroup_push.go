@@ -0,0 +1,33 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type SecgroupPush struct {
+	Model
+	SecgroupID int64
+	Status     string `gorm:"type:varchar(32)"`
+	Total      int32
+	Done       int32
+	Hosts      []*SecgroupPushHost `gorm:"foreignkey:PushID"`
+}
+
+type SecgroupPushHost struct {
+	Model
+	PushID  int64
+	Hyper   int32
+	Status  string `gorm:"type:varchar(32)"`
+	Retries int32
+	Payload string `gorm:"type:text"`
+}
+
+func init() {
+	dbs.AutoMigrate(&SecgroupPush{}, &SecgroupPushHost{})
+}
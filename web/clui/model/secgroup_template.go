@@ -0,0 +1,33 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type SecgroupTemplate struct {
+	Model
+	Name        string                  `gorm:"type:varchar(32)"`
+	Description string                  `gorm:"type:varchar(256)"`
+	Rules       []*SecgroupTemplateRule `gorm:"foreignkey:TemplateID"`
+}
+
+type SecgroupTemplateRule struct {
+	Model
+	TemplateID  int64
+	RemoteIp    string `gorm:"type:varchar(32)"`
+	RemoteGroup string `gorm:"type:varchar(32)"`
+	Direction   string `gorm:"type:varchar(16)"`
+	Protocol    string `gorm:"type:varchar(20)"`
+	PortMin     int32  `gorm:"default:-1"`
+	PortMax     int32  `gorm:"default:-1"`
+}
+
+func init() {
+	dbs.AutoMigrate(&SecgroupTemplate{}, &SecgroupTemplateRule{})
+}
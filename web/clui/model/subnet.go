@@ -27,6 +27,8 @@ type Subnet struct {
 	Netlink      *Network `gorm:"foreignkey:Vlan;AssociationForeignKey:Vlan"`
 	Type         string   `gorm:"type:varchar(20);default:'internal'"`
 	Router       int64
+	NatGatewayID int64
+	AclID        int64
 	Routes       string `gorm:"type:varchar(256)"`
 	VSwitch      string `gorm:"type:varchar(256)"`
 }
@@ -12,17 +12,45 @@ import (
 
 type Volume struct {
 	Model
-	Name       string `gorm:"type:varchar(128)"`
-	Path       string `gorm:"type:varchar(128)"`
-	Size       int32
-	Format     string `gorm:"type:varchar(32)"`
-	Status     string `gorm:"type:varchar(32)"`
-	Target     string `gorm:"type:varchar(32)"`
-	Href       string `gorm:"type:varchar(256)"`
-	InstanceID int64
+	Name        string `gorm:"type:varchar(128)"`
+	Path        string `gorm:"type:varchar(128)"`
+	Size        int32
+	Format      string `gorm:"type:varchar(32)"`
+	Status      string `gorm:"type:varchar(32)"`
+	Target      string `gorm:"type:varchar(32)"`
+	Href        string `gorm:"type:varchar(256)"`
+	InstanceID  int64
+	Instance    *Instance `gorm:"foreignkey:InstanceID"`
+	TypeID      int64
+	Type        *VolumeType         `gorm:"foreignkey:TypeID"`
+	Hyper       int32               `gorm:"default:-1"`
+	Secret      string              `gorm:"type:varchar(128)" json:"-"` /* luks passphrase of encrypted volumes */
+	MultiAttach bool                `gorm:"default:false"`
+	Pending     int32               /* target size of an extend in progress, in G */
+	Attachments []*VolumeAttachment `gorm:"PRELOAD:false"`
+}
+
+type VolumeAttachment struct {
+	Model
+	Target     string    `gorm:"type:varchar(32)"`
+	Status     string    `gorm:"type:varchar(32)"`
+	VolumeID   int64     `gorm:"index"`
+	Volume     *Volume   `gorm:"foreignkey:VolumeID"`
+	InstanceID int64     `gorm:"index"`
 	Instance   *Instance `gorm:"foreignkey:InstanceID"`
 }
 
+type VolumeSnapshot struct {
+	Model
+	Name     string  `gorm:"type:varchar(128)"`
+	Path     string  `gorm:"type:varchar(128)"`
+	Size     int32   /* size of the volume when the snapshot was taken, in G */
+	Status   string  `gorm:"type:varchar(32)"`
+	Quiesced bool    `gorm:"default:false"`
+	VolumeID int64   `gorm:"index"`
+	Volume   *Volume `gorm:"foreignkey:VolumeID"`
+}
+
 func init() {
-	dbs.AutoMigrate(&Volume{})
+	dbs.AutoMigrate(&Volume{}, &VolumeSnapshot{}, &VolumeAttachment{})
 }
@@ -0,0 +1,34 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type VolumeBackup struct {
+	Model
+	Name        string  `gorm:"type:varchar(128)"`
+	Status      string  `gorm:"type:varchar(32)"`
+	Incremental bool    `gorm:"default:false"`
+	ParentID    int64   /* previous backup of the chain, 0 for a full backup */
+	ChainID     int64   `gorm:"index"` /* the full backup starting the chain */
+	Size        int32   /* size of the volume when it was backed up, in G */
+	Bytes       int64   /* bytes uploaded to the object store */
+	VolumeID    int64   `gorm:"index"`
+	Volume      *Volume `gorm:"foreignkey:VolumeID"`
+}
+
+type BackupRetention struct {
+	Model
+	MaxChains int32 /* backup chains kept per volume, 0 means unlimited */
+	MaxDays   int32 /* days a chain is kept after its latest backup, 0 means unlimited */
+}
+
+func init() {
+	dbs.AutoMigrate(&VolumeBackup{}, &BackupRetention{})
+}
@@ -0,0 +1,26 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type VolumeTransfer struct {
+	Model
+	Name       string  `gorm:"type:varchar(128)"`
+	Status     string  `gorm:"type:varchar(32)"`
+	Salt       string  `gorm:"type:varchar(32)" json:"-"`
+	KeyHash    string  `gorm:"type:varchar(64)" json:"-"` /* sha256 of salt and the one-time auth key, the key itself is never stored */
+	AcceptedBy int64   /* org which accepted the transfer */
+	VolumeID   int64   `gorm:"index"`
+	Volume     *Volume `gorm:"foreignkey:VolumeID"`
+}
+
+func init() {
+	dbs.AutoMigrate(&VolumeTransfer{})
+}
@@ -0,0 +1,29 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type VolumeType struct {
+	Model
+	Name        string     `gorm:"type:varchar(64)"`
+	Backend     string     `gorm:"type:varchar(32)"`  /* lvm, glusterfs or nfs */
+	Source      string     `gorm:"type:varchar(256)"` /* volume group for lvm, gluster volume name or nfs export */
+	GlusterfsID int64      /* optional, the gluster cluster serving the volume */
+	Glusterfs   *Glusterfs `gorm:"foreignkey:GlusterfsID"`
+	ReadIops    int64      /* 0 means unlimited */
+	WriteIops   int64
+	ReadBytes   int64 /* bytes per second */
+	WriteBytes  int64
+	Encrypted   bool `gorm:"default:false"`
+}
+
+func init() {
+	dbs.AutoMigrate(&VolumeType{})
+}
@@ -0,0 +1,50 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package model
+
+import (
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+type IkePolicy struct {
+	Model
+	Version    string `gorm:"type:varchar(16);default:'ikev2'"`
+	Encryption string `gorm:"type:varchar(32);default:'aes256'"`
+	Integrity  string `gorm:"type:varchar(32);default:'sha256'"`
+	DhGroup    string `gorm:"type:varchar(32);default:'modp2048'"`
+	Lifetime   int32  `gorm:"default:3600"`
+}
+
+type IpsecPolicy struct {
+	Model
+	Protocol   string `gorm:"type:varchar(16);default:'esp'"`
+	Encryption string `gorm:"type:varchar(32);default:'aes256'"`
+	Integrity  string `gorm:"type:varchar(32);default:'sha256'"`
+	PfsGroup   string `gorm:"type:varchar(32);default:'modp2048'"`
+	Lifetime   int32  `gorm:"default:3600"`
+}
+
+type VpnService struct {
+	Model
+	Name          string `gorm:"type:varchar(32)"`
+	Status        string `gorm:"type:varchar(32)"`
+	GatewayID     int64
+	Gateway       *Gateway `gorm:"foreignkey:GatewayID"`
+	LocalAddress  string   `gorm:"type:varchar(64)"`
+	PeerAddress   string   `gorm:"type:varchar(64)"`
+	LocalCidrs    string   `gorm:"type:varchar(256)"`
+	PeerCidrs     string   `gorm:"type:varchar(256)"`
+	Psk           string   `gorm:"type:varchar(128)" json:"-"`
+	IkePolicyID   int64
+	IkePolicy     *IkePolicy `gorm:"foreignkey:IkePolicyID"`
+	IpsecPolicyID int64
+	IpsecPolicy   *IpsecPolicy `gorm:"foreignkey:IpsecPolicyID"`
+}
+
+func init() {
+	dbs.AutoMigrate(&IkePolicy{}, &IpsecPolicy{}, &VpnService{})
+}
@@ -0,0 +1,122 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+type AddrPairData struct {
+	IpAddress string `json:"ip_address"`
+	MacAddr   string `json:"mac_address,omitempty"`
+}
+
+// parseAddrPairs accepts a json list of pairs or the text form with pairs of ip[-mac] separated by spaces or commas
+func parseAddrPairs(content string) (pairs []*AddrPairData, err error) {
+	pairs = []*AddrPairData{}
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "[") {
+		if err = json.Unmarshal([]byte(content), &pairs); err != nil {
+			err = fmt.Errorf("Invalid address pairs: %s", err.Error())
+		}
+		return
+	}
+	for _, ap := range strings.FieldsFunc(content, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' }) {
+		pair := &AddrPairData{IpAddress: ap}
+		if i := strings.Index(ap, "-"); i >= 0 {
+			pair.IpAddress = ap[:i]
+			pair.MacAddr = ap[i+1:]
+		}
+		pairs = append(pairs, pair)
+	}
+	return
+}
+
+// validateAddrPairs checks every pair is an ip or cidr inside the subnet with an optional unicast mac,
+// the addresses and macs are normalized in place
+func validateAddrPairs(subnet *model.Subnet, pairs []*AddrPairData) (err error) {
+	ipNet := &net.IPNet{
+		IP:   net.ParseIP(subnet.Network).To4(),
+		Mask: net.IPMask(net.ParseIP(subnet.Netmask).To4()),
+	}
+	if ipNet.IP == nil || ipNet.Mask == nil {
+		return fmt.Errorf("Subnet %s has no valid network", subnet.Name)
+	}
+	subnetSize, _ := ipNet.Mask.Size()
+	seen := make(map[string]bool)
+	for _, pair := range pairs {
+		if strings.Contains(pair.IpAddress, "/") {
+			ip, cidr, err := net.ParseCIDR(pair.IpAddress)
+			if err != nil || ip.To4() == nil {
+				return fmt.Errorf("Invalid address %s", pair.IpAddress)
+			}
+			size, _ := cidr.Mask.Size()
+			if !ip.Equal(cidr.IP) {
+				return fmt.Errorf("Address %s is not a network address", pair.IpAddress)
+			}
+			if size < subnetSize || !ipNet.Contains(cidr.IP) {
+				return fmt.Errorf("Network %s is not inside subnet %s", pair.IpAddress, subnet.Name)
+			}
+			pair.IpAddress = cidr.String()
+		} else {
+			ip := net.ParseIP(pair.IpAddress)
+			if ip == nil || ip.To4() == nil {
+				return fmt.Errorf("Invalid address %s", pair.IpAddress)
+			}
+			if !ipNet.Contains(ip) {
+				return fmt.Errorf("Address %s is not inside subnet %s", pair.IpAddress, subnet.Name)
+			}
+			pair.IpAddress = ip.To4().String()
+		}
+		if pair.MacAddr != "" {
+			mac, err := net.ParseMAC(pair.MacAddr)
+			if err != nil || len(mac) != 6 {
+				return fmt.Errorf("Invalid mac address %s", pair.MacAddr)
+			}
+			if mac[0]&1 == 1 {
+				return fmt.Errorf("Mac address %s is not unicast", pair.MacAddr)
+			}
+			pair.MacAddr = mac.String()
+		}
+		key := pair.IpAddress + "-" + pair.MacAddr
+		if seen[key] {
+			return fmt.Errorf("Duplicated address pair %s", key)
+		}
+		seen[key] = true
+	}
+	return
+}
+
+// addrPairsText renders the pairs in the ip[-mac] lines expected by allow_as_addr.sh
+func addrPairsText(pairs []*model.AddressPair) string {
+	lines := []string{}
+	for _, pair := range pairs {
+		if pair.MacAddr == "" {
+			lines = append(lines, pair.IpAddress)
+		} else {
+			lines = append(lines, pair.IpAddress+"-"+pair.MacAddr)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func addrPairsEqual(pairs []*model.AddressPair, data []*AddrPairData) bool {
+	if len(pairs) != len(data) {
+		return false
+	}
+	for i, pair := range pairs {
+		if pair.IpAddress != data[i].IpAddress || pair.MacAddr != data[i].MacAddr {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestParseAddrPairs(t *testing.T) {
+	pairs, err := parseAddrPairs("10.10.10.100-52:54:02:03:04:08, 10.10.10.0/28")
+	if err != nil || len(pairs) != 2 || pairs[0].MacAddr != "52:54:02:03:04:08" || pairs[1].IpAddress != "10.10.10.0/28" || pairs[1].MacAddr != "" {
+		t.Fatal(pairs, err)
+	}
+	pairs, err = parseAddrPairs(`[{"ip_address": "10.10.10.100", "mac_address": "52:54:02:03:04:08"}]`)
+	if err != nil || len(pairs) != 1 || pairs[0].IpAddress != "10.10.10.100" {
+		t.Fatal(pairs, err)
+	}
+	if pairs, err = parseAddrPairs(""); err != nil || len(pairs) != 0 {
+		t.Fatal(pairs, err)
+	}
+}
+
+func TestValidateAddrPairs(t *testing.T) {
+	subnet := &model.Subnet{Name: "sub1", Network: "10.10.10.0", Netmask: "255.255.255.0"}
+	pairs := []*AddrPairData{
+		{IpAddress: "10.10.10.100", MacAddr: "52-54-02-03-04-08"},
+		{IpAddress: "10.10.10.64/26"},
+	}
+	if err := validateAddrPairs(subnet, pairs); err != nil {
+		t.Fatal(err)
+	}
+	if pairs[0].MacAddr != "52:54:02:03:04:08" {
+		t.Fatal("mac address should be normalized", pairs[0].MacAddr)
+	}
+	invalid := []*AddrPairData{
+		{IpAddress: "10.10.10.300"},
+		{IpAddress: "10.10.11.5"},
+		{IpAddress: "10.10.0.0/16"},
+		{IpAddress: "10.10.10.65/26"},
+		{IpAddress: "10.10.10.5", MacAddr: "52:54:02:03:04"},
+		{IpAddress: "10.10.10.5", MacAddr: "01:00:5e:00:00:01"},
+	}
+	for _, pair := range invalid {
+		if err := validateAddrPairs(subnet, []*AddrPairData{pair}); err == nil {
+			t.Fatal("address pair should be invalid", pair)
+		}
+	}
+	duplicated := []*AddrPairData{{IpAddress: "10.10.10.5"}, {IpAddress: "10.10.10.5"}}
+	if err := validateAddrPairs(subnet, duplicated); err == nil {
+		t.Fatal("duplicated address pairs should be invalid")
+	}
+}
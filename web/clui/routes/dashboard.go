@@ -23,19 +23,20 @@ var (
 )
 
 type ResourceData struct {
-	Title       string `json:"title"`
-	CpuUsed     int64  `json:"cpu_used"`
-	CpuAvail    int64  `json:"cpu_avail"`
-	MemUsed     int64  `json:"mem_used"`
-	MemAvail    int64  `json:"mem_avail"`
-	DiskUsed    int64  `json:"disk_used"`
-	DiskAvail   int64  `json:"disk_avail"`
-	VolumeUsed  int64  `json:"volume_used"`
-	VolumeAvail int64  `json:"volume_avail"`
-	PubipUsed   int64  `json:"pubip_used"`
-	PubipAvail  int64  `json:"pubip_avail"`
-	PrvipUsed   int64  `json:"prvip_used"`
-	PrvipAvail  int64  `json:"prvip_avail"`
+	Title       string       `json:"title"`
+	CpuUsed     int64        `json:"cpu_used"`
+	CpuAvail    int64        `json:"cpu_avail"`
+	MemUsed     int64        `json:"mem_used"`
+	MemAvail    int64        `json:"mem_avail"`
+	DiskUsed    int64        `json:"disk_used"`
+	DiskAvail   int64        `json:"disk_avail"`
+	VolumeUsed  int64        `json:"volume_used"`
+	VolumeAvail int64        `json:"volume_avail"`
+	PubipUsed   int64        `json:"pubip_used"`
+	PubipAvail  int64        `json:"pubip_avail"`
+	PrvipUsed   int64        `json:"prvip_used"`
+	PrvipAvail  int64        `json:"prvip_avail"`
+	Pools       []*PoolUsage `json:"pools,omitempty"`
 }
 
 type Dashboard struct{}
@@ -109,6 +110,11 @@ func (a *Dashboard) GetData(c *macaron.Context, store session.Store) {
 			return
 		}
 	}
+	pools, err := fipPoolAdmin.GetUsage(ctx)
+	if err != nil {
+		log.Println("Failed to get floating ip pool usage", err)
+	}
+	rcData.Pools = pools
 	c.JSON(200, rcData)
 	return
 }
@@ -36,29 +36,19 @@ type FloatingIps struct {
 type FloatingIpAdmin struct{}
 type FloatingIpView struct{}
 
-func (a *FloatingIpAdmin) Create(ctx context.Context, instID, ifaceID int64, types []string, publicIp, privateIp string) (floatingips []*model.FloatingIp, err error) {
-	memberShip := GetMemberShip(ctx)
+func (a *FloatingIpAdmin) getGateway(ctx context.Context, instance *model.Instance, ifaceID int64) (iface *model.Interface, gateway *model.Gateway, err error) {
 	db := DB()
-	instance := &model.Instance{Model: model.Model{ID: instID}}
-	err = db.Set("gorm:auto_preload", true).Preload("Interfaces", "primary_if = ?", true).Model(instance).Take(instance).Error
-	if err != nil {
-		log.Println("DB failed to query instance, %v", err)
-		return
-	}
-	err = db.Where("instance_id = ?", instID).Find(&instance.FloatingIps).Error
-	if err == nil && instance.FloatingIps != nil && len(instance.FloatingIps) > 0 {
-		log.Println("DB failed to query instance, %v", err)
-		floatingips = instance.FloatingIps
-		return
-	}
-	var iface *model.Interface
 	if ifaceID > 0 {
 		iface = &model.Interface{Model: model.Model{ID: ifaceID}}
-		err = db.Take(iface).Error
+		err = db.Set("gorm:auto_preload", true).Take(iface).Error
 		if err != nil {
 			log.Println("DB failed to query interface", err)
 			return
 		}
+		if iface.Instance != instance.ID {
+			err = fmt.Errorf("Interface does not belong to instance")
+			return
+		}
 	} else {
 		iface = instance.Interfaces[0]
 	}
@@ -67,30 +57,54 @@ func (a *FloatingIpAdmin) Create(ctx context.Context, instID, ifaceID int64, typ
 		log.Println("Floating IP can not be created without a gateway")
 		return
 	}
-	hasRouter := false
-	var gateway *model.Gateway
 	for _, gw := range iface.Address.Subnet.Routers {
 		if gw.ZoneID == instance.ZoneID {
-			hasRouter = true
 			gateway = gw
 			break
 		}
 	}
-	if !hasRouter {
+	if gateway == nil {
+		err = fmt.Errorf("No gateway for the instance subnet in this zone")
 		log.Println("No gateway for the instance subnet in this zone")
 		return
 	}
-	err = db.Set("gorm:auto_preload", true).Find(&gateway.Interfaces).Error
+	err = db.Set("gorm:auto_preload", true).Where("device = ?", gateway.ID).Find(&gateway.Interfaces).Error
 	if err != nil {
 		log.Println("DB failed to query interfaces", err)
 		return
 	}
+	return
+}
+
+func (a *FloatingIpAdmin) Create(ctx context.Context, instID, ifaceID, poolID int64, types []string, publicIp, privateIp string) (floatingips []*model.FloatingIp, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	instance := &model.Instance{Model: model.Model{ID: instID}}
+	err = db.Set("gorm:auto_preload", true).Preload("Interfaces", "primary_if = ?", true).Model(instance).Take(instance).Error
+	if err != nil {
+		log.Println("DB failed to query instance, %v", err)
+		return
+	}
+	err = db.Where("instance_id = ?", instID).Find(&instance.FloatingIps).Error
+	if err == nil && instance.FloatingIps != nil && len(instance.FloatingIps) > 0 {
+		log.Println("DB failed to query instance, %v", err)
+		floatingips = instance.FloatingIps
+		return
+	}
+	iface, gateway, err := a.getGateway(ctx, instance, ifaceID)
+	if err != nil {
+		log.Println("Failed to get gateway for floating ip", err)
+		return
+	}
 	for _, ftype := range types {
 		if ftype != "private" && ftype != "public" {
 			log.Println("Invalid floating ip type", err)
 			return
 		}
-		floatingip := &model.FloatingIp{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, GatewayID: gateway.ID, InstanceID: instance.ID, Type: ftype}
+		floatingip := &model.FloatingIp{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, GatewayID: gateway.ID, InstanceID: instance.ID, Type: ftype, ZoneID: gateway.ZoneID}
+		if ftype == "public" {
+			floatingip.PoolID = poolID
+		}
 		err = db.Create(floatingip).Error
 		if err != nil {
 			log.Println("DB failed to create floating ip", err)
@@ -101,7 +115,7 @@ func (a *FloatingIpAdmin) Create(ctx context.Context, instID, ifaceID int64, typ
 			address = privateIp
 		}
 		var fipIface *model.Interface
-		fipIface, err = AllocateFloatingIp(ctx, floatingip.ID, memberShip.OrgID, gateway, ftype, address)
+		fipIface, err = AllocateFloatingIp(ctx, floatingip.ID, memberShip.OrgID, floatingip.PoolID, gateway, ftype, address)
 		if err != nil {
 			log.Println("DB failed to allocate floating ip", err)
 			return
@@ -129,6 +143,164 @@ func (a *FloatingIpAdmin) Create(ctx context.Context, instID, ifaceID int64, typ
 	return
 }
 
+func (a *FloatingIpAdmin) Allocate(ctx context.Context, poolID, zoneID int64, address string) (floatingip *model.FloatingIp, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	ctx = saveTXtoCtx(ctx, db)
+	pool := &model.FloatingIpPool{Model: model.Model{ID: poolID}}
+	if err = db.Preload("Subnets").Preload("Orgs").Preload("Zones").Take(pool).Error; err != nil {
+		log.Println("DB failed to query floating ip pool", err)
+		return
+	}
+	if !fipPoolAdmin.CheckAccess(pool, memberShip.OrgID, zoneID) {
+		err = fmt.Errorf("Not allowed to allocate from this pool")
+		return
+	}
+	floatingip = &model.FloatingIp{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Type: "public", PoolID: pool.ID, ZoneID: zoneID}
+	err = db.Create(floatingip).Error
+	if err != nil {
+		log.Println("DB failed to create floating ip", err)
+		return
+	}
+	var fipIface *model.Interface
+	for _, subnet := range pool.Subnets {
+		fipIface, err = CreateInterface(ctx, subnet.ID, floatingip.ID, memberShip.OrgID, zoneID, -1, address, "", "publicfip", "floating", nil)
+		if err == nil {
+			break
+		}
+	}
+	if fipIface == nil {
+		log.Println("Failed to allocate address from pool", err)
+		err = fmt.Errorf("No available address in pool %s", pool.Name)
+		return
+	}
+	floatingip.FipAddress = fipIface.Address.Address
+	floatingip.IPAddress = strings.Split(floatingip.FipAddress, "/")[0]
+	err = db.Save(floatingip).Error
+	if err != nil {
+		log.Println("DB failed to update floating ip", err)
+		return
+	}
+	return
+}
+
+func (a *FloatingIpAdmin) Associate(ctx context.Context, id, instID, ifaceID int64) (floatingip *model.FloatingIp, err error) {
+	db := DB()
+	floatingip = &model.FloatingIp{Model: model.Model{ID: id}}
+	if err = db.Preload("Interface").Preload("Interface.Address").Preload("Interface.Address.Subnet").Take(floatingip).Error; err != nil {
+		log.Println("DB failed to query floating ip", err)
+		return
+	}
+	if floatingip.InstanceID > 0 {
+		err = fmt.Errorf("Floating ip is already associated")
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: instID}}
+	err = db.Set("gorm:auto_preload", true).Preload("Interfaces", "primary_if = ?", true).Model(instance).Take(instance).Error
+	if err != nil {
+		log.Println("DB failed to query instance", err)
+		return
+	}
+	count := 0
+	err = db.Model(&model.FloatingIp{}).Where("instance_id = ? and type = ?", instID, floatingip.Type).Count(&count).Error
+	if err != nil {
+		log.Println("DB failed to count floating ips", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Instance already has a %s floating ip", floatingip.Type)
+		return
+	}
+	iface, gateway, err := a.getGateway(ctx, instance, ifaceID)
+	if err != nil {
+		log.Println("Failed to get gateway for floating ip", err)
+		return
+	}
+	if floatingip.ZoneID > 0 && floatingip.ZoneID != gateway.ZoneID {
+		err = fmt.Errorf("Floating ip is not in the zone of the instance")
+		return
+	}
+	var extSubnet *model.Subnet
+	for _, gwIface := range gateway.Interfaces {
+		if strings.Contains(gwIface.Type, floatingip.Type) && gwIface.Address != nil {
+			extSubnet = gwIface.Address.Subnet
+			break
+		}
+	}
+	if extSubnet == nil || floatingip.Interface == nil || floatingip.Interface.Address.Subnet.Vlan != extSubnet.Vlan {
+		err = fmt.Errorf("Floating ip is not reachable from the instance gateway")
+		return
+	}
+	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+	if gateway.Hyper == gateway.Peer {
+		control = fmt.Sprintf("inter=%d", gateway.Hyper)
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_floating.sh '%d' '%s' '%s' '%s'", gateway.ID, floatingip.Type, floatingip.FipAddress, iface.Address.Address)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create floating ip failed", err)
+		return
+	}
+	floatingip.InstanceID = instance.ID
+	floatingip.GatewayID = gateway.ID
+	floatingip.IntAddress = iface.Address.Address
+	floatingip.ZoneID = gateway.ZoneID
+	err = db.Save(floatingip).Error
+	if err != nil {
+		log.Println("DB failed to update floating ip", err)
+		return
+	}
+	if floatingip.QosPolicyID > 0 {
+		err = ApplyFloatingIpQos(ctx, floatingip)
+		if err != nil {
+			log.Println("Failed to apply floating ip qos", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *FloatingIpAdmin) Disassociate(ctx context.Context, id int64) (floatingip *model.FloatingIp, err error) {
+	db := DB()
+	floatingip = &model.FloatingIp{Model: model.Model{ID: id}}
+	if err = db.Preload("Gateway").Take(floatingip).Error; err != nil {
+		log.Println("DB failed to query floating ip", err)
+		return
+	}
+	if floatingip.Gateway == nil {
+		err = fmt.Errorf("Floating ip is not associated")
+		return
+	}
+	control := fmt.Sprintf("toall=router-%d:%d,%d", floatingip.Gateway.ID, floatingip.Gateway.Hyper, floatingip.Gateway.Peer)
+	if floatingip.Gateway.Hyper == floatingip.Gateway.Peer {
+		control = fmt.Sprintf("inter=%d", floatingip.Gateway.Hyper)
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_floating.sh '%d' '%s' '%s' '%s'", floatingip.GatewayID, floatingip.Type, floatingip.FipAddress, floatingip.IntAddress)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Clear floating ip failed", err)
+		return
+	}
+	err = db.Model(floatingip).Updates(map[string]interface{}{"instance_id": 0, "gateway_id": 0, "int_address": ""}).Error
+	if err != nil {
+		log.Println("DB failed to update floating ip", err)
+		return
+	}
+	floatingip.InstanceID = 0
+	floatingip.GatewayID = 0
+	floatingip.IntAddress = ""
+	floatingip.Gateway = nil
+	return
+}
+
 func (a *FloatingIpAdmin) Delete(ctx context.Context, id int64) (err error) {
 	db := DB()
 	db = db.Begin()
@@ -304,7 +476,21 @@ func (v *FloatingIpView) New(c *macaron.Context, store session.Store) {
 	if err := db.Preload("Interfaces", "primary_if = ?", true).Preload("Interfaces.Address").Preload("Interfaces.Address.Subnet").Where(where).Find(&instances).Error; err != nil {
 		return
 	}
+	_, pools, err := fipPoolAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	zones := []*model.Zone{}
+	if err = db.Find(&zones).Error; err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
 	c.Data["Instances"] = instances
+	c.Data["Pools"] = pools
+	c.Data["Zones"] = zones
 	c.HTML(200, "floatingips_new")
 }
 
@@ -320,6 +506,29 @@ func (v *FloatingIpView) Create(c *macaron.Context, store session.Store) {
 	redirectTo := "../floatingips"
 	instID := c.QueryInt64("instance")
 	ftype := c.QueryTrim("ftype")
+	poolID := c.QueryInt64("pool")
+	if instID == 0 && poolID > 0 {
+		zoneID := c.QueryInt64("zone")
+		publicIp := c.QueryTrim("publicip")
+		floatingip, err := floatingipAdmin.Allocate(c.Req.Context(), poolID, zoneID, publicIp)
+		if err != nil {
+			log.Println("Failed to allocate floating ip", err)
+			if c.Req.Header.Get("X-Json-Format") == "yes" {
+				c.JSON(500, map[string]interface{}{
+					"error": err.Error(),
+				})
+				return
+			}
+			c.Data["ErrorMsg"] = err.Error()
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(200, floatingip)
+			return
+		}
+		c.Redirect(redirectTo)
+		return
+	}
 	permit, err := memberShip.CheckOwner(model.Writer, "instances", int64(instID))
 	if !permit {
 		log.Println("Not authorized for this operation")
@@ -333,7 +542,7 @@ func (v *FloatingIpView) Create(c *macaron.Context, store session.Store) {
 	publicIp := c.QueryTrim("publicip")
 	privateIp := c.QueryTrim("privateip")
 	types := strings.Split(ftype, ",")
-	floatingips, err := floatingipAdmin.Create(c.Req.Context(), int64(instID), 0, types, publicIp, privateIp)
+	floatingips, err := floatingipAdmin.Create(c.Req.Context(), int64(instID), 0, poolID, types, publicIp, privateIp)
 	if err != nil {
 		log.Println("Failed to create floating ip", err)
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
@@ -371,7 +580,7 @@ func (v *FloatingIpView) Assign(c *macaron.Context, store session.Store) {
 	}
 	types := []string{"public", "private"}
 	fipsData := &FloatingIps{Instance: instID}
-	floatingips, err := floatingipAdmin.Create(c.Req.Context(), int64(instID), 0, types, floatingIP, "")
+	floatingips, err := floatingipAdmin.Create(c.Req.Context(), int64(instID), 0, 0, types, floatingIP, "")
 	if err != nil {
 		log.Println("Failed to create floating ip", err)
 		fipsData.PublicIp = ""
@@ -387,7 +596,76 @@ func (v *FloatingIpView) Assign(c *macaron.Context, store session.Store) {
 	c.JSON(200, fipsData)
 }
 
-func AllocateFloatingIp(ctx context.Context, floatingipID, owner int64, gateway *model.Gateway, ftype, address string) (fipIface *model.Interface, err error) {
+func (v *FloatingIpView) Associate(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../floatingips"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "floating_ips", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	instID := c.QueryInt64("instance")
+	permit, err = memberShip.CheckOwner(model.Writer, "instances", instID)
+	if !permit {
+		log.Println("Not authorized to access instance")
+		c.Data["ErrorMsg"] = "Not authorized to access instance"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	ifaceID := c.QueryInt64("interface")
+	floatingip, err := floatingipAdmin.Associate(c.Req.Context(), id, instID, ifaceID)
+	if err != nil {
+		log.Println("Failed to associate floating ip", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, floatingip)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *FloatingIpView) Disassociate(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../floatingips"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "floating_ips", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	floatingip, err := floatingipAdmin.Disassociate(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to disassociate floating ip", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, floatingip)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func AllocateFloatingIp(ctx context.Context, floatingipID, owner, poolID int64, gateway *model.Gateway, ftype, address string) (fipIface *model.Interface, err error) {
 	var db *gorm.DB
 	ctx, db = getCtxDB(ctx)
 	var subnet *model.Subnet
@@ -403,7 +681,30 @@ func AllocateFloatingIp(ctx context.Context, floatingipID, owner int64, gateway
 	}
 	name := ftype + "fip"
 	subnets := []*model.Subnet{}
-	err = db.Where("vlan = ?", subnet.Vlan).Find(&subnets).Error
+	if poolID > 0 {
+		pool := &model.FloatingIpPool{Model: model.Model{ID: poolID}}
+		err = db.Preload("Orgs").Preload("Zones").Take(pool).Error
+		if err != nil {
+			log.Println("DB failed to query floating ip pool", err)
+			return
+		}
+		if !fipPoolAdmin.CheckAccess(pool, owner, gateway.ZoneID) {
+			err = fmt.Errorf("Not allowed to allocate from this pool")
+			return
+		}
+		err = db.Where("vlan = ? and id in (select subnet_id from fip_pool_subnets where floating_ip_pool_id = ?)", subnet.Vlan, poolID).Find(&subnets).Error
+	} else {
+		pools := []*model.FloatingIpPool{}
+		if err = db.Preload("Subnets").Preload("Orgs").Preload("Zones").Find(&pools).Error; err != nil {
+			log.Println("DB failed to query floating ip pools", err)
+			return
+		}
+		query := db.Where("vlan = ?", subnet.Vlan)
+		if denied := fipPoolAdmin.DeniedSubnets(pools, owner, gateway.ZoneID); len(denied) > 0 {
+			query = query.Where("id not in (?)", denied)
+		}
+		err = query.Find(&subnets).Error
+	}
 	if err == nil && len(subnets) > 0 {
 		for _, s := range subnets {
 			fipIface, err = CreateInterface(ctx, s.ID, floatingipID, owner, gateway.ZoneID, -1, address, "", name, "floating", nil)
@@ -0,0 +1,548 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	fipPoolAdmin = &FloatingIpPoolAdmin{}
+	fipPoolView  = &FloatingIpPoolView{}
+)
+
+type PoolUsage struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Total int64  `json:"total"`
+	Used  int64  `json:"used"`
+}
+
+type FloatingIpPoolAdmin struct{}
+type FloatingIpPoolView struct{}
+
+func parseIDList(ids string) (idList []int64, err error) {
+	for _, s := range strings.Split(ids, ",") {
+		if s == "" {
+			continue
+		}
+		var id int
+		id, err = strconv.Atoi(s)
+		if err != nil {
+			log.Println("Invalid ID", err)
+			return
+		}
+		idList = append(idList, int64(id))
+	}
+	return
+}
+
+// CheckAccess tells whether an organization may allocate from the pool in a zone,
+// empty org or zone lists mean the pool is not restricted on that dimension,
+// a zone restricted pool is never allowed without a zone
+func (a *FloatingIpPoolAdmin) CheckAccess(pool *model.FloatingIpPool, orgID, zoneID int64) (permit bool) {
+	orgOK := len(pool.Orgs) == 0
+	for _, org := range pool.Orgs {
+		if org.ID == orgID {
+			orgOK = true
+			break
+		}
+	}
+	zoneOK := len(pool.Zones) == 0
+	for _, zone := range pool.Zones {
+		if zone.ID == zoneID {
+			zoneOK = true
+			break
+		}
+	}
+	return orgOK && zoneOK
+}
+
+// DeniedSubnets returns the subnets an organization may not allocate from in a zone when no pool is given,
+// a subnet is denied when it backs restricted pools only and none of them grants access
+func (a *FloatingIpPoolAdmin) DeniedSubnets(pools []*model.FloatingIpPool, orgID, zoneID int64) (subnetIDs []int64) {
+	allowed := make(map[int64]bool)
+	for _, pool := range pools {
+		if !a.CheckAccess(pool, orgID, zoneID) {
+			continue
+		}
+		for _, subnet := range pool.Subnets {
+			allowed[subnet.ID] = true
+		}
+	}
+	denied := make(map[int64]bool)
+	for _, pool := range pools {
+		for _, subnet := range pool.Subnets {
+			if !allowed[subnet.ID] && !denied[subnet.ID] {
+				denied[subnet.ID] = true
+				subnetIDs = append(subnetIDs, subnet.ID)
+			}
+		}
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) Usage(pool *model.FloatingIpPool) (total, used int64, err error) {
+	if len(pool.Subnets) == 0 {
+		return
+	}
+	db := DB()
+	subnetIDs := []int64{}
+	for _, subnet := range pool.Subnets {
+		subnetIDs = append(subnetIDs, subnet.ID)
+	}
+	err = db.Model(&model.Address{}).Where("subnet_id in (?)", subnetIDs).Count(&total).Error
+	if err != nil {
+		log.Println("Failed to count pool addresses", err)
+		return
+	}
+	err = db.Model(&model.Address{}).Where("subnet_id in (?)", subnetIDs).Where("allocated = ?", true).Count(&used).Error
+	if err != nil {
+		log.Println("Failed to count used pool addresses", err)
+		return
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) getAttachments(subnetIDs, orgIDs, zoneIDs []int64) (subnets []*model.Subnet, orgs []*model.Organization, zones []*model.Zone, err error) {
+	db := DB()
+	subnets = []*model.Subnet{}
+	orgs = []*model.Organization{}
+	zones = []*model.Zone{}
+	for _, sID := range subnetIDs {
+		subnet := &model.Subnet{Model: model.Model{ID: sID}}
+		if err = db.Take(subnet).Error; err != nil {
+			log.Println("DB failed to query subnet", err)
+			return
+		}
+		if subnet.Type != "public" {
+			err = fmt.Errorf("Only public subnets can back a floating ip pool")
+			return
+		}
+		subnets = append(subnets, subnet)
+	}
+	for _, oID := range orgIDs {
+		org := &model.Organization{Model: model.Model{ID: oID}}
+		if err = db.Take(org).Error; err != nil {
+			log.Println("DB failed to query organization", err)
+			return
+		}
+		orgs = append(orgs, org)
+	}
+	for _, zID := range zoneIDs {
+		zone := &model.Zone{ID: zID}
+		if err = db.Take(zone).Error; err != nil {
+			log.Println("DB failed to query zone", err)
+			return
+		}
+		zones = append(zones, zone)
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) Create(ctx context.Context, name string, subnetIDs, orgIDs, zoneIDs []int64) (pool *model.FloatingIpPool, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	subnets, orgs, zones, err := a.getAttachments(subnetIDs, orgIDs, zoneIDs)
+	if err != nil {
+		log.Println("Invalid pool attachments", err)
+		return
+	}
+	if len(subnets) == 0 {
+		err = fmt.Errorf("At least one public subnet is required")
+		return
+	}
+	pool = &model.FloatingIpPool{
+		Model:   model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:    name,
+		Subnets: subnets,
+		Orgs:    orgs,
+		Zones:   zones,
+	}
+	if err = db.Create(pool).Error; err != nil {
+		log.Println("DB failed to create floating ip pool", err)
+		return
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) Update(ctx context.Context, id int64, name string, subnetIDs, orgIDs, zoneIDs []int64) (pool *model.FloatingIpPool, err error) {
+	db := DB()
+	pool = &model.FloatingIpPool{Model: model.Model{ID: id}}
+	if err = db.Take(pool).Error; err != nil {
+		log.Println("DB failed to query floating ip pool", err)
+		return
+	}
+	subnets, orgs, zones, err := a.getAttachments(subnetIDs, orgIDs, zoneIDs)
+	if err != nil {
+		log.Println("Invalid pool attachments", err)
+		return
+	}
+	if len(subnets) == 0 {
+		err = fmt.Errorf("At least one public subnet is required")
+		return
+	}
+	if err = db.Model(pool).Association("Subnets").Replace(subnets).Error; err != nil {
+		log.Println("DB failed to update pool subnets", err)
+		return
+	}
+	if err = db.Model(pool).Association("Orgs").Replace(orgs).Error; err != nil {
+		log.Println("DB failed to update pool organizations", err)
+		return
+	}
+	if err = db.Model(pool).Association("Zones").Replace(zones).Error; err != nil {
+		log.Println("DB failed to update pool zones", err)
+		return
+	}
+	if name != "" && pool.Name != name {
+		pool.Name = name
+		if err = db.Model(pool).Update("name", name).Error; err != nil {
+			log.Println("DB failed to update floating ip pool", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	count := 0
+	err = db.Model(&model.FloatingIp{}).Where("pool_id = ?", id).Count(&count).Error
+	if err != nil {
+		log.Println("Failed to count floating ips in pool", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("There are floating ips allocated from this pool")
+		return
+	}
+	pool := &model.FloatingIpPool{Model: model.Model{ID: id}}
+	if err = db.Model(pool).Association("Subnets").Clear().Error; err != nil {
+		log.Println("DB failed to clear pool subnets", err)
+		return
+	}
+	if err = db.Model(pool).Association("Orgs").Clear().Error; err != nil {
+		log.Println("DB failed to clear pool organizations", err)
+		return
+	}
+	if err = db.Model(pool).Association("Zones").Clear().Error; err != nil {
+		log.Println("DB failed to clear pool zones", err)
+		return
+	}
+	if err = db.Delete(pool).Error; err != nil {
+		log.Println("DB failed to delete floating ip pool", err)
+		return
+	}
+	return
+}
+
+func (a *FloatingIpPoolAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, pools []*model.FloatingIpPool, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := ""
+	if memberShip.GetWhere() != "" {
+		where = fmt.Sprintf("id not in (select floating_ip_pool_id from fip_pool_orgs) or id in (select floating_ip_pool_id from fip_pool_orgs where organization_id = %d)", memberShip.OrgID)
+	}
+	pools = []*model.FloatingIpPool{}
+	if err = db.Model(&model.FloatingIpPool{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count floating ip pool(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Subnets").Preload("Orgs").Preload("Zones").Where(where).Where(query).Find(&pools).Error; err != nil {
+		log.Println("DB failed to query floating ip pool(s), %v", err)
+		return
+	}
+	for _, pool := range pools {
+		pool.Total, pool.Used, err = a.Usage(pool)
+		if err != nil {
+			log.Println("Failed to get pool usage", err)
+			return
+		}
+	}
+
+	return
+}
+
+func (a *FloatingIpPoolAdmin) GetUsage(ctx context.Context) (usage []*PoolUsage, err error) {
+	_, pools, err := a.List(ctx, 0, -1, "", "")
+	if err != nil {
+		log.Println("Failed to list floating ip pools", err)
+		return
+	}
+	usage = []*PoolUsage{}
+	for _, pool := range pools {
+		usage = append(usage, &PoolUsage{ID: pool.ID, Name: pool.Name, Total: pool.Total, Used: pool.Used})
+	}
+	return
+}
+
+func (v *FloatingIpPoolView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, pools, err := fipPoolAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list floating ip pool(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["FloatingIpPools"] = pools
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"fippools": pools,
+			"total":    total,
+			"pages":    pages,
+			"query":    query,
+		})
+		return
+	}
+	c.HTML(200, "fippools")
+}
+
+func (v *FloatingIpPoolView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	id := c.Params("id")
+	if id == "" {
+		c.Data["ErrorMsg"] = "Id is Empty"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	poolID, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("Invalid floating ip pool ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = fipPoolAdmin.Delete(c.Req.Context(), int64(poolID))
+	if err != nil {
+		log.Println("Failed to delete floating ip pool", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "fippools",
+	})
+	return
+}
+
+func (v *FloatingIpPoolView) setFormData(c *macaron.Context) (err error) {
+	db := DB()
+	subnets := []*model.Subnet{}
+	if err = db.Where("type = 'public'").Find(&subnets).Error; err != nil {
+		return
+	}
+	orgs := []*model.Organization{}
+	if err = db.Find(&orgs).Error; err != nil {
+		return
+	}
+	zones := []*model.Zone{}
+	if err = db.Find(&zones).Error; err != nil {
+		return
+	}
+	c.Data["Subnets"] = subnets
+	c.Data["Orgs"] = orgs
+	c.Data["Zones"] = zones
+	return
+}
+
+func (v *FloatingIpPoolView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if err := v.setFormData(c); err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.HTML(200, "fippools_new")
+}
+
+func (v *FloatingIpPoolView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	id := c.ParamsInt64("id")
+	pool := &model.FloatingIpPool{Model: model.Model{ID: id}}
+	if err := DB().Preload("Subnets").Preload("Orgs").Preload("Zones").Take(pool).Error; err != nil {
+		log.Println("DB failed to query floating ip pool", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if err := v.setFormData(c); err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["FloatingIpPool"] = pool
+	c.HTML(200, "fippools_patch")
+}
+
+func (v *FloatingIpPoolView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../fippools"
+	id := c.ParamsInt64("id")
+	name := c.QueryTrim("name")
+	subnetIDs, err := parseIDList(c.QueryTrim("subnets"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	orgIDs, err := parseIDList(c.QueryTrim("orgs"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	zoneIDs, err := parseIDList(c.QueryTrim("zones"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	pool, err := fipPoolAdmin.Update(c.Req.Context(), id, name, subnetIDs, orgIDs, zoneIDs)
+	if err != nil {
+		log.Println("Failed to update floating ip pool", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, pool)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *FloatingIpPoolView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../fippools"
+	name := c.QueryTrim("name")
+	subnetIDs, err := parseIDList(c.QueryTrim("subnets"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	orgIDs, err := parseIDList(c.QueryTrim("orgs"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	zoneIDs, err := parseIDList(c.QueryTrim("zones"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	pool, err := fipPoolAdmin.Create(c.Req.Context(), name, subnetIDs, orgIDs, zoneIDs)
+	if err != nil {
+		log.Println("Failed to create floating ip pool", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, pool)
+		return
+	}
+	c.Redirect(redirectTo)
+}
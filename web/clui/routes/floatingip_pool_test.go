@@ -0,0 +1,59 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestFloatingIpPoolCheckAccess(t *testing.T) {
+	open := &model.FloatingIpPool{}
+	if !fipPoolAdmin.CheckAccess(open, 3, 0) {
+		t.Fatal("unrestricted pool denied")
+	}
+	pool := &model.FloatingIpPool{
+		Orgs:  []*model.Organization{{Model: model.Model{ID: 3}}},
+		Zones: []*model.Zone{{ID: 2}},
+	}
+	if !fipPoolAdmin.CheckAccess(pool, 3, 2) {
+		t.Fatal("allowed org and zone denied")
+	}
+	if fipPoolAdmin.CheckAccess(pool, 4, 2) {
+		t.Fatal("other org allowed")
+	}
+	if fipPoolAdmin.CheckAccess(pool, 3, 1) {
+		t.Fatal("other zone allowed")
+	}
+	if fipPoolAdmin.CheckAccess(pool, 3, 0) {
+		t.Fatal("zone restriction skipped without zone")
+	}
+}
+
+func TestFloatingIpPoolDeniedSubnets(t *testing.T) {
+	subnet := func(id int64) *model.Subnet {
+		return &model.Subnet{Model: model.Model{ID: id}}
+	}
+	pools := []*model.FloatingIpPool{
+		{Subnets: []*model.Subnet{subnet(1)}},
+		{Subnets: []*model.Subnet{subnet(2), subnet(3)}, Orgs: []*model.Organization{{Model: model.Model{ID: 3}}}},
+		{Subnets: []*model.Subnet{subnet(3), subnet(4)}, Zones: []*model.Zone{{ID: 2}}},
+	}
+	denied := fipPoolAdmin.DeniedSubnets(pools, 3, 1)
+	if len(denied) != 1 || denied[0] != 4 {
+		t.Fatal(denied)
+	}
+	denied = fipPoolAdmin.DeniedSubnets(pools, 4, 2)
+	if len(denied) != 1 || denied[0] != 2 {
+		t.Fatal(denied)
+	}
+	if denied = fipPoolAdmin.DeniedSubnets(pools, 3, 2); len(denied) != 0 {
+		t.Fatal(denied)
+	}
+}
@@ -0,0 +1,481 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	flowLogAdmin = &FlowLogAdmin{}
+	flowLogView  = &FlowLogView{}
+)
+
+type FlowLogAdmin struct{}
+type FlowLogView struct{}
+
+type FlowRecordFilter struct {
+	SrcIp    string
+	SrcPort  int32
+	DstIp    string
+	DstPort  int32
+	Protocol string
+	Action   string
+	Since    time.Time
+	Until    time.Time
+}
+
+var flowLogTables = map[string]string{
+	"interface": "interfaces",
+	"subnet":    "subnets",
+	"gateway":   "gateways",
+}
+
+// flowLogTarget returns where and with which arguments the flow log of a resource is set up
+func (a *FlowLogAdmin) flowLogTarget(ctx context.Context, flowLog *model.FlowLog) (control, target string, err error) {
+	db := DB()
+	switch flowLog.ResourceType {
+	case "interface":
+		iface := &model.Interface{Model: model.Model{ID: flowLog.ResourceID}}
+		if err = db.Take(iface).Error; err != nil {
+			log.Println("DB failed to query interface", err)
+			return
+		}
+		if iface.Instance == 0 {
+			err = fmt.Errorf("Flow log can only be enabled on interfaces of instances")
+			return
+		}
+		instance := &model.Instance{Model: model.Model{ID: iface.Instance}}
+		if err = db.Take(instance).Error; err != nil {
+			log.Println("DB failed to query instance", err)
+			return
+		}
+		control = fmt.Sprintf("inter=%d", instance.Hyper)
+		target = fmt.Sprintf("vnic '%s'", iface.MacAddr)
+	case "subnet", "gateway":
+		gatewayID := flowLog.ResourceID
+		subnet := &model.Subnet{}
+		if flowLog.ResourceType == "subnet" {
+			subnet.ID = flowLog.ResourceID
+			if err = db.Take(subnet).Error; err != nil {
+				log.Println("DB failed to query subnet", err)
+				return
+			}
+			if subnet.Router == 0 {
+				err = fmt.Errorf("Subnet is not attached to a gateway")
+				return
+			}
+			gatewayID = subnet.Router
+		}
+		gateway := &model.Gateway{Model: model.Model{ID: gatewayID}}
+		if err = db.Take(gateway).Error; err != nil {
+			log.Println("DB failed to query gateway", err)
+			return
+		}
+		control = fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+		if gateway.Hyper == gateway.Peer {
+			control = fmt.Sprintf("inter=%d", gateway.Hyper)
+		}
+		target = fmt.Sprintf("gateway '%d'", gateway.ID)
+		if flowLog.ResourceType == "subnet" {
+			target = fmt.Sprintf("subnet '%d' '%d' '%s'", gateway.ID, subnet.Vlan, subnetCidr(subnet))
+		}
+	default:
+		err = fmt.Errorf("Invalid resource type %s", flowLog.ResourceType)
+	}
+	return
+}
+
+func (a *FlowLogAdmin) Create(ctx context.Context, name, resourceType string, resourceID int64, action string) (flowLog *model.FlowLog, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if action == "" {
+		action = "all"
+	}
+	if action != "all" && action != "accept" && action != "drop" {
+		err = fmt.Errorf("Action must be all, accept or drop")
+		return
+	}
+	count := 0
+	if err = db.Model(&model.FlowLog{}).Where("resource_type = ? and resource_id = ?", resourceType, resourceID).Count(&count).Error; err != nil {
+		log.Println("DB failed to count flow logs", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Flow log is already enabled on this %s", resourceType)
+		return
+	}
+	flowLog = &model.FlowLog{
+		Model:        model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:         name,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Action:       action,
+		Status:       "enabled",
+	}
+	control, target, err := a.flowLogTarget(ctx, flowLog)
+	if err != nil {
+		return
+	}
+	if err = db.Create(flowLog).Error; err != nil {
+		log.Println("DB failed to create flow log", err)
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/enable_flow_log.sh '%d' '%s' %s", flowLog.ID, action, target)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Enable flow log failed", err)
+		return
+	}
+	return
+}
+
+func (a *FlowLogAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	flowLog := &model.FlowLog{Model: model.Model{ID: id}}
+	if err = db.Take(flowLog).Error; err != nil {
+		log.Println("DB failed to query flow log", err)
+		return
+	}
+	control, target, err := a.flowLogTarget(ctx, flowLog)
+	if err == nil {
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/disable_flow_log.sh '%d' '%s' %s", flowLog.ID, flowLog.Action, target)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Disable flow log failed", err)
+			return
+		}
+	}
+	if err = db.Where("flow_log_id = ?", id).Delete(&model.FlowLogRecord{}).Error; err != nil {
+		log.Println("DB failed to delete flow log records", err)
+		return
+	}
+	if err = db.Delete(flowLog).Error; err != nil {
+		log.Println("DB failed to delete flow log", err)
+		return
+	}
+	return
+}
+
+func (a *FlowLogAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, flowLogs []*model.FlowLog, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	flowLogs = []*model.FlowLog{}
+	if err = db.Model(&model.FlowLog{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count flow log(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Where(where).Where(query).Find(&flowLogs).Error; err != nil {
+		log.Println("DB failed to query flow log(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, flowLog := range flowLogs {
+			flowLog.OwnerInfo = &model.Organization{Model: model.Model{ID: flowLog.Owner}}
+			if err = db.Take(flowLog.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (a *FlowLogAdmin) Records(ctx context.Context, offset, limit int64, flowLogID int64, filter *FlowRecordFilter) (total int64, records []*model.FlowLogRecord, err error) {
+	db := DB()
+	if limit == 0 {
+		limit = 50
+	}
+	db = db.Model(&model.FlowLogRecord{}).Where("flow_log_id = ?", flowLogID)
+	if filter.SrcIp != "" {
+		db = db.Where("src_ip = ?", filter.SrcIp)
+	}
+	if filter.SrcPort > 0 {
+		db = db.Where("src_port = ?", filter.SrcPort)
+	}
+	if filter.DstIp != "" {
+		db = db.Where("dst_ip = ?", filter.DstIp)
+	}
+	if filter.DstPort > 0 {
+		db = db.Where("dst_port = ?", filter.DstPort)
+	}
+	if filter.Protocol != "" {
+		db = db.Where("protocol = ?", filter.Protocol)
+	}
+	if filter.Action != "" {
+		db = db.Where("action = ?", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		db = db.Where("start_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		db = db.Where("start_at <= ?", filter.Until)
+	}
+	records = []*model.FlowLogRecord{}
+	if err = db.Count(&total).Error; err != nil {
+		log.Println("DB failed to count flow log record(s), %v", err)
+		return
+	}
+	if err = db.Order("start_at desc").Offset(offset).Limit(limit).Find(&records).Error; err != nil {
+		log.Println("DB failed to query flow log record(s), %v", err)
+		return
+	}
+	return
+}
+
+// parseFlowTime accepts a unix timestamp or a RFC3339 time
+func parseFlowTime(value string) (t time.Time, err error) {
+	if value == "" {
+		return
+	}
+	if secs, perr := strconv.ParseInt(value, 10, 64); perr == nil {
+		t = time.Unix(secs, 0)
+		return
+	}
+	t, err = time.Parse(time.RFC3339, value)
+	return
+}
+
+func (v *FlowLogView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, flowLogs, err := flowLogAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list flow log(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["FlowLogs"] = flowLogs
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"flowlogs": flowLogs,
+			"total":    total,
+			"pages":    pages,
+			"query":    query,
+		})
+		return
+	}
+	c.HTML(200, "flowlogs")
+}
+
+func (v *FlowLogView) Records(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Reader, "flow_logs", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 50
+	}
+	filter := &FlowRecordFilter{
+		SrcIp:    c.QueryTrim("src_ip"),
+		SrcPort:  int32(c.QueryInt("src_port")),
+		DstIp:    c.QueryTrim("dst_ip"),
+		DstPort:  int32(c.QueryInt("dst_port")),
+		Protocol: c.QueryTrim("protocol"),
+		Action:   c.QueryTrim("action"),
+	}
+	filter.Since, err = parseFlowTime(c.QueryTrim("since"))
+	if err == nil {
+		filter.Until, err = parseFlowTime(c.QueryTrim("until"))
+	}
+	if err != nil {
+		log.Println("Invalid time range", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	total, records, err := flowLogAdmin.Records(c.Req.Context(), offset, limit, id, filter)
+	if err != nil {
+		log.Println("Failed to list flow log record(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["FlowRecords"] = records
+	c.Data["Filter"] = filter
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"records": records,
+			"total":   total,
+			"pages":   pages,
+		})
+		return
+	}
+	c.HTML(200, "flowrecords")
+}
+
+func (v *FlowLogView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "flow_logs", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = flowLogAdmin.Delete(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to delete flow log", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "flowlogs",
+	})
+	return
+}
+
+func (v *FlowLogView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	ctx := c.Req.Context()
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, gateways, err := gatewayAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, instances, err := instanceAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Subnets"] = subnets
+	c.Data["Gateways"] = gateways
+	c.Data["Instances"] = instances
+	c.HTML(200, "flowlogs_new")
+}
+
+func (v *FlowLogView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../flowlogs"
+	name := c.QueryTrim("name")
+	resourceType := c.QueryTrim("type")
+	resourceID := c.QueryInt64(resourceType)
+	action := c.QueryTrim("action")
+	table, ok := flowLogTables[resourceType]
+	if !ok {
+		c.Data["ErrorMsg"] = "Invalid resource type"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, _ = memberShip.CheckOwner(model.Writer, table, resourceID)
+	if !permit {
+		log.Println("Not authorized to access the resource")
+		c.Data["ErrorMsg"] = "Not authorized to access the resource"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	flowLog, err := flowLogAdmin.Create(c.Req.Context(), name, resourceType, resourceID, action)
+	if err != nil {
+		log.Println("Failed to create flow log", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, flowLog)
+		return
+	}
+	c.Redirect(redirectTo)
+}
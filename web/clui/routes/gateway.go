@@ -36,6 +36,7 @@ type SubnetIface struct {
 	Address string         `json:"ip_address"`
 	Vni     int64          `json:"vni"`
 	Routes  []*StaticRoute `json:"routes,omitempty"`
+	Acl     *SubnetAcl     `json:"acl,omitempty"`
 }
 
 type GatewayAdmin struct{}
@@ -136,12 +137,17 @@ func (a *GatewayAdmin) Create(ctx context.Context, name, stype string, pubID, pr
 				log.Println("DB failed to set gateway, %v", err)
 				return
 			}
-			routes := []*StaticRoute{}
-			err = json.Unmarshal([]byte(subnet.Routes), &routes)
+			var routes []*StaticRoute
+			routes, err = getSubnetRoutes(gateway.ID, subnet)
 			if err != nil {
-				log.Println("Failed to unmarshal routes", err)
+				log.Println("Failed to get subnet routes", err)
 			}
-			intIfaces = append(intIfaces, &SubnetIface{Address: subnet.Gateway, Vni: subnet.Vlan, Routes: routes})
+			var subnetAcl *SubnetAcl
+			subnetAcl, err = getSubnetAcl(subnet)
+			if err != nil {
+				log.Println("Failed to get subnet acl", err)
+			}
+			intIfaces = append(intIfaces, &SubnetIface{Address: subnet.Gateway, Vni: subnet.Vlan, Routes: routes, Acl: subnetAcl})
 		}
 	}
 	jsonData, err := json.Marshal(intIfaces)
@@ -241,12 +247,12 @@ func (a *GatewayAdmin) Update(ctx context.Context, id int64, name string, pubID,
 				log.Println("%v", err)
 				continue
 			}
-			control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
-			if gateway.Hyper == gateway.Peer {
-				control = fmt.Sprintf("inter=%d", gateway.Hyper)
+			if sub.NatGatewayID > 0 {
+				err = fmt.Errorf("Subnet is attached to a nat gateway")
+				log.Println("%v", err)
+				continue
 			}
-			command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_gw_route.sh '%d' '%s' '%d' 'soft' <<EOF\n%s\nEOF", gateway.ID, sub.Gateway, sub.Vlan, sub.Routes)
-			err = hyperExecute(ctx, control, command)
+			err = setRouting(ctx, gateway.ID, sub, false)
 			if err != nil {
 				log.Println("Set gateway failed")
 				continue
@@ -258,6 +264,11 @@ func (a *GatewayAdmin) Update(ctx context.Context, id int64, name string, pubID,
 			}
 		}
 	}
+	err = peeringAdmin.Refresh(ctx, gateway.ID)
+	if err != nil {
+		log.Println("Failed to refresh gateway peerings", err)
+		return
+	}
 	return
 }
 
@@ -292,6 +303,28 @@ func (a *GatewayAdmin) Delete(ctx context.Context, id int64) (err error) {
 		log.Println("There are floating ips")
 		return
 	}
+	count = 0
+	err = db.Model(&model.GatewayPeering{}).Where("gateway_id = ? or peer_gateway_id = ?", id, id).Where("status != 'rejected'").Count(&count).Error
+	if err != nil {
+		log.Println("Failed to count gateway peering")
+		return
+	}
+	if count > 0 {
+		log.Println("There are gateway peerings")
+		err = fmt.Errorf("Gateway has peerings")
+		return
+	}
+	count = 0
+	err = db.Model(&model.VpnService{}).Where("gateway_id = ?", id).Count(&count).Error
+	if err != nil {
+		log.Println("Failed to count vpn service")
+		return
+	}
+	if count > 0 {
+		log.Println("There are vpn services")
+		err = fmt.Errorf("Gateway has vpn services")
+		return
+	}
 	gateway := &model.Gateway{Model: model.Model{ID: id}}
 	if err = db.Set("gorm:auto_preload", true).Take(gateway).Error; err != nil {
 		log.Println("Failed to query gateway", err)
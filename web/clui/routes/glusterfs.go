@@ -41,12 +41,12 @@ func (a *GlusterfsAdmin) createSecgroup(ctx context.Context, name, cidr string,
 		log.Println("Failed to create security group with default rules", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 1, 65535)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 1, 65535)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 1, 65535)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 1, 65535)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
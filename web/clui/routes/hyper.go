@@ -87,8 +87,15 @@ func (v *HyperView) List(c *macaron.Context, store session.Store) {
 		c.HTML(500, "500")
 		return
 	}
+	zones := []*model.Zone{}
+	if err = DB().Find(&zones).Error; err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
 	pages := GetPages(total, limit)
 	c.Data["Hypers"] = hypers
+	c.Data["Zones"] = zones
 	c.Data["Total"] = total
 	c.Data["Pages"] = pages
 	c.Data["Query"] = query
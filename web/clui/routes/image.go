@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"strconv"
 
 	"github.com/IBM/cloudland/web/clui/model"
@@ -28,15 +29,51 @@ var (
 type ImageAdmin struct{}
 type ImageView struct{}
 
-func (a *ImageAdmin) Create(ctx context.Context, osVersion, diskType, virtType, userName, name, url, format, architecture string, instID int64, isLB bool) (image *model.Image, err error) {
+// validateImageFormat checks a declared image format, an empty format is detected on import
+func validateImageFormat(format string) (err error) {
+	switch format {
+	case "", "qcow2", "raw", "vmdk", "vhd", "iso":
+	default:
+		err = fmt.Errorf("Unsupported image format %s", format)
+	}
+	return
+}
+
+// imageConvertFormat returns the format an image is converted to on import, empty when it is kept as is
+func imageConvertFormat(image *model.Image) string {
+	if !image.Convert {
+		return ""
+	}
+	if image.VirtType == "zvm" {
+		return "raw"
+	}
+	return "qcow2"
+}
+
+func (a *ImageAdmin) Create(ctx context.Context, osVersion, diskType, virtType, userName, name, url, format, architecture, visibility string, instID int64, isLB, convert bool) (image *model.Image, err error) {
 	memberShip := GetMemberShip(ctx)
 	db := DB()
-	image = &model.Image{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, OsVersion: osVersion, DiskType: diskType, VirtType: virtType, UserName: userName, Name: name, OSCode: name, Format: format, Status: "creating", Architecture: architecture, OpenShiftLB: isLB}
+	if err = validateImageFormat(format); err != nil {
+		return
+	}
+	if visibility == "" {
+		visibility = "private"
+	}
+	if err = validateImageVisibility(memberShip, visibility); err != nil {
+		return
+	}
+	image = &model.Image{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, OsVersion: osVersion, DiskType: diskType, VirtType: virtType, UserName: userName, Name: name, OSCode: name, Format: format, Status: "creating", Architecture: architecture, OpenShiftLB: isLB, Convert: convert, Visibility: visibility}
+	if url == "" && instID == 0 {
+		// data is uploaded later through the image file api
+		image.Status = "queued"
+	}
 	err = db.Create(image).Error
 	if err != nil {
 		log.Println("DB create image failed, %v", err)
 	}
-	if instID > 0 {
+	if image.Status == "queued" {
+		return
+	} else if instID > 0 {
 		instance := &model.Instance{Model: model.Model{ID: instID}}
 		err = db.Take(instance).Error
 		if err != nil {
@@ -52,7 +89,7 @@ func (a *ImageAdmin) Create(ctx context.Context, osVersion, diskType, virtType,
 		}
 	} else {
 		control := "inter=0"
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_image.sh '%d' '%s' '%s'", image.ID, url, virtType)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_image.sh '%d' '%s' '%s' '%s' '%s'", image.ID, url, virtType, format, imageConvertFormat(image))
 		err = hyperExecute(ctx, control, command)
 		if err != nil {
 			log.Println("Create image command execution failed", err)
@@ -89,10 +126,46 @@ func (a *ImageAdmin) Delete(ctx context.Context, id int64) (err error) {
 	if err = db.Delete(&model.Image{Model: model.Model{ID: id}}).Error; err != nil {
 		return
 	}
+	if err = db.Where("image_id = ?", id).Delete(&model.ImageMember{}).Error; err != nil {
+		log.Println("Failed to delete image members", err)
+		return
+	}
+	if err = imageCacheAdmin.EvictImage(ctx, db, image); err != nil {
+		return
+	}
+	if err = os.Remove(imageUploadPath(id)); err != nil && !os.IsNotExist(err) {
+		log.Println("Failed to remove staged image upload", err)
+	}
+	err = nil
+	return
+}
+
+func (a *ImageAdmin) Update(ctx context.Context, id int64, visibility string) (image *model.Image, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if err = validateImageVisibility(memberShip, visibility); err != nil {
+		return
+	}
+	image = &model.Image{Model: model.Model{ID: id}}
+	if err = db.Take(image).Error; err != nil {
+		log.Println("Image query failed", err)
+		return
+	}
+	if image.Visibility == "public" && visibility != "public" && !isSystemAdmin(memberShip) {
+		err = fmt.Errorf("Only administrators can change a public image")
+		return
+	}
+	image.Visibility = visibility
+	if err = db.Model(image).Update("visibility", visibility).Error; err != nil {
+		log.Println("Failed to update image", err)
+		return
+	}
 	return
 }
 
-func (a *ImageAdmin) List(offset, limit int64, order, query string) (total int64, images []*model.Image, err error) {
+// List returns images visible to the org of the membership, see imageVisibleWhere for the visibility filter
+func (a *ImageAdmin) List(ctx context.Context, offset, limit int64, order, query, visibility string) (total int64, images []*model.Image, err error) {
+	memberShip := GetMemberShip(ctx)
 	db := DB()
 	if limit == 0 {
 		limit = 16
@@ -105,14 +178,23 @@ func (a *ImageAdmin) List(offset, limit int64, order, query string) (total int64
 	if query != "" {
 		query = fmt.Sprintf("name like '%%%s%%'", query)
 	}
+	where, err := imageVisibleWhere(memberShip, visibility)
+	if err != nil {
+		return
+	}
 	images = []*model.Image{}
-	if err = db.Model(&model.Image{}).Where(query).Count(&total).Error; err != nil {
+	if err = db.Model(&model.Image{}).Where(where).Where(query).Count(&total).Error; err != nil {
 		return
 	}
 	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
-	if err = db.Where(query).Find(&images).Error; err != nil {
+	if err = db.Preload("Members", "member_id = ?", memberShip.OrgID).Where(where).Where(query).Find(&images).Error; err != nil {
 		return
 	}
+	for _, image := range images {
+		if image.Visibility == "shared" && image.Owner != memberShip.OrgID && len(image.Members) > 0 {
+			image.MemberStatus = image.Members[0].Status
+		}
+	}
 
 	return
 }
@@ -136,7 +218,8 @@ func (v *ImageView) List(c *macaron.Context, store session.Store) {
 		order = "-created_at"
 	}
 	query := c.QueryTrim("q")
-	total, images, err := imageAdmin.List(offset, limit, order, query)
+	visibility := c.QueryTrim("visibility")
+	total, images, err := imageAdmin.List(c.Req.Context(), offset, limit, order, query, visibility)
 	if err != nil {
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
 			c.JSON(500, map[string]interface{}{
@@ -153,12 +236,14 @@ func (v *ImageView) List(c *macaron.Context, store session.Store) {
 	c.Data["Total"] = total
 	c.Data["Pages"] = pages
 	c.Data["Query"] = query
+	c.Data["Visibility"] = visibility
 	if c.Req.Header.Get("X-Json-Format") == "yes" {
 		c.JSON(200, map[string]interface{}{
-			"images": images,
-			"total":  total,
-			"pages":  pages,
-			"query":  query,
+			"images":     images,
+			"total":      total,
+			"pages":      pages,
+			"query":      query,
+			"visibility": visibility,
 		})
 		return
 	}
@@ -198,6 +283,73 @@ func (v *ImageView) Delete(c *macaron.Context, store session.Store) (err error)
 	return
 }
 
+func (v *ImageView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	imageID := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "images", imageID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	image := &model.Image{Model: model.Model{ID: imageID}}
+	if err = DB().Take(image).Error; err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	members, err := imageMemberAdmin.List(c.Req.Context(), imageID)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	if memberShip.CheckPermission(model.Admin) {
+		caches, err := imageCacheAdmin.List(imageID)
+		if err != nil {
+			c.Data["ErrorMsg"] = err.Error()
+			c.HTML(500, "500")
+			return
+		}
+		zones := []*model.Zone{}
+		if err = DB().Find(&zones).Error; err != nil {
+			c.Data["ErrorMsg"] = err.Error()
+			c.HTML(500, "500")
+			return
+		}
+		c.Data["Caches"] = caches
+		c.Data["Zones"] = zones
+	}
+	c.Data["Image"] = image
+	c.Data["Members"] = members
+	c.HTML(200, "images_patch")
+}
+
+func (v *ImageView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../images"
+	imageID := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "images", imageID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	image, err := imageAdmin.Update(c.Req.Context(), imageID, c.QueryTrim("visibility"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, image)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
 func (v *ImageView) New(c *macaron.Context, store session.Store) {
 	memberShip := GetMemberShip(c.Req.Context())
 	permit := memberShip.CheckPermission(model.Writer)
@@ -251,7 +403,9 @@ func (v *ImageView) Create(c *macaron.Context, store session.Store) {
 		architecture = "s390x"
 	}
 
-	image, err := imageAdmin.Create(c.Req.Context(), osVersion, diskType, virtType, userName, name, url, format, architecture, instance, isLB)
+	convert := c.QueryTrim("convert") == "yes" || c.QueryTrim("convert") == "on"
+	visibility := c.QueryTrim("visibility")
+	image, err := imageAdmin.Create(c.Req.Context(), osVersion, diskType, virtType, userName, name, url, format, architecture, visibility, instance, isLB, convert)
 	if err != nil {
 		log.Println("Create instance failed", err)
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
@@ -0,0 +1,297 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	imageCacheAdmin = &ImageCacheAdmin{}
+	imageCacheView  = &ImageCacheView{}
+)
+
+type ImageCacheAdmin struct{}
+type ImageCacheView struct{}
+
+// cachedHyperGroup returns the select control group of the active hypervisors having an image cached
+// which still fit count instances of the requested resources, it is empty when there is none
+func cachedHyperGroup(imageID, zoneID int64, hypers []*model.Hyper, cached map[int32]bool, cpu, memory, disk, count int64) string {
+	hostIDs := []string{}
+	for _, h := range hypers {
+		if h.Status != 1 || !cached[h.Hostid] || h.Resource == nil {
+			continue
+		}
+		if h.Resource.Cpu < cpu*count || h.Resource.Memory < memory*count || h.Resource.Disk < disk*count {
+			continue
+		}
+		hostIDs = append(hostIDs, strconv.Itoa(int(h.Hostid)))
+	}
+	if len(hostIDs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("group-zone-%d-image-%d:%s", zoneID, imageID, strings.Join(hostIDs, ","))
+}
+
+// zoneHypers returns the hypervisors of a zone with their resources, zoneID 0 means all zones and an empty virtType all types,
+// the image host serves the repository so it never holds a cache
+func zoneHypers(zoneID int64, virtType string) (hypers []*model.Hyper, err error) {
+	db := DB()
+	where := "hostid > 0"
+	if zoneID > 0 {
+		where = fmt.Sprintf("%s and zone_id = %d", where, zoneID)
+	}
+	if virtType != "" {
+		where = fmt.Sprintf("%s and virt_type = '%s'", where, virtType)
+	}
+	hypers = []*model.Hyper{}
+	if err = db.Where(where).Find(&hypers).Error; err != nil {
+		log.Println("Hypers query failed", err)
+		return
+	}
+	for _, hyper := range hypers {
+		hyper.Resource = &model.Resource{}
+		if err = db.Where("hostid = ?", hyper.Hostid).Take(hyper.Resource).Error; err != nil {
+			hyper.Resource = nil
+		}
+	}
+	err = nil
+	return
+}
+
+// HyperGroup returns the group of hypervisors in a zone to prefer when launching the count-th instance of an image,
+// the resources of every earlier instance are counted as the reported resources lag behind the launches
+func (a *ImageCacheAdmin) HyperGroup(image *model.Image, zoneID int64, flavor *model.Flavor, count int) (hyperGroup string) {
+	caches := []*model.ImageCache{}
+	if err := DB().Where("image_id = ?", image.ID).Find(&caches).Error; err != nil {
+		log.Println("Image caches query failed", err)
+		return
+	}
+	if len(caches) == 0 {
+		return
+	}
+	cached := make(map[int32]bool)
+	for _, cache := range caches {
+		cached[cache.Hostid] = true
+	}
+	hypers, err := zoneHypers(zoneID, image.VirtType)
+	if err != nil {
+		return
+	}
+	cpu := int64(flavor.Cpu)
+	memory := int64(flavor.Memory) * 1024
+	disk := int64(flavor.Disk+flavor.Swap+flavor.Ephemeral) * 1024 * 1024
+	hyperGroup = cachedHyperGroup(image.ID, zoneID, hypers, cached, cpu, memory, disk, int64(count))
+	return
+}
+
+// Seed pre-fetches an image to the active hypervisors of a zone which do not have it cached yet
+func (a *ImageCacheAdmin) Seed(ctx context.Context, imageID, zoneID int64) (count int, err error) {
+	db := DB()
+	image := &model.Image{Model: model.Model{ID: imageID}}
+	if err = db.Take(image).Error; err != nil {
+		log.Println("Image query failed", err)
+		return
+	}
+	if image.Status != "available" {
+		err = fmt.Errorf("Image is %s, it can not be cached", image.Status)
+		return
+	}
+	if image.VirtType == "zvm" {
+		err = fmt.Errorf("Images of z/VM are cached by the z/VM service")
+		return
+	}
+	hypers, err := zoneHypers(zoneID, image.VirtType)
+	if err != nil {
+		return
+	}
+	caches := []*model.ImageCache{}
+	if err = db.Where("image_id = ?", imageID).Find(&caches).Error; err != nil {
+		log.Println("Image caches query failed", err)
+		return
+	}
+	cached := make(map[int32]bool)
+	for _, cache := range caches {
+		cached[cache.Hostid] = true
+	}
+	hostIDs := []string{}
+	for _, h := range hypers {
+		if h.Status != 1 || cached[h.Hostid] {
+			continue
+		}
+		hostIDs = append(hostIDs, strconv.Itoa(int(h.Hostid)))
+	}
+	count = len(hostIDs)
+	if count == 0 {
+		return
+	}
+	control := fmt.Sprintf("toall=group-image-%d:%s", image.ID, strings.Join(hostIDs, ","))
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/cache_image.sh '%d' 'image-%d.%s'", image.ID, image.ID, image.Format)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Cache image command execution failed", err)
+		return
+	}
+	return
+}
+
+// evictCaches removes images cached on a hypervisor except those an instance on it was launched from,
+// it returns the ids of the evicted caches and the number of files removed
+func evictCaches(ctx context.Context, db *gorm.DB, hostid int32, caches []*model.ImageCache) (evicted []int64, count int, err error) {
+	names := []string{}
+	for _, cache := range caches {
+		inUse := 0
+		if err = db.Model(&model.Instance{}).Where("hyper = ? and image_id = ?", hostid, cache.ImageID).Count(&inUse).Error; err != nil {
+			log.Println("Failed to count instances", err)
+			return
+		}
+		if inUse > 0 {
+			continue
+		}
+		if cache.Image != nil {
+			names = append(names, fmt.Sprintf("'image-%d.%s'", cache.ImageID, cache.Image.Format))
+		}
+		evicted = append(evicted, cache.ID)
+	}
+	if len(names) > 0 {
+		control := fmt.Sprintf("inter=%d", hostid)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/evict_image.sh %s", strings.Join(names, " "))
+		if err = hyperExecute(ctx, control, command); err != nil {
+			log.Println("Evict image command execution failed", err)
+			return
+		}
+	}
+	if len(evicted) > 0 {
+		if err = db.Where(evicted).Delete(&model.ImageCache{}).Error; err != nil {
+			log.Println("Failed to delete image caches", err)
+			return
+		}
+	}
+	count = len(names)
+	return
+}
+
+// Evict removes images cached on the hypervisors of a zone which have been idle longer than idle
+// and no instance on the same hypervisor was launched from, copies of deleted images are evicted as well
+func (a *ImageCacheAdmin) Evict(ctx context.Context, zoneID int64, idle time.Duration) (count int, err error) {
+	db := DB()
+	hypers, err := zoneHypers(zoneID, "")
+	if err != nil {
+		return
+	}
+	for _, h := range hypers {
+		caches := []*model.ImageCache{}
+		if err = db.Preload("Image", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped()
+		}).Where("hostid = ? and last_used < ?", h.Hostid, time.Now().Add(-idle)).Find(&caches).Error; err != nil {
+			log.Println("Image caches query failed", err)
+			return
+		}
+		removed := 0
+		if _, removed, err = evictCaches(ctx, db, h.Hostid, caches); err != nil {
+			return
+		}
+		count += removed
+	}
+	return
+}
+
+// EvictImage removes the cached copies of an image being deleted, copies still backing instances are left to Evict
+func (a *ImageCacheAdmin) EvictImage(ctx context.Context, db *gorm.DB, image *model.Image) (err error) {
+	caches := []*model.ImageCache{}
+	if err = db.Where("image_id = ?", image.ID).Find(&caches).Error; err != nil {
+		log.Println("Image caches query failed", err)
+		return
+	}
+	hostCaches := make(map[int32][]*model.ImageCache)
+	for _, cache := range caches {
+		cache.Image = image
+		hostCaches[cache.Hostid] = append(hostCaches[cache.Hostid], cache)
+	}
+	for hostid, caches := range hostCaches {
+		if _, _, err = evictCaches(ctx, db, hostid, caches); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (a *ImageCacheAdmin) List(imageID int64) (caches []*model.ImageCache, err error) {
+	caches = []*model.ImageCache{}
+	if err = DB().Where("image_id = ?", imageID).Order("hostid").Find(&caches).Error; err != nil {
+		log.Println("Image caches query failed", err)
+		return
+	}
+	return
+}
+
+func (v *ImageCacheView) Seed(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../images/" + c.Params("id")
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	count, err := imageCacheAdmin.Seed(c.Req.Context(), c.ParamsInt64("id"), c.QueryInt64("zone"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"hypers": count,
+		})
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *ImageCacheView) Evict(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../hypers"
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	idleDays := c.QueryInt64("idle")
+	if idleDays < 0 {
+		c.Data["ErrorMsg"] = "Idle days must not be negative"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	count, err := imageCacheAdmin.Evict(c.Req.Context(), c.QueryInt64("zone"), time.Duration(idleDays)*24*time.Hour)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"evicted": count,
+		})
+		return
+	}
+	c.Redirect(redirectTo)
+}
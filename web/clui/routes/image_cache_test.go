@@ -0,0 +1,83 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+)
+
+func TestCachedHyperGroup(t *testing.T) {
+	hypers := []*model.Hyper{
+		{Hostid: 1, Status: 1, Resource: &model.Resource{Cpu: 8, Memory: 8192, Disk: 100}},
+		{Hostid: 2, Status: 0, Resource: &model.Resource{Cpu: 8, Memory: 8192, Disk: 100}},
+		{Hostid: 3, Status: 1, Resource: &model.Resource{Cpu: 2, Memory: 8192, Disk: 100}},
+		{Hostid: 4, Status: 1, Resource: &model.Resource{Cpu: 8, Memory: 8192, Disk: 100}},
+		{Hostid: 5, Status: 1},
+	}
+	cached := map[int32]bool{1: true, 2: true, 3: true, 5: true}
+	group := cachedHyperGroup(7, 1, hypers, cached, 2, 1024, 10, 1)
+	if group != "group-zone-1-image-7:1,3" {
+		t.Errorf("unexpected group %q", group)
+	}
+	group = cachedHyperGroup(7, 1, hypers, cached, 2, 1024, 10, 2)
+	if group != "group-zone-1-image-7:1" {
+		t.Errorf("unexpected group %q for the second instance", group)
+	}
+	if group = cachedHyperGroup(7, 1, hypers, cached, 2, 1024, 10, 5); group != "" {
+		t.Errorf("unexpected group %q when no cached host fits", group)
+	}
+}
+
+func TestImageCacheHyperGroup(t *testing.T) {
+	db := dbs.DB()
+	image := &model.Image{Name: "cache-test", Status: "available", VirtType: "xkvm", Format: "qcow2"}
+	if err := db.Create(image).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.Unscoped().Delete(image)
+	hostids := []int32{9001, 9002, 9003}
+	virtTypes := []string{"xkvm", "zkvm", "xkvm"}
+	defer db.Where("hostid in (?)", hostids).Delete(&model.Hyper{})
+	defer db.Where("hostid in (?)", hostids).Delete(&model.Resource{})
+	defer db.Where("image_id = ?", image.ID).Delete(&model.ImageCache{})
+	for i, hostid := range hostids {
+		hyper := &model.Hyper{Hostid: hostid, Status: 1, VirtType: virtTypes[i], ZoneID: 9001}
+		if err := db.Create(hyper).Error; err != nil {
+			t.Fatal(err)
+		}
+		resource := &model.Resource{Hostid: hostid, Cpu: 8, Memory: 8192 * 1024, Disk: 100 * 1024 * 1024}
+		if err := db.Create(resource).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&model.ImageCache{ImageID: image.ID, Hostid: hostid}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the zkvm host has the image cached but can not run it
+	flavor := &model.Flavor{Cpu: 1, Memory: 512, Disk: 1}
+	group := imageCacheAdmin.HyperGroup(image, 9001, flavor, 1)
+	if group != fmt.Sprintf("group-zone-9001-image-%d:9001,9003", image.ID) {
+		t.Errorf("unexpected group %q", group)
+	}
+	if group = imageCacheAdmin.HyperGroup(image, 9002, flavor, 1); group != "" {
+		t.Errorf("unexpected group %q in a zone without hypervisors", group)
+	}
+	count, err := imageCacheAdmin.Seed(context.Background(), image.ID, 9001)
+	if err != nil || count != 0 {
+		t.Errorf("nothing should be seeded when every xkvm host has the image, count %d, err %v", count, err)
+	}
+	db.Model(image).Update("status", "creating")
+	if _, err = imageCacheAdmin.Seed(context.Background(), image.ID, 9001); err == nil {
+		t.Error("image not available should not be seeded")
+	}
+}
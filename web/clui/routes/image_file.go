@@ -0,0 +1,414 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-macaron/session"
+	"github.com/spf13/viper"
+	macaron "gopkg.in/macaron.v1"
+)
+
+const imageFetchExpire = time.Hour * 2
+
+// imageUploads holds the ids of images with a chunk being written
+var imageUploads sync.Map
+
+// parseContentRange parses a chunk header like "bytes 0-1023/4096", total is -1 when given as "*"
+func parseContentRange(header string) (start, end, total int64, err error) {
+	total = -1
+	if !strings.HasPrefix(header, "bytes ") {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	items := strings.Split(strings.TrimPrefix(header, "bytes "), "/")
+	if len(items) != 2 {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	bounds := strings.Split(items[0], "-")
+	if len(bounds) != 2 {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	if items[1] != "*" {
+		if total, err = strconv.ParseInt(items[1], 10, 64); err != nil {
+			err = fmt.Errorf("Invalid content range %s", header)
+			return
+		}
+	}
+	if start < 0 || end < start || (total >= 0 && end >= total) {
+		err = fmt.Errorf("Invalid content range %s", header)
+		return
+	}
+	return
+}
+
+func imageUploadPath(id int64) string {
+	return filepath.Join(viper.GetString("image.upload_dir"), fmt.Sprintf("image-%d.part", id))
+}
+
+// imageChecksums returns the md5 and sha512 hex digests and the size of a file
+func imageChecksums(path string) (checksum, hashValue string, size int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("Failed to open image file", err)
+		return
+	}
+	defer file.Close()
+	md5Hash := md5.New()
+	sha512Hash := sha512.New()
+	size, err = io.Copy(io.MultiWriter(md5Hash, sha512Hash), file)
+	if err != nil {
+		log.Println("Failed to read image file", err)
+		return
+	}
+	checksum = hex.EncodeToString(md5Hash.Sum(nil))
+	hashValue = hex.EncodeToString(sha512Hash.Sum(nil))
+	return
+}
+
+// imageFetchToken signs a short lived token allowing the image host to fetch a staged upload without a session
+func imageFetchToken(id int64) (signed string, err error) {
+	claims := &jwt.StandardClaims{
+		ExpiresAt: time.Now().Add(imageFetchExpire).Unix(),
+		Issuer:    "Cloudland",
+		Subject:   fmt.Sprintf("image-%d", id),
+	}
+	signed, err = jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(privateKey())
+	return
+}
+
+func checkImageFetchToken(id int64, tokenString string) (err error) {
+	claims := &jwt.StandardClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+			return nil, fmt.Errorf("Unexpected signing method %v", token.Header["alg"])
+		}
+		return publicKey(), nil
+	})
+	if err != nil {
+		return
+	}
+	if !token.Valid || claims.Subject != fmt.Sprintf("image-%d", id) {
+		err = fmt.Errorf("Invalid token")
+		return
+	}
+	return
+}
+
+// Upload writes a chunk of image data at start, end is -1 to read the body to the end and total is -1 while the full size is unknown.
+// Chunks must be sent in order, offset tells where the next chunk starts so that an interrupted upload can be resumed.
+func (a *ImageAdmin) Upload(ctx context.Context, id int64, body io.Reader, start, end, total int64) (image *model.Image, offset int64, err error) {
+	db := DB()
+	image = &model.Image{Model: model.Model{ID: id}}
+	if err = db.Take(image).Error; err != nil {
+		log.Println("DB failed to query image", err)
+		return
+	}
+	if _, busy := imageUploads.LoadOrStore(image.ID, true); busy {
+		err = fmt.Errorf("Another chunk of the image is being uploaded")
+		return
+	}
+	defer imageUploads.Delete(image.ID)
+	// the previous chunk may have finished the upload in the meantime
+	if err = db.Take(image).Error; err != nil {
+		log.Println("DB failed to query image", err)
+		return
+	}
+	if image.Status != "queued" && image.Status != "uploading" {
+		err = fmt.Errorf("Image is %s, upload is not allowed", image.Status)
+		return
+	}
+	path := imageUploadPath(image.ID)
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Println("Failed to create upload directory", err)
+		return
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Println("Failed to open upload file", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Println("Failed to stat upload file", err)
+		return
+	}
+	offset = info.Size()
+	if start != offset {
+		err = fmt.Errorf("Upload must continue at offset %d", offset)
+		return
+	}
+	if image.Status == "queued" {
+		image.Status = "uploading"
+		if err = db.Model(image).Update("status", image.Status).Error; err != nil {
+			log.Println("DB failed to update image", err)
+			return
+		}
+	}
+	if _, err = file.Seek(start, io.SeekStart); err != nil {
+		log.Println("Failed to seek upload file", err)
+		return
+	}
+	reader := body
+	if end >= 0 {
+		reader = io.LimitReader(body, end-start+1)
+	}
+	written, err := io.Copy(file, reader)
+	offset += written
+	if err != nil {
+		log.Println("Failed to write upload file", err)
+		return
+	}
+	if end >= 0 && offset != end+1 {
+		err = fmt.Errorf("Chunk is incomplete, upload must continue at offset %d", offset)
+		return
+	}
+	if (total >= 0 && offset == total) || (end < 0 && total < 0) {
+		if err = a.importUpload(ctx, image); err != nil && image.Status == "queued" {
+			offset = 0
+		}
+	}
+	return
+}
+
+// importUpload records the checksums of a finished upload and lets the image host fetch it
+func (a *ImageAdmin) importUpload(ctx context.Context, image *model.Image) (err error) {
+	db := DB()
+	path := imageUploadPath(image.ID)
+	image.Checksum, image.OsHashValue, image.Size, err = imageChecksums(path)
+	if err != nil {
+		return
+	}
+	if image.Size == 0 {
+		err = fmt.Errorf("Image data is empty")
+		return
+	}
+	image.OsHashAlgo = "sha512"
+	image.Status = "importing"
+	defer func() {
+		if err != nil {
+			// the image host never got the data, queue the image again so that the upload can be restarted
+			image.Status = "queued"
+			if rerr := db.Model(image).Update("status", image.Status).Error; rerr != nil {
+				log.Println("DB failed to update image", rerr)
+			}
+			if rerr := os.Remove(path); rerr != nil && !os.IsNotExist(rerr) {
+				log.Println("Failed to remove staged image upload", rerr)
+			}
+		}
+	}()
+	if err = db.Model(image).Updates(map[string]interface{}{
+		"checksum":      image.Checksum,
+		"os_hash_algo":  image.OsHashAlgo,
+		"os_hash_value": image.OsHashValue,
+		"size":          image.Size,
+		"status":        image.Status}).Error; err != nil {
+		log.Println("DB failed to update image", err)
+		return
+	}
+	token, err := imageFetchToken(image.ID)
+	if err != nil {
+		log.Println("Failed to sign image fetch token", err)
+		return
+	}
+	url := fmt.Sprintf("%s/imagefiles/%d/%s", viper.GetString("api.endpoint"), image.ID, token)
+	control := "inter=0"
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/import_image.sh '%d' '%s' '%s' '%s' '%s' '%s'", image.ID, url, image.Checksum, image.VirtType, image.Format, imageConvertFormat(image))
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Import image command execution failed", err)
+		return
+	}
+	return
+}
+
+func (v *ImageView) Upload(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "images", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.JSON(http.StatusUnauthorized, map[string]interface{}{
+			"error": "Not authorized for this operation",
+		})
+		return
+	}
+	var start, end, total int64 = 0, -1, -1
+	if header := c.Req.Header.Get("Content-Range"); header != "" {
+		var err error
+		start, end, total, err = parseContentRange(header)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	image, offset, err := imageAdmin.Upload(c.Req.Context(), id, c.Req.Request.Body, start, end, total)
+	c.Resp.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		log.Println("Upload image failed", err)
+		code := http.StatusBadRequest
+		if image != nil && (image.Status == "queued" || image.Status == "uploading") {
+			code = http.StatusConflict
+		}
+		c.JSON(code, map[string]interface{}{
+			"error":  err.Error(),
+			"offset": offset,
+		})
+		return
+	}
+	if image.Status == "uploading" {
+		c.JSON(http.StatusAccepted, map[string]interface{}{
+			"offset": offset,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, image)
+}
+
+// UploadStatus reports how much of an image has been uploaded so that a client can resume
+func (v *ImageView) UploadStatus(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "images", id)
+	if !permit {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+	var offset int64
+	if info, err := os.Stat(imageUploadPath(id)); err == nil {
+		offset = info.Size()
+	}
+	c.Resp.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Status(http.StatusOK)
+}
+
+// Download opens an available image in the image repository, rng is passed through so that downloads can be resumed
+func (a *ImageAdmin) Download(ctx context.Context, id int64, method, rng string) (image *model.Image, resp *http.Response, err error) {
+	image = &model.Image{Model: model.Model{ID: id}}
+	if err = DB().Take(image).Error; err != nil {
+		log.Println("DB failed to query image", err)
+		return
+	}
+	if image.Status != "available" {
+		err = fmt.Errorf("Image is %s, download is not allowed", image.Status)
+		return
+	}
+	if err = imageMemberAdmin.CheckImageAccess(ctx, image); err != nil {
+		return
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/image-%d.%s", viper.GetString("image.repo"), image.ID, image.Format), nil)
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		log.Println("Failed to fetch image from repository", err)
+		return
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		err = fmt.Errorf("Image repository returned %s", resp.Status)
+		return
+	}
+	return
+}
+
+// writeImageData relays an image repository response to the client with the image checksum
+func writeImageData(w http.ResponseWriter, image *model.Image, resp *http.Response) {
+	defer resp.Body.Close()
+	for _, key := range []string{"Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified"} {
+		if value := resp.Header.Get(key); value != "" {
+			w.Header().Set(key, value)
+		}
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=image-%d.%s", image.ID, image.Format))
+	if image.Checksum != "" {
+		w.Header().Set("Content-MD5", image.Checksum)
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Println("Failed to stream image", err)
+	}
+}
+
+func (v *ImageView) Download(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	image, resp, err := imageAdmin.Download(c.Req.Context(), c.ParamsInt64("id"), c.Req.Method, c.Req.Header.Get("Range"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	writeImageData(c.Resp, image, resp)
+}
+
+// Fetch serves a staged upload to the image host, it is authorized by the token in the url instead of a session
+func (v *ImageView) Fetch(c *macaron.Context) {
+	id := c.ParamsInt64("id")
+	if err := checkImageFetchToken(id, c.Params("token")); err != nil {
+		log.Println("Invalid image fetch token", err)
+		code := http.StatusUnauthorized
+		c.Error(code, http.StatusText(code))
+		return
+	}
+	file, err := os.Open(imageUploadPath(id))
+	if err != nil {
+		code := http.StatusNotFound
+		c.Error(code, http.StatusText(code))
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		code := http.StatusInternalServerError
+		c.Error(code, http.StatusText(code))
+		return
+	}
+	http.ServeContent(c.Resp, c.Req.Request, filepath.Base(file.Name()), info.ModTime(), file)
+}
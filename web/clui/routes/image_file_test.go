@@ -0,0 +1,59 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	valid := []struct {
+		header            string
+		start, end, total int64
+	}{
+		{"bytes 0-1023/4096", 0, 1023, 4096},
+		{"bytes 1024-4095/4096", 1024, 4095, 4096},
+		{"bytes 0-0/*", 0, 0, -1},
+	}
+	for _, tc := range valid {
+		start, end, total, err := parseContentRange(tc.header)
+		if err != nil || start != tc.start || end != tc.end || total != tc.total {
+			t.Errorf("%q parsed as %d-%d/%d, %v", tc.header, start, end, total, err)
+		}
+	}
+	for _, header := range []string{"", "0-1/2", "bytes 0-1", "bytes 5-1/10", "bytes 0-10/10", "bytes -1-3/10", "bytes a-b/c"} {
+		if _, _, _, err := parseContentRange(header); err == nil {
+			t.Errorf("%q unexpectedly accepted", header)
+		}
+	}
+}
+
+func TestImageChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "image-1.part")
+	if err = ioutil.WriteFile(path, []byte("abc"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	checksum, hashValue, size, err := imageChecksums(path)
+	if err != nil || size != 3 {
+		t.Fatalf("unexpected size %d, %v", size, err)
+	}
+	if checksum != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Errorf("unexpected md5 %s", checksum)
+	}
+	if hashValue != "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f" {
+		t.Errorf("unexpected sha512 %s", hashValue)
+	}
+}
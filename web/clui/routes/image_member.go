@@ -0,0 +1,266 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	imageMemberAdmin = &ImageMemberAdmin{}
+	imageMemberView  = &ImageMemberView{}
+)
+
+type ImageMemberAdmin struct{}
+type ImageMemberView struct{}
+
+// isSystemAdmin tells whether the membership belongs to an administrator of the admin organization
+func isSystemAdmin(memberShip *MemberShip) bool {
+	return memberShip.OrgName == "admin" && memberShip.Role == model.Admin
+}
+
+// validateImageVisibility checks the visibility an image is set to, only system administrators may publish images
+func validateImageVisibility(memberShip *MemberShip, visibility string) (err error) {
+	switch visibility {
+	case "private", "shared", "community":
+	case "public":
+		if !isSystemAdmin(memberShip) {
+			err = fmt.Errorf("Only administrators can make an image public")
+		}
+	default:
+		err = fmt.Errorf("Invalid image visibility %s", visibility)
+	}
+	return
+}
+
+// imageVisibleWhere returns the condition of images listed to an org, by default its own, public and accepted shared images,
+// community images and images shared to the org but not yet accepted are only listed when asked for by visibility
+func imageVisibleWhere(memberShip *MemberShip, visibility string) (where string, err error) {
+	admin := isSystemAdmin(memberShip)
+	sharedTo := fmt.Sprintf("id in (select image_id from image_members where member_id = %d and deleted_at is null)", memberShip.OrgID)
+	switch visibility {
+	case "":
+		if !admin {
+			accepted := fmt.Sprintf("id in (select image_id from image_members where member_id = %d and status = 'accepted' and deleted_at is null)", memberShip.OrgID)
+			where = fmt.Sprintf("owner = %d or visibility = 'public' or (visibility = 'shared' and %s)", memberShip.OrgID, accepted)
+		}
+	case "public", "community":
+		where = fmt.Sprintf("visibility = '%s'", visibility)
+	case "private":
+		where = "visibility = 'private'"
+		if !admin {
+			where = fmt.Sprintf("owner = %d and %s", memberShip.OrgID, where)
+		}
+	case "shared":
+		where = "visibility = 'shared'"
+		if !admin {
+			where = fmt.Sprintf("%s and (owner = %d or %s)", where, memberShip.OrgID, sharedTo)
+		}
+	default:
+		err = fmt.Errorf("Invalid image visibility %s", visibility)
+	}
+	return
+}
+
+// CheckImageAccess makes sure an image is visible to the org of the membership so that it can be launched,
+// like glance a member may use a shared image whatever status it has set for the membership,
+// openshift load balancer images are launched on behalf of every cluster so they are always accessible
+func (a *ImageMemberAdmin) CheckImageAccess(ctx context.Context, image *model.Image) (err error) {
+	memberShip := GetMemberShip(ctx)
+	if isSystemAdmin(memberShip) || image.Owner == memberShip.OrgID || image.OpenShiftLB {
+		return
+	}
+	switch image.Visibility {
+	case "public", "community":
+		return
+	case "shared":
+		member := &model.ImageMember{}
+		err = DB().Where("image_id = ? and member_id = ?", image.ID, memberShip.OrgID).Take(member).Error
+		if err == nil {
+			return
+		} else if !gorm.IsRecordNotFoundError(err) {
+			log.Println("Failed to query image member", err)
+			return
+		}
+	}
+	err = fmt.Errorf("Image %d is not visible to the organization", image.ID)
+	return
+}
+
+func (a *ImageMemberAdmin) Create(ctx context.Context, imageID, orgID int64) (member *model.ImageMember, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	image := &model.Image{Model: model.Model{ID: imageID}}
+	if err = db.Take(image).Error; err != nil {
+		log.Println("Image query failed", err)
+		return
+	}
+	if image.Visibility != "shared" {
+		err = fmt.Errorf("Only shared images can have members")
+		return
+	}
+	if orgID == image.Owner {
+		err = fmt.Errorf("Image is owned by the organization already")
+		return
+	}
+	org := &model.Organization{Model: model.Model{ID: orgID}}
+	if err = db.Take(org).Error; err != nil {
+		log.Println("Organization query failed", err)
+		return
+	}
+	count := 0
+	if err = db.Model(&model.ImageMember{}).Where("image_id = ? and member_id = ?", imageID, orgID).Count(&count).Error; err != nil {
+		log.Println("Failed to count image members", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Image is shared with %s already", org.Name)
+		return
+	}
+	member = &model.ImageMember{Model: model.Model{Creater: memberShip.UserID, Owner: image.Owner}, ImageID: imageID, MemberID: orgID, Status: "pending"}
+	if err = db.Create(member).Error; err != nil {
+		log.Println("DB create image member failed", err)
+		return
+	}
+	member.MemberInfo = org
+	return
+}
+
+func (a *ImageMemberAdmin) Delete(ctx context.Context, imageID, orgID int64) (err error) {
+	db := DB()
+	result := db.Where("image_id = ? and member_id = ?", imageID, orgID).Delete(&model.ImageMember{})
+	if err = result.Error; err != nil {
+		log.Println("Failed to delete image member", err)
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = fmt.Errorf("Image is not shared with the organization")
+	}
+	return
+}
+
+// Update lets the org of the membership accept or reject an image shared with it
+func (a *ImageMemberAdmin) Update(ctx context.Context, imageID int64, status string) (member *model.ImageMember, err error) {
+	memberShip := GetMemberShip(ctx)
+	switch status {
+	case "pending", "accepted", "rejected":
+	default:
+		err = fmt.Errorf("Invalid image member status %s", status)
+		return
+	}
+	db := DB()
+	member = &model.ImageMember{}
+	if err = db.Where("image_id = ? and member_id = ?", imageID, memberShip.OrgID).Take(member).Error; err != nil {
+		log.Println("Image member query failed", err)
+		err = fmt.Errorf("Image is not shared with the organization")
+		return
+	}
+	member.Status = status
+	if err = db.Model(member).Update("status", status).Error; err != nil {
+		log.Println("Failed to update image member", err)
+		return
+	}
+	return
+}
+
+func (a *ImageMemberAdmin) List(ctx context.Context, imageID int64) (members []*model.ImageMember, err error) {
+	members = []*model.ImageMember{}
+	if err = DB().Preload("MemberInfo").Where("image_id = ?", imageID).Find(&members).Error; err != nil {
+		log.Println("Failed to list image members", err)
+		return
+	}
+	return
+}
+
+func (v *ImageMemberView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../images/" + c.Params("id")
+	imageID := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "images", imageID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	org := &model.Organization{}
+	if err = DB().Where("name = ?", c.QueryTrim("org")).Take(org).Error; err != nil {
+		log.Println("Organization query failed", err)
+		c.Data["ErrorMsg"] = "No such organization"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	member, err := imageMemberAdmin.Create(c.Req.Context(), imageID, org.ID)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, member)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *ImageMemberView) Delete(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../images/" + c.Params("id")
+	imageID := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "images", imageID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	orgID, err := strconv.ParseInt(c.QueryTrim("member"), 10, 64)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if err = imageMemberAdmin.Delete(c.Req.Context(), imageID, orgID); err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+// Update accepts or rejects an image shared with the org of the session
+func (v *ImageMemberView) Update(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../../images?visibility=shared"
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	member, err := imageMemberAdmin.Update(c.Req.Context(), c.ParamsInt64("id"), c.QueryTrim("status"))
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, member)
+		return
+	}
+	c.Redirect(redirectTo)
+}
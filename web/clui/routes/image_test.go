@@ -0,0 +1,88 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestValidateImageFormat(t *testing.T) {
+	for _, format := range []string{"", "qcow2", "raw", "vmdk", "vhd", "iso"} {
+		if err := validateImageFormat(format); err != nil {
+			t.Errorf("format %q unexpectedly rejected: %v", format, err)
+		}
+	}
+	for _, format := range []string{"vpc", "QCOW2", "qcow2' ; rm"} {
+		if err := validateImageFormat(format); err == nil {
+			t.Errorf("format %q unexpectedly accepted", format)
+		}
+	}
+}
+
+func TestImageConvertFormat(t *testing.T) {
+	cases := []struct {
+		image  *model.Image
+		format string
+	}{
+		{&model.Image{VirtType: "kvm-x86_64"}, ""},
+		{&model.Image{VirtType: "kvm-x86_64", Convert: true}, "qcow2"},
+		{&model.Image{VirtType: "zvm", Convert: true}, "raw"},
+	}
+	for _, tc := range cases {
+		if format := imageConvertFormat(tc.image); format != tc.format {
+			t.Errorf("unexpected convert format %q for %+v", format, tc.image)
+		}
+	}
+}
+
+func TestValidateImageVisibility(t *testing.T) {
+	admin := &MemberShip{OrgID: 1, OrgName: "admin", Role: model.Admin}
+	user := &MemberShip{OrgID: 2, OrgName: "demo", Role: model.Admin}
+	for _, visibility := range []string{"private", "shared", "community"} {
+		if err := validateImageVisibility(user, visibility); err != nil {
+			t.Errorf("visibility %q unexpectedly rejected: %v", visibility, err)
+		}
+	}
+	if err := validateImageVisibility(admin, "public"); err != nil {
+		t.Errorf("public visibility unexpectedly rejected for admin: %v", err)
+	}
+	if err := validateImageVisibility(user, "public"); err == nil {
+		t.Errorf("public visibility unexpectedly accepted for an org admin")
+	}
+	if err := validateImageVisibility(admin, "everyone"); err == nil {
+		t.Errorf("unknown visibility unexpectedly accepted")
+	}
+}
+
+func TestImageVisibleWhere(t *testing.T) {
+	admin := &MemberShip{OrgID: 1, OrgName: "admin", Role: model.Admin}
+	user := &MemberShip{OrgID: 2, OrgName: "demo", Role: model.Writer}
+	cases := []struct {
+		memberShip *MemberShip
+		visibility string
+		where      string
+	}{
+		{admin, "", ""},
+		{admin, "shared", "visibility = 'shared'"},
+		{user, "", "owner = 2 or visibility = 'public' or (visibility = 'shared' and id in (select image_id from image_members where member_id = 2 and status = 'accepted' and deleted_at is null))"},
+		{user, "community", "visibility = 'community'"},
+		{user, "private", "owner = 2 and visibility = 'private'"},
+		{user, "shared", "visibility = 'shared' and (owner = 2 or id in (select image_id from image_members where member_id = 2 and deleted_at is null))"},
+	}
+	for _, tc := range cases {
+		where, err := imageVisibleWhere(tc.memberShip, tc.visibility)
+		if err != nil || where != tc.where {
+			t.Errorf("unexpected condition %q for %q, %v", where, tc.visibility, err)
+		}
+	}
+	if _, err := imageVisibleWhere(user, "owner = 1"); err == nil {
+		t.Errorf("invalid visibility filter unexpectedly accepted")
+	}
+}
@@ -52,17 +52,20 @@ type InstanceNetwork struct {
 }
 
 type NetworkLink struct {
-	MacAddr string `json:"ethernet_mac_address"`
-	Mtu     uint   `json:"mtu"`
-	ID      string `json:"id"`
-	Type    string `json:"type,omitempty"`
+	MacAddr  string `json:"ethernet_mac_address"`
+	Mtu      uint   `json:"mtu"`
+	ID       string `json:"id"`
+	Type     string `json:"type,omitempty"`
+	VlanLink string `json:"vlan_link,omitempty"`
+	VlanID   int32  `json:"vlan_id,omitempty"`
 }
 
 type VlanInfo struct {
-	Device  string `json:"device"`
-	Vlan    int64  `json:"vlan"`
-	IpAddr  string `json:"ip_address"`
-	MacAddr string `json:"mac_address"`
+	Device  string   `json:"device"`
+	Vlan    int64    `json:"vlan"`
+	IpAddr  string   `json:"ip_address"`
+	MacAddr string   `json:"mac_address"`
+	Qos     *QosData `json:"qos,omitempty"`
 }
 
 type SecurityData struct {
@@ -105,12 +108,12 @@ type InstancesData struct {
 	IsAdmin   bool              `json:"is_admin"`
 }
 
-func (a *InstanceAdmin) getHyperGroup(imageType string, zoneID int64) (hyperGroup string, err error) {
+func (a *InstanceAdmin) getHyperGroup(virtType string, zoneID int64) (hyperGroup string, err error) {
 	db := DB()
 	hypers := []*model.Hyper{}
 	where := fmt.Sprintf("zone_id = %d", zoneID)
-	if imageType != "" {
-		where = fmt.Sprintf("%s and type = '%s'", where, imageType)
+	if virtType != "" {
+		where = fmt.Sprintf("%s and virt_type = '%s'", where, virtType)
 	}
 	if err = db.Where(where).Find(&hypers).Error; err != nil {
 		log.Println("Hypers query failed", err)
@@ -147,6 +150,10 @@ func (a *InstanceAdmin) Create(ctx context.Context, count int, prefix, userdata
 			log.Println("Image status not available")
 			return
 		}
+		if err = imageMemberAdmin.CheckImageAccess(ctx, image); err != nil {
+			log.Println("Image not accessible", err)
+			return
+		}
 	}
 	log.Printf("Image id %d", imageID)
 	flavor := &model.Flavor{Model: model.Model{ID: flavorID}}
@@ -220,7 +227,7 @@ func (a *InstanceAdmin) Create(ctx context.Context, count int, prefix, userdata
 			}
 		}
 	}
-	hyperGroup, err := instanceAdmin.getHyperGroup(image.HypervisorType, zoneID)
+	hyperGroup, err := instanceAdmin.getHyperGroup(image.VirtType, zoneID)
 	if err != nil {
 		log.Println("No valid hypervisor", err)
 		return
@@ -256,7 +263,14 @@ func (a *InstanceAdmin) Create(ctx context.Context, count int, prefix, userdata
 		}
 		instance.Interfaces = ifaces
 		rcNeeded := fmt.Sprintf("cpu=%d memory=%d disk=%d network=%d", flavor.Cpu, flavor.Memory*1024, (flavor.Disk+flavor.Swap+flavor.Ephemeral)*1024*1024, 0)
-		control := "select=" + hyperGroup + " " + rcNeeded
+		group := hyperGroup
+		if imageID > 0 {
+			// hypervisors with the image cached launch without downloading it
+			if cachedGroup := imageCacheAdmin.HyperGroup(image, zoneID, flavor, i+1); cachedGroup != "" {
+				group = cachedGroup
+			}
+		}
+		control := "select=" + group + " " + rcNeeded
 		if i == 0 && hyperID >= 0 {
 			control = fmt.Sprintf("inter=%d %s", hyperID, rcNeeded)
 		}
@@ -280,6 +294,13 @@ func (a *InstanceAdmin) Create(ctx context.Context, count int, prefix, userdata
 			log.Println("Launch vm command execution failed", err)
 			return
 		}
+		for _, iface := range ifaces {
+			err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, secGroups, nil)
+			if err != nil {
+				log.Println("Failed to update remote security group members", err)
+				return
+			}
+		}
 		i++
 	}
 	return
@@ -428,6 +449,11 @@ func (a *InstanceAdmin) Update(ctx context.Context, id, flavorID int64, hostname
 				log.Println("Failed to delete interface", err)
 				return
 			}
+			err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, nil, iface.Secgroups)
+			if err != nil {
+				log.Println("Failed to update remote security group members", err)
+				return
+			}
 		}
 	}
 	index := len(instance.Interfaces)
@@ -457,6 +483,16 @@ func (a *InstanceAdmin) Update(ctx context.Context, id, flavorID int64, hostname
 				log.Println("Delete vm command execution failed", err)
 				return
 			}
+			err = ApplyInterfaceQos(ctx, iface)
+			if err != nil {
+				log.Println("Failed to apply interface qos", err)
+				return
+			}
+			err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, secGroups, nil)
+			if err != nil {
+				log.Println("Failed to update remote security group members", err)
+				return
+			}
 		}
 	}
 	return
@@ -483,6 +519,11 @@ func hyperExecute(ctx context.Context, control, command string) (err error) {
 
 func (a *InstanceAdmin) deleteInterfaces(ctx context.Context, instance *model.Instance) (err error) {
 	for _, iface := range instance.Interfaces {
+		err = trunkAdmin.deleteSubports(ctx, iface)
+		if err != nil {
+			log.Println("Failed to delete sub-ports", err)
+			continue
+		}
 		err = a.deleteInterface(ctx, iface)
 		if err != nil {
 			log.Println("Failed to delete interface", err)
@@ -583,7 +624,12 @@ func (a *InstanceAdmin) buildMetadata(ctx context.Context, primary *model.Subnet
 	instNetwork.Routes = append(instNetwork.Routes, instRoute)
 	instNetworks = append(instNetworks, instNetwork)
 	instLinks = append(instLinks, &NetworkLink{MacAddr: iface.MacAddr, Mtu: uint(iface.Mtu), ID: iface.Name, Type: "phy"})
-	vlans = append(vlans, &VlanInfo{Device: "eth0", Vlan: primary.Vlan, IpAddr: address, MacAddr: iface.MacAddr})
+	qosData, err := getQosData(iface.QosPolicyID)
+	if err != nil {
+		log.Println("Failed to get interface qos", err)
+		return
+	}
+	vlans = append(vlans, &VlanInfo{Device: "eth0", Vlan: primary.Vlan, IpAddr: address, MacAddr: iface.MacAddr, Qos: qosData})
 	for i, subnet := range subnets {
 		ifname := fmt.Sprintf("eth%d", i+1)
 		iface, err = a.createInterface(ctx, subnet, "", "", instance, ifname, secGroups, zoneID)
@@ -601,7 +647,12 @@ func (a *InstanceAdmin) buildMetadata(ctx context.Context, primary *model.Subnet
 			ID:      fmt.Sprintf("network%d", i+1),
 		})
 		instLinks = append(instLinks, &NetworkLink{MacAddr: iface.MacAddr, Mtu: uint(iface.Mtu), ID: iface.Name, Type: "phy"})
-		vlans = append(vlans, &VlanInfo{Device: ifname, Vlan: subnet.Vlan, IpAddr: address, MacAddr: iface.MacAddr})
+		qosData, err = getQosData(iface.QosPolicyID)
+		if err != nil {
+			log.Println("Failed to get interface qos", err)
+			return
+		}
+		vlans = append(vlans, &VlanInfo{Device: ifname, Vlan: subnet.Vlan, IpAddr: address, MacAddr: iface.MacAddr, Qos: qosData})
 	}
 	var instKeys []string
 	for _, key := range keys {
@@ -726,6 +777,18 @@ func (a *InstanceAdmin) Delete(ctx context.Context, id int64) (err error) {
 			}
 		}
 	}
+	attachments := []*model.VolumeAttachment{}
+	if err = db.Where("instance_id = ? and status <> 'detaching'", instance.ID).Find(&attachments).Error; err != nil {
+		log.Println("Failed to query volume attachment(s), %v", err)
+		return
+	}
+	for _, attachment := range attachments {
+		_, err = volumeAdmin.Detach(ctx, attachment.VolumeID, instance.ID)
+		if err != nil {
+			log.Println("Failed to detach volume, %v", err)
+			return
+		}
+	}
 	if instance.Hyper != -1 {
 		control := fmt.Sprintf("inter=%d", instance.Hyper)
 		command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_vm.sh '%d'", instance.ID)
@@ -743,6 +806,15 @@ func (a *InstanceAdmin) Delete(ctx context.Context, id int64) (err error) {
 		log.Println("Failed to delete instance, %v", err)
 		return
 	}
+	for _, iface := range instance.Interfaces {
+		if iface.Address == nil {
+			continue
+		}
+		if err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, nil, iface.Secgroups); err != nil {
+			log.Println("Failed to update remote security group members, %v", err)
+			return
+		}
+	}
 	return
 }
 
@@ -930,8 +1002,8 @@ func (v *InstanceView) New(c *macaron.Context, store session.Store) {
 		return
 	}
 	db := DB()
-	images := []*model.Image{}
-	if err := db.Find(&images).Error; err != nil {
+	_, images, err := imageAdmin.List(c.Req.Context(), 0, -1, "", "", "")
+	if err != nil {
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(500, "500")
 		return
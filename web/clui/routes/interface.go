@@ -33,7 +33,40 @@ type InterfaceAdmin struct{}
 
 type InterfaceView struct{}
 
-func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name, pairs string, sgIDs []int64) (iface *model.Interface, err error) {
+// replaceAddrPairs swaps the address pairs of an interface for pairs in one transaction
+func (a *InterfaceAdmin) replaceAddrPairs(iface *model.Interface, pairs []*AddrPairData) (err error) {
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	if err = db.Where("interface_id = ?", iface.ID).Delete(&model.AddressPair{}).Error; err != nil {
+		log.Println("Failed to delete address pairs", err)
+		return
+	}
+	addrPairs := []*model.AddressPair{}
+	for _, pair := range pairs {
+		addrPair := &model.AddressPair{
+			Model:       model.Model{Creater: iface.Creater, Owner: iface.Owner},
+			InterfaceID: iface.ID,
+			IpAddress:   pair.IpAddress,
+			MacAddr:     pair.MacAddr,
+		}
+		if err = db.Create(addrPair).Error; err != nil {
+			log.Println("Failed to create address pair", err)
+			return
+		}
+		addrPairs = append(addrPairs, addrPair)
+	}
+	iface.AddrPairs = addrPairs
+	return
+}
+
+func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name string, pairs []*AddrPairData, sgIDs []int64, qosID int64) (iface *model.Interface, err error) {
 	db := DB()
 	iface = &model.Interface{Model: model.Model{ID: id}}
 	if err = db.Set("gorm:auto_preload", true).Take(iface).Error; err != nil {
@@ -47,10 +80,16 @@ func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name, pairs strin
 			return
 		}
 	}
-	if iface.AddrPairs != pairs {
-		iface.AddrPairs = pairs
-		if err = db.Save(iface).Error; err != nil {
-			log.Println("Failed to save interface", err)
+	subnet := &model.Subnet{Model: model.Model{ID: iface.Address.SubnetID}}
+	if err = db.Take(subnet).Error; err != nil {
+		log.Println("Failed to query subnet", err)
+		return
+	}
+	if err = validateAddrPairs(subnet, pairs); err != nil {
+		return
+	}
+	if !addrPairsEqual(iface.AddrPairs, pairs) {
+		if err = a.replaceAddrPairs(iface, pairs); err != nil {
 			return
 		}
 	}
@@ -63,12 +102,24 @@ func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name, pairs strin
 		}
 		control = fmt.Sprintf("inter=%d", instance.Hyper)
 	}
-	command := fmt.Sprintf("/opt/cloudland/scripts/backend/allow_as_addr.sh '%s' '%s' <<EOF\n%s\nEOF", iface.Address.Address, iface.MacAddr, pairs)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/allow_as_addr.sh '%s' '%s' <<EOF\n%s\nEOF", iface.Address.Address, iface.MacAddr, addrPairsText(iface.AddrPairs))
 	err = hyperExecute(ctx, control, command)
 	if err != nil {
 		log.Println("Launch vm command execution failed", err)
 		return
 	}
+	if qosID >= 0 && iface.QosPolicyID != qosID {
+		iface.QosPolicyID = qosID
+		if err = db.Model(iface).Update("qos_policy_id", qosID).Error; err != nil {
+			log.Println("Failed to save interface qos policy", err)
+			return
+		}
+		err = ApplyInterfaceQos(ctx, iface)
+		if err != nil {
+			log.Println("Failed to apply interface qos policy", err)
+			return
+		}
+	}
 	sgChanged := false
 	for _, esg := range iface.Secgroups {
 		found := false
@@ -106,6 +157,7 @@ func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name, pairs strin
 			log.Println("Security group query failed", err)
 			return
 		}
+		oldGroups := iface.Secgroups
 		db.Model(iface).Association("Secgroups").Clear()
 		iface.Secgroups = secGroups
 		if err = db.Save(iface).Error; err != nil {
@@ -144,6 +196,230 @@ func (a *InterfaceAdmin) Update(ctx context.Context, id int64, name, pairs strin
 			log.Println("Launch vm command execution failed", err)
 			return
 		}
+		err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, secgroupsDiff(secGroups, oldGroups), secgroupsDiff(oldGroups, secGroups))
+		if err != nil {
+			log.Println("Failed to update remote security group members", err)
+			return
+		}
+	}
+	return
+}
+
+// Attach hot-plugs a new interface on the subnet to the instance, the subnet must cross the zone of the instance
+func (a *InterfaceAdmin) Attach(ctx context.Context, instanceID, subnetID int64, address, mac string, sgIDs []int64) (iface *model.Interface, err error) {
+	db := DB()
+	instance := &model.Instance{Model: model.Model{ID: instanceID}}
+	if err = db.Preload("Interfaces").Preload("Interfaces.Address").Take(instance).Error; err != nil {
+		log.Println("Failed to query instance ", err)
+		return
+	}
+	if instance.Hyper < 0 {
+		err = fmt.Errorf("Instance is not scheduled to a hypervisor yet")
+		return
+	}
+	index := 0
+	for _, eif := range instance.Interfaces {
+		if eif.Address != nil && eif.Address.SubnetID == subnetID {
+			err = fmt.Errorf("Instance already has an interface on this subnet")
+			return
+		}
+		n := 0
+		if _, e := fmt.Sscanf(eif.Name, "eth%d", &n); e == nil && n >= index {
+			index = n + 1
+		}
+	}
+	subnet := &model.Subnet{Model: model.Model{ID: subnetID}}
+	if err = db.Preload("Netlink").Preload("Zones").Take(subnet).Error; err != nil {
+		log.Println("Failed to query subnet", err)
+		return
+	}
+	valid := false
+	for _, z := range subnet.Zones {
+		if z.ID == instance.ZoneID {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		err = fmt.Errorf("Subnet doesn't cross the zone of the instance")
+		return
+	}
+	secGroups := []*model.SecurityGroup{}
+	if err = db.Where(sgIDs).Find(&secGroups).Error; err != nil {
+		log.Println("Security group query failed", err)
+		return
+	}
+	secRules, err := model.GetSecurityRules(secGroups)
+	if err != nil {
+		log.Println("Failed to get security rules", err)
+		return
+	}
+	jsonData, err := json.Marshal(toSecurityData(secRules))
+	if err != nil {
+		log.Println("Failed to marshal security json data, %v", err)
+		return
+	}
+	ifname := fmt.Sprintf("eth%d", index)
+	iface, err = instanceAdmin.createInterface(ctx, subnet, address, mac, instance, ifname, secGroups, instance.ZoneID)
+	if err != nil {
+		log.Println("Failed to create interface", err)
+		return
+	}
+	iface.Address.Subnet = subnet
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/attach_nic.sh '%d' '%d' '%s' '%s' <<EOF\n%s\nEOF", instance.ID, subnet.Vlan, iface.Address.Address, iface.MacAddr, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Attach nic command execution failed", err)
+		if err2 := instanceAdmin.deleteInterface(ctx, iface); err2 != nil {
+			log.Println("Failed to delete interface", err2)
+		}
+		return
+	}
+	err = ApplyInterfaceQos(ctx, iface)
+	if err != nil {
+		log.Println("Failed to apply interface qos", err)
+		return
+	}
+	err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, secGroups, nil)
+	if err != nil {
+		log.Println("Failed to update remote security group members", err)
+		return
+	}
+	err = a.syncNetworkMeta(ctx, instance)
+	return
+}
+
+// Detach hot-unplugs a secondary interface from its instance and releases its address
+func (a *InterfaceAdmin) Detach(ctx context.Context, id int64) (iface *model.Interface, err error) {
+	db := DB()
+	iface = &model.Interface{Model: model.Model{ID: id}}
+	if err = db.Set("gorm:auto_preload", true).Take(iface).Error; err != nil {
+		log.Println("Failed to query interface ", err)
+		return
+	}
+	if iface.Type != "instance" || iface.Instance == 0 {
+		err = fmt.Errorf("Interface is not attached to an instance")
+		return
+	}
+	if iface.PrimaryIf {
+		err = fmt.Errorf("Primary interface can not be detached")
+		return
+	}
+	count := 0
+	if err = db.Model(&model.FloatingIp{}).Where("instance_id = ? and int_address = ?", iface.Instance, iface.Address.Address).Count(&count).Error; err != nil {
+		log.Println("Failed to count floating ips", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Interface has floating ip associated")
+		return
+	}
+	if err = db.Model(&model.Portmap{}).Where("interface_id = ?", iface.ID).Count(&count).Error; err != nil {
+		log.Println("Failed to count portmaps", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Interface has port maps")
+		return
+	}
+	if err = db.Model(&model.Interface{}).Where("parent_id = ? and type = ?", iface.ID, "subport").Count(&count).Error; err != nil {
+		log.Println("Failed to count sub-ports", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Interface has trunk sub-ports")
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: iface.Instance}}
+	if err = db.Take(instance).Error; err != nil {
+		log.Println("Failed to query instance ", err)
+		return
+	}
+	if instance.Hyper >= 0 {
+		control := fmt.Sprintf("inter=%d", instance.Hyper)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/detach_nic.sh '%d' '%d' '%s' '%s'", instance.ID, iface.Address.Subnet.Vlan, iface.Address.Address, iface.MacAddr)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Detach nic command execution failed", err)
+			return
+		}
+	}
+	err = instanceAdmin.deleteInterface(ctx, iface)
+	if err != nil {
+		log.Println("Failed to delete interface", err)
+		return
+	}
+	err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, nil, iface.Secgroups)
+	if err != nil {
+		log.Println("Failed to update remote security group members", err)
+		return
+	}
+	err = a.syncNetworkMeta(ctx, instance)
+	return
+}
+
+// syncNetworkMeta regenerates the network data of the config drive after the interfaces of an instance change
+func (a *InterfaceAdmin) syncNetworkMeta(ctx context.Context, instance *model.Instance) (err error) {
+	if instance.Hyper < 0 {
+		return
+	}
+	db := DB()
+	ifaces := []*model.Interface{}
+	if err = db.Preload("Address").Preload("Address.Subnet").Where("instance = ? and type = ?", instance.ID, "instance").Order("primary_if desc, id").Find(&ifaces).Error; err != nil {
+		log.Println("Failed to query interfaces", err)
+		return
+	}
+	instData := &InstanceData{}
+	for i, iface := range ifaces {
+		if iface.Address == nil || iface.Address.Subnet == nil {
+			continue
+		}
+		subnet := iface.Address.Subnet
+		instNetwork := &InstanceNetwork{
+			Address: strings.Split(iface.Address.Address, "/")[0],
+			Netmask: subnet.Netmask,
+			Type:    "ipv4",
+			Link:    iface.Name,
+			ID:      fmt.Sprintf("network%d", i),
+		}
+		if iface.PrimaryIf {
+			gateway := strings.Split(subnet.Gateway, "/")[0]
+			instNetwork.Routes = append(instNetwork.Routes, &NetworkRoute{Network: "0.0.0.0", Netmask: "0.0.0.0", Gateway: gateway})
+			instData.DNS = subnet.NameServer
+		}
+		instData.Networks = append(instData.Networks, instNetwork)
+		instData.Links = append(instData.Links, &NetworkLink{MacAddr: iface.MacAddr, Mtu: uint(iface.Mtu), ID: iface.Name, Type: "phy"})
+		subports := []*model.Interface{}
+		if err = db.Preload("Address").Preload("Address.Subnet").Where("parent_id = ? and type = ?", iface.ID, "subport").Order("segmentation_id").Find(&subports).Error; err != nil {
+			log.Println("Failed to query sub-ports", err)
+			return
+		}
+		for _, sub := range subports {
+			if sub.Address == nil || sub.Address.Subnet == nil {
+				continue
+			}
+			instData.Networks = append(instData.Networks, &InstanceNetwork{
+				Address: strings.Split(sub.Address.Address, "/")[0],
+				Netmask: sub.Address.Subnet.Netmask,
+				Type:    "ipv4",
+				Link:    sub.Name,
+				ID:      fmt.Sprintf("network%d-%d", i, sub.SegmentationID),
+			})
+			instData.Links = append(instData.Links, &NetworkLink{MacAddr: sub.MacAddr, Mtu: uint(sub.Mtu), ID: sub.Name, Type: "vlan", VlanLink: iface.Name, VlanID: sub.SegmentationID})
+		}
+	}
+	jsonData, err := json.Marshal(instData)
+	if err != nil {
+		log.Println("Failed to marshal network json data, %v", err)
+		return
+	}
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/update_meta.sh '%d' <<EOF\n%s\nEOF", instance.ID, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Update meta command execution failed", err)
+		return
 	}
 	return
 }
@@ -175,14 +451,25 @@ func (v *InterfaceView) Edit(c *macaron.Context, store session.Store) {
 		log.Println("Image query failed", err)
 		return
 	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, iface)
+		return
+	}
 	_, secgroups, err := secgroupAdmin.List(c.Req.Context(), 0, -1, "", "")
 	if err != nil {
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(500, "500")
 		return
 	}
+	_, policies, err := qosAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
 	c.Data["Interface"] = iface
 	c.Data["Secgroups"] = secgroups
+	c.Data["QosPolicies"] = policies
 	c.HTML(200, "interfaces_patch")
 }
 
@@ -251,6 +538,11 @@ func (v *InterfaceView) Create(c *macaron.Context, store session.Store) {
 		c.JSON(500, map[string]interface{}{
 			"error": err.Error(),
 		})
+		return
+	}
+	err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, secGroups, nil)
+	if err != nil {
+		log.Println("Failed to update remote security group members", err)
 	}
 	c.JSON(200, iface)
 }
@@ -267,7 +559,7 @@ func (v *InterfaceView) Delete(c *macaron.Context, store session.Store) {
 		return
 	}
 	iface := &model.Interface{Model: model.Model{ID: id}}
-	err = DB().Take(iface).Error
+	err = DB().Preload("Address").Preload("Secgroups").Take(iface).Error
 	if err != nil {
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(http.StatusBadRequest, "error")
@@ -279,6 +571,12 @@ func (v *InterfaceView) Delete(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
+	if iface.Address != nil {
+		err = secruleAdmin.MemberChanged(ctx, iface.Address.Address, nil, iface.Secgroups)
+		if err != nil {
+			log.Println("Failed to update remote security group members", err)
+		}
+	}
 	c.JSON(200, "ok")
 }
 
@@ -306,7 +604,13 @@ func (v *InterfaceView) Patch(c *macaron.Context, store session.Store) {
 	}
 	name := c.QueryTrim("name")
 	secgroups := c.QueryStrings("secgroups")
-	pairs := c.QueryTrim("pairs")
+	pairs, err := parseAddrPairs(c.QueryTrim("pairs"))
+	if err != nil {
+		log.Println("Invalid address pairs", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
 	var sgIDs []int64
 	log.Println("$$$$$$ len = ", len(secgroups))
 	if len(secgroups) > 0 {
@@ -336,7 +640,17 @@ func (v *InterfaceView) Patch(c *macaron.Context, store session.Store) {
 		}
 		sgIDs = append(sgIDs, sID)
 	}
-	iface, err := interfaceAdmin.Update(c.Req.Context(), int64(ifaceID), name, pairs, sgIDs)
+	qosID := int64(-1)
+	if c.QueryTrim("qos") != "" {
+		if !memberShip.CheckPermission(model.Admin) {
+			log.Println("Not authorized to change qos policy")
+			c.Data["ErrorMsg"] = "Not authorized to change qos policy"
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+		qosID = c.QueryInt64("qos")
+	}
+	iface, err := interfaceAdmin.Update(c.Req.Context(), int64(ifaceID), name, pairs, sgIDs, qosID)
 	if err != nil {
 		log.Println("Failed to update interface", err)
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
@@ -354,6 +668,140 @@ func (v *InterfaceView) Patch(c *macaron.Context, store session.Store) {
 	c.Redirect(redirectTo)
 }
 
+func (v *InterfaceView) InstanceList(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	instID := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "instances", instID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: instID}}
+	if err = db.Set("gorm:auto_preload", true).Preload("Interfaces.AddrPairs").Take(instance).Error; err != nil {
+		log.Println("Failed to query instance", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, secgroups, err := secgroupAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"interfaces": instance.Interfaces,
+		})
+		return
+	}
+	c.Data["Instance"] = instance
+	c.Data["Subnets"] = subnets
+	c.Data["Secgroups"] = secgroups
+	c.HTML(200, "instances_interfaces")
+}
+
+func (v *InterfaceView) Attach(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	instID := c.ParamsInt64("id")
+	redirectTo := fmt.Sprintf("/instances/%d/interfaces", instID)
+	permit, err := memberShip.CheckOwner(model.Writer, "instances", instID)
+	if !permit {
+		log.Println("Not authorized to access instance")
+		c.Data["ErrorMsg"] = "Not authorized to access instance"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	subnetID := c.QueryInt64("subnet")
+	permit, err = memberShip.CheckOwner(model.Writer, "subnets", subnetID)
+	if !permit {
+		log.Println("Not authorized to access subnet")
+		c.Data["ErrorMsg"] = "Not authorized to access subnet"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	address := c.QueryTrim("address")
+	mac := c.QueryTrim("mac")
+	var sgIDs []int64
+	for _, s := range c.QueryStrings("secgroups") {
+		sgID, err := strconv.Atoi(s)
+		if err != nil {
+			log.Println("Invalid security group ID", err)
+			continue
+		}
+		permit, err = memberShip.CheckOwner(model.Writer, "security_groups", int64(sgID))
+		if !permit {
+			log.Println("Not authorized to access security group")
+			c.Data["ErrorMsg"] = "Not authorized to access security group"
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+		sgIDs = append(sgIDs, int64(sgID))
+	}
+	if len(sgIDs) == 0 {
+		sgIDs = append(sgIDs, store.Get("defsg").(int64))
+	}
+	iface, err := interfaceAdmin.Attach(ctx, instID, subnetID, address, mac, sgIDs)
+	if err != nil {
+		log.Println("Failed to attach interface", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, iface)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *InterfaceView) Detach(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	instID := c.ParamsInt64("id")
+	ifaceID := c.ParamsInt64("ifaceid")
+	permit, err := memberShip.CheckOwner(model.Writer, "instances", instID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	count := 0
+	if err = DB().Model(&model.Interface{}).Where("id = ? and instance = ?", ifaceID, instID).Count(&count).Error; err != nil || count == 0 {
+		log.Println("Interface does not belong to instance", err)
+		c.Data["ErrorMsg"] = "Interface does not belong to instance"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, err = interfaceAdmin.Detach(ctx, ifaceID)
+	if err != nil {
+		log.Println("Failed to detach interface", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": fmt.Sprintf("/instances/%d/interfaces", instID),
+	})
+}
+
 func AllocateAddress(ctx context.Context, subnetID, ifaceID int64, ipaddr, addrType string) (address *model.Address, err error) {
 	var db *gorm.DB
 	ctx, db = getCtxDB(ctx)
@@ -421,6 +869,11 @@ func SetGateway(ctx context.Context, subnetID, zoneID int64, router *model.Gatew
 		err = fmt.Errorf("Only internal gateway can be set gateway")
 		return nil, err
 	}
+	if subnet.NatGatewayID > 0 {
+		log.Println("Subnet is attached to a nat gateway")
+		err = fmt.Errorf("Subnet is attached to a nat gateway")
+		return nil, err
+	}
 	found := false
 	for _, z := range subnet.Zones {
 		if z.ID == zoneID {
@@ -525,9 +978,18 @@ func CreateInterface(ctx context.Context, subnetID, ID, owner, zoneID int64, hyp
 		iface.FloatingIp = ID
 	} else if ifType == "dhcp" {
 		iface.Dhcp = ID
+	} else if ifType == "subport" {
+		iface.ParentID = ID
+	} else if ifType == "nat" {
+		iface.Device = ID
 	} else if strings.Contains(ifType, "gateway") {
 		iface.Device = ID
 	}
+	iface.QosPolicyID, err = getInterfaceQos(ctx, iface)
+	if err != nil {
+		log.Println("Failed to get interface qos policy", err)
+		return
+	}
 	err = db.Create(iface).Error
 	if err != nil {
 		log.Println("Failed to create interface, ", err)
@@ -559,6 +1021,8 @@ func DeleteInterfaces(ctx context.Context, masterID, subnetID int64, ifType stri
 		err = db.Where("floating_ip = ? and type = ?", masterID, "floating").Where(where).Find(&ifaces).Error
 	} else if ifType == "dhcp" {
 		err = db.Where("dhcp = ? and type = ?", masterID, "dhcp").Where(where).Find(&ifaces).Error
+	} else if ifType == "nat" {
+		err = db.Where("device = ? and type = ?", masterID, "nat").Where(where).Find(&ifaces).Error
 	} else {
 		err = db.Where("device = ? and type like ?", masterID, "%gateway%").Where(where).Find(&ifaces).Error
 	}
@@ -572,6 +1036,14 @@ func DeleteInterfaces(ctx context.Context, masterID, subnetID int64, ifType stri
 			log.Println("Failed to deallocate address, %v", err)
 			return
 		}
+		ifaceIDs := []int64{}
+		for _, iface := range ifaces {
+			ifaceIDs = append(ifaceIDs, iface.ID)
+		}
+		if err = db.Where("interface_id in (?)", ifaceIDs).Delete(&model.AddressPair{}).Error; err != nil {
+			log.Println("Failed to delete address pairs, %v", err)
+			return
+		}
 		if ifType == "instance" {
 			err = db.Where("instance = ? and type = ?", masterID, "instance").Where(where).Delete(&model.Interface{}).Error
 		} else if ifType == "floating" {
@@ -580,6 +1052,8 @@ func DeleteInterfaces(ctx context.Context, masterID, subnetID int64, ifType stri
 			err = db.Where("device = ? and type like ?", masterID, "%gateway%").Where(where).Delete(&model.Interface{}).Error
 		} else if ifType == "dhcp" {
 			err = db.Where("dhcp = ? and type = ?", masterID, "dhcp").Where(where).Delete(&model.Interface{}).Error
+		} else if ifType == "nat" {
+			err = db.Where("device = ? and type = ?", masterID, "nat").Where(where).Delete(&model.Interface{}).Error
 		}
 		if err != nil {
 			log.Println("Failed to delete interface, %v", err)
@@ -596,6 +1070,10 @@ func DeleteInterface(ctx context.Context, iface *model.Interface) (err error) {
 		log.Println("Failed to Update addresses, %v", err)
 		return
 	}
+	if err = db.Where("interface_id = ?", iface.ID).Delete(&model.AddressPair{}).Error; err != nil {
+		log.Println("Failed to delete address pairs, %v", err)
+		return
+	}
 	err = db.Delete(iface).Error
 	if err != nil {
 		log.Println("Failed to delete interface", err)
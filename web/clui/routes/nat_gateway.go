@@ -0,0 +1,558 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	natAdmin = &NatGatewayAdmin{}
+	natView  = &NatGatewayView{}
+)
+
+type NatGatewayAdmin struct{}
+type NatGatewayView struct{}
+
+type NatSubnet struct {
+	Address string `json:"ip_address"`
+	Vni     int64  `json:"vni"`
+	Network string `json:"network"`
+}
+
+// checkNatSubnet makes sure a subnet can get its egress from the nat gateway
+func checkNatSubnet(subnet *model.Subnet, natID, zoneID int64) (err error) {
+	if subnet.Type != "internal" {
+		return fmt.Errorf("Only internal subnets can be attached to a nat gateway")
+	}
+	if subnet.Router > 0 {
+		return fmt.Errorf("Subnet %s already belongs to a gateway", subnet.Name)
+	}
+	if subnet.NatGatewayID > 0 && subnet.NatGatewayID != natID {
+		return fmt.Errorf("Subnet %s already belongs to another nat gateway", subnet.Name)
+	}
+	for _, z := range subnet.Zones {
+		if z.ID == zoneID {
+			return
+		}
+	}
+	return fmt.Errorf("Subnet %s does not cross the zone of the nat gateway", subnet.Name)
+}
+
+func (a *NatGatewayAdmin) natSubnet(subnet *model.Subnet) (jsonData []byte, err error) {
+	jsonData, err = json.Marshal(&NatSubnet{Address: subnet.Gateway, Vni: subnet.Vlan, Network: subnetCidr(subnet)})
+	if err != nil {
+		log.Println("Failed to marshal nat subnet json data", err)
+	}
+	return
+}
+
+func (a *NatGatewayAdmin) Create(ctx context.Context, name string, poolID, zoneID int64, subnetIDs []int64) (natgw *model.NatGateway, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	pool := &model.FloatingIpPool{Model: model.Model{ID: poolID}}
+	if err = db.Preload("Subnets").Preload("Orgs").Preload("Zones").Take(pool).Error; err != nil {
+		log.Println("DB failed to query floating ip pool", err)
+		return
+	}
+	if !fipPoolAdmin.CheckAccess(pool, memberShip.OrgID, zoneID) {
+		err = fmt.Errorf("Not allowed to allocate from this pool")
+		return
+	}
+	subnets := []*model.Subnet{}
+	if len(subnetIDs) > 0 {
+		if err = db.Preload("Zones").Where(subnetIDs).Find(&subnets).Error; err != nil {
+			log.Println("DB failed to query subnets", err)
+			return
+		}
+	}
+	for _, subnet := range subnets {
+		if err = checkNatSubnet(subnet, 0, zoneID); err != nil {
+			return
+		}
+	}
+	hypers := []*model.Hyper{}
+	if err = db.Where("zone_id = ? and hostid >= 0", zoneID).Find(&hypers).Error; err != nil {
+		log.Println("Hypers query failed", err)
+		return
+	}
+	if len(hypers) == 0 {
+		err = fmt.Errorf("No hypervisor in the zone to host the nat gateway")
+		return
+	}
+	natgw = &model.NatGateway{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: name, Status: "pending", PoolID: pool.ID, ZoneID: zoneID}
+	if err = db.Create(natgw).Error; err != nil {
+		log.Println("DB failed to create nat gateway", err)
+		return
+	}
+	// nothing is left behind if the nat gateway can not be set up
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err2 := db.Model(&model.Subnet{}).Where("nat_gateway_id = ?", natgw.ID).Update("nat_gateway_id", 0).Error; err2 != nil {
+			log.Println("DB failed to detach subnets", err2)
+		}
+		if err2 := DeleteInterfaces(ctx, natgw.ID, 0, "nat"); err2 != nil {
+			log.Println("DB failed to delete interfaces", err2)
+		}
+		if err2 := db.Delete(natgw).Error; err2 != nil {
+			log.Println("DB failed to delete nat gateway", err2)
+		}
+	}()
+	var pubIface *model.Interface
+	var pubSubnet *model.Subnet
+	for _, pubSubnet = range pool.Subnets {
+		pubIface, err = CreateInterface(ctx, pubSubnet.ID, natgw.ID, memberShip.OrgID, zoneID, -1, "", "", "natpub", "nat", nil)
+		if err == nil {
+			break
+		}
+	}
+	if pubIface == nil {
+		log.Println("Failed to allocate address from pool", err)
+		err = fmt.Errorf("No available address in pool %s", pool.Name)
+		return
+	}
+	natgw.PublicAddress = pubIface.Address.Address
+	if err = db.Model(natgw).Update("public_address", natgw.PublicAddress).Error; err != nil {
+		log.Println("DB failed to update nat gateway", err)
+		return
+	}
+	natSubnets := []*NatSubnet{}
+	for _, subnet := range subnets {
+		if err = db.Model(subnet).Update("nat_gateway_id", natgw.ID).Error; err != nil {
+			log.Println("DB failed to attach subnet", err)
+			return
+		}
+		natSubnets = append(natSubnets, &NatSubnet{Address: subnet.Gateway, Vni: subnet.Vlan, Network: subnetCidr(subnet)})
+	}
+	jsonData, err := json.Marshal(natSubnets)
+	if err != nil {
+		log.Println("Failed to marshal nat gateway json data", err)
+		return
+	}
+	hyperGroup := fmt.Sprintf("group-zone-%d", zoneID)
+	for i, h := range hypers {
+		if i == 0 {
+			hyperGroup = fmt.Sprintf("%s:%d", hyperGroup, h.Hostid)
+		} else {
+			hyperGroup = fmt.Sprintf("%s,%d", hyperGroup, h.Hostid)
+		}
+	}
+	control := "select=" + hyperGroup
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_nat.sh '%d' '%d' '%s' '%s' <<EOF\n%s\nEOF", natgw.ID, pubSubnet.Vlan, natgw.PublicAddress, pubSubnet.Gateway, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create nat gateway command execution failed", err)
+		return
+	}
+	return
+}
+
+func (a *NatGatewayAdmin) Update(ctx context.Context, id int64, name string, subnetIDs []int64) (natgw *model.NatGateway, err error) {
+	db := DB()
+	natgw = &model.NatGateway{Model: model.Model{ID: id}}
+	if err = db.Preload("Subnets").Take(natgw).Error; err != nil {
+		log.Println("DB failed to query nat gateway", err)
+		return
+	}
+	if natgw.Name != name {
+		natgw.Name = name
+		if err = db.Model(natgw).Update("name", name).Error; err != nil {
+			log.Println("DB failed to update nat gateway", err)
+			return
+		}
+	}
+	attached := make(map[int64]bool)
+	for _, subnet := range natgw.Subnets {
+		attached[subnet.ID] = true
+	}
+	wanted := make(map[int64]bool)
+	for _, sID := range subnetIDs {
+		wanted[sID] = true
+	}
+	control := fmt.Sprintf("inter=%d", natgw.Hyper)
+	for _, subnet := range natgw.Subnets {
+		if wanted[subnet.ID] {
+			continue
+		}
+		var jsonData []byte
+		jsonData, err = a.natSubnet(subnet)
+		if err != nil {
+			return
+		}
+		if natgw.Hyper < 0 {
+			err = fmt.Errorf("Nat gateway is not active yet")
+			return
+		}
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_nat_subnet.sh '%d' <<EOF\n%s\nEOF", natgw.ID, jsonData)
+		if err = hyperExecute(ctx, control, command); err != nil {
+			log.Println("Clear nat subnet command execution failed", err)
+			return
+		}
+		if err = db.Model(subnet).Update("nat_gateway_id", 0).Error; err != nil {
+			log.Println("DB failed to detach subnet", err)
+			return
+		}
+	}
+	for _, sID := range subnetIDs {
+		if attached[sID] {
+			continue
+		}
+		subnet := &model.Subnet{Model: model.Model{ID: sID}}
+		if err = db.Preload("Zones").Take(subnet).Error; err != nil {
+			log.Println("DB failed to query subnet", err)
+			return
+		}
+		if err = checkNatSubnet(subnet, natgw.ID, natgw.ZoneID); err != nil {
+			return
+		}
+		var jsonData []byte
+		jsonData, err = a.natSubnet(subnet)
+		if err != nil {
+			return
+		}
+		if natgw.Hyper < 0 {
+			err = fmt.Errorf("Nat gateway is not active yet")
+			return
+		}
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_nat_subnet.sh '%d' <<EOF\n%s\nEOF", natgw.ID, jsonData)
+		if err = hyperExecute(ctx, control, command); err != nil {
+			log.Println("Set nat subnet command execution failed", err)
+			return
+		}
+		if err = db.Model(subnet).Update("nat_gateway_id", natgw.ID).Error; err != nil {
+			log.Println("DB failed to attach subnet", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *NatGatewayAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	natgw := &model.NatGateway{Model: model.Model{ID: id}}
+	if err = db.Preload("Subnets").Take(natgw).Error; err != nil {
+		log.Println("DB failed to query nat gateway", err)
+		return
+	}
+	natSubnets := []*NatSubnet{}
+	for _, subnet := range natgw.Subnets {
+		natSubnets = append(natSubnets, &NatSubnet{Address: subnet.Gateway, Vni: subnet.Vlan, Network: subnetCidr(subnet)})
+	}
+	jsonData, err := json.Marshal(natSubnets)
+	if err != nil {
+		log.Println("Failed to marshal nat gateway json data", err)
+		return
+	}
+	control := "toall="
+	if natgw.Hyper >= 0 {
+		control = fmt.Sprintf("inter=%d", natgw.Hyper)
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_nat.sh '%d' <<EOF\n%s\nEOF", natgw.ID, jsonData)
+	if err = hyperExecute(ctx, control, command); err != nil {
+		log.Println("Clear nat gateway command execution failed", err)
+		return
+	}
+	if err = db.Model(&model.Subnet{}).Where("nat_gateway_id = ?", id).Update("nat_gateway_id", 0).Error; err != nil {
+		log.Println("DB failed to detach subnets", err)
+		return
+	}
+	if err = DeleteInterfaces(ctx, id, 0, "nat"); err != nil {
+		log.Println("DB failed to delete interfaces", err)
+		return
+	}
+	if err = db.Delete(natgw).Error; err != nil {
+		log.Println("DB failed to delete nat gateway", err)
+		return
+	}
+	return
+}
+
+func (a *NatGatewayAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, natgws []*model.NatGateway, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	natgws = []*model.NatGateway{}
+	if err = db.Model(&model.NatGateway{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count nat gateway(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Subnets").Preload("Pool").Preload("Zone").Where(where).Where(query).Find(&natgws).Error; err != nil {
+		log.Println("DB failed to query nat gateway(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, natgw := range natgws {
+			natgw.OwnerInfo = &model.Organization{Model: model.Model{ID: natgw.Owner}}
+			if err = db.Take(natgw.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (v *NatGatewayView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, natgws, err := natAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list nat gateway(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["NatGateways"] = natgws
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"natgateways": natgws,
+			"total":       total,
+			"pages":       pages,
+			"query":       query,
+		})
+		return
+	}
+	c.HTML(200, "natgateways")
+}
+
+func (v *NatGatewayView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "nat_gateways", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = natAdmin.Delete(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to delete nat gateway", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "natgateways",
+	})
+	return
+}
+
+func (v *NatGatewayView) New(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	db := DB()
+	zones := []*model.Zone{}
+	if err := db.Find(&zones).Error; err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, pools, err := fipPoolAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Zones"] = zones
+	c.Data["Pools"] = pools
+	c.Data["Subnets"] = subnets
+	c.HTML(200, "natgateways_new")
+}
+
+func (v *NatGatewayView) Edit(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "nat_gateways", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	natgw := &model.NatGateway{Model: model.Model{ID: id}}
+	if err = DB().Preload("Subnets").Take(natgw).Error; err != nil {
+		log.Println("DB failed to query nat gateway", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["NatGateway"] = natgw
+	c.Data["Subnets"] = subnets
+	c.HTML(200, "natgateways_patch")
+}
+
+func (v *NatGatewayView) getSubnetIDs(c *macaron.Context) (subnetIDs []int64, err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	for _, s := range strings.Split(strings.Join(c.QueryStrings("subnets"), ","), ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		sID, err := strconv.Atoi(s)
+		if err != nil {
+			log.Println("Invalid subnet ID", err)
+			continue
+		}
+		permit, _ := memberShip.CheckOwner(model.Writer, "subnets", int64(sID))
+		if !permit {
+			err = fmt.Errorf("Not authorized to access subnet")
+			return nil, err
+		}
+		subnetIDs = append(subnetIDs, int64(sID))
+	}
+	return
+}
+
+func (v *NatGatewayView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../natgateways"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "nat_gateways", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	name := c.QueryTrim("name")
+	subnetIDs, err := v.getSubnetIDs(c)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	natgw, err := natAdmin.Update(c.Req.Context(), id, name, subnetIDs)
+	if err != nil {
+		log.Println("Failed to update nat gateway", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, natgw)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *NatGatewayView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../natgateways"
+	name := c.QueryTrim("name")
+	poolID := c.QueryInt64("pool")
+	zoneID := c.QueryInt64("zone")
+	subnetIDs, err := v.getSubnetIDs(c)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	natgw, err := natAdmin.Create(c.Req.Context(), name, poolID, zoneID, subnetIDs)
+	if err != nil {
+		log.Println("Failed to create nat gateway", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, natgw)
+		return
+	}
+	c.Redirect(redirectTo)
+}
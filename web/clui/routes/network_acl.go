@@ -0,0 +1,800 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	aclAdmin     = &AclAdmin{}
+	aclView      = &AclView{}
+	aclRuleAdmin = &AclRuleAdmin{}
+	aclRuleView  = &AclRuleView{}
+)
+
+type AclAdmin struct{}
+type AclView struct{}
+type AclRuleAdmin struct{}
+type AclRuleView struct{}
+
+type AclRuleData struct {
+	Action    string `json:"action"`
+	Direction string `json:"direction"`
+	Protocol  string `json:"protocol"`
+	Cidr      string `json:"cidr"`
+	PortMin   int32  `json:"port_min"`
+	PortMax   int32  `json:"port_max"`
+}
+
+type SubnetAcl struct {
+	Network string         `json:"network"`
+	Rules   []*AclRuleData `json:"rules"`
+}
+
+func subnetCidr(subnet *model.Subnet) string {
+	preSize, _ := net.IPMask(net.ParseIP(subnet.Netmask).To4()).Size()
+	return fmt.Sprintf("%s/%d", subnet.Network, preSize)
+}
+
+// aclRuleData returns the rules in the order they are evaluated, lower numbers first
+func aclRuleData(rules []*model.NetworkAclRule) (data []*AclRuleData) {
+	sorted := make([]*model.NetworkAclRule, len(rules))
+	copy(sorted, rules)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Number < sorted[j].Number })
+	data = []*AclRuleData{}
+	for _, rule := range sorted {
+		data = append(data, &AclRuleData{
+			Action:    rule.Action,
+			Direction: rule.Direction,
+			Protocol:  rule.Protocol,
+			Cidr:      rule.Cidr,
+			PortMin:   rule.PortMin,
+			PortMax:   rule.PortMax,
+		})
+	}
+	return
+}
+
+// validateAclRule checks an acl rule, ports of tcp and udp range from -1 meaning any to 65535,
+// for icmp they carry the type and code from -1 meaning any to 255 and they are ignored for all
+func validateAclRule(number int32, action, direction, protocol string, portMin, portMax int32) (err error) {
+	if number <= 0 {
+		err = fmt.Errorf("Rule number must be positive")
+		return
+	}
+	if action != "allow" && action != "deny" {
+		err = fmt.Errorf("Action must be allow or deny")
+		return
+	}
+	if direction != "ingress" && direction != "egress" {
+		err = fmt.Errorf("Direction must be ingress or egress")
+		return
+	}
+	limit := int32(65535)
+	switch protocol {
+	case "tcp", "udp":
+	case "icmp":
+		limit = 255
+	case "all":
+		return
+	default:
+		err = fmt.Errorf("Protocol must be tcp, udp, icmp or all")
+		return
+	}
+	if portMin < -1 || portMax < -1 || portMin > limit || portMax > limit {
+		err = fmt.Errorf("Ports of %s must be between -1 and %d", protocol, limit)
+		return
+	}
+	if portMin > portMax || (portMin == -1 && portMax != -1) {
+		err = fmt.Errorf("Invalid port range")
+		return
+	}
+	return
+}
+
+// getSubnetAcl returns the ordered rules of the acl attached to the subnet, nil if there is none
+func getSubnetAcl(subnet *model.Subnet) (subnetAcl *SubnetAcl, err error) {
+	if subnet.AclID == 0 {
+		return
+	}
+	db := DB()
+	rules := []*model.NetworkAclRule{}
+	if err = db.Where("acl_id = ?", subnet.AclID).Find(&rules).Error; err != nil {
+		log.Println("DB failed to query network acl rules", err)
+		return
+	}
+	subnetAcl = &SubnetAcl{Network: subnetCidr(subnet), Rules: aclRuleData(rules)}
+	return
+}
+
+// subnetGateways returns every gateway the subnet is attached to, the acl of the subnet is enforced on each of them
+func subnetGateways(subnet *model.Subnet) (gateways []*model.Gateway, err error) {
+	db := DB()
+	routed := &model.Subnet{Model: model.Model{ID: subnet.ID}}
+	if err = db.Preload("Routers").Take(routed).Error; err != nil {
+		log.Println("DB failed to query subnet gateways", err)
+		return
+	}
+	gateways = routed.Routers
+	if subnet.Router == 0 {
+		return
+	}
+	for _, gateway := range gateways {
+		if gateway.ID == subnet.Router {
+			return
+		}
+	}
+	gateway := &model.Gateway{Model: model.Model{ID: subnet.Router}}
+	if err = db.Take(gateway).Error; err != nil {
+		log.Println("DB failed to query gateway", err)
+		return
+	}
+	gateways = append(gateways, gateway)
+	return
+}
+
+// Apply enforces the acl of the subnet on its gateways, or clears it if the subnet has no acl
+func (a *AclAdmin) Apply(ctx context.Context, subnet *model.Subnet) (err error) {
+	gateways, err := subnetGateways(subnet)
+	if err != nil {
+		return
+	}
+	for _, gateway := range gateways {
+		if err = a.apply(ctx, gateway, subnet); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (a *AclAdmin) apply(ctx context.Context, gateway *model.Gateway, subnet *model.Subnet) (err error) {
+	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+	if gateway.Hyper == gateway.Peer {
+		control = fmt.Sprintf("inter=%d", gateway.Hyper)
+	}
+	subnetAcl, err := getSubnetAcl(subnet)
+	if err != nil {
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_subnet_acl.sh '%d' '%d' '%s'", gateway.ID, subnet.Vlan, subnetCidr(subnet))
+	if subnetAcl != nil {
+		var jsonData []byte
+		jsonData, err = json.Marshal(subnetAcl.Rules)
+		if err != nil {
+			log.Println("Failed to marshal acl rules", err)
+			return
+		}
+		command = fmt.Sprintf("/opt/cloudland/scripts/backend/apply_subnet_acl.sh '%d' '%d' '%s' <<EOF\n%s\nEOF", gateway.ID, subnet.Vlan, subnetAcl.Network, jsonData)
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Apply subnet acl failed", err)
+		return
+	}
+	return
+}
+
+func (a *AclAdmin) applyAll(ctx context.Context, subnets []*model.Subnet) (err error) {
+	for _, subnet := range subnets {
+		err = a.Apply(ctx, subnet)
+		if err != nil {
+			log.Println("Failed to apply subnet acl", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *AclAdmin) Create(ctx context.Context, name string, subnetIDs []int64) (acl *model.NetworkAcl, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	acl = &model.NetworkAcl{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: name}
+	if err = db.Create(acl).Error; err != nil {
+		log.Println("DB failed to create network acl", err)
+		return
+	}
+	_, err = a.Update(ctx, acl.ID, name, subnetIDs)
+	return
+}
+
+func (a *AclAdmin) Update(ctx context.Context, id int64, name string, subnetIDs []int64) (acl *model.NetworkAcl, err error) {
+	db := DB()
+	acl = &model.NetworkAcl{Model: model.Model{ID: id}}
+	if err = db.Preload("Subnets").Take(acl).Error; err != nil {
+		log.Println("DB failed to query network acl", err)
+		return
+	}
+	subnets := []*model.Subnet{}
+	if len(subnetIDs) > 0 {
+		if err = db.Preload("Routers").Where(subnetIDs).Find(&subnets).Error; err != nil {
+			log.Println("DB failed to query subnets", err)
+			return
+		}
+	}
+	for _, subnet := range subnets {
+		if subnet.Type != "internal" {
+			err = fmt.Errorf("Network acl can only be attached to internal subnets")
+			return
+		}
+		if subnet.Router == 0 && len(subnet.Routers) == 0 {
+			err = fmt.Errorf("Subnet %s is not attached to a gateway to enforce the network acl", subnet.Name)
+			return
+		}
+	}
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	if acl.Name != name {
+		if err = db.Model(acl).Update("name", name).Error; err != nil {
+			log.Println("DB failed to update network acl", err)
+			return
+		}
+	}
+	changed := []*model.Subnet{}
+	for _, subnet := range acl.Subnets {
+		found := false
+		for _, sID := range subnetIDs {
+			if subnet.ID == sID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			subnet.AclID = 0
+			if err = db.Model(subnet).Update("acl_id", 0).Error; err != nil {
+				log.Println("DB failed to detach network acl", err)
+				return
+			}
+			changed = append(changed, subnet)
+		}
+	}
+	for _, subnet := range subnets {
+		if subnet.AclID != acl.ID {
+			subnet.AclID = acl.ID
+			if err = db.Model(subnet).Update("acl_id", acl.ID).Error; err != nil {
+				log.Println("DB failed to attach network acl", err)
+				return
+			}
+			changed = append(changed, subnet)
+		}
+	}
+	acl.Name = name
+	acl.Subnets = subnets
+	err = a.applyAll(ctx, changed)
+	return
+}
+
+func (a *AclAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	acl := &model.NetworkAcl{Model: model.Model{ID: id}}
+	if err = db.Preload("Subnets").Take(acl).Error; err != nil {
+		log.Println("DB failed to query network acl", err)
+		return
+	}
+	if len(acl.Subnets) > 0 {
+		err = fmt.Errorf("Network acl is still attached to subnets")
+		return
+	}
+	if err = db.Where("acl_id = ?", id).Delete(&model.NetworkAclRule{}).Error; err != nil {
+		log.Println("DB failed to delete network acl rules", err)
+		return
+	}
+	if err = db.Delete(acl).Error; err != nil {
+		log.Println("DB failed to delete network acl", err)
+		return
+	}
+	return
+}
+
+func (a *AclAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, acls []*model.NetworkAcl, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	acls = []*model.NetworkAcl{}
+	if err = db.Model(&model.NetworkAcl{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count network acl(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Rules").Preload("Subnets").Where(where).Where(query).Find(&acls).Error; err != nil {
+		log.Println("DB failed to query network acl(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, acl := range acls {
+			acl.OwnerInfo = &model.Organization{Model: model.Model{ID: acl.Owner}}
+			if err = db.Take(acl.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (a *AclRuleAdmin) Create(ctx context.Context, aclID int64, number int32, action, direction, protocol, cidr string, portMin, portMax int32) (rule *model.NetworkAclRule, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if err = validateAclRule(number, action, direction, protocol, portMin, portMax); err != nil {
+		return
+	}
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		log.Println("Invalid cidr", err)
+		return
+	}
+	acl := &model.NetworkAcl{Model: model.Model{ID: aclID}}
+	if err = db.Preload("Subnets").Take(acl).Error; err != nil {
+		log.Println("DB failed to query network acl", err)
+		return
+	}
+	count := 0
+	if err = db.Model(&model.NetworkAclRule{}).Where("acl_id = ? and number = ?", aclID, number).Count(&count).Error; err != nil {
+		log.Println("DB failed to count network acl rules", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Rule number %d already exists", number)
+		return
+	}
+	rule = &model.NetworkAclRule{
+		Model:     model.Model{Creater: memberShip.UserID, Owner: acl.Owner},
+		AclID:     aclID,
+		Number:    number,
+		Action:    action,
+		Direction: direction,
+		Protocol:  protocol,
+		Cidr:      ipNet.String(),
+		PortMin:   portMin,
+		PortMax:   portMax,
+	}
+	if err = db.Create(rule).Error; err != nil {
+		log.Println("DB failed to create network acl rule", err)
+		return
+	}
+	err = aclAdmin.applyAll(ctx, acl.Subnets)
+	return
+}
+
+func (a *AclRuleAdmin) Delete(ctx context.Context, aclID, id int64) (err error) {
+	db := DB()
+	acl := &model.NetworkAcl{Model: model.Model{ID: aclID}}
+	if err = db.Preload("Subnets").Take(acl).Error; err != nil {
+		log.Println("DB failed to query network acl", err)
+		return
+	}
+	if err = db.Where("acl_id = ?", aclID).Delete(&model.NetworkAclRule{Model: model.Model{ID: id}}).Error; err != nil {
+		log.Println("DB failed to delete network acl rule", err)
+		return
+	}
+	err = aclAdmin.applyAll(ctx, acl.Subnets)
+	return
+}
+
+func (a *AclRuleAdmin) List(ctx context.Context, offset, limit int64, order string, aclID int64) (total int64, rules []*model.NetworkAclRule, err error) {
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "number"
+	}
+
+	where := fmt.Sprintf("acl_id = %d", aclID)
+	rules = []*model.NetworkAclRule{}
+	if err = db.Model(&model.NetworkAclRule{}).Where(where).Count(&total).Error; err != nil {
+		log.Println("DB failed to count network acl rule(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Where(where).Find(&rules).Error; err != nil {
+		log.Println("DB failed to query network acl rule(s), %v", err)
+		return
+	}
+
+	return
+}
+
+func (v *AclView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, acls, err := aclAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list network acl(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["Acls"] = acls
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"acls":  acls,
+			"total": total,
+			"pages": pages,
+			"query": query,
+		})
+		return
+	}
+	c.HTML(200, "acls")
+}
+
+func (v *AclView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.Params("id")
+	if id == "" {
+		c.Data["ErrorMsg"] = "Id is Empty"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	aclID, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("Invalid network acl ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, err := memberShip.CheckOwner(model.Writer, "network_acls", int64(aclID))
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = aclAdmin.Delete(c.Req.Context(), int64(aclID))
+	if err != nil {
+		log.Println("Failed to delete network acl", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "acls",
+	})
+	return
+}
+
+func (v *AclView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, subnets, err := subnetAdmin.List(c.Req.Context(), 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Subnets"] = subnets
+	c.HTML(200, "acls_new")
+}
+
+func (v *AclView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "network_acls", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	acl := &model.NetworkAcl{Model: model.Model{ID: id}}
+	if err = DB().Preload("Subnets").Take(acl).Error; err != nil {
+		log.Println("DB failed to query network acl", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, subnets, err := subnetAdmin.List(c.Req.Context(), 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Acl"] = acl
+	c.Data["Subnets"] = subnets
+	c.HTML(200, "acls_patch")
+}
+
+// getSubnetIDs checks the subnets can be written and that an acl attached by someone else is
+// not replaced, so a baseline acl can only be changed by its owner
+func (v *AclView) getSubnetIDs(c *macaron.Context, aclID int64) (subnetIDs []int64, err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	db := DB()
+	for _, s := range strings.Split(c.QueryTrim("subnets"), ",") {
+		if s == "" {
+			continue
+		}
+		var sID int
+		sID, err = strconv.Atoi(s)
+		if err != nil {
+			log.Println("Invalid subnet ID", err)
+			return
+		}
+		permit, _ := memberShip.CheckOwner(model.Writer, "subnets", int64(sID))
+		if !permit {
+			err = fmt.Errorf("Not authorized to access subnet %d", sID)
+			return
+		}
+		subnet := &model.Subnet{Model: model.Model{ID: int64(sID)}}
+		if err = db.Take(subnet).Error; err != nil {
+			log.Println("DB failed to query subnet", err)
+			return
+		}
+		if subnet.AclID > 0 && subnet.AclID != aclID {
+			permit, _ = memberShip.CheckOwner(model.Writer, "network_acls", subnet.AclID)
+			if !permit {
+				err = fmt.Errorf("Subnet %d has a network acl which can not be replaced", sID)
+				return
+			}
+		}
+		subnetIDs = append(subnetIDs, int64(sID))
+	}
+	return
+}
+
+func (v *AclView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../acls"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "network_acls", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	name := c.QueryTrim("name")
+	subnetIDs, err := v.getSubnetIDs(c, id)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	acl, err := aclAdmin.Update(c.Req.Context(), id, name, subnetIDs)
+	if err != nil {
+		log.Println("Failed to update network acl", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, acl)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *AclView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../acls"
+	name := c.QueryTrim("name")
+	subnetIDs, err := v.getSubnetIDs(c, 0)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	acl, err := aclAdmin.Create(c.Req.Context(), name, subnetIDs)
+	if err != nil {
+		log.Println("Failed to create network acl", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, acl)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *AclRuleView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	aclID := c.ParamsInt64("aclid")
+	permit, err := memberShip.CheckOwner(model.Reader, "network_acls", aclID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	total, rules, err := aclRuleAdmin.List(c.Req.Context(), offset, limit, order, aclID)
+	if err != nil {
+		log.Println("Failed to list network acl rule(s)", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["AclRules"] = rules
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"aclrules": rules,
+			"total":    total,
+			"pages":    pages,
+		})
+		return
+	}
+	c.HTML(200, "aclrules")
+}
+
+func (v *AclRuleView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	aclID := c.ParamsInt64("aclid")
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "network_acls", aclID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = aclRuleAdmin.Delete(c.Req.Context(), aclID, id)
+	if err != nil {
+		log.Println("Failed to delete network acl rule", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "rules",
+	})
+	return
+}
+
+func (v *AclRuleView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	aclID := c.ParamsInt64("aclid")
+	permit, _ := memberShip.CheckOwner(model.Writer, "network_acls", aclID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.HTML(200, "aclrules_new")
+}
+
+func (v *AclRuleView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	aclID := c.ParamsInt64("aclid")
+	permit, err := memberShip.CheckOwner(model.Writer, "network_acls", aclID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../rules"
+	number := c.QueryInt("number")
+	action := c.QueryTrim("action")
+	direction := c.QueryTrim("direction")
+	protocol := c.QueryTrim("protocol")
+	cidr := c.QueryTrim("cidr")
+	portMin := -1
+	portMax := -1
+	if c.QueryTrim("portmin") != "" {
+		portMin = c.QueryInt("portmin")
+		portMax = portMin
+	}
+	if c.QueryTrim("portmax") != "" {
+		portMax = c.QueryInt("portmax")
+	}
+	rule, err := aclRuleAdmin.Create(c.Req.Context(), aclID, int32(number), action, direction, protocol, cidr, int32(portMin), int32(portMax))
+	if err != nil {
+		log.Println("Failed to create network acl rule", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, rule)
+		return
+	}
+	c.Redirect(redirectTo)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestValidateAclRule(t *testing.T) {
+	cases := []struct {
+		number    int32
+		action    string
+		direction string
+		protocol  string
+		portMin   int32
+		portMax   int32
+		ok        bool
+	}{
+		{100, "allow", "ingress", "tcp", 22, 22, true},
+		{100, "deny", "egress", "udp", 1000, 2000, true},
+		{100, "allow", "ingress", "tcp", -1, -1, true},
+		{100, "allow", "ingress", "icmp", 8, 0, false},
+		{100, "allow", "ingress", "icmp", 0, 8, true},
+		{100, "allow", "ingress", "icmp", -1, -1, true},
+		{100, "allow", "ingress", "all", -5, 70000, true},
+		{0, "allow", "ingress", "tcp", 22, 22, false},
+		{100, "accept", "ingress", "tcp", 22, 22, false},
+		{100, "allow", "inbound", "tcp", 22, 22, false},
+		{100, "allow", "ingress", "gre", -1, -1, false},
+		{100, "allow", "ingress", "tcp", -2, 22, false},
+		{100, "allow", "ingress", "tcp", -1, 22, false},
+		{100, "allow", "ingress", "udp", 2000, 1000, false},
+		{100, "allow", "ingress", "tcp", 22, 65536, false},
+		{100, "allow", "ingress", "icmp", 0, 256, false},
+	}
+	for _, tc := range cases {
+		err := validateAclRule(tc.number, tc.action, tc.direction, tc.protocol, tc.portMin, tc.portMax)
+		if tc.ok && err != nil {
+			t.Errorf("rule %v unexpectedly rejected: %v", tc, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("rule %v unexpectedly accepted", tc)
+		}
+	}
+}
+
+func TestAclRuleData(t *testing.T) {
+	rules := []*model.NetworkAclRule{
+		{Number: 300, Action: "deny", Protocol: "all"},
+		{Number: 100, Action: "allow", Protocol: "tcp", PortMin: 22, PortMax: 22},
+		{Number: 200, Action: "allow", Protocol: "icmp", PortMin: -1, PortMax: -1},
+	}
+	data := aclRuleData(rules)
+	cases := []struct {
+		action   string
+		protocol string
+	}{
+		{"allow", "tcp"},
+		{"allow", "icmp"},
+		{"deny", "all"},
+	}
+	if len(data) != len(cases) {
+		t.Fatal(data)
+	}
+	for i, tc := range cases {
+		if data[i].Action != tc.action || data[i].Protocol != tc.protocol {
+			t.Errorf("rule %d is %v, expected %v", i, data[i], tc)
+		}
+	}
+	if rules[0].Number != 300 {
+		t.Error("rules sorted in place")
+	}
+	if data = aclRuleData(nil); data == nil || len(data) != 0 {
+		t.Error("no rules should give an empty list")
+	}
+}
@@ -45,82 +45,82 @@ func (a *OpenshiftAdmin) createSecgroup(ctx context.Context, name, cidr string,
 		log.Println("Failed to create security group with default rules", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 6443, 6443)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 6443, 6443)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 22623, 22623)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 22623, 22623)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 443, 443)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 443, 443)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 80, 80)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 80, 80)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 53, 53)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 53, 53)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "udp", 53, 53)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "udp", 53, 53)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 8080, 8080)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 8080, 8080)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 2379, 2380)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 2379, 2380)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 2049, 2049)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 2049, 2049)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 9000, 9999)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 9000, 9999)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "tcp", 10249, 10259)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "tcp", 10249, 10259)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 9000, 9999)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 9000, 9999)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 4789, 4789)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 4789, 4789)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 2049, 2049)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 2049, 2049)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 6081, 6081)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 6081, 6081)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, "ingress", "udp", 30000, 32767)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, cidr, 0, "ingress", "udp", 30000, 32767)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
@@ -0,0 +1,159 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	restModels "github.com/IBM/cloudland/web/rest-api/rest/models"
+	"github.com/go-openapi/strfmt"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var imageMemberInstance = &ImageMemberRest{}
+
+type ImageMemberRest struct{}
+
+func imageMemberItem(imageUUID string, member *model.ImageMember) *restModels.Member {
+	creatAt, _ := strfmt.ParseDateTime(member.CreatedAt.Format(time.RFC3339))
+	updateAt, _ := strfmt.ParseDateTime(member.UpdatedAt.Format(time.RFC3339))
+	item := &restModels.Member{
+		CreatedAt: creatAt,
+		ImageID:   imageUUID,
+		Schema:    `/v2/schemas/member`,
+		Status:    member.Status,
+		UpdatedAt: updateAt,
+	}
+	if member.MemberInfo != nil {
+		item.MemberID = member.MemberInfo.UUID
+	}
+	return item
+}
+
+// checkImageMemberOwner resolves the image of the request and makes sure it is owned by the project of the token
+func checkImageMemberOwner(c *macaron.Context) (imageUUID string, imageID int64, err error) {
+	if _, _, err = ChecKPermissionWithErrorResp(model.Writer, c); err != nil {
+		return
+	}
+	imageUUID = c.Params("id")
+	if err = CheckResWithErrorResponse("images", imageUUID, c); err != nil {
+		return
+	}
+	imageID = c.Data[imageUUID].(int64)
+	permit, err := GetMemberShip(c.Req.Context()).CheckOwner(model.Writer, "images", imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewResponseError("Image member fail", err.Error(), http.StatusInternalServerError))
+		return
+	} else if !permit {
+		code := http.StatusForbidden
+		c.JSON(code, NewResponseError("Image member fail", "image is not owned by the project", code))
+		err = fmt.Errorf("image is not owned by the project")
+	}
+	return
+}
+
+// List returns the members of an image like glance GET /v2/images/{image_id}/members
+func (v *ImageMemberRest) List(c *macaron.Context) {
+	imageUUID, imageID, err := checkImageMemberOwner(c)
+	if err != nil {
+		return
+	}
+	members, err := imageMemberAdmin.List(c.Req.Context(), imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewResponseError("List image members fail", err.Error(), http.StatusInternalServerError))
+		return
+	}
+	items := restModels.Members{}
+	for _, member := range members {
+		items = append(items, imageMemberItem(imageUUID, member))
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"members": items,
+		"schema":  `/v2/schemas/members`,
+	})
+}
+
+// Create shares an image with a project like glance POST /v2/images/{image_id}/members
+func (v *ImageMemberRest) Create(c *macaron.Context) {
+	imageUUID, imageID, err := checkImageMemberOwner(c)
+	if err != nil {
+		return
+	}
+	body, _ := c.Req.Body().Bytes()
+	requestData := &restModels.CreateImageMemberParamsBody{}
+	if err = json.Unmarshal(body, requestData); err != nil || requestData.Member == nil {
+		code := http.StatusBadRequest
+		c.JSON(code, NewResponseError("Unmarshal fail", "member is required", code))
+		return
+	}
+	if err = CheckResWithErrorResponse("organizations", *requestData.Member, c); err != nil {
+		return
+	}
+	member, err := imageMemberAdmin.Create(c.Req.Context(), imageID, c.Data[*requestData.Member].(int64))
+	if err != nil {
+		code := http.StatusConflict
+		c.JSON(code, NewResponseError("Create image member fail", err.Error(), code))
+		return
+	}
+	c.JSON(http.StatusOK, imageMemberItem(imageUUID, member))
+}
+
+// Update accepts or rejects an image shared with the project like glance PUT /v2/images/{image_id}/members/{member_id}
+func (v *ImageMemberRest) Update(c *macaron.Context) {
+	if _, _, err := ChecKPermissionWithErrorResp(model.Writer, c); err != nil {
+		return
+	}
+	imageUUID := c.Params("id")
+	if err := CheckResWithErrorResponse("images", imageUUID, c); err != nil {
+		return
+	}
+	memberShip := GetMemberShip(c.Req.Context())
+	org := &model.Organization{Model: model.Model{ID: memberShip.OrgID}}
+	if err := DB().Take(org).Error; err != nil || org.UUID != c.Params("member_id") {
+		code := http.StatusForbidden
+		c.JSON(code, NewResponseError("Update image member fail", "only the member can update its status", code))
+		return
+	}
+	body, _ := c.Req.Body().Bytes()
+	requestData := &restModels.UpdateImageMemberParamsBody{}
+	if err := json.Unmarshal(body, requestData); err != nil {
+		code := http.StatusBadRequest
+		c.JSON(code, NewResponseError("Unmarshal fail", err.Error(), code))
+		return
+	}
+	member, err := imageMemberAdmin.Update(c.Req.Context(), c.Data[imageUUID].(int64), requestData.Status)
+	if err != nil {
+		code := http.StatusBadRequest
+		c.JSON(code, NewResponseError("Update image member fail", err.Error(), code))
+		return
+	}
+	member.MemberInfo = org
+	c.JSON(http.StatusOK, imageMemberItem(imageUUID, member))
+}
+
+// Delete stops sharing an image with a project like glance DELETE /v2/images/{image_id}/members/{member_id}
+func (v *ImageMemberRest) Delete(c *macaron.Context) {
+	_, imageID, err := checkImageMemberOwner(c)
+	if err != nil {
+		return
+	}
+	memberUUID := c.Params("member_id")
+	if err = CheckResWithErrorResponse("organizations", memberUUID, c); err != nil {
+		return
+	}
+	if err = imageMemberAdmin.Delete(c.Req.Context(), imageID, c.Data[memberUUID].(int64)); err != nil {
+		code := http.StatusNotFound
+		c.JSON(code, NewResponseError("Delete image member fail", err.Error(), code))
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -10,6 +10,7 @@ package routes
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/IBM/cloudland/web/clui/model"
@@ -32,7 +33,7 @@ func (v *ImageRest) List(c *macaron.Context) {
 	if order == "" {
 		order = "-created_at"
 	}
-	_, images, err := imageAdmin.List(offset, limit, order, "")
+	_, images, err := imageAdmin.List(c.Req.Context(), offset, limit, order, "", c.Query("visibility"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, NewResponseError("List images fail", err.Error(), http.StatusInternalServerError))
 		return
@@ -115,3 +116,61 @@ func (v *ImageRest) Create(c *macaron.Context) {
 	c.JSON(http.StatusCreated, imageOK)
 
 }
+
+// Upload stores image data like glance PUT /v2/images/{image_id}/file, Content-Range chunks resume an interrupted upload
+func (v *ImageRest) Upload(c *macaron.Context) {
+	_, oid, err := ChecKPermissionWithErrorResp(model.Writer, c)
+	if err != nil {
+		return
+	}
+	imageUUID := c.Params("id")
+	if err = CheckResWithErrorResponse("images", imageUUID, c); err != nil {
+		return
+	}
+	id := c.Data[imageUUID].(int64)
+	image := &model.Image{Model: model.Model{ID: id}}
+	if err = DB().Take(image).Error; err != nil || image.Owner != oid {
+		code := http.StatusForbidden
+		c.JSON(code, NewResponseError("Upload image fail", "image is not owned by the project", code))
+		return
+	}
+	var start, end, total int64 = 0, -1, -1
+	if header := c.Req.Header.Get("Content-Range"); header != "" {
+		if start, end, total, err = parseContentRange(header); err != nil {
+			code := http.StatusBadRequest
+			c.JSON(code, NewResponseError("Upload image fail", err.Error(), code))
+			return
+		}
+	}
+	image, offset, err := imageAdmin.Upload(c.Req.Context(), id, c.Req.Request.Body, start, end, total)
+	c.Resp.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	if err != nil {
+		code := http.StatusConflict
+		c.JSON(code, NewResponseError("Upload image fail", err.Error(), code))
+		return
+	}
+	if image.Status == "uploading" {
+		c.Status(http.StatusAccepted)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Download returns image data like glance GET /v2/images/{image_id}/file
+func (v *ImageRest) Download(c *macaron.Context) {
+	_, _, err := ChecKPermissionWithErrorResp(model.Reader, c)
+	if err != nil {
+		return
+	}
+	imageUUID := c.Params("id")
+	if err = CheckResWithErrorResponse("images", imageUUID, c); err != nil {
+		return
+	}
+	image, resp, err := imageAdmin.Download(c.Req.Context(), c.Data[imageUUID].(int64), c.Req.Method, c.Req.Header.Get("Range"))
+	if err != nil {
+		code := http.StatusConflict
+		c.JSON(code, NewResponseError("Download image fail", err.Error(), code))
+		return
+	}
+	writeImageData(c.Resp, image, resp)
+}
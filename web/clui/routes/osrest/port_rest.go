@@ -0,0 +1,154 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	restModels "github.com/IBM/cloudland/web/rest-api/rest/models"
+	"github.com/go-openapi/strfmt"
+	"github.com/jinzhu/gorm"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	portInstance = &PortRest{}
+)
+
+type PortRest struct{}
+
+func portDeviceOwner(iface *model.Interface) string {
+	switch {
+	case iface.Type == "instance":
+		return "compute:cloudland"
+	case iface.Type == "dhcp":
+		return "network:dhcp"
+	case iface.Type == "floating":
+		return "network:floatingip"
+	case iface.Type == "gateway_public", iface.Type == "gateway_private":
+		return "network:router_gateway"
+	case strings.Contains(iface.Type, "gateway"):
+		return "network:router_interface"
+	}
+	return ""
+}
+
+func toPort(iface *model.Interface) (port *restModels.Port) {
+	creatAt, _ := strfmt.ParseDateTime(iface.CreatedAt.Format(time.RFC3339))
+	updateAt, _ := strfmt.ParseDateTime(iface.UpdatedAt.Format(time.RFC3339))
+	port = &restModels.Port{
+		AdminStateUp:        true,
+		AllowedAddressPairs: []*restModels.PortAllowedAddressPairsItems{},
+		CreatedAt:           creatAt,
+		DeviceOwner:         portDeviceOwner(iface),
+		FixedIps:            []*restModels.PortFixedIpsItems{},
+		ID:                  iface.UUID,
+		MacAddress:          iface.MacAddr,
+		Mtu:                 int64(iface.Mtu),
+		Name:                iface.Name,
+		PortSecurityEnabled: len(iface.Secgroups) > 0,
+		ProjectID:           "default",
+		SecurityGroups:      []string{},
+		Status:              restModels.PortStatusACTIVE,
+		TenantID:            "default",
+		UpdatedAt:           updateAt,
+	}
+	if iface.Instance > 0 {
+		instance := &model.Instance{Model: model.Model{ID: iface.Instance}}
+		if err := DB().Take(instance).Error; err == nil {
+			port.DeviceID = instance.UUID
+			if instance.Status != "running" {
+				port.Status = restModels.PortStatusDOWN
+			}
+		}
+	}
+	if iface.Address != nil && iface.Address.Subnet != nil {
+		subnet := iface.Address.Subnet
+		if subnet.Netlink != nil {
+			port.NetworkID = subnet.Netlink.UUID
+		}
+		port.FixedIps = append(port.FixedIps, &restModels.PortFixedIpsItems{
+			IPAddress: strings.Split(iface.Address.Address, "/")[0],
+			SubnetID:  subnet.UUID,
+		})
+	}
+	// same as neutron, a pair without mac address is allowed with the mac address of the port
+	for _, pair := range iface.AddrPairs {
+		macAddr := pair.MacAddr
+		if macAddr == "" {
+			macAddr = iface.MacAddr
+		}
+		port.AllowedAddressPairs = append(port.AllowedAddressPairs, &restModels.PortAllowedAddressPairsItems{
+			IPAddress:  pair.IpAddress,
+			MacAddress: macAddr,
+		})
+	}
+	for _, secgroup := range iface.Secgroups {
+		port.SecurityGroups = append(port.SecurityGroups, secgroup.UUID)
+	}
+	return
+}
+
+func (v *PortRest) ListPorts(c *macaron.Context) {
+	_, oid, err := ChecKPermissionWithErrorResp(model.Reader, c)
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+	db := DB()
+	ifaces := []*model.Interface{}
+	db = db.Preload("Address").Preload("Address.Subnet").Preload("Address.Subnet.Netlink").Preload("Secgroups").Preload("AddrPairs")
+	query := db.Where("owner = ?", oid)
+	if deviceID := c.QueryTrim("device_id"); deviceID != "" {
+		instance := &model.Instance{}
+		if err = DB().Where("uuid = ? and owner = ?", deviceID, oid).Take(instance).Error; err != nil {
+			c.JSON(200, &restModels.ListPortsOKBody{Ports: restModels.Ports{}})
+			return
+		}
+		query = query.Where("instance = ?", instance.ID)
+	}
+	if err = query.Order("created_at").Find(&ifaces).Error; err != nil {
+		code := http.StatusInternalServerError
+		c.JSON(code, NewResponseError("List ports fail", err.Error(), code))
+		return
+	}
+	networkID := c.QueryTrim("network_id")
+	ports := restModels.Ports{}
+	for _, iface := range ifaces {
+		port := toPort(iface)
+		if networkID != "" && port.NetworkID != networkID {
+			continue
+		}
+		ports = append(ports, port)
+	}
+	c.JSON(200, &restModels.ListPortsOKBody{Ports: ports})
+}
+
+func (v *PortRest) ShowPort(c *macaron.Context) {
+	_, oid, err := ChecKPermissionWithErrorResp(model.Reader, c)
+	if err != nil {
+		log.Print(err.Error())
+		return
+	}
+	uuid := c.Params("id")
+	iface := &model.Interface{}
+	db := DB().Preload("Address").Preload("Address.Subnet").Preload("Address.Subnet.Netlink").Preload("Secgroups").Preload("AddrPairs")
+	if err = db.Where("uuid = ? and owner = ?", uuid, oid).Take(iface).Error; err != nil {
+		code := http.StatusInternalServerError
+		if gorm.IsRecordNotFoundError(err) {
+			code = http.StatusNotFound
+		}
+		c.JSON(code, NewResponseError(fmt.Sprintf("fail to show port: %s", uuid), err.Error(), code))
+		return
+	}
+	c.JSON(200, &restModels.ShowPortOKBody{Port: toPort(iface)})
+}
@@ -28,6 +28,7 @@ var (
 		"network":       `/v2.0/networks`,
 		"identity":      `/identity`,
 		"subnet":        `/v2.0/subnets`,
+		"port":          `/v2.0/ports`,
 		"identityToken": "/identity/v3/auth/tokens",
 		"flavor":        "/compute/v2.1/flavors",
 	}
@@ -70,6 +71,17 @@ func Rest() (m *macaron.Macaron) {
 	m.Get(resourceEndpoints["subnet"], subnetInstance.ListSubnets)
 	m.Post(resourceEndpoints["subnet"], subnetInstance.CreateSubnet)
 	m.Delete(resourceEndpoints["subnet"]+`/:id`, subnetInstance.DeleteSubnet)
+	//neutron port API
+	m.Get(resourceEndpoints["port"], portInstance.ListPorts)
+	m.Get(resourceEndpoints["port"]+`/:id`, portInstance.ShowPort)
+	//glance image data
+	m.Put(resourceEndpoints["image"]+`/v2/images/:id/file`, imageInstance.Upload)
+	m.Get(resourceEndpoints["image"]+`/v2/images/:id/file`, imageInstance.Download)
+	//glance image members
+	m.Get(resourceEndpoints["image"]+`/v2/images/:id/members`, imageMemberInstance.List)
+	m.Post(resourceEndpoints["image"]+`/v2/images/:id/members`, imageMemberInstance.Create)
+	m.Put(resourceEndpoints["image"]+`/v2/images/:id/members/:member_id`, imageMemberInstance.Update)
+	m.Delete(resourceEndpoints["image"]+`/v2/images/:id/members/:member_id`, imageMemberInstance.Delete)
 	//nova flavor
 	m.Get(resourceEndpoints["flavor"]+`/detail`, flavorInstance.ListFlavorsDetail)
 	m.Get(resourceEndpoints["flavor"], flavorInstance.ListFlavors)
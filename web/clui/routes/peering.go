@@ -0,0 +1,651 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	peeringAdmin = &PeeringAdmin{}
+	peeringView  = &PeeringView{}
+	slotLocker   = sync.Mutex{}
+)
+
+const maxPeeringSlot = 8191
+
+type PeeringAdmin struct{}
+type PeeringView struct{}
+
+func init() {
+	dbs.AutoUpgrade("0003-GatewayPeering-0001-Slot", assignPeeringSlots)
+}
+
+// Transit links are carved as /30 out of 169.254.0.0/17, away from the vrrp addresses
+func peeringAddrs(slot int32) (localAddr, peerAddr string) {
+	base := uint32(169)<<24 | uint32(254)<<16 | uint32(slot)*4
+	localAddr = fmt.Sprintf("%s/30", net.IPv4(byte(base>>24), byte(base>>16), byte(base>>8), byte(base+1)).String())
+	peerAddr = fmt.Sprintf("%s/30", net.IPv4(byte(base>>24), byte(base>>16), byte(base>>8), byte(base+2)).String())
+	return
+}
+
+// peeringSlot returns the slot of a transit link local address, 0 when the address is not on a link
+func peeringSlot(localAddr string) int32 {
+	ip, _, err := net.ParseCIDR(localAddr)
+	if err != nil || ip.To4() == nil {
+		return 0
+	}
+	ip = ip.To4()
+	slot := int32(ip[2])<<6 | int32(ip[3])>>2
+	if local, _ := peeringAddrs(slot); slot > maxPeeringSlot || local != localAddr {
+		return 0
+	}
+	return slot
+}
+
+// freePeeringSlot returns the lowest slot not in use, 0 when all are taken
+func freePeeringSlot(used []int32) int32 {
+	taken := make(map[int32]bool)
+	for _, slot := range used {
+		taken[slot] = true
+	}
+	for slot := int32(1); slot <= maxPeeringSlot; slot++ {
+		if !taken[slot] {
+			return slot
+		}
+	}
+	return 0
+}
+
+// allocPeeringSlot assigns a free transit link to a peering, the slots of deleted peerings are reused
+func allocPeeringSlot(peering *model.GatewayPeering) (err error) {
+	slotLocker.Lock()
+	defer slotLocker.Unlock()
+	db := DB()
+	used := []int32{}
+	if err = db.Model(&model.GatewayPeering{}).Where("slot > 0").Pluck("slot", &used).Error; err != nil {
+		log.Println("DB failed to query peering slots", err)
+		return
+	}
+	peering.Slot = freePeeringSlot(used)
+	if peering.Slot == 0 {
+		err = fmt.Errorf("No transit link available for peering")
+		return
+	}
+	peering.LocalAddr, peering.PeerAddr = peeringAddrs(peering.Slot)
+	if err = db.Save(peering).Error; err != nil {
+		log.Println("DB failed to save gateway peering", err)
+		return
+	}
+	return
+}
+
+// assignPeeringSlots tracks the links of peerings created before slots were, a peering keeps the link of its addresses
+// unless another one already holds it, then it gets a free link which is set up when the peering is connected again
+func assignPeeringSlots(db *gorm.DB) (err error) {
+	peerings := []*model.GatewayPeering{}
+	if err = db.Where("slot = 0 and status <> 'rejected'").Order("id").Find(&peerings).Error; err != nil {
+		log.Println("DB failed to query gateway peerings", err)
+		return
+	}
+	used := []int32{}
+	if err = db.Model(&model.GatewayPeering{}).Where("slot > 0").Pluck("slot", &used).Error; err != nil {
+		log.Println("DB failed to query peering slots", err)
+		return
+	}
+	taken := make(map[int32]bool)
+	for _, slot := range used {
+		taken[slot] = true
+	}
+	for _, peering := range peerings {
+		slot := peeringSlot(peering.LocalAddr)
+		if slot == 0 || taken[slot] {
+			if slot = freePeeringSlot(used); slot == 0 {
+				err = fmt.Errorf("No transit link available for peering %d", peering.ID)
+				return
+			}
+			peering.LocalAddr, peering.PeerAddr = peeringAddrs(slot)
+		}
+		taken[slot] = true
+		used = append(used, slot)
+		if err = db.Model(peering).Updates(map[string]interface{}{
+			"slot":       slot,
+			"local_addr": peering.LocalAddr,
+			"peer_addr":  peering.PeerAddr}).Error; err != nil {
+			log.Println("DB failed to update gateway peering", err)
+			return
+		}
+	}
+	return
+}
+
+func gatewayNets(gateway *model.Gateway) (nets []*net.IPNet) {
+	for _, subnet := range gateway.Subnets {
+		inNet := &net.IPNet{
+			IP:   net.ParseIP(subnet.Network),
+			Mask: net.IPMask(net.ParseIP(subnet.Netmask).To4()),
+		}
+		_, ipNet, err := net.ParseCIDR(inNet.String())
+		if err != nil {
+			log.Println("CIDR parsing failed", err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return
+}
+
+func (a *PeeringAdmin) checkOverlap(gateway, peerGateway *model.Gateway) (err error) {
+	if cidrsOverlap(gatewayNets(gateway), gatewayNets(peerGateway)) {
+		err = fmt.Errorf("Subnets of gateway %s overlap with subnets of gateway %s", gateway.Name, peerGateway.Name)
+		return
+	}
+	return
+}
+
+func (a *PeeringAdmin) connect(ctx context.Context, peering *model.GatewayPeering) (err error) {
+	sides := []struct {
+		gateway *model.Gateway
+		remote  *model.Gateway
+		addr    string
+		nexthop string
+	}{
+		{peering.Gateway, peering.PeerGateway, peering.LocalAddr, peering.PeerAddr},
+		{peering.PeerGateway, peering.Gateway, peering.PeerAddr, peering.LocalAddr},
+	}
+	for _, side := range sides {
+		routes := []*StaticRoute{}
+		for _, ipNet := range gatewayNets(side.remote) {
+			routes = append(routes, &StaticRoute{Destination: ipNet.String(), Nexthop: strings.Split(side.nexthop, "/")[0]})
+		}
+		var jsonData []byte
+		jsonData, err = json.Marshal(routes)
+		if err != nil {
+			log.Println("Failed to marshal peering routes", err)
+			return
+		}
+		subnet := &model.Subnet{Gateway: side.addr, Vlan: peering.Vni, Type: "internal", Routes: string(jsonData)}
+		err = setRouting(ctx, side.gateway.ID, subnet, false)
+		if err != nil {
+			log.Println("Failed to set peering routes", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *PeeringAdmin) disconnect(ctx context.Context, peering *model.GatewayPeering) (err error) {
+	sides := []struct {
+		gateway *model.Gateway
+		addr    string
+	}{
+		{peering.Gateway, peering.LocalAddr},
+		{peering.PeerGateway, peering.PeerAddr},
+	}
+	for _, side := range sides {
+		if side.gateway == nil || side.gateway.ID == 0 {
+			continue
+		}
+		control := fmt.Sprintf("toall=router-%d:%d,%d", side.gateway.ID, side.gateway.Hyper, side.gateway.Peer)
+		if side.gateway.Hyper == side.gateway.Peer {
+			control = fmt.Sprintf("inter=%d", side.gateway.Hyper)
+		}
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_gateway.sh 'router-%d' '%s' '%d'", side.gateway.ID, side.addr, peering.Vni)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Clear peering link failed", err)
+			return
+		}
+	}
+	return
+}
+
+func (a *PeeringAdmin) Create(ctx context.Context, name string, gatewayID, peerGatewayID int64) (peering *model.GatewayPeering, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if gatewayID == peerGatewayID {
+		err = fmt.Errorf("Can not peer a gateway with itself")
+		return
+	}
+	gateway := &model.Gateway{Model: model.Model{ID: gatewayID}}
+	if err = db.Set("gorm:auto_preload", true).Take(gateway).Error; err != nil {
+		log.Println("DB failed to query gateway", err)
+		return
+	}
+	peerGateway := &model.Gateway{Model: model.Model{ID: peerGatewayID}}
+	if err = db.Set("gorm:auto_preload", true).Take(peerGateway).Error; err != nil {
+		log.Println("DB failed to query peer gateway", err)
+		err = fmt.Errorf("Peer gateway not found")
+		return
+	}
+	count := 0
+	err = db.Model(&model.GatewayPeering{}).Where("(gateway_id = ? and peer_gateway_id = ?) or (gateway_id = ? and peer_gateway_id = ?)", gatewayID, peerGatewayID, peerGatewayID, gatewayID).Where("status != 'rejected'").Count(&count).Error
+	if err != nil {
+		log.Println("DB failed to count gateway peerings", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Peering between the gateways already exists")
+		return
+	}
+	err = a.checkOverlap(gateway, peerGateway)
+	if err != nil {
+		log.Println("Gateway subnets overlap", err)
+		return
+	}
+	vni, err := getValidVni()
+	if err != nil {
+		log.Println("Failed to get valid vni", err)
+		return
+	}
+	peering = &model.GatewayPeering{
+		Model:         model.Model{Creater: memberShip.UserID, Owner: gateway.Owner},
+		Name:          name,
+		Status:        "pending",
+		GatewayID:     gateway.ID,
+		PeerGatewayID: peerGateway.ID,
+		PeerOwner:     peerGateway.Owner,
+		Vni:           int64(vni),
+	}
+	if err = db.Create(peering).Error; err != nil {
+		log.Println("DB failed to create gateway peering", err)
+		return
+	}
+	if err = allocPeeringSlot(peering); err != nil {
+		log.Println("Failed to allocate peering slot", err)
+		db.Delete(peering)
+		return
+	}
+	peering.Gateway = gateway
+	peering.PeerGateway = peerGateway
+	if peerGateway.Owner == gateway.Owner {
+		err = a.Accept(ctx, peering.ID)
+		if err != nil {
+			log.Println("Failed to accept gateway peering", err)
+			return
+		}
+		peering.Status = "active"
+	}
+	return
+}
+
+func (a *PeeringAdmin) Accept(ctx context.Context, id int64) (err error) {
+	db := DB()
+	peering := &model.GatewayPeering{Model: model.Model{ID: id}}
+	if err = db.Preload("Gateway").Preload("Gateway.Subnets").Preload("PeerGateway").Preload("PeerGateway.Subnets").Take(peering).Error; err != nil {
+		log.Println("DB failed to query gateway peering", err)
+		return
+	}
+	if peering.Status != "pending" {
+		err = fmt.Errorf("Peering is not pending for acceptance")
+		return
+	}
+	if peering.Gateway.Hyper < 0 || peering.PeerGateway.Hyper < 0 {
+		err = fmt.Errorf("Gateways are not active yet")
+		return
+	}
+	err = a.checkOverlap(peering.Gateway, peering.PeerGateway)
+	if err != nil {
+		log.Println("Gateway subnets overlap", err)
+		return
+	}
+	err = a.connect(ctx, peering)
+	if err != nil {
+		log.Println("Failed to connect gateways", err)
+		return
+	}
+	peering.Status = "active"
+	if err = db.Model(peering).Update("status", peering.Status).Error; err != nil {
+		log.Println("DB failed to update gateway peering", err)
+		return
+	}
+	return
+}
+
+func (a *PeeringAdmin) Reject(ctx context.Context, id int64) (err error) {
+	db := DB()
+	peering := &model.GatewayPeering{Model: model.Model{ID: id}}
+	if err = db.Take(peering).Error; err != nil {
+		log.Println("DB failed to query gateway peering", err)
+		return
+	}
+	if peering.Status != "pending" {
+		err = fmt.Errorf("Peering is not pending for acceptance")
+		return
+	}
+	// a rejected peering is never connected, its transit link is released like a deleted one
+	if err = db.Model(peering).Updates(map[string]interface{}{
+		"status":     "rejected",
+		"slot":       0,
+		"local_addr": "",
+		"peer_addr":  ""}).Error; err != nil {
+		log.Println("DB failed to update gateway peering", err)
+		return
+	}
+	return
+}
+
+// Refresh re-pushes peering routes after the subnets of a gateway changed, it stops at the first peering failing
+func (a *PeeringAdmin) Refresh(ctx context.Context, gatewayID int64) (err error) {
+	db := DB()
+	peerings := []*model.GatewayPeering{}
+	if err = db.Preload("Gateway").Preload("Gateway.Subnets").Preload("PeerGateway").Preload("PeerGateway.Subnets").Where("gateway_id = ? or peer_gateway_id = ?", gatewayID, gatewayID).Where("status = 'active'").Find(&peerings).Error; err != nil {
+		log.Println("DB failed to query gateway peerings", err)
+		return
+	}
+	for _, peering := range peerings {
+		err = a.checkOverlap(peering.Gateway, peering.PeerGateway)
+		if err != nil {
+			log.Println("Gateway subnets overlap, peering routes not updated", err)
+			err = fmt.Errorf("Peering %s not refreshed: %v", peering.Name, err)
+			return
+		}
+		err = a.connect(ctx, peering)
+		if err != nil {
+			log.Println("Failed to refresh peering routes", err)
+			err = fmt.Errorf("Peering %s not refreshed: %v", peering.Name, err)
+			return
+		}
+	}
+	return
+}
+
+func (a *PeeringAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	peering := &model.GatewayPeering{Model: model.Model{ID: id}}
+	if err = db.Preload("Gateway").Preload("PeerGateway").Take(peering).Error; err != nil {
+		log.Println("DB failed to query gateway peering", err)
+		return
+	}
+	if peering.Status == "active" {
+		err = a.disconnect(ctx, peering)
+		if err != nil {
+			log.Println("Failed to disconnect gateways", err)
+			return
+		}
+	}
+	if err = db.Delete(peering).Error; err != nil {
+		log.Println("DB failed to delete gateway peering", err)
+		return
+	}
+	return
+}
+
+func (a *PeeringAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, peerings []*model.GatewayPeering, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	if where != "" {
+		where = fmt.Sprintf("owner = %d or peer_owner = %d", memberShip.OrgID, memberShip.OrgID)
+	}
+	peerings = []*model.GatewayPeering{}
+	if err = db.Model(&model.GatewayPeering{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count gateway peering(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Gateway").Preload("PeerGateway").Where(where).Where(query).Find(&peerings).Error; err != nil {
+		log.Println("DB failed to query gateway peering(s), %v", err)
+		return
+	}
+	db = db.Offset(0).Limit(-1)
+	for _, peering := range peerings {
+		peering.OwnerInfo = &model.Organization{Model: model.Model{ID: peering.Owner}}
+		if err = db.Take(peering.OwnerInfo).Error; err != nil {
+			log.Println("Failed to query owner info", err)
+			return
+		}
+		peering.PeerOwnerInfo = &model.Organization{Model: model.Model{ID: peering.PeerOwner}}
+		if err = db.Take(peering.PeerOwnerInfo).Error; err != nil {
+			log.Println("Failed to query peer owner info", err)
+			return
+		}
+	}
+
+	return
+}
+
+func (v *PeeringView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, peerings, err := peeringAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list gateway peering(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["Peerings"] = peerings
+	c.Data["OrgID"] = memberShip.OrgID
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"peerings": peerings,
+			"total":    total,
+			"pages":    pages,
+			"query":    query,
+		})
+		return
+	}
+	c.HTML(200, "peerings")
+}
+
+func (v *PeeringView) checkPeerOwner(c *macaron.Context, id int64) (permit bool) {
+	memberShip := GetMemberShip(c.Req.Context())
+	if !memberShip.CheckPermission(model.Writer) {
+		return false
+	}
+	if memberShip.OrgName == "admin" && memberShip.Role == model.Admin {
+		return true
+	}
+	peering := &model.GatewayPeering{Model: model.Model{ID: id}}
+	if err := DB().Take(peering).Error; err != nil {
+		log.Println("DB failed to query gateway peering", err)
+		return false
+	}
+	return peering.PeerOwner == memberShip.OrgID
+}
+
+func (v *PeeringView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.Params("id")
+	if id == "" {
+		c.Data["ErrorMsg"] = "Id is Empty"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	peeringID, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("Invalid peering ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, err := memberShip.CheckOwner(model.Writer, "gateway_peerings", int64(peeringID))
+	if !permit && !v.checkPeerOwner(c, int64(peeringID)) {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = peeringAdmin.Delete(c.Req.Context(), int64(peeringID))
+	if err != nil {
+		log.Println("Failed to delete gateway peering", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "peerings",
+	})
+	return
+}
+
+func (v *PeeringView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, gateways, err := gatewayAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Gateways"] = gateways
+	c.HTML(200, "peerings_new")
+}
+
+func (v *PeeringView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../peerings"
+	name := c.QueryTrim("name")
+	gatewayID := c.QueryInt64("gateway")
+	permit, err := memberShip.CheckOwner(model.Writer, "gateways", gatewayID)
+	if !permit {
+		log.Println("Not authorized to access gateway")
+		c.Data["ErrorMsg"] = "Not authorized to access gateway"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	peerGatewayID := c.QueryInt64("peergateway")
+	peering, err := peeringAdmin.Create(c.Req.Context(), name, gatewayID, peerGatewayID)
+	if err != nil {
+		log.Println("Failed to create gateway peering", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, peering)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *PeeringView) Accept(c *macaron.Context, store session.Store) {
+	redirectTo := "../../peerings"
+	id := c.ParamsInt64("id")
+	if !v.checkPeerOwner(c, id) {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err := peeringAdmin.Accept(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to accept gateway peering", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, "ok")
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *PeeringView) Reject(c *macaron.Context, store session.Store) {
+	redirectTo := "../../peerings"
+	id := c.ParamsInt64("id")
+	if !v.checkPeerOwner(c, id) {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err := peeringAdmin.Reject(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to reject gateway peering", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, "ok")
+		return
+	}
+	c.Redirect(redirectTo)
+}
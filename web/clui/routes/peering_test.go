@@ -0,0 +1,53 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+)
+
+func TestPeeringAddrs(t *testing.T) {
+	local, peer := peeringAddrs(1)
+	if local != "169.254.0.5/30" || peer != "169.254.0.6/30" {
+		t.Fatal(local, peer)
+	}
+	local, peer = peeringAddrs(8191)
+	if local != "169.254.127.253/30" || peer != "169.254.127.254/30" {
+		t.Fatal(local, peer)
+	}
+}
+
+func TestFreePeeringSlot(t *testing.T) {
+	if slot := freePeeringSlot(nil); slot != 1 {
+		t.Fatal(slot)
+	}
+	if slot := freePeeringSlot([]int32{1, 2, 4}); slot != 3 {
+		t.Fatal(slot)
+	}
+	used := []int32{}
+	for i := int32(1); i <= maxPeeringSlot; i++ {
+		used = append(used, i)
+	}
+	if slot := freePeeringSlot(used); slot != 0 {
+		t.Fatal(slot)
+	}
+}
+
+func TestPeeringSlot(t *testing.T) {
+	for _, slot := range []int32{1, 64, maxPeeringSlot} {
+		local, _ := peeringAddrs(slot)
+		if got := peeringSlot(local); got != slot {
+			t.Fatal(local, got)
+		}
+	}
+	for _, addr := range []string{"", "169.254.0.6/30", "10.0.0.5/30", "169.254.0.5/24"} {
+		if slot := peeringSlot(addr); slot != 0 {
+			t.Fatal(addr, slot)
+		}
+	}
+}
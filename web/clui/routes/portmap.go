@@ -11,13 +11,17 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"net"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/cloudland/web/clui/model"
 	"github.com/IBM/cloudland/web/sca/dbs"
 	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
 	macaron "gopkg.in/macaron.v1"
 )
 
@@ -26,6 +30,7 @@ var (
 	portmapView  = &PortmapView{}
 	remoteMin    = 18000
 	remoteMax    = 20000
+	remoteLocker = sync.Mutex{}
 )
 
 type PortmapAdmin struct{}
@@ -36,50 +41,223 @@ func init() {
 	return
 }
 
-func (a *PortmapAdmin) Create(ctx context.Context, instID int64, port int) (portmap *model.Portmap, err error) {
+func portsOverlap(start1, end1, start2, end2 int32) bool {
+	if end1 == 0 {
+		end1 = start1
+	}
+	if end2 == 0 {
+		end2 = start2
+	}
+	return start1 <= end2 && start2 <= end1
+}
+
+// ipsecPorts are kept on the public address of every gateway for the ike and nat traversal of vpn services
+var ipsecPorts = []int32{500, 4500}
+
+// reservedPort tells if an external port range takes a port a vpn service on the gateway needs
+func reservedPort(protocol string, start, end int32) bool {
+	if protocol != "udp" {
+		return false
+	}
+	for _, port := range ipsecPorts {
+		if portsOverlap(start, end, port, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func portRange(start, end int32, sep string) string {
+	if end == 0 || end == start {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d%s%d", start, sep, end)
+}
+
+// parsePortRange accepts a single port or a range like 8000-8010
+func parsePortRange(ports string) (start, end int, err error) {
+	parts := strings.SplitN(ports, "-", 2)
+	start, err = strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return
+	}
+	if len(parts) == 2 {
+		end, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return
+		}
+		if end < start {
+			err = fmt.Errorf("Invalid port range %s", ports)
+			return
+		}
+	}
+	return
+}
+
+func (a *PortmapAdmin) getInterface(ctx context.Context, instID, ifaceID int64) (instance *model.Instance, iface *model.Interface, err error) {
+	db := DB()
+	instance = &model.Instance{Model: model.Model{ID: instID}}
+	err = db.Preload("Interfaces").Preload("Interfaces.Address").Preload("Interfaces.Address.Subnet").Take(instance).Error
+	if err != nil {
+		log.Println("DB failed to query instance", err)
+		return
+	}
+	for _, i := range instance.Interfaces {
+		if (ifaceID == 0 && i.PrimaryIf) || i.ID == ifaceID {
+			iface = i
+			break
+		}
+	}
+	if iface == nil || iface.Address == nil || iface.Address.Subnet == nil {
+		err = fmt.Errorf("Interface not found on instance")
+		log.Println("Interface not found on instance", err)
+		return
+	}
+	return
+}
+
+// checkConflict tells if the external ports of a new portmap are taken on the gateway,
+// tunnel portmaps share the ports of the relay host so they are checked globally
+func (a *PortmapAdmin) checkConflict(db *gorm.DB, portmap *model.Portmap) (conflict bool, err error) {
+	existing := []*model.Portmap{}
+	if portmap.Mode == "tunnel" {
+		err = db.Where("mode = 'tunnel' or mode is null").Find(&existing).Error
+	} else {
+		err = db.Where("gateway_id = ? and mode = 'dnat' and protocol = ?", portmap.GatewayID, portmap.Protocol).Find(&existing).Error
+	}
+	if err != nil {
+		log.Println("Failed to query existing remote ports", err)
+		return
+	}
+	for _, pmap := range existing {
+		if portsOverlap(portmap.RemotePort, portmap.RemotePortEnd, pmap.RemotePort, pmap.RemotePortEnd) {
+			conflict = true
+			return
+		}
+	}
+	return
+}
+
+// Create forwards a port or port range of an instance interface to the outside. A single tcp port
+// without a chosen remote port or source restriction keeps using the ssh tunnel to the portmap relay,
+// everything else is forwarded with dnat on the public address of the gateway.
+func (a *PortmapAdmin) Create(ctx context.Context, instID, ifaceID int64, protocol string, port, portEnd, rport int32, source string) (portmap *model.Portmap, err error) {
 	memberShip := GetMemberShip(ctx)
 	db := DB()
-	instance := &model.Instance{Model: model.Model{ID: instID}}
-	err = db.Set("gorm:auto_preload", true).Preload("Interfaces", "primary_if = ?", true).Model(instance).Take(instance).Error
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	if protocol != "tcp" && protocol != "udp" {
+		err = fmt.Errorf("Unsupported protocol %s", protocol)
+		return
+	}
+	if port <= 0 || port > 65535 || (portEnd != 0 && (portEnd < port || portEnd > 65535)) {
+		err = fmt.Errorf("Invalid port range")
+		return
+	}
+	if rport < 0 || rport > 65535 {
+		err = fmt.Errorf("Invalid remote port")
+		return
+	}
+	if portEnd == port {
+		portEnd = 0
+	}
+	if source != "" {
+		var srcNet *net.IPNet
+		_, srcNet, err = net.ParseCIDR(source)
+		if err != nil {
+			log.Println("Invalid source cidr", err)
+			return
+		}
+		source = srcNet.String()
+	}
+	instance, iface, err := a.getInterface(ctx, instID, ifaceID)
 	if err != nil {
-		log.Println("DB failed to query instance, %v", err)
 		return
 	}
-	iface := instance.Interfaces[0]
 	if iface.Address.Subnet.Router == 0 {
 		err = fmt.Errorf("Portmap can not be created without a gateway")
 		log.Println("Portmap can not be created without a gateway")
 		return
 	}
 	gateway := &model.Gateway{Model: model.Model{ID: iface.Address.Subnet.Router}}
-	err = db.Model(gateway).Set("gorm:auto_preload", true).Take(gateway).Error
+	err = db.Preload("Interfaces").Preload("Interfaces.Address").Take(gateway).Error
 	if err != nil {
 		log.Println("DB failed to query gateway", err)
 		return
 	}
-	count := 1
-	rport := 0
-	for count > 0 {
-		rport = rand.Intn(remoteMax-remoteMin) + remoteMin
-		if err = db.Model(&model.Portmap{}).Where("remote_port = ?", rport).Count(&count).Error; err != nil {
-			log.Println("Failed to query existing remote port", err)
+	name := fmt.Sprintf("%s-%d-%d", instance.Hostname, instance.ID, port)
+	portmap = &model.Portmap{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, GatewayID: gateway.ID, InstanceID: instance.ID, InterfaceID: iface.ID, Name: name, Status: "pending", Mode: "tunnel", Protocol: protocol, LocalAddress: iface.Address.Address, LocalPort: port, LocalPortEnd: portEnd, RemotePort: rport, SourceCidr: source}
+	if rport > 0 || portEnd > 0 || protocol != "tcp" || source != "" {
+		portmap.Mode = "dnat"
+		for _, gIface := range gateway.Interfaces {
+			if gIface.Type == "gateway_public" && gIface.Address != nil {
+				portmap.RemoteAddress = strings.Split(gIface.Address.Address, "/")[0]
+				break
+			}
+		}
+		if portmap.RemoteAddress == "" {
+			err = fmt.Errorf("Gateway has no public address for port forwarding")
+			log.Println("Gateway has no public address", err)
 			return
 		}
 	}
-	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
-	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_portmap.sh '%d' '%s' '%d' '%d'", gateway.ID, iface.Address.Address, port, rport)
-	err = hyperExecute(ctx, control, command)
-	if err != nil {
-		log.Println("Create portmap failed", err)
-		return
+	// remote ports are checked and claimed in one transaction, creations are serialized so that they can not claim the same port
+	remoteLocker.Lock()
+	defer remoteLocker.Unlock()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	conflict := true
+	for conflict {
+		if rport == 0 {
+			portmap.RemotePort = int32(rand.Intn(remoteMax-remoteMin) + remoteMin)
+		}
+		if portEnd > 0 {
+			portmap.RemotePortEnd = portmap.RemotePort + portEnd - port
+		}
+		if portmap.RemotePort > 65535 || portmap.RemotePortEnd > 65535 {
+			err = fmt.Errorf("Invalid remote port range")
+			return
+		}
+		if portmap.Mode == "dnat" && reservedPort(protocol, portmap.RemotePort, portmap.RemotePortEnd) {
+			if rport > 0 {
+				err = fmt.Errorf("Remote udp ports 500 and 4500 are reserved for vpn on the gateway")
+				log.Println("Remote port is reserved", err)
+				return
+			}
+			continue
+		}
+		conflict, err = a.checkConflict(db, portmap)
+		if err != nil {
+			return
+		}
+		if conflict && rport > 0 {
+			err = fmt.Errorf("Remote port %s is already in use on the gateway", portRange(portmap.RemotePort, portmap.RemotePortEnd, "-"))
+			log.Println("Remote port conflicts", err)
+			return
+		}
 	}
-	name := fmt.Sprintf("%s-%d-%d", instance.Hostname, instance.ID, port)
-	portmap = &model.Portmap{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, GatewayID: gateway.ID, InstanceID: instance.ID, Name: name, Status: "pending", LocalAddress: iface.Address.Address, LocalPort: int32(port), RemotePort: int32(rport)}
 	err = db.Create(portmap).Error
 	if err != nil {
 		log.Println("DB failed to create port map", err)
 		return
 	}
+	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_portmap.sh '%d' '%s' '%d' '%d'", gateway.ID, iface.Address.Address, port, portmap.RemotePort)
+	if portmap.Mode == "dnat" {
+		command = fmt.Sprintf("/opt/cloudland/scripts/backend/create_dnat_portmap.sh '%d' '%d' '%s' '%s' '%s' '%s' '%s' '%s'", gateway.ID, portmap.ID, protocol, portmap.RemoteAddress, portRange(portmap.RemotePort, portmap.RemotePortEnd, ":"), iface.Address.Address, portRange(port, portEnd, "-"), source)
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create portmap failed", err)
+		return
+	}
 	return
 }
 
@@ -101,6 +279,9 @@ func (a *PortmapAdmin) Delete(ctx context.Context, id int64) (err error) {
 	if portmap.Gateway != nil {
 		control := fmt.Sprintf("toall=router-%d:%d,%d", portmap.Gateway.ID, portmap.Gateway.Hyper, portmap.Gateway.Peer)
 		command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_portmap.sh '%d' '%s' '%d' '%d'", portmap.Gateway.ID, portmap.LocalAddress, portmap.LocalPort, portmap.RemotePort)
+		if portmap.Mode == "dnat" {
+			command = fmt.Sprintf("/opt/cloudland/scripts/backend/clear_dnat_portmap.sh '%d' '%s' '%s' '%s' '%s' '%s' '%s'", portmap.Gateway.ID, portmap.Protocol, portmap.RemoteAddress, portRange(portmap.RemotePort, portmap.RemotePortEnd, ":"), portmap.LocalAddress, portRange(portmap.LocalPort, portmap.LocalPortEnd, "-"), portmap.SourceCidr)
+		}
 		err = hyperExecute(ctx, control, command)
 		if err != nil {
 			log.Println("Delete portmap failed", err)
@@ -234,7 +415,7 @@ func (v *PortmapView) New(c *macaron.Context, store session.Store) {
 	}
 	db := DB()
 	instances := []*model.Instance{}
-	if err := db.Preload("Interfaces", "primary_if = ?", true).Preload("Interfaces.Address").Find(&instances).Error; err != nil {
+	if err := db.Preload("Interfaces").Preload("Interfaces.Address").Find(&instances).Error; err != nil {
 		return
 	}
 	c.Data["Instances"] = instances
@@ -252,10 +433,9 @@ func (v *PortmapView) Create(c *macaron.Context, store session.Store) {
 	}
 	redirectTo := "../portmaps"
 	instance := c.QueryTrim("instance")
-	port := c.QueryTrim("port")
 	instID, err := strconv.Atoi(instance)
 	if err != nil {
-		log.Println("Invalid interface ID", err)
+		log.Println("Invalid instance ID", err)
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(http.StatusBadRequest, "error")
 		return
@@ -267,18 +447,41 @@ func (v *PortmapView) Create(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
-	portNo, err := strconv.Atoi(port)
+	ifaceID := c.QueryInt64("interface")
+	protocol := c.QueryTrim("protocol")
+	source := c.QueryTrim("source")
+	port := c.QueryTrim("port")
+	portNo, portEnd, err := parsePortRange(port)
 	if err != nil {
 		log.Println("Invalid port number", err)
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
-	_, err = portmapAdmin.Create(c.Req.Context(), int64(instID), portNo)
+	rport := 0
+	remotePort := c.QueryTrim("remote_port")
+	if remotePort != "" {
+		rport, err = strconv.Atoi(remotePort)
+		if err == nil && (rport < 0 || rport > 65535) {
+			err = fmt.Errorf("Invalid remote port %d", rport)
+		}
+		if err != nil {
+			log.Println("Invalid remote port number", err)
+			c.Data["ErrorMsg"] = err.Error()
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+	}
+	portmap, err := portmapAdmin.Create(c.Req.Context(), int64(instID), ifaceID, protocol, int32(portNo), int32(portEnd), int32(rport), source)
 	if err != nil {
 		log.Println("Failed to create port map", err)
 		c.Data["ErrorMsg"] = err.Error()
-		c.HTML(500, "500")
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, portmap)
+		return
 	}
 	c.Redirect(redirectTo)
 }
@@ -0,0 +1,50 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+)
+
+func TestParsePortRange(t *testing.T) {
+	start, end, err := parsePortRange("8080")
+	if err != nil || start != 8080 || end != 0 {
+		t.Fatal(start, end, err)
+	}
+	start, end, err = parsePortRange("8000-8010")
+	if err != nil || start != 8000 || end != 8010 {
+		t.Fatal(start, end, err)
+	}
+	if _, _, err = parsePortRange("8010-8000"); err == nil {
+		t.Fatal("reversed range should fail")
+	}
+}
+
+func TestPortsOverlap(t *testing.T) {
+	if !portsOverlap(8000, 0, 8000, 0) {
+		t.Fatal("same port should overlap")
+	}
+	if !portsOverlap(8000, 8010, 8005, 0) {
+		t.Fatal("port in range should overlap")
+	}
+	if portsOverlap(8000, 8010, 8011, 8020) {
+		t.Fatal("adjacent ranges should not overlap")
+	}
+	if portRange(8000, 8010, ":") != "8000:8010" || portRange(22, 0, "-") != "22" {
+		t.Fatal("wrong port range format")
+	}
+}
+
+func TestReservedPort(t *testing.T) {
+	if !reservedPort("udp", 500, 0) || !reservedPort("udp", 4000, 5000) {
+		t.Fatal("ipsec ports should be reserved")
+	}
+	if reservedPort("tcp", 500, 0) || reservedPort("udp", 501, 4499) {
+		t.Fatal("other ports should not be reserved")
+	}
+}
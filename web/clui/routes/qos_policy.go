@@ -0,0 +1,621 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	qosAdmin = &QosAdmin{}
+	qosView  = &QosView{}
+)
+
+type QosAdmin struct{}
+type QosView struct{}
+
+type QosData struct {
+	IngressRate  int32 `json:"ingress_rate"`
+	IngressBurst int32 `json:"ingress_burst"`
+	EgressRate   int32 `json:"egress_rate"`
+	EgressBurst  int32 `json:"egress_burst"`
+	Dscp         int32 `json:"dscp"`
+}
+
+func getQosData(policyID int64) (qosData *QosData, err error) {
+	if policyID == 0 {
+		return
+	}
+	policy := &model.QosPolicy{Model: model.Model{ID: policyID}}
+	if err = DB().Take(policy).Error; err != nil {
+		log.Println("DB failed to query qos policy", err)
+		return
+	}
+	qosData = &QosData{
+		IngressRate:  policy.IngressRate,
+		IngressBurst: policy.IngressBurst,
+		EgressRate:   policy.EgressRate,
+		EgressBurst:  policy.EgressBurst,
+		Dscp:         policy.Dscp,
+	}
+	return
+}
+
+func qosJson(policyID int64) (jsonData []byte, err error) {
+	qosData, err := getQosData(policyID)
+	if err != nil {
+		return
+	}
+	if qosData == nil {
+		jsonData = []byte("{}")
+		return
+	}
+	jsonData, err = json.Marshal(qosData)
+	return
+}
+
+// getInterfaceQos returns the qos policy an interface gets when it is created
+func getInterfaceQos(ctx context.Context, iface *model.Interface) (policyID int64, err error) {
+	_, db := getCtxDB(ctx)
+	if iface.Instance > 0 {
+		instance := &model.Instance{Model: model.Model{ID: iface.Instance}}
+		if err = db.Take(instance).Error; err != nil {
+			log.Println("DB failed to query instance", err)
+			return
+		}
+		flavor := &model.Flavor{Model: model.Model{ID: instance.FlavorID}}
+		if err = db.Take(flavor).Error; err != nil {
+			log.Println("DB failed to query flavor", err)
+			err = nil
+			return
+		}
+		policyID = flavor.QosPolicyID
+	} else if iface.FloatingIp > 0 {
+		floatingip := &model.FloatingIp{Model: model.Model{ID: iface.FloatingIp}}
+		if err = db.Take(floatingip).Error; err != nil {
+			log.Println("DB failed to query floating ip", err)
+			return
+		}
+		policyID = floatingip.QosPolicyID
+	}
+	return
+}
+
+// ApplyInterfaceQos enforces the qos policy of an instance interface on its hypervisor,
+// interfaces of instances not scheduled yet get it at launch
+func ApplyInterfaceQos(ctx context.Context, iface *model.Interface) (err error) {
+	if iface.Instance == 0 {
+		return
+	}
+	db := DB()
+	instance := &model.Instance{Model: model.Model{ID: iface.Instance}}
+	if err = db.Take(instance).Error; err != nil {
+		log.Println("DB failed to query instance", err)
+		return
+	}
+	if instance.Hyper < 0 {
+		return
+	}
+	jsonData, err := qosJson(iface.QosPolicyID)
+	if err != nil {
+		return
+	}
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_nic_qos.sh '%d' '%s' <<EOF\n%s\nEOF", instance.ID, iface.MacAddr, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Set interface qos failed", err)
+		return
+	}
+	return
+}
+
+// ApplyFloatingIpQos enforces the qos policy of an associated floating ip on its gateway
+func ApplyFloatingIpQos(ctx context.Context, floatingip *model.FloatingIp) (err error) {
+	if floatingip.GatewayID == 0 || floatingip.IntAddress == "" {
+		return
+	}
+	db := DB()
+	gateway := &model.Gateway{Model: model.Model{ID: floatingip.GatewayID}}
+	if err = db.Take(gateway).Error; err != nil {
+		log.Println("DB failed to query gateway", err)
+		return
+	}
+	jsonData, err := qosJson(floatingip.QosPolicyID)
+	if err != nil {
+		return
+	}
+	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+	if gateway.Hyper == gateway.Peer {
+		control = fmt.Sprintf("inter=%d", gateway.Hyper)
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_fip_qos.sh '%d' '%s' '%s' '%s' <<EOF\n%s\nEOF", gateway.ID, floatingip.Type, floatingip.FipAddress, floatingip.IntAddress, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Set floating ip qos failed", err)
+		return
+	}
+	return
+}
+
+func validateQos(ingressRate, ingressBurst, egressRate, egressBurst, dscp int32) (err error) {
+	if ingressRate < 0 || ingressBurst < 0 || egressRate < 0 || egressBurst < 0 {
+		return fmt.Errorf("Bandwidth and burst can not be negative")
+	}
+	if (ingressBurst > 0 && ingressRate == 0) || (egressBurst > 0 && egressRate == 0) {
+		return fmt.Errorf("Burst requires a bandwidth")
+	}
+	if dscp < -1 || dscp > 63 {
+		return fmt.Errorf("DSCP must be between 0 and 63")
+	}
+	return
+}
+
+func (a *QosAdmin) Create(ctx context.Context, name string, ingressRate, ingressBurst, egressRate, egressBurst, dscp int32) (policy *model.QosPolicy, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if err = validateQos(ingressRate, ingressBurst, egressRate, egressBurst, dscp); err != nil {
+		return
+	}
+	policy = &model.QosPolicy{
+		Model:        model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:         name,
+		IngressRate:  ingressRate,
+		IngressBurst: ingressBurst,
+		EgressRate:   egressRate,
+		EgressBurst:  egressBurst,
+		Dscp:         dscp,
+	}
+	if err = db.Create(policy).Error; err != nil {
+		log.Println("DB failed to create qos policy", err)
+		return
+	}
+	return
+}
+
+func (a *QosAdmin) Update(ctx context.Context, id int64, name string, ingressRate, ingressBurst, egressRate, egressBurst, dscp int32) (policy *model.QosPolicy, err error) {
+	db := DB()
+	if err = validateQos(ingressRate, ingressBurst, egressRate, egressBurst, dscp); err != nil {
+		return
+	}
+	policy = &model.QosPolicy{Model: model.Model{ID: id}}
+	if err = db.Take(policy).Error; err != nil {
+		log.Println("DB failed to query qos policy", err)
+		return
+	}
+	policy.Name = name
+	policy.IngressRate = ingressRate
+	policy.IngressBurst = ingressBurst
+	policy.EgressRate = egressRate
+	policy.EgressBurst = egressBurst
+	policy.Dscp = dscp
+	if err = db.Save(policy).Error; err != nil {
+		log.Println("DB failed to update qos policy", err)
+		return
+	}
+	ifaces := []*model.Interface{}
+	if err = db.Where("qos_policy_id = ?", id).Find(&ifaces).Error; err != nil {
+		log.Println("DB failed to query interfaces", err)
+		return
+	}
+	for _, iface := range ifaces {
+		if iface.Type == "instance" {
+			err = ApplyInterfaceQos(ctx, iface)
+			if err != nil {
+				return
+			}
+		}
+	}
+	floatingips := []*model.FloatingIp{}
+	if err = db.Where("qos_policy_id = ?", id).Find(&floatingips).Error; err != nil {
+		log.Println("DB failed to query floating ips", err)
+		return
+	}
+	for _, floatingip := range floatingips {
+		err = ApplyFloatingIpQos(ctx, floatingip)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (a *QosAdmin) inUse(id int64) (used bool, err error) {
+	db := DB()
+	for _, table := range []interface{}{&model.Interface{}, &model.FloatingIp{}, &model.Flavor{}} {
+		count := 0
+		if err = db.Model(table).Where("qos_policy_id = ?", id).Count(&count).Error; err != nil {
+			log.Println("DB failed to count qos policy references", err)
+			return
+		}
+		if count > 0 {
+			used = true
+			return
+		}
+	}
+	return
+}
+
+func (a *QosAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	used, err := a.inUse(id)
+	if err != nil {
+		return
+	}
+	if used {
+		err = fmt.Errorf("Qos policy is still in use")
+		return
+	}
+	if err = db.Delete(&model.QosPolicy{Model: model.Model{ID: id}}).Error; err != nil {
+		log.Println("DB failed to delete qos policy", err)
+		return
+	}
+	return
+}
+
+// Attach sets the qos policy of an interface, floating ip or flavor, policy 0 detaches it
+func (a *QosAdmin) Attach(ctx context.Context, policyID int64, targetType string, targetID int64) (err error) {
+	db := DB()
+	switch targetType {
+	case "interface":
+		iface := &model.Interface{Model: model.Model{ID: targetID}}
+		if err = db.Take(iface).Error; err != nil {
+			log.Println("DB failed to query interface", err)
+			return
+		}
+		iface.QosPolicyID = policyID
+		if err = db.Model(iface).Update("qos_policy_id", policyID).Error; err != nil {
+			log.Println("DB failed to update interface qos", err)
+			return
+		}
+		err = ApplyInterfaceQos(ctx, iface)
+	case "floatingip":
+		floatingip := &model.FloatingIp{Model: model.Model{ID: targetID}}
+		if err = db.Take(floatingip).Error; err != nil {
+			log.Println("DB failed to query floating ip", err)
+			return
+		}
+		floatingip.QosPolicyID = policyID
+		if err = db.Model(floatingip).Update("qos_policy_id", policyID).Error; err != nil {
+			log.Println("DB failed to update floating ip qos", err)
+			return
+		}
+		err = ApplyFloatingIpQos(ctx, floatingip)
+	case "flavor":
+		flavor := &model.Flavor{Model: model.Model{ID: targetID}}
+		if err = db.Take(flavor).Error; err != nil {
+			log.Println("DB failed to query flavor", err)
+			return
+		}
+		oldPolicyID := flavor.QosPolicyID
+		if err = db.Model(flavor).Update("qos_policy_id", policyID).Error; err != nil {
+			log.Println("DB failed to update flavor qos", err)
+			return
+		}
+		err = a.propagateFlavorQos(ctx, flavor.ID, oldPolicyID, policyID)
+	default:
+		err = fmt.Errorf("Invalid target type %s", targetType)
+	}
+	return
+}
+
+// propagateFlavorQos moves the instance interfaces still using the previous policy of a flavor
+// to its new one, interfaces given another policy by the admin are kept as they are
+func (a *QosAdmin) propagateFlavorQos(ctx context.Context, flavorID, oldPolicyID, policyID int64) (err error) {
+	if oldPolicyID == policyID {
+		return
+	}
+	db := DB()
+	ifaces := []*model.Interface{}
+	where := "type = 'instance' and qos_policy_id = ? and instance in (select id from instances where flavor_id = ? and deleted_at is null)"
+	if err = db.Where(where, oldPolicyID, flavorID).Find(&ifaces).Error; err != nil {
+		log.Println("DB failed to query flavor interfaces", err)
+		return
+	}
+	for _, iface := range ifaces {
+		iface.QosPolicyID = policyID
+		if err = db.Model(iface).Update("qos_policy_id", policyID).Error; err != nil {
+			log.Println("DB failed to update interface qos", err)
+			return
+		}
+		err = ApplyInterfaceQos(ctx, iface)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (a *QosAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, policies []*model.QosPolicy, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	policies = []*model.QosPolicy{}
+	if err = db.Model(&model.QosPolicy{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count qos policy(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Where(where).Where(query).Find(&policies).Error; err != nil {
+		log.Println("DB failed to query qos policy(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, policy := range policies {
+			policy.OwnerInfo = &model.Organization{Model: model.Model{ID: policy.Owner}}
+			if err = db.Take(policy.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (v *QosView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, policies, err := qosAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list qos policy(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["QosPolicies"] = policies
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"qospolicies": policies,
+			"total":       total,
+			"pages":       pages,
+			"query":       query,
+		})
+		return
+	}
+	c.HTML(200, "qospolicies")
+}
+
+func (v *QosView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "qos_policies", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = qosAdmin.Delete(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to delete qos policy", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "qospolicies",
+	})
+	return
+}
+
+func (v *QosView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.HTML(200, "qospolicies_new")
+}
+
+func (v *QosView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "qos_policies", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	policy := &model.QosPolicy{Model: model.Model{ID: id}}
+	if err = DB().Take(policy).Error; err != nil {
+		log.Println("DB failed to query qos policy", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.Data["QosPolicy"] = policy
+	c.HTML(200, "qospolicies_patch")
+}
+
+func (v *QosView) getQosParams(c *macaron.Context) (ingressRate, ingressBurst, egressRate, egressBurst, dscp int32) {
+	ingressRate = int32(c.QueryInt("ingress_rate"))
+	ingressBurst = int32(c.QueryInt("ingress_burst"))
+	egressRate = int32(c.QueryInt("egress_rate"))
+	egressBurst = int32(c.QueryInt("egress_burst"))
+	dscp = -1
+	if c.QueryTrim("dscp") != "" {
+		dscp = int32(c.QueryInt("dscp"))
+	}
+	return
+}
+
+func (v *QosView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../qospolicies"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "qos_policies", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	// a policy attached by the admin is a limit on its owner, only the admin may change it
+	if !memberShip.CheckPermission(model.Admin) {
+		used, err := qosAdmin.inUse(id)
+		if err != nil || used {
+			log.Println("Not authorized to change qos policy in use")
+			c.Data["ErrorMsg"] = "Not authorized to change qos policy in use"
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+	}
+	name := c.QueryTrim("name")
+	ingressRate, ingressBurst, egressRate, egressBurst, dscp := v.getQosParams(c)
+	policy, err := qosAdmin.Update(c.Req.Context(), id, name, ingressRate, ingressBurst, egressRate, egressBurst, dscp)
+	if err != nil {
+		log.Println("Failed to update qos policy", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, policy)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *QosView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../qospolicies"
+	name := c.QueryTrim("name")
+	ingressRate, ingressBurst, egressRate, egressBurst, dscp := v.getQosParams(c)
+	policy, err := qosAdmin.Create(c.Req.Context(), name, ingressRate, ingressBurst, egressRate, egressBurst, dscp)
+	if err != nil {
+		log.Println("Failed to create qos policy", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, policy)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *QosView) Attach(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	policyID := c.ParamsInt64("id")
+	if policyID > 0 {
+		permit, _ := memberShip.CheckOwner(model.Reader, "qos_policies", policyID)
+		if !permit {
+			log.Println("Not authorized to access qos policy")
+			c.Data["ErrorMsg"] = "Not authorized to access qos policy"
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+	}
+	targetType := c.QueryTrim("type")
+	target := c.QueryTrim("target")
+	targetID, err := strconv.Atoi(target)
+	if err != nil {
+		log.Println("Invalid target ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	// qos policies are limits imposed by the admin, owners of the target may not lift them
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = qosAdmin.Attach(c.Req.Context(), policyID, targetType, int64(targetID))
+	if err != nil {
+		log.Println("Failed to attach qos policy", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"qos_policy_id": policyID,
+		})
+		return
+	}
+	c.Redirect("/qospolicies")
+}
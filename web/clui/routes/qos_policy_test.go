@@ -0,0 +1,33 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+)
+
+func TestValidateQos(t *testing.T) {
+	if err := validateQos(10000, 1000, 0, 0, -1); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateQos(0, 0, 5000, 0, 46); err != nil {
+		t.Fatal(err)
+	}
+	invalid := [][5]int32{
+		{-1, 0, 0, 0, -1},
+		{0, 100, 0, 0, -1},
+		{0, 0, 0, 100, -1},
+		{1000, 0, 1000, 0, 64},
+		{1000, 0, 1000, 0, -2},
+	}
+	for _, args := range invalid {
+		if err := validateQos(args[0], args[1], args[2], args[3], args[4]); err == nil {
+			t.Fatal("qos should be invalid", args)
+		}
+	}
+}
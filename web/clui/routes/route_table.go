@@ -0,0 +1,654 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	routeTableAdmin = &RouteTableAdmin{}
+	routeTableView  = &RouteTableView{}
+)
+
+type RouteTableAdmin struct{}
+type RouteTableView struct{}
+
+// getSubnetRoutes merges the legacy subnet routes with the routes of the tables
+// attached to the subnet or to the gateway whose next hops live in the subnet
+func getSubnetRoutes(gatewayID int64, subnet *model.Subnet) (routes []*StaticRoute, err error) {
+	routes = []*StaticRoute{}
+	if subnet.Routes != "" {
+		err = json.Unmarshal([]byte(subnet.Routes), &routes)
+		if err != nil {
+			log.Println("Failed to unmarshal routes", err)
+			routes = []*StaticRoute{}
+		}
+	}
+	if subnet.ID == 0 {
+		return routes, nil
+	}
+	db := DB()
+	tables := []*model.RouteTable{}
+	err = db.Preload("Routes").Preload("Routes.Address").Where("id in (select route_table_id from subnet_route_tables where subnet_id = ?) or id in (select route_table_id from gateway_route_tables where gateway_id = ?)", subnet.ID, gatewayID).Find(&tables).Error
+	if err != nil {
+		log.Println("DB failed to query route tables", err)
+		return
+	}
+	for _, table := range tables {
+		for _, route := range table.Routes {
+			if route.Address == nil || route.Address.SubnetID != subnet.ID {
+				continue
+			}
+			routes = append(routes, &StaticRoute{Destination: route.Destination, Nexthop: route.Nexthop})
+		}
+	}
+	return
+}
+
+// nexthopSubnets returns the ids of the attached subnets and the subnets of the attached gateways owned by owner
+func nexthopSubnets(owner int64, subnets []*model.Subnet, gateways []*model.Gateway) (subnetIDs []int64) {
+	subnetIDs = []int64{}
+	for _, subnet := range subnets {
+		if subnet.Owner == owner {
+			subnetIDs = append(subnetIDs, subnet.ID)
+		}
+	}
+	for _, gateway := range gateways {
+		for _, subnet := range gateway.Subnets {
+			if subnet.Owner == owner {
+				subnetIDs = append(subnetIDs, subnet.ID)
+			}
+		}
+	}
+	return
+}
+
+// parseRoutes parses the routes of a table owned by owner, next hops are looked up in the attached subnets
+// and the subnets of the attached gateways, or in the subnets of the owner when nothing is attached
+func (a *RouteTableAdmin) parseRoutes(owner int64, routes string, subnets []*model.Subnet, gateways []*model.Gateway) (rts []*model.Route, err error) {
+	db := DB()
+	scope := db.Where("subnet_id in (select id from subnets where owner = ? and deleted_at is null)", owner)
+	if len(subnets) > 0 || len(gateways) > 0 {
+		scope = db.Where("subnet_id in (?)", nexthopSubnets(owner, subnets, gateways))
+	}
+	for _, route := range strings.Fields(routes) {
+		pair := strings.Split(route, ":")
+		if len(pair) != 2 {
+			log.Println("No valid pair delimiter")
+			err = fmt.Errorf("No valid pair delimiter")
+			return
+		}
+		var ipNet *net.IPNet
+		_, ipNet, err = net.ParseCIDR(pair[0])
+		if err != nil {
+			log.Println("Failed to parse cidr")
+			err = fmt.Errorf("Failed to parse cidr %s", pair[0])
+			return
+		}
+		nexthop := net.ParseIP(pair[1])
+		if nexthop == nil {
+			err = fmt.Errorf("Invalid nexthop %s", pair[1])
+			return
+		}
+		addresses := []*model.Address{}
+		err = scope.Where("address like ?", nexthop.String()+"/%").Find(&addresses).Error
+		if err != nil {
+			log.Println("DB failed to query nexthop address", err)
+			return
+		}
+		var address *model.Address
+		for _, addr := range addresses {
+			if strings.Split(addr.Address, "/")[0] == nexthop.String() {
+				address = addr
+				break
+			}
+		}
+		if address == nil {
+			err = fmt.Errorf("Nexthop %s is not an existing address", nexthop.String())
+			return
+		}
+		rts = append(rts, &model.Route{Destination: ipNet.String(), Nexthop: nexthop.String(), AddressID: address.ID, Address: address})
+	}
+	return
+}
+
+func (a *RouteTableAdmin) checkNexthops(rts []*model.Route, subnets []*model.Subnet, gateways []*model.Gateway) (err error) {
+	if len(subnets) == 0 && len(gateways) == 0 {
+		return
+	}
+	for _, route := range rts {
+		found := false
+		for _, subnet := range subnets {
+			if route.Address.SubnetID == subnet.ID {
+				found = true
+				break
+			}
+		}
+		for _, gateway := range gateways {
+			for _, subnet := range gateway.Subnets {
+				if route.Address.SubnetID == subnet.ID {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			err = fmt.Errorf("Nexthop %s is not reachable from attached subnets or gateways", route.Nexthop)
+			return
+		}
+	}
+	return
+}
+
+func (a *RouteTableAdmin) getAttachments(subnetIDs, gatewayIDs []int64) (subnets []*model.Subnet, gateways []*model.Gateway, err error) {
+	db := DB()
+	subnets = []*model.Subnet{}
+	gateways = []*model.Gateway{}
+	for _, sID := range subnetIDs {
+		subnet := &model.Subnet{Model: model.Model{ID: sID}}
+		if err = db.Preload("Routers").Take(subnet).Error; err != nil {
+			log.Println("DB failed to query subnet", err)
+			return
+		}
+		if subnet.Type != "internal" {
+			err = fmt.Errorf("Only internal subnet can be attached to route table")
+			return
+		}
+		subnets = append(subnets, subnet)
+	}
+	for _, gID := range gatewayIDs {
+		gateway := &model.Gateway{Model: model.Model{ID: gID}}
+		if err = db.Preload("Subnets").Take(gateway).Error; err != nil {
+			log.Println("DB failed to query gateway", err)
+			return
+		}
+		gateways = append(gateways, gateway)
+	}
+	return
+}
+
+func (a *RouteTableAdmin) apply(ctx context.Context, subnets []*model.Subnet, gateways []*model.Gateway) (err error) {
+	applied := make(map[string]bool)
+	for _, subnet := range subnets {
+		for _, router := range subnet.Routers {
+			key := fmt.Sprintf("%d-%d", router.ID, subnet.ID)
+			if applied[key] {
+				continue
+			}
+			applied[key] = true
+			err = setRouting(ctx, router.ID, subnet, true)
+			if err != nil {
+				log.Println("Failed to set routing for subnet", err)
+				return
+			}
+		}
+	}
+	for _, gateway := range gateways {
+		for _, subnet := range gateway.Subnets {
+			key := fmt.Sprintf("%d-%d", gateway.ID, subnet.ID)
+			if applied[key] {
+				continue
+			}
+			applied[key] = true
+			err = setRouting(ctx, gateway.ID, subnet, true)
+			if err != nil {
+				log.Println("Failed to set routing for gateway", err)
+				return
+			}
+		}
+	}
+	return
+}
+
+func (a *RouteTableAdmin) Create(ctx context.Context, name, routes string, subnetIDs, gatewayIDs []int64) (table *model.RouteTable, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	subnets, gateways, err := a.getAttachments(subnetIDs, gatewayIDs)
+	if err != nil {
+		log.Println("Invalid attachments", err)
+		return
+	}
+	rts, err := a.parseRoutes(memberShip.OrgID, routes, subnets, gateways)
+	if err != nil {
+		log.Println("Invalid routes", err)
+		return
+	}
+	err = a.checkNexthops(rts, subnets, gateways)
+	if err != nil {
+		log.Println("Invalid nexthops", err)
+		return
+	}
+	table = &model.RouteTable{
+		Model:    model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:     name,
+		Routes:   rts,
+		Subnets:  subnets,
+		Gateways: gateways,
+	}
+	if err = db.Create(table).Error; err != nil {
+		log.Println("DB failed to create route table", err)
+		return
+	}
+	err = a.apply(ctx, subnets, gateways)
+	if err != nil {
+		log.Println("Failed to apply route table", err)
+		return
+	}
+	return
+}
+
+func (a *RouteTableAdmin) Update(ctx context.Context, id int64, name, routes string, subnetIDs, gatewayIDs []int64) (table *model.RouteTable, err error) {
+	db := DB()
+	table = &model.RouteTable{Model: model.Model{ID: id}}
+	if err = db.Preload("Routes").Preload("Subnets").Preload("Subnets.Routers").Preload("Gateways").Preload("Gateways.Subnets").Take(table).Error; err != nil {
+		log.Println("DB failed to query route table", err)
+		return
+	}
+	subnets, gateways, err := a.getAttachments(subnetIDs, gatewayIDs)
+	if err != nil {
+		log.Println("Invalid attachments", err)
+		return
+	}
+	rts, err := a.parseRoutes(table.Owner, routes, subnets, gateways)
+	if err != nil {
+		log.Println("Invalid routes", err)
+		return
+	}
+	err = a.checkNexthops(rts, subnets, gateways)
+	if err != nil {
+		log.Println("Invalid nexthops", err)
+		return
+	}
+	oldSubnets := table.Subnets
+	oldGateways := table.Gateways
+	if err = db.Where("route_table_id = ?", table.ID).Delete(&model.Route{}).Error; err != nil {
+		log.Println("DB failed to delete routes", err)
+		return
+	}
+	for _, route := range rts {
+		route.RouteTableID = table.ID
+		if err = db.Create(route).Error; err != nil {
+			log.Println("DB failed to create route", err)
+			return
+		}
+	}
+	if err = db.Model(table).Association("Subnets").Replace(subnets).Error; err != nil {
+		log.Println("DB failed to update route table subnets", err)
+		return
+	}
+	if err = db.Model(table).Association("Gateways").Replace(gateways).Error; err != nil {
+		log.Println("DB failed to update route table gateways", err)
+		return
+	}
+	table.Name = name
+	table.Routes = rts
+	if err = db.Model(table).Update("name", name).Error; err != nil {
+		log.Println("DB failed to update route table", err)
+		return
+	}
+	err = a.apply(ctx, append(oldSubnets, subnets...), append(oldGateways, gateways...))
+	if err != nil {
+		log.Println("Failed to apply route table", err)
+		return
+	}
+	return
+}
+
+func (a *RouteTableAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	table := &model.RouteTable{Model: model.Model{ID: id}}
+	if err = db.Preload("Subnets").Preload("Subnets.Routers").Preload("Gateways").Preload("Gateways.Subnets").Take(table).Error; err != nil {
+		log.Println("DB failed to query route table", err)
+		return
+	}
+	if err = db.Model(table).Association("Subnets").Clear().Error; err != nil {
+		log.Println("DB failed to clear route table subnets", err)
+		return
+	}
+	if err = db.Model(table).Association("Gateways").Clear().Error; err != nil {
+		log.Println("DB failed to clear route table gateways", err)
+		return
+	}
+	if err = db.Where("route_table_id = ?", table.ID).Delete(&model.Route{}).Error; err != nil {
+		log.Println("DB failed to delete routes", err)
+		return
+	}
+	if err = db.Delete(table).Error; err != nil {
+		log.Println("DB failed to delete route table", err)
+		return
+	}
+	err = a.apply(ctx, table.Subnets, table.Gateways)
+	if err != nil {
+		log.Println("Failed to apply route table", err)
+		return
+	}
+	return
+}
+
+func (a *RouteTableAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, tables []*model.RouteTable, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	tables = []*model.RouteTable{}
+	if err = db.Model(&model.RouteTable{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count route table(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Routes").Preload("Subnets").Preload("Gateways").Where(where).Where(query).Find(&tables).Error; err != nil {
+		log.Println("DB failed to query route table(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, table := range tables {
+			table.OwnerInfo = &model.Organization{Model: model.Model{ID: table.Owner}}
+			if err = db.Take(table.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (v *RouteTableView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, tables, err := routeTableAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list route table(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["RouteTables"] = tables
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"routetables": tables,
+			"total":       total,
+			"pages":       pages,
+			"query":       query,
+		})
+		return
+	}
+	c.HTML(200, "routetables")
+}
+
+func (v *RouteTableView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.Params("id")
+	if id == "" {
+		c.Data["ErrorMsg"] = "Id is Empty"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	tableID, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("Invalid route table ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, err := memberShip.CheckOwner(model.Writer, "route_tables", int64(tableID))
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = routeTableAdmin.Delete(c.Req.Context(), int64(tableID))
+	if err != nil {
+		log.Println("Failed to delete route table", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "routetables",
+	})
+	return
+}
+
+func (v *RouteTableView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	ctx := c.Req.Context()
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, gateways, err := gatewayAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Subnets"] = subnets
+	c.Data["Gateways"] = gateways
+	c.HTML(200, "routetables_new")
+}
+
+func (v *RouteTableView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "route_tables", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	table := &model.RouteTable{Model: model.Model{ID: id}}
+	if err = DB().Preload("Routes").Preload("Subnets").Preload("Gateways").Take(table).Error; err != nil {
+		log.Println("DB failed to query route table", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	routes := ""
+	for i, route := range table.Routes {
+		if i == 0 {
+			routes = fmt.Sprintf("%s:%s", route.Destination, route.Nexthop)
+		} else {
+			routes = fmt.Sprintf("%s %s:%s", routes, route.Destination, route.Nexthop)
+		}
+	}
+	ctx := c.Req.Context()
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	_, gateways, err := gatewayAdmin.List(ctx, 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["RouteTable"] = table
+	c.Data["Routes"] = routes
+	c.Data["Subnets"] = subnets
+	c.Data["Gateways"] = gateways
+	c.HTML(200, "routetables_patch")
+}
+
+func (v *RouteTableView) getAttachmentIDs(c *macaron.Context) (subnetIDs, gatewayIDs []int64, err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	for _, s := range strings.Split(c.QueryTrim("subnets"), ",") {
+		if s == "" {
+			continue
+		}
+		var sID int
+		sID, err = strconv.Atoi(s)
+		if err != nil {
+			log.Println("Invalid subnet ID", err)
+			return
+		}
+		permit, _ := memberShip.CheckOwner(model.Writer, "subnets", int64(sID))
+		if !permit {
+			err = fmt.Errorf("Not authorized to access subnet %d", sID)
+			return
+		}
+		subnetIDs = append(subnetIDs, int64(sID))
+	}
+	for _, g := range strings.Split(c.QueryTrim("gateways"), ",") {
+		if g == "" {
+			continue
+		}
+		var gID int
+		gID, err = strconv.Atoi(g)
+		if err != nil {
+			log.Println("Invalid gateway ID", err)
+			return
+		}
+		permit, _ := memberShip.CheckOwner(model.Writer, "gateways", int64(gID))
+		if !permit {
+			err = fmt.Errorf("Not authorized to access gateway %d", gID)
+			return
+		}
+		gatewayIDs = append(gatewayIDs, int64(gID))
+	}
+	return
+}
+
+func (v *RouteTableView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../routetables"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "route_tables", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	name := c.QueryTrim("name")
+	routes := c.QueryTrim("routes")
+	subnetIDs, gatewayIDs, err := v.getAttachmentIDs(c)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	table, err := routeTableAdmin.Update(c.Req.Context(), id, name, routes, subnetIDs, gatewayIDs)
+	if err != nil {
+		log.Println("Failed to update route table", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, table)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *RouteTableView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../routetables"
+	name := c.QueryTrim("name")
+	routes := c.QueryTrim("routes")
+	subnetIDs, gatewayIDs, err := v.getAttachmentIDs(c)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	table, err := routeTableAdmin.Create(c.Req.Context(), name, routes, subnetIDs, gatewayIDs)
+	if err != nil {
+		log.Println("Failed to create route table", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, table)
+		return
+	}
+	c.Redirect(redirectTo)
+}
@@ -0,0 +1,27 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestNexthopSubnets(t *testing.T) {
+	own := &model.Subnet{Model: model.Model{ID: 1, Owner: 5}}
+	other := &model.Subnet{Model: model.Model{ID: 2, Owner: 6}}
+	gateway := &model.Gateway{Subnets: []*model.Subnet{{Model: model.Model{ID: 3, Owner: 5}}, other}}
+	ids := nexthopSubnets(5, []*model.Subnet{own, other}, []*model.Gateway{gateway})
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Fatal(ids)
+	}
+	if ids = nexthopSubnets(7, []*model.Subnet{own}, nil); len(ids) != 0 {
+		t.Fatal(ids)
+	}
+}
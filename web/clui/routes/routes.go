@@ -51,6 +51,7 @@ func runArgs(cfg string) (args []interface{}) {
 
 func Run() (err error) {
 	m := New()
+	go pruneBackups()
 	cert := viper.GetString("api.cert")
 	key := viper.GetString("api.key")
 	if cert != "" && key != "" {
@@ -91,6 +92,7 @@ func New() (m *macaron.Macaron) {
 	m.Get("/login", userView.LoginGet)
 	m.Post("/login", userView.LoginPost)
 	m.Get("/hypers", hyperView.List)
+	m.Post("/hypers/evict", imageCacheView.Evict)
 	m.Get("/users", userView.List)
 	m.Get("/users/:id", userView.Edit)
 	m.Post("/users/:id", userView.Patch)
@@ -131,6 +133,12 @@ func New() (m *macaron.Macaron) {
 	m.Post("/interfaces/:id", interfaceView.Patch)
 	m.Post("/interfaces/new", interfaceView.Create)
 	m.Delete("/interfaces/:id", interfaceView.Delete)
+	m.Get("/instances/:id/interfaces", interfaceView.InstanceList)
+	m.Post("/instances/:id/interfaces", interfaceView.Attach)
+	m.Delete("/instances/:id/interfaces/:ifaceid", interfaceView.Detach)
+	m.Get("/interfaces/:id/subports", trunkView.List)
+	m.Post("/interfaces/:id/subports", trunkView.Create)
+	m.Delete("/interfaces/:id/subports/:subid", trunkView.Delete)
 	m.Get("/flavors", flavorView.List)
 	m.Get("/flavors/new", flavorView.New)
 	m.Post("/flavors/new", flavorView.Create)
@@ -139,12 +147,42 @@ func New() (m *macaron.Macaron) {
 	m.Get("/images/new", imageView.New)
 	m.Post("/images/new", imageView.Create)
 	m.Delete("/images/:id", imageView.Delete)
+	m.Get("/images/:id", imageView.Edit)
+	m.Post("/images/:id", imageView.Patch)
+	m.Post("/images/:id/members", imageMemberView.Create)
+	m.Post("/images/:id/members/remove", imageMemberView.Delete)
+	m.Post("/images/:id/membership", imageMemberView.Update)
+	m.Post("/images/:id/cache", imageCacheView.Seed)
+	m.Put("/images/:id/file", imageView.Upload)
+	m.Head("/images/:id/file", imageView.UploadStatus)
+	m.Get("/images/:id/file", imageView.Download)
+	m.Get("/imagefiles/:id/:token", imageView.Fetch)
 	m.Get("/volumes", volumeView.List)
 	m.Get("/volumes/new", volumeView.New)
 	m.Post("/volumes/new", volumeView.Create)
 	m.Delete("/volumes/:id", volumeView.Delete)
 	m.Get("/volumes/:id", volumeView.Edit)
 	m.Post("/volumes/:id", volumeView.Patch)
+	m.Post("/volumes/:id/extend", volumeView.Extend)
+	m.Post("/volumes/:id/detach", volumeView.Detach)
+	m.Get("/volumetypes", volTypeView.List)
+	m.Get("/volumetypes/new", volTypeView.New)
+	m.Post("/volumetypes/new", volTypeView.Create)
+	m.Delete("/volumetypes/:id", volTypeView.Delete)
+	m.Get("/volumebackups", backupView.List)
+	m.Post("/volumebackups/new", backupView.Create)
+	m.Post("/volumebackups/retention", backupView.Retention)
+	m.Delete("/volumebackups/:id", backupView.Delete)
+	m.Post("/volumebackups/:id/restore", backupView.Restore)
+	m.Get("/volumetransfers", transferView.List)
+	m.Post("/volumetransfers/new", transferView.Create)
+	m.Post("/volumetransfers/accept", transferView.Accept)
+	m.Delete("/volumetransfers/:id", transferView.Delete)
+	m.Get("/volumes/:id/snapshots", volSnapshotView.List)
+	m.Post("/volumes/:id/snapshots", volSnapshotView.Create)
+	m.Delete("/volumes/:id/snapshots/:snapid", volSnapshotView.Delete)
+	m.Post("/volumes/:id/snapshots/:snapid/revert", volSnapshotView.Revert)
+	m.Post("/volumes/:id/snapshots/:snapid/volume", volSnapshotView.CreateVolume)
 	m.Get("/subnets", subnetView.List)
 	m.Get("/subnets/new", subnetView.New)
 	m.Post("/subnets/new", subnetView.Create)
@@ -161,6 +199,14 @@ func New() (m *macaron.Macaron) {
 	m.Post("/floatingips/new", floatingipView.Create)
 	m.Post("/floatingips/assign", floatingipView.Assign)
 	m.Delete("/floatingips/:id", floatingipView.Delete)
+	m.Post("/floatingips/:id/associate", floatingipView.Associate)
+	m.Post("/floatingips/:id/disassociate", floatingipView.Disassociate)
+	m.Get("/fippools", fipPoolView.List)
+	m.Get("/fippools/new", fipPoolView.New)
+	m.Post("/fippools/new", fipPoolView.Create)
+	m.Delete("/fippools/:id", fipPoolView.Delete)
+	m.Get("/fippools/:id", fipPoolView.Edit)
+	m.Post("/fippools/:id", fipPoolView.Patch)
 	m.Get("/portmaps", portmapView.List)
 	m.Get("/portmaps/new", portmapView.New)
 	m.Post("/portmaps/new", portmapView.Create)
@@ -171,9 +217,36 @@ func New() (m *macaron.Macaron) {
 	m.Delete("/gateways/:id", gatewayView.Delete)
 	m.Get("/gateways/:id", gatewayView.Edit)
 	m.Post("/gateways/:id", gatewayView.Patch)
+	m.Get("/natgateways", natView.List)
+	m.Get("/natgateways/new", natView.New)
+	m.Post("/natgateways/new", natView.Create)
+	m.Delete("/natgateways/:id", natView.Delete)
+	m.Get("/natgateways/:id", natView.Edit)
+	m.Post("/natgateways/:id", natView.Patch)
+	m.Get("/vpns", vpnView.List)
+	m.Get("/vpns/new", vpnView.New)
+	m.Post("/vpns/new", vpnView.Create)
+	m.Delete("/vpns/:id", vpnView.Delete)
+	m.Get("/vpns/:id", vpnView.Edit)
+	m.Post("/vpns/:id", vpnView.Patch)
+	m.Get("/peerings", peeringView.List)
+	m.Get("/peerings/new", peeringView.New)
+	m.Post("/peerings/new", peeringView.Create)
+	m.Delete("/peerings/:id", peeringView.Delete)
+	m.Post("/peerings/:id/accept", peeringView.Accept)
+	m.Post("/peerings/:id/reject", peeringView.Reject)
+	m.Get("/routetables", routeTableView.List)
+	m.Get("/routetables/new", routeTableView.New)
+	m.Post("/routetables/new", routeTableView.Create)
+	m.Delete("/routetables/:id", routeTableView.Delete)
+	m.Get("/routetables/:id", routeTableView.Edit)
+	m.Post("/routetables/:id", routeTableView.Patch)
 	m.Get("/secgroups", secgroupView.List)
 	m.Get("/secgroups/new", secgroupView.New)
 	m.Post("/secgroups/new", secgroupView.Create)
+	m.Get("/secgroups/import", secgroupView.ImportNew)
+	m.Post("/secgroups/import", secgroupView.Import)
+	m.Get("/secgroups/:id/export", secgroupView.Export)
 	m.Delete("/secgroups/:id", secgroupView.Delete)
 	m.Get("/secgroups/:id", secgroupView.Edit)
 	m.Post("/secgroups/:id", secgroupView.Patch)
@@ -181,6 +254,35 @@ func New() (m *macaron.Macaron) {
 	m.Get("/secgroups/:sgid/secrules/new", secruleView.New)
 	m.Post("/secgroups/:sgid/secrules/new", secruleView.Create)
 	m.Delete("/secgroups/:sgid/secrules/:id", secruleView.Delete)
+	m.Get("/secgroups/:sgid/pushes", secpushView.List)
+	m.Post("/secgroups/:sgid/pushes/:id/retry", secpushView.Retry)
+	m.Get("/sgtemplates", sgTemplateView.List)
+	m.Get("/sgtemplates/new", sgTemplateView.New)
+	m.Post("/sgtemplates/new", sgTemplateView.Create)
+	m.Delete("/sgtemplates/:id", sgTemplateView.Delete)
+	m.Post("/sgtemplates/:id/instantiate", sgTemplateView.Instantiate)
+	m.Get("/flowlogs", flowLogView.List)
+	m.Get("/flowlogs/new", flowLogView.New)
+	m.Post("/flowlogs/new", flowLogView.Create)
+	m.Delete("/flowlogs/:id", flowLogView.Delete)
+	m.Get("/flowlogs/:id/records", flowLogView.Records)
+	m.Get("/qospolicies", qosView.List)
+	m.Get("/qospolicies/new", qosView.New)
+	m.Post("/qospolicies/new", qosView.Create)
+	m.Delete("/qospolicies/:id", qosView.Delete)
+	m.Get("/qospolicies/:id", qosView.Edit)
+	m.Post("/qospolicies/:id", qosView.Patch)
+	m.Post("/qospolicies/:id/attach", qosView.Attach)
+	m.Get("/acls", aclView.List)
+	m.Get("/acls/new", aclView.New)
+	m.Post("/acls/new", aclView.Create)
+	m.Delete("/acls/:id", aclView.Delete)
+	m.Get("/acls/:id", aclView.Edit)
+	m.Post("/acls/:id", aclView.Patch)
+	m.Get("/acls/:aclid/rules", aclRuleView.List)
+	m.Get("/acls/:aclid/rules/new", aclRuleView.New)
+	m.Post("/acls/:aclid/rules/new", aclRuleView.Create)
+	m.Delete("/acls/:aclid/rules/:id", aclRuleView.Delete)
 	m.Get("/error", func(c *macaron.Context) {
 		c.Data["ErrorMsg"] = c.QueryTrim("ErrorMsg")
 		c.HTML(500, "error")
@@ -215,7 +317,7 @@ func LinkHandler(c *macaron.Context, store session.Store) {
 		}
 		c.Data["Organization"] = store.Get("org").(string)
 		c.Data["Members"] = store.Get("members").([]*model.Member)
-	} else if link != "" && link != "/" && !strings.HasPrefix(link, "/login") && !strings.HasPrefix(link, "/consoleresolver") {
+	} else if link != "" && link != "/" && !strings.HasPrefix(link, "/login") && !strings.HasPrefix(link, "/consoleresolver") && !strings.HasPrefix(link, "/imagefiles") {
 		UrlBefore = link
 		c.Redirect("login?redirect_to=")
 	}
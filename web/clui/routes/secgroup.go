@@ -90,32 +90,32 @@ func (a *SecgroupAdmin) Create(ctx context.Context, name string, isDefault bool,
 		log.Println("DB failed to create security group, %v", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "egress", "tcp", 1, 65535)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "egress", "tcp", 1, 65535)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "egress", "udp", 1, 65535)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "egress", "udp", 1, 65535)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "tcp", 22, 22)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "tcp", 22, 22)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "udp", 68, 68)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "udp", 68, 68)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "egress", "icmp", -1, -1)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "egress", "icmp", -1, -1)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
 	}
-	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", "ingress", "icmp", -1, -1)
+	_, err = secruleAdmin.Create(ctx, secgroup.ID, owner, "0.0.0.0/0", 0, "ingress", "icmp", -1, -1)
 	if err != nil {
 		log.Println("Failed to create security rule", err)
 		return
@@ -144,6 +144,21 @@ func (a *SecgroupAdmin) Delete(id int64) (err error) {
 		err = fmt.Errorf("Security group has associated interfaces")
 		return
 	}
+	if err = db.Take(secgroup).Error; err != nil {
+		log.Println("DB failed to query security group", err)
+		return
+	}
+	count := 0
+	err = db.Model(&model.SecurityRule{}).Where("remote_group = ? and secgroup != ?", secgroup.UUID, id).Count(&count).Error
+	if err != nil {
+		log.Println("DB failed to count referencing security rules", err)
+		return
+	}
+	if count > 0 {
+		log.Println("Security group is referenced by rules of other security groups")
+		err = fmt.Errorf("Security group is referenced by rules of other security groups")
+		return
+	}
 	err = db.Where("secgroup = ?", id).Delete(&model.SecurityRule{}).Error
 	if err != nil {
 		log.Println("DB failed to delete security group rules", err)
@@ -0,0 +1,142 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IBM/cloudland/web/clui/grpcs"
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	secpushAdmin = &SecpushAdmin{}
+	secpushView  = &SecpushView{}
+)
+
+type SecpushAdmin struct{}
+type SecpushView struct{}
+
+func (a *SecpushAdmin) Retry(ctx context.Context, sgID, id int64) (err error) {
+	db := DB()
+	push := &model.SecgroupPush{Model: model.Model{ID: id}}
+	if err = db.Where("secgroup_id = ?", sgID).Take(push).Error; err != nil {
+		log.Println("DB failed to query security group push", err)
+		return
+	}
+	if push.Status == "done" {
+		return
+	}
+	go grpcs.SendSecgroupPush(context.Background(), push.ID)
+	return
+}
+
+func (a *SecpushAdmin) List(ctx context.Context, offset, limit int64, order string, secgroupID int64) (total int64, pushes []*model.SecgroupPush, err error) {
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	where := fmt.Sprintf("secgroup_id = %d", secgroupID)
+	pushes = []*model.SecgroupPush{}
+	if err = db.Model(&model.SecgroupPush{}).Where(where).Count(&total).Error; err != nil {
+		log.Println("DB failed to count security group push(es), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Hosts", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, push_id, hyper, status, retries")
+	}).Where(where).Find(&pushes).Error; err != nil {
+		log.Println("DB failed to query security group push(es), %v", err)
+		return
+	}
+
+	return
+}
+
+func (v *SecpushView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	secgroupID := c.ParamsInt64("sgid")
+	permit, err := memberShip.CheckOwner(model.Reader, "security_groups", secgroupID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	total, pushes, err := secpushAdmin.List(c.Req.Context(), offset, limit, order, secgroupID)
+	if err != nil {
+		log.Println("Failed to list security group push(es)", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["Pushes"] = pushes
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"pushes": pushes,
+			"total":  total,
+			"pages":  pages,
+		})
+		return
+	}
+	c.HTML(200, "secpushes")
+}
+
+func (v *SecpushView) Retry(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	secgroupID := c.ParamsInt64("sgid")
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "security_groups", secgroupID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = secpushAdmin.Retry(c.Req.Context(), secgroupID, id)
+	if err != nil {
+		log.Println("Failed to retry security group push", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, "ok")
+		return
+	}
+	c.Redirect("../../pushes")
+}
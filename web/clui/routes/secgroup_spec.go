@@ -0,0 +1,305 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+	yaml "gopkg.in/yaml.v2"
+)
+
+type SecruleSpec struct {
+	RemoteIp    string `json:"remote_ip,omitempty" yaml:"remote_ip,omitempty"`
+	RemoteGroup string `json:"remote_group,omitempty" yaml:"remote_group,omitempty"`
+	Direction   string `json:"direction" yaml:"direction"`
+	Protocol    string `json:"protocol" yaml:"protocol"`
+	PortMin     int32  `json:"port_min" yaml:"port_min"`
+	PortMax     int32  `json:"port_max" yaml:"port_max"`
+}
+
+type SecgroupSpec struct {
+	Name  string         `json:"name" yaml:"name"`
+	Rules []*SecruleSpec `json:"rules" yaml:"rules"`
+}
+
+func validateSecruleSpec(rule *SecruleSpec) (err error) {
+	if rule.Direction != "ingress" && rule.Direction != "egress" {
+		return fmt.Errorf("Invalid direction %s", rule.Direction)
+	}
+	if rule.RemoteIp != "" && rule.RemoteGroup != "" {
+		return fmt.Errorf("Remote ip and remote group can not be both specified")
+	}
+	if rule.RemoteIp != "" && net.ParseIP(rule.RemoteIp) == nil {
+		if _, _, err = net.ParseCIDR(rule.RemoteIp); err != nil {
+			return fmt.Errorf("Invalid remote ip %s", rule.RemoteIp)
+		}
+	}
+	switch rule.Protocol {
+	case "tcp", "udp":
+		if rule.PortMin < 1 || rule.PortMax > 65535 || rule.PortMax < rule.PortMin {
+			return fmt.Errorf("Invalid %s port range %d-%d", rule.Protocol, rule.PortMin, rule.PortMax)
+		}
+	case "icmp":
+		if rule.PortMin < -1 || rule.PortMin > 255 || rule.PortMax < -1 || rule.PortMax > 255 {
+			return fmt.Errorf("Invalid icmp type %d or code %d", rule.PortMin, rule.PortMax)
+		}
+	case "vrrp":
+	default:
+		return fmt.Errorf("Invalid protocol %s", rule.Protocol)
+	}
+	return
+}
+
+// parseSecgroupSpec decodes a security group in json or yaml, the format is detected from the content if not given
+func parseSecgroupSpec(content []byte, format string) (spec *SecgroupSpec, err error) {
+	spec = &SecgroupSpec{}
+	if format == "" {
+		format = "yaml"
+		if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+			format = "json"
+		}
+	}
+	switch format {
+	case "json":
+		err = json.Unmarshal(content, spec)
+	case "yaml":
+		err = yaml.Unmarshal(content, spec)
+	default:
+		err = fmt.Errorf("Unsupported format %s", format)
+	}
+	if err != nil {
+		log.Println("Failed to parse security group", err)
+		return
+	}
+	if spec.Name == "" {
+		err = fmt.Errorf("Security group name is empty")
+		return
+	}
+	for i, rule := range spec.Rules {
+		if err = validateSecruleSpec(rule); err != nil {
+			err = fmt.Errorf("Rule %d: %s", i+1, err.Error())
+			return
+		}
+	}
+	return
+}
+
+func marshalSecgroupSpec(spec *SecgroupSpec, format string) (content []byte, err error) {
+	if format == "yaml" {
+		content, err = yaml.Marshal(spec)
+	} else {
+		content, err = json.MarshalIndent(spec, "", "  ")
+	}
+	return
+}
+
+func (a *SecgroupAdmin) Export(ctx context.Context, id int64) (spec *SecgroupSpec, err error) {
+	db := DB()
+	secgroup := &model.SecurityGroup{Model: model.Model{ID: id}}
+	if err = db.Take(secgroup).Error; err != nil {
+		log.Println("DB failed to query security group", err)
+		return
+	}
+	secrules := []*model.SecurityRule{}
+	if err = db.Where("secgroup = ?", id).Order("id").Find(&secrules).Error; err != nil {
+		log.Println("DB failed to query security rules", err)
+		return
+	}
+	spec = &SecgroupSpec{Name: secgroup.Name, Rules: []*SecruleSpec{}}
+	for _, rule := range secrules {
+		remoteGroup := ""
+		if rule.RemoteGroup != "" {
+			rsg := &model.SecurityGroup{}
+			if err = db.Where("uuid = ?", rule.RemoteGroup).Take(rsg).Error; err != nil {
+				log.Println("DB failed to query remote security group", err)
+				return
+			}
+			remoteGroup = rsg.Name
+		}
+		spec.Rules = append(spec.Rules, &SecruleSpec{
+			RemoteIp:    rule.RemoteIp,
+			RemoteGroup: remoteGroup,
+			Direction:   rule.Direction,
+			Protocol:    rule.Protocol,
+			PortMin:     rule.PortMin,
+			PortMax:     rule.PortMax,
+		})
+	}
+	return
+}
+
+// Import creates a security group with exactly the rules of the spec, remote groups are
+// resolved by name among the groups of the owner, including the imported group itself.
+// The group is new and has no interface yet, so the rules are only saved and nothing is pushed.
+func (a *SecgroupAdmin) Import(ctx context.Context, spec *SecgroupSpec, owner int64) (secgroup *model.SecurityGroup, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	remoteGroups := make(map[string]string)
+	for i, rule := range spec.Rules {
+		if err = validateSecruleSpec(rule); err != nil {
+			err = fmt.Errorf("Rule %d: %s", i+1, err.Error())
+			return
+		}
+		if rule.RemoteGroup == "" || rule.RemoteGroup == spec.Name {
+			continue
+		}
+		if _, ok := remoteGroups[rule.RemoteGroup]; ok {
+			continue
+		}
+		rsg := &model.SecurityGroup{}
+		if err = db.Where("owner = ? and name = ?", owner, rule.RemoteGroup).Take(rsg).Error; err != nil {
+			log.Println("DB failed to query remote security group", err)
+			err = fmt.Errorf("Rule %d: remote group %s not found", i+1, rule.RemoteGroup)
+			return
+		}
+		remoteGroups[rule.RemoteGroup] = rsg.UUID
+	}
+	secgroup = &model.SecurityGroup{Model: model.Model{Creater: memberShip.UserID, Owner: owner}, Name: spec.Name}
+	if err = db.Create(secgroup).Error; err != nil {
+		log.Println("DB failed to create security group, %v", err)
+		return
+	}
+	remoteGroups[spec.Name] = secgroup.UUID
+	for _, rule := range spec.Rules {
+		secrule := &model.SecurityRule{
+			Model:       model.Model{Creater: memberShip.UserID, Owner: owner},
+			Secgroup:    secgroup.ID,
+			RemoteIp:    rule.RemoteIp,
+			RemoteGroup: remoteGroups[rule.RemoteGroup],
+			Direction:   rule.Direction,
+			IpVersion:   "ipv4",
+			Protocol:    rule.Protocol,
+			PortMin:     rule.PortMin,
+			PortMax:     rule.PortMax,
+		}
+		if err = db.Create(secrule).Error; err != nil {
+			log.Println("DB failed to create security rule", err)
+			return
+		}
+	}
+	return
+}
+
+func (v *SecgroupView) Export(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Reader, "security_groups", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	format := c.QueryTrim("format")
+	if format != "yaml" {
+		format = "json"
+	}
+	spec, err := secgroupAdmin.Export(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to export security group", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	content, err := marshalSecgroupSpec(spec, format)
+	if err != nil {
+		log.Println("Failed to marshal security group", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	contentType := "application/json"
+	if format == "yaml" {
+		contentType = "application/x-yaml"
+	}
+	c.Resp.Header().Set("Content-Type", contentType)
+	c.Resp.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s", spec.Name, format))
+	c.Resp.WriteHeader(200)
+	c.Resp.Write(content)
+}
+
+func (v *SecgroupView) ImportNew(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.HTML(200, "secgroups_import")
+}
+
+func (v *SecgroupView) Import(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../secgroups"
+	content := []byte(c.QueryTrim("content"))
+	if len(content) == 0 {
+		content, _ = c.Req.Body().Bytes()
+	}
+	spec, err := parseSecgroupSpec(content, c.QueryTrim("format"))
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(400, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	if name := c.QueryTrim("name"); name != "" {
+		for _, rule := range spec.Rules {
+			if rule.RemoteGroup == spec.Name {
+				rule.RemoteGroup = name
+			}
+		}
+		spec.Name = name
+	}
+	secgroup, err := secgroupAdmin.Import(c.Req.Context(), spec, memberShip.OrgID)
+	if err != nil {
+		log.Println("Failed to import security group", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, secgroup)
+		return
+	}
+	c.Redirect(redirectTo)
+}
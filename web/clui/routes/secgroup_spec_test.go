@@ -0,0 +1,80 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+)
+
+func TestParseSecgroupSpec(t *testing.T) {
+	spec, err := parseSecgroupSpec([]byte(`{"name": "web", "rules": [{"direction": "ingress", "protocol": "tcp", "port_min": 80, "port_max": 443, "remote_ip": "0.0.0.0/0"}]}`), "")
+	if err != nil || spec.Name != "web" || len(spec.Rules) != 1 || spec.Rules[0].PortMax != 443 {
+		t.Fatal(spec, err)
+	}
+	yamlSpec := `
+name: k8s-node
+rules:
+- direction: ingress
+  protocol: tcp
+  port_min: 10250
+  port_max: 10250
+  remote_group: k8s-node
+- direction: egress
+  protocol: icmp
+  port_min: -1
+  port_max: -1
+`
+	spec, err = parseSecgroupSpec([]byte(yamlSpec), "")
+	if err != nil || spec.Name != "k8s-node" || len(spec.Rules) != 2 || spec.Rules[0].RemoteGroup != "k8s-node" {
+		t.Fatal(spec, err)
+	}
+	if _, err = parseSecgroupSpec([]byte("name: web"), "json"); err == nil {
+		t.Fatal("yaml parsed as json should fail")
+	}
+	if _, err = parseSecgroupSpec([]byte(`{"name": "web"}`), "xml"); err == nil {
+		t.Fatal("unsupported format should fail")
+	}
+	if _, err = parseSecgroupSpec([]byte(`{"rules": []}`), "json"); err == nil {
+		t.Fatal("spec without name should fail")
+	}
+}
+
+func TestValidateSecruleSpec(t *testing.T) {
+	invalid := []*SecruleSpec{
+		{Direction: "inbound", Protocol: "tcp", PortMin: 22, PortMax: 22},
+		{Direction: "ingress", Protocol: "sctp", PortMin: 22, PortMax: 22},
+		{Direction: "ingress", Protocol: "tcp", PortMin: 0, PortMax: 22},
+		{Direction: "ingress", Protocol: "udp", PortMin: 53, PortMax: 70000},
+		{Direction: "ingress", Protocol: "tcp", PortMin: 443, PortMax: 80},
+		{Direction: "ingress", Protocol: "icmp", PortMin: 300, PortMax: -1},
+		{Direction: "ingress", Protocol: "tcp", PortMin: 22, PortMax: 22, RemoteIp: "10.0.0.0/33"},
+		{Direction: "ingress", Protocol: "tcp", PortMin: 22, PortMax: 22, RemoteIp: "10.0.0.0/8", RemoteGroup: "web"},
+	}
+	for _, rule := range invalid {
+		if err := validateSecruleSpec(rule); err == nil {
+			t.Fatal("rule should be invalid", rule)
+		}
+	}
+	if err := validateSecruleSpec(&SecruleSpec{Direction: "egress", Protocol: "icmp", PortMin: -1, PortMax: -1, RemoteIp: "192.168.1.1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMarshalSecgroupSpec(t *testing.T) {
+	spec := &SecgroupSpec{Name: "web", Rules: []*SecruleSpec{{Direction: "ingress", Protocol: "tcp", PortMin: 80, PortMax: 80, RemoteIp: "0.0.0.0/0"}}}
+	for _, format := range []string{"json", "yaml"} {
+		content, err := marshalSecgroupSpec(spec, format)
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		parsed, err := parseSecgroupSpec(content, format)
+		if err != nil || parsed.Name != "web" || len(parsed.Rules) != 1 || parsed.Rules[0].RemoteIp != "0.0.0.0/0" {
+			t.Fatal(format, parsed, err)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	sgTemplateAdmin = &SgTemplateAdmin{}
+	sgTemplateView  = &SgTemplateView{}
+)
+
+type SgTemplateAdmin struct{}
+type SgTemplateView struct{}
+
+// Create publishes a template from a security group spec, a remote group of the rules may
+// only refer to the template itself since it is instantiated in different organizations
+func (a *SgTemplateAdmin) Create(ctx context.Context, spec *SecgroupSpec, description string) (template *model.SecgroupTemplate, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	for i, rule := range spec.Rules {
+		if err = validateSecruleSpec(rule); err != nil {
+			err = fmt.Errorf("Rule %d: %s", i+1, err.Error())
+			return
+		}
+		if rule.RemoteGroup != "" && rule.RemoteGroup != spec.Name {
+			err = fmt.Errorf("Rule %d: remote group of a template can only be the template itself", i+1)
+			return
+		}
+	}
+	count := 0
+	if err = db.Model(&model.SecgroupTemplate{}).Where("name = ?", spec.Name).Count(&count).Error; err != nil {
+		log.Println("DB failed to count security group templates", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Security group template %s already exists", spec.Name)
+		return
+	}
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	template = &model.SecgroupTemplate{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: spec.Name, Description: description}
+	if err = db.Create(template).Error; err != nil {
+		log.Println("DB failed to create security group template", err)
+		return
+	}
+	for _, rule := range spec.Rules {
+		tmplRule := &model.SecgroupTemplateRule{
+			Model:       model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+			TemplateID:  template.ID,
+			RemoteIp:    rule.RemoteIp,
+			RemoteGroup: rule.RemoteGroup,
+			Direction:   rule.Direction,
+			Protocol:    rule.Protocol,
+			PortMin:     rule.PortMin,
+			PortMax:     rule.PortMax,
+		}
+		if err = db.Create(tmplRule).Error; err != nil {
+			log.Println("DB failed to create security group template rule", err)
+			return
+		}
+		template.Rules = append(template.Rules, tmplRule)
+	}
+	return
+}
+
+func (a *SgTemplateAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	if err = db.Where("template_id = ?", id).Delete(&model.SecgroupTemplateRule{}).Error; err != nil {
+		log.Println("DB failed to delete security group template rules", err)
+		return
+	}
+	if err = db.Delete(&model.SecgroupTemplate{Model: model.Model{ID: id}}).Error; err != nil {
+		log.Println("DB failed to delete security group template", err)
+		return
+	}
+	return
+}
+
+// Instantiate creates a security group named name in the organization owner from the template
+func (a *SgTemplateAdmin) Instantiate(ctx context.Context, id int64, name string, owner int64) (secgroup *model.SecurityGroup, err error) {
+	db := DB()
+	template := &model.SecgroupTemplate{Model: model.Model{ID: id}}
+	if err = db.Preload("Rules").Take(template).Error; err != nil {
+		log.Println("DB failed to query security group template", err)
+		return
+	}
+	if name == "" {
+		name = template.Name
+	}
+	spec := &SecgroupSpec{Name: name, Rules: []*SecruleSpec{}}
+	for _, rule := range template.Rules {
+		remoteGroup := ""
+		if rule.RemoteGroup != "" {
+			remoteGroup = name
+		}
+		spec.Rules = append(spec.Rules, &SecruleSpec{
+			RemoteIp:    rule.RemoteIp,
+			RemoteGroup: remoteGroup,
+			Direction:   rule.Direction,
+			Protocol:    rule.Protocol,
+			PortMin:     rule.PortMin,
+			PortMax:     rule.PortMax,
+		})
+	}
+	secgroup, err = secgroupAdmin.Import(ctx, spec, owner)
+	return
+}
+
+func (a *SgTemplateAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, templates []*model.SecgroupTemplate, err error) {
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	templates = []*model.SecgroupTemplate{}
+	if err = db.Model(&model.SecgroupTemplate{}).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count security group template(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Rules").Where(query).Find(&templates).Error; err != nil {
+		log.Println("DB failed to query security group template(s), %v", err)
+		return
+	}
+
+	return
+}
+
+func (v *SgTemplateView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, templates, err := sgTemplateAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list security group template(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["SgTemplates"] = templates
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"sgtemplates": templates,
+			"total":       total,
+			"pages":       pages,
+			"query":       query,
+		})
+		return
+	}
+	c.HTML(200, "sgtemplates")
+}
+
+func (v *SgTemplateView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	id := c.ParamsInt64("id")
+	err = sgTemplateAdmin.Delete(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to delete security group template", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "sgtemplates",
+	})
+	return
+}
+
+func (v *SgTemplateView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.HTML(200, "sgtemplates_new")
+}
+
+func (v *SgTemplateView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../sgtemplates"
+	content := []byte(c.QueryTrim("content"))
+	if len(content) == 0 {
+		content, _ = c.Req.Body().Bytes()
+	}
+	spec, err := parseSecgroupSpec(content, c.QueryTrim("format"))
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(400, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	description := c.QueryTrim("description")
+	template, err := sgTemplateAdmin.Create(c.Req.Context(), spec, description)
+	if err != nil {
+		log.Println("Failed to create security group template", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, template)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *SgTemplateView) Instantiate(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../../secgroups"
+	id := c.ParamsInt64("id")
+	name := c.QueryTrim("name")
+	secgroup, err := sgTemplateAdmin.Instantiate(c.Req.Context(), id, name, memberShip.OrgID)
+	if err != nil {
+		log.Println("Failed to instantiate security group template", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, secgroup)
+		return
+	}
+	c.Redirect(redirectTo)
+}
@@ -13,7 +13,9 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/IBM/cloudland/web/clui/grpcs"
 	"github.com/IBM/cloudland/web/clui/model"
 	"github.com/IBM/cloudland/web/sca/dbs"
 	"github.com/go-macaron/session"
@@ -28,22 +30,15 @@ var (
 type SecruleAdmin struct{}
 type SecruleView struct{}
 
-func (a *SecruleAdmin) ApplySecgroup(ctx context.Context, secgroup *model.SecurityGroup, ruleID int64) (err error) {
-	db := DB()
-	if len(secgroup.Interfaces) <= 0 {
-		return
-	}
-	securityData := []*SecurityData{}
-	secrules := []*model.SecurityRule{}
-	err = db.Model(&model.SecurityRule{}).Where("secgroup = ?", secgroup.ID).Find(&secrules).Error
-	if err != nil {
-		log.Println("DB failed to query security rules", err)
-		return
-	}
-	for _, rule := range secrules {
-		if rule.ID == ruleID {
-			continue
-		}
+type SecurityDelta struct {
+	Address string          `json:"address"`
+	MacAddr string          `json:"mac_addr"`
+	Add     []*SecurityData `json:"add,omitempty"`
+	Delete  []*SecurityData `json:"delete,omitempty"`
+}
+
+func toSecurityData(secRules []*model.SecurityRule) (securityData []*SecurityData) {
+	for _, rule := range secRules {
 		sgr := &SecurityData{
 			Secgroup:    rule.Secgroup,
 			RemoteIp:    rule.RemoteIp,
@@ -56,30 +51,167 @@ func (a *SecruleAdmin) ApplySecgroup(ctx context.Context, secgroup *model.Securi
 		}
 		securityData = append(securityData, sgr)
 	}
-	jsonData, err := json.Marshal(securityData)
-	if err != nil {
-		log.Println("Failed to marshal instance json data, %v", err)
+	return
+}
+
+// ApplySecgroup propagates the added and deleted rules to the interfaces of the security group,
+// the deltas are batched per hypervisor and delivered in the background, the returned push
+// tracks the progress and keeps the batches of offline hypervisors for retrying
+func (a *SecruleAdmin) ApplySecgroup(ctx context.Context, secgroup *model.SecurityGroup, added, deleted []*model.SecurityRule) (push *model.SecgroupPush, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if len(secgroup.Interfaces) <= 0 || (len(added) == 0 && len(deleted) == 0) {
 		return
 	}
+	instIDs := []int64{}
 	for _, iface := range secgroup.Interfaces {
-		inst := &model.Instance{Model: model.Model{ID: iface.Instance}}
-		err = db.Take(inst).Error
-		if err != nil {
-			log.Println("DB failed to create security rule", err)
+		instIDs = append(instIDs, iface.Instance)
+	}
+	instances := []*model.Instance{}
+	if err = db.Where(instIDs).Find(&instances).Error; err != nil {
+		log.Println("DB failed to query instances", err)
+		return
+	}
+	instHypers := make(map[int64]int32)
+	for _, inst := range instances {
+		instHypers[inst.ID] = inst.Hyper
+	}
+	hypers := []int32{}
+	batches := make(map[int32][]*SecurityDelta)
+	addData := toSecurityData(added)
+	deleteData := toSecurityData(deleted)
+	for _, iface := range secgroup.Interfaces {
+		hyper, ok := instHypers[iface.Instance]
+		if !ok || hyper < 0 || iface.Address == nil {
 			continue
 		}
-		control := fmt.Sprintf("inter=%d", inst.Hyper)
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/reapply_secgroup.sh '%s' '%s' <<EOF\n%s\nEOF", iface.Address.Address, iface.MacAddr, jsonData)
-		err = hyperExecute(ctx, control, command)
+		if _, ok = batches[hyper]; !ok {
+			hypers = append(hypers, hyper)
+		}
+		batches[hyper] = append(batches[hyper], &SecurityDelta{
+			Address: iface.Address.Address,
+			MacAddr: iface.MacAddr,
+			Add:     addData,
+			Delete:  deleteData,
+		})
+	}
+	if len(hypers) == 0 {
+		return
+	}
+	push = &model.SecgroupPush{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, SecgroupID: secgroup.ID, Status: "pending", Total: int32(len(hypers))}
+	if err = db.Create(push).Error; err != nil {
+		log.Println("DB failed to create security group push", err)
+		return
+	}
+	for _, hyper := range hypers {
+		var jsonData []byte
+		jsonData, err = json.Marshal(batches[hyper])
+		if err != nil {
+			log.Println("Failed to marshal security delta json data, %v", err)
+			return
+		}
+		pushHost := &model.SecgroupPushHost{Model: model.Model{Owner: memberShip.OrgID}, PushID: push.ID, Hyper: hyper, Status: "pending", Payload: string(jsonData)}
+		if err = db.Create(pushHost).Error; err != nil {
+			log.Println("DB failed to create security group push host", err)
+			return
+		}
+	}
+	go grpcs.SendSecgroupPush(context.Background(), push.ID)
+	return
+}
+
+func secgroupsDiff(secGroups, others []*model.SecurityGroup) (diff []*model.SecurityGroup) {
+	for _, sg := range secGroups {
+		found := false
+		for _, other := range others {
+			if other.ID == sg.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			diff = append(diff, sg)
+		}
+	}
+	return
+}
+
+// memberRules returns the rules referencing the security groups as remote group, resolved to the member address
+func (a *SecruleAdmin) memberRules(ctx context.Context, secGroups []*model.SecurityGroup, memberIp string) (secrules []*model.SecurityRule, err error) {
+	db := DB()
+	uuids := []string{}
+	for _, sg := range secGroups {
+		if sg.UUID == "" {
+			if err = db.Take(sg).Error; err != nil {
+				log.Println("DB failed to query security group", err)
+				return
+			}
+		}
+		uuids = append(uuids, sg.UUID)
+	}
+	if len(uuids) == 0 {
+		return
+	}
+	if err = db.Where("remote_group in (?)", uuids).Find(&secrules).Error; err != nil {
+		log.Println("DB failed to query rules referencing security groups", err)
+		return
+	}
+	for _, rule := range secrules {
+		rule.RemoteIp = memberIp
+	}
+	return
+}
+
+// MemberChanged is called when an interface with the address joins or leaves security groups,
+// the security groups having rules referencing them get the member address added or deleted
+func (a *SecruleAdmin) MemberChanged(ctx context.Context, address string, joined, left []*model.SecurityGroup) (err error) {
+	db := DB()
+	if address == "" {
+		return
+	}
+	memberIp := strings.Split(address, "/")[0] + "/32"
+	added, err := a.memberRules(ctx, joined, memberIp)
+	if err != nil {
+		return
+	}
+	deleted, err := a.memberRules(ctx, left, memberIp)
+	if err != nil {
+		return
+	}
+	sgIDs := []int64{}
+	addedBySg := make(map[int64][]*model.SecurityRule)
+	deletedBySg := make(map[int64][]*model.SecurityRule)
+	for _, rule := range added {
+		if _, ok := addedBySg[rule.Secgroup]; !ok {
+			sgIDs = append(sgIDs, rule.Secgroup)
+		}
+		addedBySg[rule.Secgroup] = append(addedBySg[rule.Secgroup], rule)
+	}
+	for _, rule := range deleted {
+		_, ok1 := addedBySg[rule.Secgroup]
+		_, ok2 := deletedBySg[rule.Secgroup]
+		if !ok1 && !ok2 {
+			sgIDs = append(sgIDs, rule.Secgroup)
+		}
+		deletedBySg[rule.Secgroup] = append(deletedBySg[rule.Secgroup], rule)
+	}
+	for _, sgID := range sgIDs {
+		secgroup := &model.SecurityGroup{Model: model.Model{ID: sgID}}
+		err = db.Model(secgroup).Preload("Address").Related(&secgroup.Interfaces, "Interfaces").Error
 		if err != nil {
-			log.Println("Launch vm command execution failed", err)
+			log.Println("DB failed to query security group", err)
+			return
+		}
+		_, err = a.ApplySecgroup(ctx, secgroup, addedBySg[sgID], deletedBySg[sgID])
+		if err != nil {
+			log.Println("Failed to apply security group", err)
 			return
 		}
 	}
 	return
 }
 
-func (a *SecruleAdmin) Create(ctx context.Context, sgID, owner int64, remoteIp, direction, protocol string, portMin, portMax int) (secrule *model.SecurityRule, err error) {
+func (a *SecruleAdmin) Create(ctx context.Context, sgID, owner int64, remoteIp string, remoteGroupID int64, direction, protocol string, portMin, portMax int) (secrule *model.SecurityRule, err error) {
 	memberShip := GetMemberShip(ctx)
 	db := DB()
 	secgroup := &model.SecurityGroup{Model: model.Model{ID: sgID}}
@@ -88,22 +220,41 @@ func (a *SecruleAdmin) Create(ctx context.Context, sgID, owner int64, remoteIp,
 		log.Println("DB failed to query security group", err)
 		return
 	}
+	remoteGroup := ""
+	if remoteGroupID > 0 {
+		if remoteIp != "" {
+			err = fmt.Errorf("Remote ip and remote group can not be both specified")
+			return
+		}
+		rsg := &model.SecurityGroup{Model: model.Model{ID: remoteGroupID}}
+		if err = db.Take(rsg).Error; err != nil {
+			log.Println("DB failed to query remote security group", err)
+			return
+		}
+		remoteGroup = rsg.UUID
+	}
 	secrule = &model.SecurityRule{
-		Model:     model.Model{Creater: memberShip.UserID, Owner: owner},
-		Secgroup:  sgID,
-		RemoteIp:  remoteIp,
-		Direction: direction,
-		IpVersion: "ipv4",
-		Protocol:  protocol,
-		PortMin:   int32(portMin),
-		PortMax:   int32(portMax),
+		Model:       model.Model{Creater: memberShip.UserID, Owner: owner},
+		Secgroup:    sgID,
+		RemoteIp:    remoteIp,
+		RemoteGroup: remoteGroup,
+		Direction:   direction,
+		IpVersion:   "ipv4",
+		Protocol:    protocol,
+		PortMin:     int32(portMin),
+		PortMax:     int32(portMax),
 	}
 	err = db.Create(secrule).Error
 	if err != nil {
 		log.Println("DB failed to create security rule", err)
 		return
 	}
-	err = a.ApplySecgroup(ctx, secgroup, 0)
+	added, err := model.ExpandSecurityRules([]*model.SecurityRule{secrule})
+	if err != nil {
+		log.Println("Failed to expand security rule", err)
+		return
+	}
+	_, err = a.ApplySecgroup(ctx, secgroup, added, nil)
 	if err != nil {
 		log.Println("Failed to apply security rule", err)
 		return
@@ -127,11 +278,21 @@ func (a *SecruleAdmin) Delete(ctx context.Context, sgID, id int64) (err error) {
 		log.Println("DB failed to query security group", err)
 		return
 	}
+	secrule := &model.SecurityRule{Model: model.Model{ID: id}}
+	if err = db.Where("secgroup = ?", sgID).Take(secrule).Error; err != nil {
+		log.Println("DB failed to query security rule, %v", err)
+		return
+	}
+	deleted, err := model.ExpandSecurityRules([]*model.SecurityRule{secrule})
+	if err != nil {
+		log.Println("Failed to expand security rule", err)
+		return
+	}
 	if err = db.Delete(&model.SecurityRule{Model: model.Model{ID: id}, Secgroup: sgID}).Error; err != nil {
 		log.Println("DB failed to delete security rule, %v", err)
 		return
 	}
-	err = a.ApplySecgroup(ctx, secgroup, id)
+	_, err = a.ApplySecgroup(ctx, secgroup, nil, deleted)
 	if err != nil {
 		log.Println("Failed to apply security rule", err)
 		return
@@ -301,6 +462,14 @@ func (v *SecruleView) New(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
+	_, secgroups, err := secgroupAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		log.Println("Failed to list security groups", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.Data["Secgroups"] = secgroups
 	c.HTML(200, "secrules_new")
 }
 
@@ -329,13 +498,23 @@ func (v *SecruleView) Create(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
+	remoteGroupID := c.QueryInt64("remotegroup")
+	if remoteGroupID > 0 {
+		permit, err = memberShip.CheckOwner(model.Reader, "security_groups", remoteGroupID)
+		if !permit {
+			log.Println("Not authorized to access remote security group")
+			c.Data["ErrorMsg"] = "Not authorized to access remote security group"
+			c.HTML(http.StatusBadRequest, "error")
+			return
+		}
+	}
 	direction := c.QueryTrim("direction")
 	protocol := c.QueryTrim("protocol")
 	min := c.QueryTrim("portmin")
 	max := c.QueryTrim("portmax")
 	portMin, err := strconv.Atoi(min)
 	portMax, err := strconv.Atoi(max)
-	secrule, err := secruleAdmin.Create(c.Req.Context(), int64(secgroupID), memberShip.OrgID, remoteIp, direction, protocol, portMin, portMax)
+	secrule, err := secruleAdmin.Create(c.Req.Context(), int64(secgroupID), memberShip.OrgID, remoteIp, remoteGroupID, direction, protocol, portMin, portMax)
 	if err != nil {
 		log.Println("Failed to create security rule, %v", err)
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
@@ -167,7 +167,7 @@ func (a *SubnetAdmin) Update(ctx context.Context, id int64, name, gateway, start
 		return
 	}
 	if subnet.Router > 0 {
-		err = setRouting(ctx, subnet.ID, subnet, false)
+		err = setRouting(ctx, subnet.Router, subnet, false)
 		if err != nil {
 			log.Println("Failed to set routing for subnet")
 			return
@@ -202,12 +202,25 @@ func setRouting(ctx context.Context, gatewayID int64, subnet *model.Subnet, rout
 	if gateway.Hyper == gateway.Peer {
 		control = fmt.Sprintf("inter=%d", gateway.Hyper)
 	}
+	routes, err := getSubnetRoutes(gateway.ID, subnet)
+	if err != nil {
+		log.Println("Failed to get subnet routes", err)
+		return
+	}
+	jsonData, err := json.Marshal(routes)
+	if err != nil {
+		log.Println("Failed to marshal routes", err)
+		return
+	}
 	if routeOnly {
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_route.sh '%d' '%d' '%s'<<EOF\n%s\nEOF", gateway.ID, subnet.Vlan, subnet.Type, subnet.Routes)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_route.sh '%d' '%d' '%s'<<EOF\n%s\nEOF", gateway.ID, subnet.Vlan, subnet.Type, jsonData)
 		err = hyperExecute(ctx, control, command)
 	} else {
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_gw_route.sh '%d' '%s' '%d' soft <<EOF\n%s\nEOF", gateway.ID, subnet.Gateway, subnet.Vlan, subnet.Routes)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_gw_route.sh '%d' '%s' '%d' soft <<EOF\n%s\nEOF", gateway.ID, subnet.Gateway, subnet.Vlan, jsonData)
 		err = hyperExecute(ctx, control, command)
+		if err == nil && subnet.AclID > 0 {
+			err = aclAdmin.apply(ctx, gateway, subnet)
+		}
 	}
 	if err != nil {
 		log.Println("Set gateway failed")
@@ -419,6 +432,11 @@ func (a *SubnetAdmin) Delete(ctx context.Context, id int64) (err error) {
 		log.Println("Subnet belongs to a gateway", err)
 		return
 	}
+	if subnet.NatGatewayID > 0 {
+		err = fmt.Errorf("Subnet belongs to a nat gateway")
+		log.Println("Subnet belongs to a nat gateway", err)
+		return
+	}
 	count := 0
 	err = db.Model(&model.Interface{}).Where("subnet = ? and type <> ?", subnet.ID, "dhcp").Count(&count).Error
 	if err != nil {
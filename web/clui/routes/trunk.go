@@ -0,0 +1,365 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	trunkAdmin = &TrunkAdmin{}
+	trunkView  = &TrunkView{}
+)
+
+type TrunkAdmin struct{}
+
+type TrunkView struct{}
+
+// validateSubport checks the segmentation id and subnet of a new sub-port against the parent port and its existing sub-ports
+func validateSubport(parent *model.Interface, subports []*model.Interface, subnetID int64, segID int32) (err error) {
+	if segID < 1 || segID > 4094 {
+		return fmt.Errorf("Segmentation id must be between 1 and 4094")
+	}
+	if parent.Subnet == subnetID {
+		return fmt.Errorf("Sub-port can not be on the subnet of its parent port")
+	}
+	for _, sub := range subports {
+		if sub.SegmentationID == segID {
+			return fmt.Errorf("Segmentation id %d is already used on this trunk", segID)
+		}
+		if sub.Subnet == subnetID {
+			return fmt.Errorf("Trunk already has a sub-port on this subnet")
+		}
+	}
+	return
+}
+
+func (a *TrunkAdmin) subnetControl(subnet *model.Subnet) (control string) {
+	netlink := subnet.Netlink
+	if netlink == nil {
+		return
+	}
+	if netlink.Hyper >= 0 {
+		control = fmt.Sprintf("inter=%d", netlink.Hyper)
+		if netlink.Peer >= 0 && netlink.Hyper != netlink.Peer {
+			control = fmt.Sprintf("toall=vlan-%d:%d,%d", subnet.Vlan, netlink.Hyper, netlink.Peer)
+		}
+	} else if netlink.Peer >= 0 {
+		control = fmt.Sprintf("inter=%d", netlink.Peer)
+	}
+	return
+}
+
+// AddSubport maps a segmentation id on the parent instance interface to an address on another subnet
+func (a *TrunkAdmin) AddSubport(ctx context.Context, parentID, subnetID int64, segID int32, address string) (subport *model.Interface, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	parent := &model.Interface{Model: model.Model{ID: parentID}}
+	if err = db.Preload("Secgroups").Take(parent).Error; err != nil {
+		log.Println("Failed to query interface", err)
+		return
+	}
+	if parent.Type != "instance" || parent.Instance == 0 {
+		err = fmt.Errorf("Only instance interfaces can be trunk parents")
+		return
+	}
+	subports := []*model.Interface{}
+	if err = db.Where("parent_id = ? and type = ?", parent.ID, "subport").Find(&subports).Error; err != nil {
+		log.Println("Failed to query sub-ports", err)
+		return
+	}
+	if err = validateSubport(parent, subports, subnetID, segID); err != nil {
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: parent.Instance}}
+	if err = db.Take(instance).Error; err != nil {
+		log.Println("Failed to query instance", err)
+		return
+	}
+	if instance.Hyper < 0 {
+		err = fmt.Errorf("Instance is not scheduled to a hypervisor yet")
+		return
+	}
+	subnet := &model.Subnet{Model: model.Model{ID: subnetID}}
+	if err = db.Preload("Netlink").Preload("Zones").Take(subnet).Error; err != nil {
+		log.Println("Failed to query subnet", err)
+		return
+	}
+	if subnet.Type == "public" {
+		err = fmt.Errorf("Sub-ports can not be created on public subnets")
+		return
+	}
+	valid := false
+	for _, z := range subnet.Zones {
+		if z.ID == instance.ZoneID {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		err = fmt.Errorf("Subnet doesn't cross the zone of the instance")
+		return
+	}
+	secRules, err := model.GetSecurityRules(parent.Secgroups)
+	if err != nil {
+		log.Println("Failed to get security rules", err)
+		return
+	}
+	jsonData, err := json.Marshal(toSecurityData(secRules))
+	if err != nil {
+		log.Println("Failed to marshal security json data, %v", err)
+		return
+	}
+	name := fmt.Sprintf("%s.%d", parent.Name, segID)
+	subport, err = CreateInterface(ctx, subnetID, parent.ID, memberShip.OrgID, instance.ZoneID, instance.Hyper, address, parent.MacAddr, name, "subport", parent.Secgroups)
+	if err != nil {
+		log.Println("Failed to create sub-port", err)
+		return
+	}
+	subport.SegmentationID = segID
+	subport.Address.Subnet = subnet
+	if err = db.Model(subport).Update("segmentation_id", segID).Error; err != nil {
+		log.Println("Failed to update segmentation id", err)
+		if err2 := DeleteInterface(ctx, subport); err2 != nil {
+			log.Println("Failed to delete sub-port", err2)
+		}
+		return
+	}
+	if control := a.subnetControl(subnet); control != "" {
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/set_host.sh '%d' '%s' '%s' '%s' '%s'", subnet.Vlan, subport.MacAddr, instance.Hostname, subport.Address.Address, subnet.DomainSearch)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Set host command execution failed", err)
+			if err2 := a.deleteSubport(ctx, subport); err2 != nil {
+				log.Println("Failed to delete sub-port", err2)
+			}
+			return
+		}
+	}
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/attach_subport.sh '%d' '%s' '%d' '%d' '%s' <<EOF\n%s\nEOF", instance.ID, parent.MacAddr, segID, subnet.Vlan, subport.Address.Address, jsonData)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Attach sub-port command execution failed", err)
+		if err2 := a.deleteSubport(ctx, subport); err2 != nil {
+			log.Println("Failed to delete sub-port", err2)
+		}
+		return
+	}
+	err = secruleAdmin.MemberChanged(ctx, subport.Address.Address, parent.Secgroups, nil)
+	if err != nil {
+		log.Println("Failed to update remote security group members", err)
+		return
+	}
+	err = interfaceAdmin.syncNetworkMeta(ctx, instance)
+	return
+}
+
+// RemoveSubport unmaps a sub-port from its trunk and releases its address
+func (a *TrunkAdmin) RemoveSubport(ctx context.Context, id int64) (subport *model.Interface, err error) {
+	db := DB()
+	subport = &model.Interface{Model: model.Model{ID: id}}
+	if err = db.Set("gorm:auto_preload", true).Take(subport).Error; err != nil {
+		log.Println("Failed to query sub-port", err)
+		return
+	}
+	if subport.Type != "subport" {
+		err = fmt.Errorf("Interface is not a trunk sub-port")
+		return
+	}
+	parent := &model.Interface{Model: model.Model{ID: subport.ParentID}}
+	if err = db.Take(parent).Error; err != nil {
+		log.Println("Failed to query parent interface", err)
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: parent.Instance}}
+	if err = db.Take(instance).Error; err != nil {
+		log.Println("Failed to query instance", err)
+		return
+	}
+	if instance.Hyper >= 0 {
+		control := fmt.Sprintf("inter=%d", instance.Hyper)
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/detach_subport.sh '%d' '%s' '%d' '%d'", instance.ID, parent.MacAddr, subport.SegmentationID, subport.Address.Subnet.Vlan)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Detach sub-port command execution failed", err)
+			return
+		}
+	}
+	err = a.deleteSubport(ctx, subport)
+	if err != nil {
+		log.Println("Failed to delete sub-port", err)
+		return
+	}
+	err = secruleAdmin.MemberChanged(ctx, subport.Address.Address, nil, subport.Secgroups)
+	if err != nil {
+		log.Println("Failed to update remote security group members", err)
+		return
+	}
+	err = interfaceAdmin.syncNetworkMeta(ctx, instance)
+	return
+}
+
+func (a *TrunkAdmin) deleteSubport(ctx context.Context, subport *model.Interface) (err error) {
+	err = DeleteInterface(ctx, subport)
+	if err != nil {
+		log.Println("Failed to delete sub-port", err)
+		return
+	}
+	subnet := subport.Address.Subnet
+	if control := a.subnetControl(subnet); control != "" {
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/del_host.sh '%d' '%s' '%s'", subnet.Vlan, subport.MacAddr, subport.Address.Address)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Delete host command execution failed", err)
+			return
+		}
+	}
+	return
+}
+
+// deleteSubports releases all sub-ports of a parent interface, the hypervisor side is cleared along with the instance
+func (a *TrunkAdmin) deleteSubports(ctx context.Context, parent *model.Interface) (err error) {
+	subports := []*model.Interface{}
+	if err = DB().Preload("Address").Preload("Address.Subnet").Preload("Address.Subnet.Netlink").Where("parent_id = ? and type = ?", parent.ID, "subport").Find(&subports).Error; err != nil {
+		log.Println("Failed to query sub-ports", err)
+		return
+	}
+	for _, sub := range subports {
+		err = a.deleteSubport(ctx, sub)
+		if err != nil {
+			log.Println("Failed to delete sub-port", err)
+			return
+		}
+	}
+	return
+}
+
+func (v *TrunkView) checkParent(c *macaron.Context, ifaceID int64) (parent *model.Interface, ok bool) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	parent = &model.Interface{Model: model.Model{ID: ifaceID}}
+	if err := DB().Take(parent).Error; err != nil {
+		log.Println("Failed to query interface", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, _ := memberShip.CheckOwner(model.Writer, "instances", parent.Instance)
+	if !permit || parent.Instance == 0 {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	ok = true
+	return
+}
+
+func (v *TrunkView) List(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	parent, ok := v.checkParent(c, c.ParamsInt64("id"))
+	if !ok {
+		return
+	}
+	db := DB()
+	subports := []*model.Interface{}
+	if err := db.Preload("Address").Preload("Address.Subnet").Where("parent_id = ? and type = ?", parent.ID, "subport").Order("segmentation_id").Find(&subports).Error; err != nil {
+		log.Println("Failed to query sub-ports", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"subports": subports,
+		})
+		return
+	}
+	_, subnets, err := subnetAdmin.List(ctx, 0, -1, "", "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Interface"] = parent
+	c.Data["Subports"] = subports
+	c.Data["Subnets"] = subnets
+	c.HTML(200, "interfaces_subports")
+}
+
+func (v *TrunkView) Create(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	memberShip := GetMemberShip(ctx)
+	parent, ok := v.checkParent(c, c.ParamsInt64("id"))
+	if !ok {
+		return
+	}
+	redirectTo := fmt.Sprintf("/interfaces/%d/subports", parent.ID)
+	subnetID := c.QueryInt64("subnet")
+	permit, _ := memberShip.CheckOwner(model.Writer, "subnets", subnetID)
+	if !permit {
+		log.Println("Not authorized to access subnet")
+		c.Data["ErrorMsg"] = "Not authorized to access subnet"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	segID := c.QueryInt("segmentation_id")
+	address := c.QueryTrim("address")
+	subport, err := trunkAdmin.AddSubport(ctx, parent.ID, subnetID, int32(segID), address)
+	if err != nil {
+		log.Println("Failed to add sub-port", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, subport)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *TrunkView) Delete(c *macaron.Context, store session.Store) {
+	ctx := c.Req.Context()
+	parent, ok := v.checkParent(c, c.ParamsInt64("id"))
+	if !ok {
+		return
+	}
+	subID := c.ParamsInt64("subid")
+	count := 0
+	if err := DB().Model(&model.Interface{}).Where("id = ? and parent_id = ? and type = ?", subID, parent.ID, "subport").Count(&count).Error; err != nil || count == 0 {
+		log.Println("Sub-port does not belong to interface", err)
+		c.Data["ErrorMsg"] = "Sub-port does not belong to interface"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, err := trunkAdmin.RemoveSubport(ctx, subID)
+	if err != nil {
+		log.Println("Failed to remove sub-port", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": fmt.Sprintf("/interfaces/%d/subports", parent.ID),
+	})
+}
@@ -0,0 +1,37 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestValidateSubport(t *testing.T) {
+	parent := &model.Interface{Subnet: 1}
+	subports := []*model.Interface{{Subnet: 2, SegmentationID: 100}}
+	invalid := []struct {
+		subnet int64
+		segID  int32
+	}{
+		{3, 0},
+		{3, 4095},
+		{1, 200},
+		{2, 200},
+		{3, 100},
+	}
+	for _, sub := range invalid {
+		if err := validateSubport(parent, subports, sub.subnet, sub.segID); err == nil {
+			t.Fatal("sub-port should be invalid", sub)
+		}
+	}
+	if err := validateSubport(parent, subports, 3, 200); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -8,36 +8,97 @@ package routes
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"github.com/IBM/cloudland/web/clui/model"
 	"github.com/IBM/cloudland/web/sca/dbs"
 	"github.com/go-macaron/session"
+	"github.com/jinzhu/gorm"
 	macaron "gopkg.in/macaron.v1"
 )
 
 var (
-	volumeAdmin = &VolumeAdmin{}
-	volumeView  = &VolumeView{}
+	volumeAdmin  = &VolumeAdmin{}
+	volumeView   = &VolumeView{}
+	extendLocker sync.Mutex
 )
 
 type VolumeAdmin struct{}
 type VolumeView struct{}
 
-func (a *VolumeAdmin) Create(ctx context.Context, name string, size int) (volume *model.Volume, err error) {
+// volumeControl returns where operations on a detached volume run, typed volumes stay on the host which created them
+func volumeControl(volume *model.Volume) (control string, err error) {
+	control = "inter="
+	if volume.TypeID > 0 {
+		if volume.Hyper < 0 {
+			err = fmt.Errorf("Volume is not placed on any hypervisor yet")
+			return
+		}
+		control = fmt.Sprintf("inter=%d", volume.Hyper)
+	}
+	return
+}
+
+func (a *VolumeAdmin) Create(ctx context.Context, name string, size int, typeID int64, multiAttach bool) (volume *model.Volume, err error) {
 	memberShip := GetMemberShip(ctx)
 	db := DB()
-	volume = &model.Volume{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: name, Format: "raw", Size: int32(size), Status: "pending"}
+	volume = &model.Volume{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: name, Format: "raw", Size: int32(size), Status: "pending", MultiAttach: multiAttach}
+	control := fmt.Sprintf("inter=")
+	if typeID > 0 {
+		volType := &model.VolumeType{Model: model.Model{ID: typeID}}
+		if err = db.Preload("Glusterfs").Take(volType).Error; err != nil {
+			log.Println("DB failed to query volume type", err)
+			return
+		}
+		hypers := []*model.Hyper{}
+		if err = db.Where("status = 1").Find(&hypers).Error; err != nil {
+			log.Println("Hypers query failed", err)
+			return
+		}
+		control, err = backendHyperGroup(hypers, volType.Backend)
+		if err != nil {
+			return
+		}
+		control = "select=" + control
+		volume.TypeID = volType.ID
+		volume.Type = volType
+		if volType.Backend != "lvm" && !multiAttach {
+			volume.Format = "qcow2"
+		}
+		if volType.Encrypted {
+			if multiAttach {
+				err = fmt.Errorf("Encrypted volume can not be multi-attached")
+				return
+			}
+			volume.Format = "luks"
+			secret := make([]byte, 32)
+			if _, err = rand.Read(secret); err != nil {
+				log.Println("Failed to generate volume secret", err)
+				return
+			}
+			volume.Secret = hex.EncodeToString(secret)
+		}
+	}
 	err = db.Create(volume).Error
 	if err != nil {
 		log.Println("DB failed to create volume", err)
 		return
 	}
-	control := fmt.Sprintf("inter=")
 	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_volume.sh '%d' '%d'", volume.ID, volume.Size)
+	if volume.TypeID > 0 || volume.MultiAttach {
+		var jsonData []byte
+		jsonData, err = volumeBackendJson(volume)
+		if err != nil {
+			return
+		}
+		command = fmt.Sprintf("%s 'yes' <<EOF\n%s\nEOF", command, jsonData)
+	}
 	err = hyperExecute(ctx, control, command)
 	if err != nil {
 		log.Println("Create volume execution failed", err)
@@ -46,6 +107,17 @@ func (a *VolumeAdmin) Create(ctx context.Context, name string, size int) (volume
 	return
 }
 
+func (a *VolumeAdmin) getType(volume *model.Volume) (volType *model.VolumeType, err error) {
+	volType = &model.VolumeType{Model: model.Model{ID: volume.TypeID}}
+	if err = DB().Take(volType).Error; err != nil {
+		log.Println("DB failed to query volume type", err)
+		return
+	}
+	volume.Type = volType
+	return
+}
+
+// Update renames a volume and attaches it to an instance, instID 0 detaches it from every instance it is attached to
 func (a *VolumeAdmin) Update(ctx context.Context, id int64, name string, instID int64) (volume *model.Volume, err error) {
 	db := DB()
 	volume = &model.Volume{Model: model.Model{ID: id}}
@@ -53,43 +125,275 @@ func (a *VolumeAdmin) Update(ctx context.Context, id int64, name string, instID
 		log.Println("DB: query volume failed", err)
 		return
 	}
-	if volume.InstanceID > 0 && instID > 0 && volume.InstanceID != instID {
+	if !volume.MultiAttach && volume.InstanceID > 0 && instID > 0 && volume.InstanceID != instID {
 		err = fmt.Errorf("Pease detach volume before attach it to new instance")
 		return
 	}
 	if name != "" {
 		volume.Name = name
 	}
-	if volume.InstanceID > 0 && instID == 0 && volume.Status == "attached" {
-		control := fmt.Sprintf("inter=%d", volume.Instance.Hyper)
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/detach_volume.sh '%d' '%d'", volume.Instance.ID, volume.ID)
-		err = hyperExecute(ctx, control, command)
+	if instID == 0 && volume.Status == "attached" {
+		if err = a.detachAll(ctx, volume); err != nil {
+			return
+		}
+	} else if instID > 0 && ((volume.Status == "available" && volume.InstanceID == 0) || (volume.MultiAttach && volume.Status == "attached")) {
+		if err = a.attach(ctx, volume, instID); err != nil {
+			return
+		}
+	}
+	if err = db.Model(volume).Save(volume).Error; err != nil {
+		log.Println("DB: query volume failed", err)
+		return
+	}
+	return
+}
+
+// Detach detaches a volume from one instance, the other attachments of a multi-attach volume are kept
+func (a *VolumeAdmin) Detach(ctx context.Context, id, instID int64) (volume *model.Volume, err error) {
+	db := DB()
+	volume = &model.Volume{Model: model.Model{ID: id}}
+	if err = db.Take(volume).Error; err != nil {
+		log.Println("DB: query volume failed", err)
+		return
+	}
+	count := 0
+	if err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ? and instance_id = ? and status <> 'detaching'", volume.ID, instID).Count(&count).Error; err != nil {
+		log.Println("DB: query volume attachments failed", err)
+		return
+	}
+	if count == 0 && volume.InstanceID != instID {
+		err = fmt.Errorf("Volume is not attached to instance %d", instID)
+		return
+	}
+	instance := &model.Instance{Model: model.Model{ID: instID}}
+	if err = db.Take(instance).Error; err != nil {
+		log.Println("DB: query instance failed", err)
+		return
+	}
+	if err = a.detach(ctx, volume, instance); err != nil {
+		return
+	}
+	if err = db.Model(volume).Save(volume).Error; err != nil {
+		log.Println("DB: update volume failed", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeAdmin) attach(ctx context.Context, volume *model.Volume, instID int64) (err error) {
+	db := DB()
+	instance := &model.Instance{Model: model.Model{ID: instID}}
+	if err = db.Model(instance).Take(instance).Error; err != nil {
+		log.Println("DB: query instance failed", err)
+		return
+	}
+	if volume.MultiAttach {
+		count := 0
+		if err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ? and instance_id = ? and status <> 'detaching'", volume.ID, instID).Count(&count).Error; err != nil {
+			log.Println("DB: query volume attachments failed", err)
+			return
+		}
+		if count > 0 {
+			// already attached to this instance
+			return
+		}
+	}
+	if volume.TypeID > 0 && volume.Hyper != instance.Hyper {
+		var volType *model.VolumeType
+		volType, err = a.getType(volume)
 		if err != nil {
-			log.Println("Detach volume execution failed", err)
 			return
 		}
-		volume.Instance = nil
-		volume.InstanceID = 0
-	} else if instID > 0 && volume.InstanceID == 0 && volume.Status == "available" {
-		instance := &model.Instance{Model: model.Model{ID: instID}}
-		if err = db.Model(instance).Take(instance).Error; err != nil {
-			log.Println("DB: query instance failed", err)
+		if volType.Backend == "lvm" {
+			err = fmt.Errorf("Local volume can only be attached to instances on the same hypervisor")
 			return
 		}
-		control := fmt.Sprintf("inter=%d", instance.Hyper)
-		command := fmt.Sprintf("/opt/cloudland/scripts/backend/attach_volume.sh '%d' '%d' '%s'", instance.ID, volume.ID, volume.Path)
-		err = hyperExecute(ctx, control, command)
+	}
+	attachment := &model.VolumeAttachment{
+		Model:      model.Model{Creater: volume.Creater, Owner: volume.Owner},
+		Status:     "attaching",
+		VolumeID:   volume.ID,
+		InstanceID: instance.ID,
+	}
+	if err = db.Create(attachment).Error; err != nil {
+		log.Println("DB: create volume attachment failed", err)
+		return
+	}
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/attach_volume.sh '%d' '%d' '%s'", instance.ID, volume.ID, volume.Path)
+	if volume.TypeID > 0 || volume.MultiAttach {
+		var jsonData []byte
+		jsonData, err = volumeBackendJson(volume)
 		if err != nil {
-			log.Println("Create volume execution failed", err)
 			return
 		}
+		command = fmt.Sprintf("%s 'yes' <<EOF\n%s\nEOF", command, jsonData)
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create volume execution failed", err)
+		db.Delete(attachment)
+		return
+	}
+	if !volume.MultiAttach {
 		volume.InstanceID = instID
 		volume.Instance = nil
 	}
-	if err = db.Model(volume).Save(volume).Error; err != nil {
+	return
+}
+
+func (a *VolumeAdmin) detach(ctx context.Context, volume *model.Volume, instance *model.Instance) (err error) {
+	db := DB()
+	control := fmt.Sprintf("inter=%d", instance.Hyper)
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/detach_volume.sh '%d' '%d'", instance.ID, volume.ID)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Detach volume execution failed", err)
+		return
+	}
+	if err = db.Model(&model.VolumeAttachment{}).Where("volume_id = ? and instance_id = ?", volume.ID, instance.ID).Update("status", "detaching").Error; err != nil {
+		log.Println("DB: update volume attachment failed", err)
+		return
+	}
+	if volume.InstanceID == instance.ID {
+		volume.Instance = nil
+		volume.InstanceID = 0
+	}
+	return
+}
+
+// detachAll detaches a volume from all its instances, volumes attached before attachments were tracked only have InstanceID
+func (a *VolumeAdmin) detachAll(ctx context.Context, volume *model.Volume) (err error) {
+	db := DB()
+	attachments := []*model.VolumeAttachment{}
+	if err = db.Preload("Instance").Where("volume_id = ? and status <> 'detaching'", volume.ID).Find(&attachments).Error; err != nil {
+		log.Println("DB: query volume attachments failed", err)
+		return
+	}
+	instances := []*model.Instance{}
+	if volume.InstanceID > 0 && volume.Instance != nil {
+		instances = append(instances, volume.Instance)
+	}
+	for _, attachment := range attachments {
+		if attachment.Instance != nil && attachment.InstanceID != volume.InstanceID {
+			instances = append(instances, attachment.Instance)
+		}
+	}
+	for _, instance := range instances {
+		if err = a.detach(ctx, volume, instance); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// volumeUsage returns the total volume size of an org and its volume quota, limit is 0 when the org has no quota
+func volumeUsage(db *gorm.DB, owner int64) (used, limit int32, err error) {
+	quota := &model.Quota{}
+	if err = db.Where("owner = ?", owner).Take(quota).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			err = nil
+		} else {
+			log.Println("DB: query quota failed", err)
+		}
+		return
+	}
+	limit = quota.Volume
+	row := db.Model(&model.Volume{}).Where("owner = ?", owner).Select("coalesce(sum(case when pending > size then pending else size end), 0)").Row()
+	if err = row.Scan(&used); err != nil {
+		log.Println("DB: query volume usage failed", err)
+		return
+	}
+	return
+}
+
+// validateExtend checks that a volume can grow to size, used is the total volume size of the owner and limit its quota, 0 means unlimited
+func validateExtend(volume *model.Volume, size, used, limit int32) (err error) {
+	if volume.Status != "available" && volume.Status != "attached" {
+		err = fmt.Errorf("Volume is %s, extend is not allowed", volume.Status)
+		return
+	}
+	if size <= volume.Size {
+		err = fmt.Errorf("New size must be larger than %dG", volume.Size)
+		return
+	}
+	if limit > 0 && used-volume.Size+size > limit {
+		err = fmt.Errorf("Volume quota exceeded, %dG of %dG is in use", used, limit)
+		return
+	}
+	return
+}
+
+// Extend grows a volume, attached volumes are resized through the hypervisor so that the guest sees the new capacity, the size is only updated when the backend confirms
+func (a *VolumeAdmin) Extend(ctx context.Context, id int64, size int32) (volume *model.Volume, err error) {
+	db := DB()
+	volume = &model.Volume{Model: model.Model{ID: id}}
+	if err = db.Preload("Instance").Take(volume).Error; err != nil {
 		log.Println("DB: query volume failed", err)
 		return
 	}
+	var control string
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/extend_volume.sh '%d' '%s' '%d'", volume.ID, volume.Path, size)
+	if volume.Status != "attached" {
+		if volume.Secret != "" {
+			err = fmt.Errorf("Encrypted volume can only be extended while attached")
+			return
+		}
+		control, err = volumeControl(volume)
+		if err != nil {
+			return
+		}
+	} else {
+		if volume.MultiAttach {
+			err = fmt.Errorf("Multi-attach volume can only be extended while detached")
+			return
+		}
+		if volume.Instance == nil || volume.Target == "" {
+			err = fmt.Errorf("Volume is not attached properly")
+			return
+		}
+		control = fmt.Sprintf("inter=%d", volume.Instance.Hyper)
+		command = fmt.Sprintf("%s '%d' '%s'", command, volume.Instance.ID, volume.Target)
+	}
+	status := volume.Status
+	if err = a.claimExtend(db, volume, size); err != nil {
+		return
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Extend volume execution failed", err)
+		if rerr := db.Model(volume).Where("status = ?", "extending").Updates(map[string]interface{}{"status": status, "pending": 0}).Error; rerr != nil {
+			log.Println("DB: restore volume status failed", rerr)
+		}
+		volume.Status = status
+		return
+	}
+	return
+}
+
+// claimExtend checks the quota and marks the volume as extending to size, pending sizes of other extends are counted as used
+func (a *VolumeAdmin) claimExtend(db *gorm.DB, volume *model.Volume, size int32) (err error) {
+	extendLocker.Lock()
+	defer extendLocker.Unlock()
+	used, limit, err := volumeUsage(db, volume.Owner)
+	if err != nil {
+		return
+	}
+	err = validateExtend(volume, size, used, limit)
+	if err != nil {
+		return
+	}
+	result := db.Model(volume).Where("status = ?", volume.Status).Updates(map[string]interface{}{"status": "extending", "pending": size})
+	if err = result.Error; err != nil {
+		log.Println("DB: update volume failed", err)
+		return
+	}
+	if result.RowsAffected == 0 {
+		err = fmt.Errorf("Volume is busy, extend is not allowed")
+		return
+	}
+	volume.Status = "extending"
+	volume.Pending = size
 	return
 }
 
@@ -108,12 +412,36 @@ func (a *VolumeAdmin) Delete(ctx context.Context, id int64) (err error) {
 		log.Println("DB: query volume failed", err)
 		return
 	}
+	if volume.Status == "awaiting-transfer" {
+		err = fmt.Errorf("Volume has a pending transfer")
+		return
+	}
+	count := 0
+	if err = db.Model(&model.VolumeSnapshot{}).Where("volume_id = ?", volume.ID).Count(&count).Error; err != nil {
+		log.Println("DB: query snapshots failed", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Volume has snapshots")
+		return
+	}
 	if err = db.Model(volume).Delete(volume).Error; err != nil {
 		log.Println("DB: update volume failed", err)
 		return
 	}
-	control := fmt.Sprintf("inter=")
-	command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_volume.sh '%d' '%d'", volume.ID, volume.Path)
+	if err = db.Where("volume_id = ?", volume.ID).Delete(&model.VolumeAttachment{}).Error; err != nil {
+		log.Println("DB: delete volume attachments failed", err)
+		return
+	}
+	if volume.TypeID > 0 && volume.Hyper < 0 {
+		// creation never reached a backend, nothing to clear
+		return
+	}
+	control, err := volumeControl(volume)
+	if err != nil {
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_volume.sh '%d' '%s'", volume.ID, volume.Path)
 	err = hyperExecute(ctx, control, command)
 	if err != nil {
 		log.Println("Delete volume execution failed", err)
@@ -146,7 +474,7 @@ func (a *VolumeAdmin) List(ctx context.Context, offset, limit int64, order, quer
 		return
 	}
 	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
-	if err = db.Preload("Instance").Where(where).Where(query).Find(&volumes).Error; err != nil {
+	if err = db.Preload("Instance").Preload("Attachments", "status = 'attached'").Preload("Attachments.Instance").Where(where).Where(query).Find(&volumes).Error; err != nil {
 		return
 	}
 	permit := memberShip.CheckPermission(model.Admin)
@@ -254,6 +582,13 @@ func (v *VolumeView) New(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
+	_, volTypes, err := volTypeAdmin.List(0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["VolumeTypes"] = volTypes
 	c.HTML(200, "volumes_new")
 }
 
@@ -275,7 +610,7 @@ func (v *VolumeView) Edit(c *macaron.Context, store session.Store) {
 		return
 	}
 	volume := &model.Volume{Model: model.Model{ID: int64(volID)}}
-	if err := db.Preload("Instance").Take(volume).Error; err != nil {
+	if err := db.Preload("Instance").Preload("Attachments", "status = 'attached'").Preload("Attachments.Instance").Take(volume).Error; err != nil {
 		c.Data["ErrorMsg"] = err.Error()
 		c.HTML(500, err.Error())
 		return
@@ -343,6 +678,74 @@ func (v *VolumeView) Patch(c *macaron.Context, store session.Store) {
 	return
 }
 
+func (v *VolumeView) Detach(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	volID := c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volumes", volID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../../volumes"
+	instID := c.QueryInt64("instance")
+	volume, err := volumeAdmin.Detach(c.Req.Context(), volID, instID)
+	if err != nil {
+		log.Println("Detach volume failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VolumeView) Extend(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	volID := c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volumes", volID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../../volumes"
+	size := c.QueryTrim("size")
+	vsize, err := strconv.Atoi(size)
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	volume, err := volumeAdmin.Extend(c.Req.Context(), volID, int32(vsize))
+	if err != nil {
+		log.Println("Extend volume failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
 func (v *VolumeView) Create(c *macaron.Context, store session.Store) {
 	memberShip := GetMemberShip(c.Req.Context())
 	permit := memberShip.CheckPermission(model.Writer)
@@ -361,7 +764,9 @@ func (v *VolumeView) Create(c *macaron.Context, store session.Store) {
 		c.HTML(http.StatusBadRequest, "error")
 		return
 	}
-	volume, err := volumeAdmin.Create(c.Req.Context(), name, vsize)
+	typeID := c.QueryInt64("type")
+	multiAttach := c.QueryTrim("multiattach") == "yes" || c.QueryTrim("multiattach") == "on"
+	volume, err := volumeAdmin.Create(c.Req.Context(), name, vsize, typeID, multiAttach)
 	if err != nil {
 		log.Println("Create volume failed", err)
 		if c.Req.Header.Get("X-Json-Format") == "yes" {
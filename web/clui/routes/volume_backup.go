@@ -0,0 +1,597 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	"github.com/spf13/viper"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	backupAdmin = &VolumeBackupAdmin{}
+	backupView  = &VolumeBackupView{}
+)
+
+type VolumeBackupAdmin struct{}
+type VolumeBackupView struct{}
+
+type BackupStore struct {
+	Endpoint  string `json:"endpoint"`
+	Bucket    string `json:"bucket,omitempty"`
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+}
+
+func backupStoreJson() (jsonData []byte, err error) {
+	store := &BackupStore{
+		Endpoint:  viper.GetString("backup.endpoint"),
+		Bucket:    viper.GetString("backup.bucket"),
+		AccessKey: viper.GetString("backup.access_key"),
+		SecretKey: viper.GetString("backup.secret_key"),
+	}
+	if store.Endpoint == "" {
+		err = fmt.Errorf("Backup store is not configured")
+		return
+	}
+	jsonData, err = json.Marshal(store)
+	if err != nil {
+		log.Println("Failed to marshal backup store json data", err)
+		return
+	}
+	return
+}
+
+// expiredChains returns the chains of a volume's backups to be removed by a retention policy, chains with backups in progress are always kept
+func expiredChains(backups []*model.VolumeBackup, maxChains, maxDays int32, now time.Time) (chainIDs []int64) {
+	latest := map[int64]time.Time{}
+	busy := map[int64]bool{}
+	for _, backup := range backups {
+		if backup.CreatedAt.After(latest[backup.ChainID]) {
+			latest[backup.ChainID] = backup.CreatedAt
+		}
+		if backup.Status == "pending" {
+			busy[backup.ChainID] = true
+		}
+	}
+	chains := []int64{}
+	for chainID := range latest {
+		chains = append(chains, chainID)
+	}
+	sort.Slice(chains, func(i, j int) bool { return latest[chains[i]].After(latest[chains[j]]) })
+	for i, chainID := range chains {
+		if busy[chainID] {
+			continue
+		}
+		if (maxChains > 0 && int32(i) >= maxChains) || (maxDays > 0 && now.Sub(latest[chainID]) > time.Duration(maxDays)*24*time.Hour) {
+			chainIDs = append(chainIDs, chainID)
+		}
+	}
+	return
+}
+
+// Create backs up a volume to the object store, incremental backups only upload what changed since the latest backup of the volume
+func (a *VolumeBackupAdmin) Create(ctx context.Context, volumeID int64, name string, incremental bool) (backup *model.VolumeBackup, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	storeJson, err := backupStoreJson()
+	if err != nil {
+		return
+	}
+	volume := &model.Volume{Model: model.Model{ID: volumeID}}
+	if err = db.Preload("Instance").Take(volume).Error; err != nil {
+		log.Println("DB failed to query volume", err)
+		return
+	}
+	if volume.Status != "available" && volume.Status != "attached" {
+		err = fmt.Errorf("Volume is %s, backup is not allowed", volume.Status)
+		return
+	}
+	if volume.MultiAttach && volume.Status == "attached" {
+		err = fmt.Errorf("Backup of attached multi-attach volume is not supported")
+		return
+	}
+	if volume.Secret != "" {
+		err = fmt.Errorf("Backup of encrypted volume is not supported")
+		return
+	}
+	control, err := volumeControl(volume)
+	if err != nil {
+		return
+	}
+	attached := ""
+	if volume.Status == "attached" && volume.Instance != nil {
+		if volume.Target == "" {
+			err = fmt.Errorf("Target of attached volume is unknown")
+			return
+		}
+		control = fmt.Sprintf("inter=%d", volume.Instance.Hyper)
+		attached = fmt.Sprintf("%d", volume.Instance.ID)
+	}
+	backup = &model.VolumeBackup{
+		Model:    model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:     name,
+		Status:   "pending",
+		Size:     volume.Size,
+		VolumeID: volume.ID,
+	}
+	if incremental {
+		parent := &model.VolumeBackup{}
+		err = db.Where("volume_id = ? and owner = ? and status = 'available'", volume.ID, backup.Owner).Order("created_at desc").Take(parent).Error
+		if err == nil && parent.Size == volume.Size {
+			backup.Incremental = true
+			backup.ParentID = parent.ID
+			backup.ChainID = parent.ChainID
+		}
+		err = nil
+	}
+	if err = db.Create(backup).Error; err != nil {
+		log.Println("DB failed to create backup", err)
+		return
+	}
+	if backup.ChainID == 0 {
+		backup.ChainID = backup.ID
+		if err = db.Model(backup).Update("chain_id", backup.ChainID).Error; err != nil {
+			log.Println("DB failed to update backup", err)
+			return
+		}
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/backup_volume.sh '%d' '%s' '%d' '%s' '%s' <<EOF\n%s\nEOF", backup.ID, volume.Path, backup.ParentID, attached, volume.Target, storeJson)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Backup volume execution failed", err)
+		return
+	}
+	if err = a.prune(ctx, volume.ID, volume.Owner); err != nil {
+		log.Println("Failed to apply backup retention", err)
+		err = nil
+	}
+	return
+}
+
+// prune removes the backup chains of a volume exceeding the retention of its organization
+func (a *VolumeBackupAdmin) prune(ctx context.Context, volumeID, owner int64) (err error) {
+	db := DB()
+	retention := &model.BackupRetention{}
+	if err = db.Where("owner = ?", owner).Take(retention).Error; err != nil {
+		err = nil
+		return
+	}
+	backups := []*model.VolumeBackup{}
+	if err = db.Where("volume_id = ?", volumeID).Find(&backups).Error; err != nil {
+		log.Println("DB failed to query backups", err)
+		return
+	}
+	for _, chainID := range expiredChains(backups, retention.MaxChains, retention.MaxDays, time.Now()) {
+		err = a.deleteChain(ctx, chainID)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// backupPruneInterval is how often the retention of every organization is enforced
+const backupPruneInterval = time.Hour
+
+// PruneExpired enforces the retention of every organization on all its volumes,
+// so chains past MaxDays are removed even when their volume gets no new backup
+func (a *VolumeBackupAdmin) PruneExpired(ctx context.Context) (err error) {
+	db := DB()
+	retentions := []*model.BackupRetention{}
+	if err = db.Where("max_days > 0").Find(&retentions).Error; err != nil {
+		log.Println("DB failed to query backup retentions", err)
+		return
+	}
+	for _, retention := range retentions {
+		volumeIDs := []int64{}
+		if err = db.Model(&model.VolumeBackup{}).Where("owner = ?", retention.Owner).Pluck("distinct volume_id", &volumeIDs).Error; err != nil {
+			log.Println("DB failed to query backup volumes", err)
+			return
+		}
+		for _, volumeID := range volumeIDs {
+			if err = a.prune(ctx, volumeID, retention.Owner); err != nil {
+				log.Println("Failed to apply backup retention", volumeID, err)
+			}
+		}
+	}
+	err = nil
+	return
+}
+
+// pruneBackups runs the retention of backups in the background for the life of the server
+func pruneBackups() {
+	for range time.Tick(backupPruneInterval) {
+		backupAdmin.PruneExpired(context.Background())
+	}
+}
+
+func (a *VolumeBackupAdmin) deleteChain(ctx context.Context, chainID int64) (err error) {
+	backups := []*model.VolumeBackup{}
+	if err = DB().Where("chain_id = ?", chainID).Order("id desc").Find(&backups).Error; err != nil {
+		log.Println("DB failed to query backups", err)
+		return
+	}
+	for _, backup := range backups {
+		err = a.delete(ctx, backup)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (a *VolumeBackupAdmin) delete(ctx context.Context, backup *model.VolumeBackup) (err error) {
+	db := DB()
+	storeJson, err := backupStoreJson()
+	if err != nil {
+		return
+	}
+	count := 0
+	if err = db.Model(&model.VolumeBackup{}).Where("parent_id = ? and status <> 'error'", backup.ID).Count(&count).Error; err != nil {
+		log.Println("DB failed to count backups", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Backup has incremental backups depending on it")
+		return
+	}
+	control := "inter="
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/delete_volume_backup.sh '%d' <<EOF\n%s\nEOF", backup.ID, storeJson)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Delete backup execution failed", err)
+		return
+	}
+	if err = db.Delete(backup).Error; err != nil {
+		log.Println("DB failed to delete backup", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeBackupAdmin) Delete(ctx context.Context, id int64) (err error) {
+	backup := &model.VolumeBackup{Model: model.Model{ID: id}}
+	if err = DB().Take(backup).Error; err != nil {
+		log.Println("DB failed to query backup", err)
+		return
+	}
+	if backup.Status == "pending" {
+		err = fmt.Errorf("Backup is still in progress")
+		return
+	}
+	return a.delete(ctx, backup)
+}
+
+// Restore writes a backup into a detached volume, or into a new volume when volumeID is 0
+func (a *VolumeBackupAdmin) Restore(ctx context.Context, id, volumeID int64, name string) (volume *model.Volume, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	storeJson, err := backupStoreJson()
+	if err != nil {
+		return
+	}
+	backup := &model.VolumeBackup{Model: model.Model{ID: id}}
+	if err = db.Take(backup).Error; err != nil {
+		log.Println("DB failed to query backup", err)
+		return
+	}
+	if backup.Status != "available" {
+		err = fmt.Errorf("Backup is not available")
+		return
+	}
+	control := "inter="
+	command := ""
+	if volumeID == 0 {
+		if name == "" {
+			name = fmt.Sprintf("restore-%s", backup.Name)
+		}
+		volume = &model.Volume{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}, Name: name, Format: "qcow2", Size: backup.Size, Status: "pending"}
+		if err = db.Create(volume).Error; err != nil {
+			log.Println("DB failed to create volume", err)
+			return
+		}
+		command = fmt.Sprintf("/opt/cloudland/scripts/backend/restore_volume_backup.sh '%d' '%d' <<EOF\n%s\nEOF", backup.ID, volume.ID, storeJson)
+	} else {
+		volume = &model.Volume{Model: model.Model{ID: volumeID}}
+		if err = db.Take(volume).Error; err != nil {
+			log.Println("DB failed to query volume", err)
+			return
+		}
+		if volume.Status != "available" || volume.InstanceID > 0 {
+			err = fmt.Errorf("Please detach volume before restoring it")
+			return
+		}
+		if volume.Secret != "" {
+			err = fmt.Errorf("Restore into encrypted volume is not supported")
+			return
+		}
+		if volume.Size < backup.Size {
+			err = fmt.Errorf("Volume is smaller than the backup")
+			return
+		}
+		control, err = volumeControl(volume)
+		if err != nil {
+			return
+		}
+		volume.Status = "restoring"
+		if err = db.Model(volume).Update("status", volume.Status).Error; err != nil {
+			log.Println("DB failed to update volume", err)
+			return
+		}
+		command = fmt.Sprintf("/opt/cloudland/scripts/backend/restore_volume_backup.sh '%d' '%d' '%s' <<EOF\n%s\nEOF", backup.ID, volume.ID, volume.Path, storeJson)
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Restore backup execution failed", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeBackupAdmin) GetRetention(ctx context.Context) (retention *model.BackupRetention, err error) {
+	memberShip := GetMemberShip(ctx)
+	retention = &model.BackupRetention{}
+	err = DB().Where("owner = ?", memberShip.OrgID).Take(retention).Error
+	if err != nil {
+		retention = &model.BackupRetention{}
+		err = nil
+	}
+	return
+}
+
+func (a *VolumeBackupAdmin) SetRetention(ctx context.Context, maxChains, maxDays int32) (retention *model.BackupRetention, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if maxChains < 0 || maxDays < 0 {
+		err = fmt.Errorf("Retention can not be negative")
+		return
+	}
+	retention = &model.BackupRetention{Model: model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID}}
+	if err = db.Where("owner = ?", memberShip.OrgID).FirstOrCreate(retention).Error; err != nil {
+		log.Println("DB failed to query backup retention", err)
+		return
+	}
+	retention.MaxChains = maxChains
+	retention.MaxDays = maxDays
+	if err = db.Save(retention).Error; err != nil {
+		log.Println("DB failed to save backup retention", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeBackupAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, backups []*model.VolumeBackup, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	backups = []*model.VolumeBackup{}
+	if err = db.Model(&model.VolumeBackup{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count backup(s)", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Volume").Where(where).Where(query).Find(&backups).Error; err != nil {
+		log.Println("DB failed to query backup(s)", err)
+		return
+	}
+
+	return
+}
+
+func (v *VolumeBackupView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, backups, err := backupAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	retention, err := backupAdmin.GetRetention(c.Req.Context())
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"backups":   backups,
+			"retention": retention,
+			"total":     total,
+			"pages":     pages,
+			"query":     query,
+		})
+		return
+	}
+	_, volumes, err := volumeAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Backups"] = backups
+	c.Data["Volumes"] = volumes
+	c.Data["Retention"] = retention
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	c.HTML(200, "volumebackups")
+}
+
+func (v *VolumeBackupView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	volumeID := c.QueryInt64("volume")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volumes", volumeID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../volumebackups"
+	name := c.QueryTrim("name")
+	incremental := c.QueryTrim("incremental") == "yes" || c.QueryTrim("incremental") == "on"
+	backup, err := backupAdmin.Create(c.Req.Context(), volumeID, name, incremental)
+	if err != nil {
+		log.Println("Create backup failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, backup)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VolumeBackupView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "volume_backups", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = backupAdmin.Delete(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to delete backup", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "volumebackups",
+	})
+	return
+}
+
+func (v *VolumeBackupView) Restore(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volume_backups", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	volumeID := c.QueryInt64("volume")
+	if volumeID > 0 {
+		permit, _ = memberShip.CheckOwner(model.Writer, "volumes", volumeID)
+	} else {
+		permit = memberShip.CheckPermission(model.Writer)
+	}
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../../volumes"
+	name := c.QueryTrim("name")
+	volume, err := backupAdmin.Restore(c.Req.Context(), id, volumeID, name)
+	if err != nil {
+		log.Println("Restore backup failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VolumeBackupView) Retention(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../volumebackups"
+	maxChains := int32(c.QueryInt("max_chains"))
+	maxDays := int32(c.QueryInt("max_days"))
+	retention, err := backupAdmin.SetRetention(c.Req.Context(), maxChains, maxDays)
+	if err != nil {
+		log.Println("Set backup retention failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, retention)
+		return
+	}
+	c.Redirect(redirectTo)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestExpiredChains(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	backup := func(id, chainID int64, age time.Duration, status string) *model.VolumeBackup {
+		b := &model.VolumeBackup{Model: model.Model{ID: id}, ChainID: chainID, Status: status}
+		b.CreatedAt = now.Add(-age)
+		return b
+	}
+	backups := []*model.VolumeBackup{
+		backup(1, 1, 30*day, "available"),
+		backup(2, 1, 29*day, "available"),
+		backup(3, 3, 20*day, "available"),
+		backup(4, 3, 10*day, "available"),
+		backup(5, 5, 2*day, "available"),
+		backup(6, 5, day, "pending"),
+		backup(7, 7, 40*day, "pending"),
+	}
+	cases := []struct {
+		maxChains int32
+		maxDays   int32
+		expired   []int64
+	}{
+		{0, 0, nil},
+		{1, 0, []int64{1, 3}},
+		{2, 0, []int64{1}},
+		{0, 15, []int64{1}},
+		{0, 5, []int64{1, 3}},
+		{3, 25, []int64{1}},
+	}
+	for _, tc := range cases {
+		expired := expiredChains(backups, tc.maxChains, tc.maxDays, now)
+		sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+		if !reflect.DeepEqual(expired, tc.expired) {
+			t.Errorf("retention %d chains %d days expired %v, expected %v", tc.maxChains, tc.maxDays, expired, tc.expired)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	volSnapshotAdmin = &VolumeSnapshotAdmin{}
+	volSnapshotView  = &VolumeSnapshotView{}
+)
+
+type VolumeSnapshotAdmin struct{}
+type VolumeSnapshotView struct{}
+
+// getSnapshot returns a snapshot together with its volume, the snapshot must belong to the volume
+func (a *VolumeSnapshotAdmin) getSnapshot(volumeID, snapID int64) (snapshot *model.VolumeSnapshot, err error) {
+	snapshot = &model.VolumeSnapshot{Model: model.Model{ID: snapID}}
+	if err = DB().Preload("Volume").Preload("Volume.Instance").Take(snapshot).Error; err != nil {
+		log.Println("DB failed to query snapshot", err)
+		return
+	}
+	if snapshot.VolumeID != volumeID || snapshot.Volume == nil {
+		err = fmt.Errorf("Snapshot does not belong to this volume")
+		return
+	}
+	return
+}
+
+// Create copies the volume into a new snapshot, attached volumes are frozen through the guest agent when quiesce is set or paused otherwise
+func (a *VolumeSnapshotAdmin) Create(ctx context.Context, volumeID int64, name string, quiesce bool) (snapshot *model.VolumeSnapshot, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	volume := &model.Volume{Model: model.Model{ID: volumeID}}
+	if err = db.Preload("Instance").Take(volume).Error; err != nil {
+		log.Println("DB failed to query volume", err)
+		return
+	}
+	if volume.Status != "available" && volume.Status != "attached" {
+		err = fmt.Errorf("Volume is %s, snapshot is not allowed", volume.Status)
+		return
+	}
+	if volume.MultiAttach && volume.Status == "attached" {
+		err = fmt.Errorf("Snapshot of attached multi-attach volume is not supported")
+		return
+	}
+	if volume.Secret != "" {
+		err = fmt.Errorf("Snapshot of encrypted volume is not supported")
+		return
+	}
+	snapshot = &model.VolumeSnapshot{
+		Model:    model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:     name,
+		Size:     volume.Size,
+		Status:   "pending",
+		VolumeID: volume.ID,
+	}
+	control, err := volumeControl(volume)
+	if err != nil {
+		return
+	}
+	attached := ""
+	if volume.Status == "attached" && volume.Instance != nil {
+		control = fmt.Sprintf("inter=%d", volume.Instance.Hyper)
+		attached = fmt.Sprintf("%d", volume.Instance.ID)
+		snapshot.Quiesced = quiesce
+	}
+	if err = db.Create(snapshot).Error; err != nil {
+		log.Println("DB failed to create snapshot", err)
+		return
+	}
+	quiesceArg := "no"
+	if snapshot.Quiesced {
+		quiesceArg = "yes"
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_volume_snapshot.sh '%d' '%s' '%s' '%s'", snapshot.ID, volume.Path, attached, quiesceArg)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create snapshot execution failed", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeSnapshotAdmin) Delete(ctx context.Context, volumeID, snapID int64) (err error) {
+	db := DB()
+	snapshot, err := a.getSnapshot(volumeID, snapID)
+	if err != nil {
+		return
+	}
+	if snapshot.Status == "pending" {
+		err = fmt.Errorf("Snapshot is still being created")
+		return
+	}
+	control, err := volumeControl(snapshot.Volume)
+	if err != nil {
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/delete_volume_snapshot.sh '%d' '%s'", snapshot.ID, snapshot.Path)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Delete snapshot execution failed", err)
+		return
+	}
+	if err = db.Delete(snapshot).Error; err != nil {
+		log.Println("DB failed to delete snapshot", err)
+		return
+	}
+	return
+}
+
+// Revert overwrites a detached volume with the content of one of its snapshots
+func (a *VolumeSnapshotAdmin) Revert(ctx context.Context, volumeID, snapID int64) (volume *model.Volume, err error) {
+	db := DB()
+	snapshot, err := a.getSnapshot(volumeID, snapID)
+	if err != nil {
+		return
+	}
+	volume = snapshot.Volume
+	if snapshot.Status != "available" {
+		err = fmt.Errorf("Snapshot is not available")
+		return
+	}
+	if volume.Status != "available" || volume.InstanceID > 0 {
+		err = fmt.Errorf("Please detach volume before reverting it")
+		return
+	}
+	control, err := volumeControl(volume)
+	if err != nil {
+		return
+	}
+	volume.Status = "reverting"
+	if err = db.Model(volume).Update("status", volume.Status).Error; err != nil {
+		log.Println("DB failed to update volume", err)
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/revert_volume_snapshot.sh '%d' '%s' '%d' '%s'", volume.ID, volume.Path, snapshot.ID, snapshot.Path)
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Revert snapshot execution failed", err)
+		return
+	}
+	return
+}
+
+// CreateVolume creates a new volume with the content of a snapshot
+func (a *VolumeSnapshotAdmin) CreateVolume(ctx context.Context, volumeID, snapID int64, name string) (volume *model.Volume, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	snapshot, err := a.getSnapshot(volumeID, snapID)
+	if err != nil {
+		return
+	}
+	if snapshot.Status != "available" {
+		err = fmt.Errorf("Snapshot is not available")
+		return
+	}
+	control, err := volumeControl(snapshot.Volume)
+	if err != nil {
+		return
+	}
+	if name == "" {
+		name = fmt.Sprintf("%s-%s", snapshot.Volume.Name, snapshot.Name)
+	}
+	// the snapshot keeps the format and the luks secret of its volume, so the new volume is created
+	// with the same type next to it on the same hypervisor
+	source := snapshot.Volume
+	volume = &model.Volume{
+		Model:  model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:   name,
+		Format: source.Format,
+		Size:   snapshot.Size,
+		Status: "pending",
+		TypeID: source.TypeID,
+		Hyper:  source.Hyper,
+		Secret: source.Secret,
+	}
+	if source.TypeID > 0 {
+		volume.Type = &model.VolumeType{Model: model.Model{ID: source.TypeID}}
+		if err = db.Preload("Glusterfs").Take(volume.Type).Error; err != nil {
+			log.Println("DB failed to query volume type", err)
+			return
+		}
+	}
+	if err = db.Create(volume).Error; err != nil {
+		log.Println("DB failed to create volume", err)
+		return
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_volume_from_snapshot.sh '%d' '%s' '%d'", volume.ID, snapshot.Path, volume.Size)
+	if volume.TypeID > 0 {
+		var jsonData []byte
+		jsonData, err = volumeBackendJson(volume)
+		if err != nil {
+			return
+		}
+		command = fmt.Sprintf("%s 'yes' <<EOF\n%s\nEOF", command, jsonData)
+	}
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create volume from snapshot execution failed", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeSnapshotAdmin) List(ctx context.Context, volumeID int64) (snapshots []*model.VolumeSnapshot, err error) {
+	snapshots = []*model.VolumeSnapshot{}
+	if err = DB().Where("volume_id = ?", volumeID).Order("created_at desc").Find(&snapshots).Error; err != nil {
+		log.Println("DB failed to query snapshots", err)
+		return
+	}
+	return
+}
+
+func (v *VolumeSnapshotView) checkVolume(c *macaron.Context) (volumeID int64, ok bool) {
+	memberShip := GetMemberShip(c.Req.Context())
+	volumeID = c.ParamsInt64("id")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volumes", volumeID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	ok = true
+	return
+}
+
+func (v *VolumeSnapshotView) List(c *macaron.Context, store session.Store) {
+	volumeID, ok := v.checkVolume(c)
+	if !ok {
+		return
+	}
+	volume := &model.Volume{Model: model.Model{ID: volumeID}}
+	if err := DB().Preload("Instance").Take(volume).Error; err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	snapshots, err := volSnapshotAdmin.List(c.Req.Context(), volumeID)
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"snapshots": snapshots,
+		})
+		return
+	}
+	c.Data["Volume"] = volume
+	c.Data["Snapshots"] = snapshots
+	c.HTML(200, "volumes_snapshots")
+}
+
+func (v *VolumeSnapshotView) Create(c *macaron.Context, store session.Store) {
+	volumeID, ok := v.checkVolume(c)
+	if !ok {
+		return
+	}
+	redirectTo := fmt.Sprintf("/volumes/%d/snapshots", volumeID)
+	name := c.QueryTrim("name")
+	quiesce := c.QueryTrim("quiesce") == "yes" || c.QueryTrim("quiesce") == "on"
+	snapshot, err := volSnapshotAdmin.Create(c.Req.Context(), volumeID, name, quiesce)
+	if err != nil {
+		log.Println("Create snapshot failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, snapshot)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VolumeSnapshotView) Delete(c *macaron.Context, store session.Store) {
+	volumeID, ok := v.checkVolume(c)
+	if !ok {
+		return
+	}
+	err := volSnapshotAdmin.Delete(c.Req.Context(), volumeID, c.ParamsInt64("snapid"))
+	if err != nil {
+		log.Println("Delete snapshot failed", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": fmt.Sprintf("/volumes/%d/snapshots", volumeID),
+	})
+}
+
+func (v *VolumeSnapshotView) Revert(c *macaron.Context, store session.Store) {
+	volumeID, ok := v.checkVolume(c)
+	if !ok {
+		return
+	}
+	redirectTo := fmt.Sprintf("/volumes/%d/snapshots", volumeID)
+	volume, err := volSnapshotAdmin.Revert(c.Req.Context(), volumeID, c.ParamsInt64("snapid"))
+	if err != nil {
+		log.Println("Revert snapshot failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VolumeSnapshotView) CreateVolume(c *macaron.Context, store session.Store) {
+	volumeID, ok := v.checkVolume(c)
+	if !ok {
+		return
+	}
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "/volumes"
+	name := c.QueryTrim("name")
+	volume, err := volSnapshotAdmin.CreateVolume(c.Req.Context(), volumeID, c.ParamsInt64("snapid"), name)
+	if err != nil {
+		log.Println("Create volume from snapshot failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
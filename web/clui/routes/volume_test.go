@@ -0,0 +1,42 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestValidateExtend(t *testing.T) {
+	cases := []struct {
+		status string
+		size   int32
+		used   int32
+		limit  int32
+		ok     bool
+	}{
+		{"available", 20, 10, 100, true},
+		{"attached", 20, 10, 0, true},
+		{"available", 10, 10, 100, false},
+		{"available", 5, 10, 100, false},
+		{"pending", 20, 10, 100, false},
+		{"extending", 20, 10, 100, false},
+		{"available", 100, 50, 100, false},
+		{"available", 60, 50, 100, true},
+	}
+	for _, tc := range cases {
+		volume := &model.Volume{Status: tc.status, Size: 10}
+		err := validateExtend(volume, tc.size, tc.used, tc.limit)
+		if tc.ok && err != nil {
+			t.Errorf("extend %v unexpectedly rejected: %v", tc, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("extend %v unexpectedly accepted", tc)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	transferAdmin = &VolumeTransferAdmin{}
+	transferView  = &VolumeTransferView{}
+)
+
+type VolumeTransferAdmin struct{}
+type VolumeTransferView struct{}
+
+func randomHex(n int) (str string, err error) {
+	buf := make([]byte, n)
+	if _, err = rand.Read(buf); err != nil {
+		log.Println("Failed to generate random bytes", err)
+		return
+	}
+	str = hex.EncodeToString(buf)
+	return
+}
+
+func hashTransferKey(salt, authKey string) string {
+	sum := sha256.Sum256([]byte(salt + authKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkTransferKey verifies an auth key against a pending transfer, the key is only good once since accepting clears the hash
+func checkTransferKey(transfer *model.VolumeTransfer, authKey string) (err error) {
+	if transfer.Status != "pending" || transfer.KeyHash == "" {
+		err = fmt.Errorf("Transfer is %s", transfer.Status)
+		return
+	}
+	if authKey == "" || subtle.ConstantTimeCompare([]byte(hashTransferKey(transfer.Salt, authKey)), []byte(transfer.KeyHash)) != 1 {
+		err = fmt.Errorf("Invalid auth key")
+		return
+	}
+	return
+}
+
+// Create offers a detached volume to another organization, the auth key is returned only here and must be handed to the receiver
+func (a *VolumeTransferAdmin) Create(ctx context.Context, volumeID int64, name string) (transfer *model.VolumeTransfer, authKey string, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	volume := &model.Volume{Model: model.Model{ID: volumeID}}
+	if err = db.Take(volume).Error; err != nil {
+		log.Println("DB failed to query volume", err)
+		return
+	}
+	if volume.Status != "available" || volume.InstanceID > 0 {
+		err = fmt.Errorf("Volume is %s, only detached volumes can be transferred", volume.Status)
+		return
+	}
+	query := db.Model(&model.Volume{}).Where("id = ? and status = 'available'", volume.ID).Update("status", "awaiting-transfer")
+	if err = query.Error; err != nil {
+		log.Println("DB failed to update volume", err)
+		return
+	}
+	if query.RowsAffected != 1 {
+		err = fmt.Errorf("Volume status changed, please retry")
+		return
+	}
+	authKey, err = randomHex(16)
+	if err != nil {
+		return
+	}
+	salt, err := randomHex(8)
+	if err != nil {
+		return
+	}
+	if name == "" {
+		name = volume.Name
+	}
+	transfer = &model.VolumeTransfer{
+		Model:    model.Model{Creater: memberShip.UserID, Owner: volume.Owner},
+		Name:     name,
+		Status:   "pending",
+		Salt:     salt,
+		KeyHash:  hashTransferKey(salt, authKey),
+		VolumeID: volume.ID,
+	}
+	if err = db.Create(transfer).Error; err != nil {
+		log.Println("DB failed to create volume transfer", err)
+		return
+	}
+	return
+}
+
+// Cancel withdraws a pending transfer and gives the volume back to its owner
+func (a *VolumeTransferAdmin) Cancel(ctx context.Context, id int64) (err error) {
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	transfer := &model.VolumeTransfer{Model: model.Model{ID: id}}
+	if err = db.Take(transfer).Error; err != nil {
+		log.Println("DB failed to query volume transfer", err)
+		return
+	}
+	if transfer.Status == "pending" {
+		if err = db.Model(&model.Volume{}).Where("id = ? and status = 'awaiting-transfer'", transfer.VolumeID).Update("status", "available").Error; err != nil {
+			log.Println("DB failed to update volume", err)
+			return
+		}
+	}
+	if err = db.Delete(transfer).Error; err != nil {
+		log.Println("DB failed to delete volume transfer", err)
+		return
+	}
+	return
+}
+
+// Accept moves the volume of a transfer to the caller's organization, ownership and quota usage switch in one transaction
+func (a *VolumeTransferAdmin) Accept(ctx context.Context, id int64, authKey string) (volume *model.Volume, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	transfer := &model.VolumeTransfer{Model: model.Model{ID: id}}
+	if err = db.Take(transfer).Error; err != nil {
+		log.Println("DB failed to query volume transfer", err)
+		err = fmt.Errorf("Invalid transfer")
+		return
+	}
+	if err = checkTransferKey(transfer, authKey); err != nil {
+		return
+	}
+	if transfer.Owner == memberShip.OrgID {
+		err = fmt.Errorf("Volume already belongs to this organization")
+		return
+	}
+	volume = &model.Volume{Model: model.Model{ID: transfer.VolumeID}}
+	if err = db.Take(volume).Error; err != nil {
+		log.Println("DB failed to query volume", err)
+		return
+	}
+	if volume.Status != "awaiting-transfer" || volume.Owner != transfer.Owner {
+		err = fmt.Errorf("Volume is %s, transfer is not possible", volume.Status)
+		return
+	}
+	used, limit, err := volumeUsage(db, memberShip.OrgID)
+	if err != nil {
+		return
+	}
+	if limit > 0 && used+volume.Size > limit {
+		err = fmt.Errorf("Volume quota exceeded, %dG of %dG is in use", used, limit)
+		return
+	}
+	query := db.Model(&model.Volume{}).Where("id = ? and owner = ? and status = 'awaiting-transfer'", volume.ID, transfer.Owner).Updates(map[string]interface{}{
+		"owner":   memberShip.OrgID,
+		"creater": memberShip.UserID,
+		"status":  "available"})
+	if err = query.Error; err != nil {
+		log.Println("DB failed to update volume", err)
+		return
+	}
+	if query.RowsAffected != 1 {
+		err = fmt.Errorf("Volume status changed, transfer is not possible")
+		return
+	}
+	if err = db.Model(&model.VolumeSnapshot{}).Where("volume_id = ?", volume.ID).Updates(map[string]interface{}{
+		"owner":   memberShip.OrgID,
+		"creater": memberShip.UserID}).Error; err != nil {
+		log.Println("DB failed to update volume snapshots", err)
+		return
+	}
+	if err = db.Model(transfer).Updates(map[string]interface{}{
+		"status":      "accepted",
+		"accepted_by": memberShip.OrgID,
+		"key_hash":    ""}).Error; err != nil {
+		log.Println("DB failed to update volume transfer", err)
+		return
+	}
+	volume.Owner = memberShip.OrgID
+	volume.Creater = memberShip.UserID
+	volume.Status = "available"
+	return
+}
+
+func (a *VolumeTransferAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, transfers []*model.VolumeTransfer, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+
+	where := memberShip.GetWhere()
+	transfers = []*model.VolumeTransfer{}
+	if err = db.Model(&model.VolumeTransfer{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count volume transfer(s)", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Volume").Where(where).Where(query).Find(&transfers).Error; err != nil {
+		log.Println("DB failed to query volume transfer(s)", err)
+		return
+	}
+
+	return
+}
+
+func (v *VolumeTransferView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, transfers, err := transferAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"transfers": transfers,
+			"total":     total,
+			"pages":     pages,
+			"query":     query,
+		})
+		return
+	}
+	_, volumes, err := volumeAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Transfers"] = transfers
+	c.Data["Volumes"] = volumes
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	c.HTML(200, "volumetransfers")
+}
+
+func (v *VolumeTransferView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	volumeID := c.QueryInt64("volume")
+	permit, _ := memberShip.CheckOwner(model.Writer, "volumes", volumeID)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	name := c.QueryTrim("name")
+	transfer, authKey, err := transferAdmin.Create(c.Req.Context(), volumeID, name)
+	if err != nil {
+		log.Println("Create volume transfer failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"transfer": transfer,
+			"auth_key": authKey,
+		})
+		return
+	}
+	c.Data["Transfer"] = transfer
+	c.Data["AuthKey"] = authKey
+	c.HTML(200, "volumetransfers_key")
+}
+
+func (v *VolumeTransferView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "volume_transfers", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = transferAdmin.Cancel(c.Req.Context(), id)
+	if err != nil {
+		log.Println("Failed to cancel volume transfer", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "volumetransfers",
+	})
+	return
+}
+
+func (v *VolumeTransferView) Accept(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../volumes"
+	id := c.QueryInt64("transfer")
+	authKey := c.QueryTrim("auth_key")
+	volume, err := transferAdmin.Accept(c.Req.Context(), id, authKey)
+	if err != nil {
+		log.Println("Accept volume transfer failed", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volume)
+		return
+	}
+	c.Redirect(redirectTo)
+}
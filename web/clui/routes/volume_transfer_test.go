@@ -0,0 +1,35 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestCheckTransferKey(t *testing.T) {
+	salt := "0011223344556677"
+	authKey := "00112233445566778899aabbccddeeff"
+	pending := &model.VolumeTransfer{Status: "pending", Salt: salt, KeyHash: hashTransferKey(salt, authKey)}
+	if err := checkTransferKey(pending, authKey); err != nil {
+		t.Errorf("valid key rejected: %v", err)
+	}
+	for _, key := range []string{"", "00112233445566778899aabbccddeefe", authKey + "00"} {
+		if err := checkTransferKey(pending, key); err == nil {
+			t.Errorf("key %q accepted", key)
+		}
+	}
+	if hashTransferKey("other", authKey) == pending.KeyHash {
+		t.Errorf("salt is not part of the hash")
+	}
+	accepted := &model.VolumeTransfer{Status: "accepted", Salt: salt}
+	if err := checkTransferKey(accepted, authKey); err == nil {
+		t.Errorf("key accepted twice")
+	}
+}
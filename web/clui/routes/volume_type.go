@@ -0,0 +1,349 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	volTypeAdmin = &VolumeTypeAdmin{}
+	volTypeView  = &VolumeTypeView{}
+)
+
+type VolumeTypeAdmin struct{}
+type VolumeTypeView struct{}
+
+type VolumeQos struct {
+	ReadIops   int64 `json:"read_iops_sec,omitempty"`
+	WriteIops  int64 `json:"write_iops_sec,omitempty"`
+	ReadBytes  int64 `json:"read_bytes_sec,omitempty"`
+	WriteBytes int64 `json:"write_bytes_sec,omitempty"`
+}
+
+// volumeBackend holds what the backend scripts need to create and attach a volume of a type
+type volumeBackend struct {
+	Backend   string     `json:"backend"`
+	Source    string     `json:"source,omitempty"`
+	Host      string     `json:"host,omitempty"`
+	Secret    string     `json:"secret,omitempty"`
+	Shareable bool       `json:"shareable,omitempty"`
+	Qos       *VolumeQos `json:"qos,omitempty"`
+}
+
+func validateVolumeType(backend, source string, glusterfsID int64, encrypted bool, qos *VolumeQos) (err error) {
+	switch backend {
+	case "lvm", "nfs":
+		if source == "" {
+			return fmt.Errorf("Backend %s requires a source", backend)
+		}
+		if backend == "nfs" && !strings.Contains(source, ":/") {
+			return fmt.Errorf("NFS source must be like server:/export")
+		}
+	case "glusterfs":
+		if source == "" && glusterfsID > 0 {
+			return fmt.Errorf("Gluster volume name is required when a gluster cluster is given")
+		}
+	default:
+		return fmt.Errorf("Invalid backend %s", backend)
+	}
+	if strings.ContainsAny(source, "' \"") {
+		return fmt.Errorf("Invalid source %s", source)
+	}
+	if encrypted && backend == "glusterfs" && source == "" {
+		return fmt.Errorf("Encryption is not supported on the default gluster volume")
+	}
+	if qos.ReadIops < 0 || qos.WriteIops < 0 || qos.ReadBytes < 0 || qos.WriteBytes < 0 {
+		return fmt.Errorf("Limits can not be negative")
+	}
+	return
+}
+
+// backendHyperGroup returns the select control group of the active hypervisors able to serve a storage backend
+func backendHyperGroup(hypers []*model.Hyper, backend string) (hyperGroup string, err error) {
+	hostIDs := []string{}
+	for _, h := range hypers {
+		if h.Status != 1 {
+			continue
+		}
+		for _, b := range strings.Split(h.Backends, ",") {
+			if strings.TrimSpace(b) == backend {
+				hostIDs = append(hostIDs, fmt.Sprintf("%d", h.Hostid))
+				break
+			}
+		}
+	}
+	if len(hostIDs) == 0 {
+		err = fmt.Errorf("No hypervisor serves storage backend %s", backend)
+		return
+	}
+	hyperGroup = fmt.Sprintf("group-backend-%s:%s", backend, strings.Join(hostIDs, ","))
+	return
+}
+
+// getVolumeBackend returns the backend description of a volume, volumes without a type live on the default gluster volume
+func getVolumeBackend(volume *model.Volume) (backend *volumeBackend, err error) {
+	backend = &volumeBackend{Backend: "glusterfs", Secret: volume.Secret, Shareable: volume.MultiAttach}
+	if volume.TypeID == 0 {
+		return
+	}
+	volType := volume.Type
+	if volType == nil {
+		volType = &model.VolumeType{Model: model.Model{ID: volume.TypeID}}
+		if err = DB().Preload("Glusterfs").Take(volType).Error; err != nil {
+			log.Println("DB failed to query volume type", err)
+			return
+		}
+	}
+	backend.Backend = volType.Backend
+	backend.Source = volType.Source
+	if volType.Glusterfs != nil && volType.Glusterfs.Endpoint != "" {
+		backend.Host = volType.Glusterfs.Endpoint
+		if i := strings.Index(backend.Host, "://"); i >= 0 {
+			backend.Host = backend.Host[i+3:]
+		}
+		backend.Host = strings.Split(strings.Split(backend.Host, "/")[0], ":")[0]
+	}
+	qos := &VolumeQos{ReadIops: volType.ReadIops, WriteIops: volType.WriteIops, ReadBytes: volType.ReadBytes, WriteBytes: volType.WriteBytes}
+	if *qos != (VolumeQos{}) {
+		backend.Qos = qos
+	}
+	return
+}
+
+func volumeBackendJson(volume *model.Volume) (jsonData []byte, err error) {
+	backend, err := getVolumeBackend(volume)
+	if err != nil {
+		return
+	}
+	jsonData, err = json.Marshal(backend)
+	if err != nil {
+		log.Println("Failed to marshal volume backend json data", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeTypeAdmin) Create(ctx context.Context, name, backend, source string, glusterfsID int64, encrypted bool, qos *VolumeQos) (volType *model.VolumeType, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if err = validateVolumeType(backend, source, glusterfsID, encrypted, qos); err != nil {
+		return
+	}
+	if glusterfsID > 0 {
+		if backend != "glusterfs" {
+			err = fmt.Errorf("Gluster cluster is only valid for glusterfs backend")
+			return
+		}
+		if err = db.Take(&model.Glusterfs{Model: model.Model{ID: glusterfsID}}).Error; err != nil {
+			log.Println("DB failed to query glusterfs", err)
+			return
+		}
+	}
+	volType = &model.VolumeType{
+		Model:       model.Model{Creater: memberShip.UserID, Owner: memberShip.OrgID},
+		Name:        name,
+		Backend:     backend,
+		Source:      source,
+		GlusterfsID: glusterfsID,
+		ReadIops:    qos.ReadIops,
+		WriteIops:   qos.WriteIops,
+		ReadBytes:   qos.ReadBytes,
+		WriteBytes:  qos.WriteBytes,
+		Encrypted:   encrypted,
+	}
+	if err = db.Create(volType).Error; err != nil {
+		log.Println("DB failed to create volume type", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeTypeAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	count := 0
+	if err = db.Model(&model.Volume{}).Where("type_id = ?", id).Count(&count).Error; err != nil {
+		log.Println("DB failed to count volumes", err)
+		return
+	}
+	if count > 0 {
+		err = fmt.Errorf("Volume type is still in use")
+		return
+	}
+	if err = db.Delete(&model.VolumeType{Model: model.Model{ID: id}}).Error; err != nil {
+		log.Println("DB failed to delete volume type", err)
+		return
+	}
+	return
+}
+
+func (a *VolumeTypeAdmin) List(offset, limit int64, order, query string) (total int64, volTypes []*model.VolumeType, err error) {
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+
+	volTypes = []*model.VolumeType{}
+	if err = db.Model(&model.VolumeType{}).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count volume type(s)", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Glusterfs").Where(query).Find(&volTypes).Error; err != nil {
+		log.Println("DB failed to query volume type(s)", err)
+		return
+	}
+
+	return
+}
+
+func (v *VolumeTypeView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, volTypes, err := volTypeAdmin.List(offset, limit, order, query)
+	if err != nil {
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["VolumeTypes"] = volTypes
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"volumetypes": volTypes,
+			"total":       total,
+			"pages":       pages,
+			"query":       query,
+		})
+		return
+	}
+	c.HTML(200, "volumetypes")
+}
+
+func (v *VolumeTypeView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = volTypeAdmin.Delete(c.Req.Context(), c.ParamsInt64("id"))
+	if err != nil {
+		log.Println("Failed to delete volume type", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "volumetypes",
+	})
+	return
+}
+
+func (v *VolumeTypeView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	glusterfses := []*model.Glusterfs{}
+	if err := DB().Find(&glusterfses).Error; err != nil {
+		log.Println("DB failed to query glusterfs", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.Data["Glusterfses"] = glusterfses
+	c.HTML(200, "volumetypes_new")
+}
+
+func (v *VolumeTypeView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Admin)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../volumetypes"
+	name := c.QueryTrim("name")
+	backend := c.QueryTrim("backend")
+	source := c.QueryTrim("source")
+	glusterfsID := c.QueryInt64("glusterfs")
+	encrypted := c.QueryTrim("encrypted") == "yes" || c.QueryTrim("encrypted") == "on"
+	qos := &VolumeQos{
+		ReadIops:   c.QueryInt64("read_iops"),
+		WriteIops:  c.QueryInt64("write_iops"),
+		ReadBytes:  c.QueryInt64("read_bytes"),
+		WriteBytes: c.QueryInt64("write_bytes"),
+	}
+	volType, err := volTypeAdmin.Create(c.Req.Context(), name, backend, source, glusterfsID, encrypted, qos)
+	if err != nil {
+		log.Println("Failed to create volume type", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, volType)
+		return
+	}
+	c.Redirect(redirectTo)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestValidateVolumeType(t *testing.T) {
+	qos := &VolumeQos{}
+	valid := []struct {
+		backend   string
+		source    string
+		glusterfs int64
+		encrypted bool
+	}{
+		{"glusterfs", "", 0, false},
+		{"glusterfs", "fast-volume", 2, true},
+		{"lvm", "vg-cloud", 0, true},
+		{"nfs", "10.0.0.5:/export/volumes", 0, false},
+	}
+	for _, tc := range valid {
+		if err := validateVolumeType(tc.backend, tc.source, tc.glusterfs, tc.encrypted, qos); err != nil {
+			t.Errorf("volume type %v unexpectedly rejected: %v", tc, err)
+		}
+	}
+	invalid := []struct {
+		backend   string
+		source    string
+		glusterfs int64
+		encrypted bool
+	}{
+		{"ceph", "pool", 0, false},
+		{"lvm", "", 0, false},
+		{"nfs", "10.0.0.5", 0, false},
+		{"glusterfs", "", 2, false},
+		{"glusterfs", "", 0, true},
+		{"lvm", "vg' ; rm", 0, false},
+	}
+	for _, tc := range invalid {
+		if err := validateVolumeType(tc.backend, tc.source, tc.glusterfs, tc.encrypted, qos); err == nil {
+			t.Errorf("volume type %v unexpectedly accepted", tc)
+		}
+	}
+	if err := validateVolumeType("lvm", "vg", 0, false, &VolumeQos{ReadIops: -1}); err == nil {
+		t.Errorf("negative limit unexpectedly accepted")
+	}
+}
+
+func TestBackendHyperGroup(t *testing.T) {
+	hypers := []*model.Hyper{
+		{Hostid: 1, Status: 1, Backends: "glusterfs,lvm"},
+		{Hostid: 2, Status: 0, Backends: "lvm"},
+		{Hostid: 3, Status: 1, Backends: "nfs, lvm"},
+		{Hostid: 4, Status: 1, Backends: ""},
+	}
+	group, err := backendHyperGroup(hypers, "lvm")
+	if err != nil || group != "group-backend-lvm:1,3" {
+		t.Errorf("unexpected lvm group %q, %v", group, err)
+	}
+	group, err = backendHyperGroup(hypers, "nfs")
+	if err != nil || group != "group-backend-nfs:3" {
+		t.Errorf("unexpected nfs group %q, %v", group, err)
+	}
+	if _, err = backendHyperGroup(hypers, "ceph"); err == nil {
+		t.Errorf("ceph group unexpectedly found")
+	}
+}
+
+func TestDefaultVolumeBackend(t *testing.T) {
+	backend, err := getVolumeBackend(&model.Volume{MultiAttach: true})
+	if err != nil || backend.Backend != "glusterfs" || !backend.Shareable || backend.Qos != nil {
+		t.Errorf("unexpected backend %+v, %v", backend, err)
+	}
+	backend, err = getVolumeBackend(&model.Volume{Secret: "abc"})
+	if err != nil || backend.Shareable || backend.Secret != "abc" {
+		t.Errorf("unexpected backend %+v, %v", backend, err)
+	}
+}
@@ -0,0 +1,663 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/IBM/cloudland/web/clui/model"
+	"github.com/IBM/cloudland/web/sca/dbs"
+	"github.com/go-macaron/session"
+	macaron "gopkg.in/macaron.v1"
+)
+
+var (
+	vpnAdmin = &VpnAdmin{}
+	vpnView  = &VpnView{}
+)
+
+type IkeData struct {
+	Version    string `json:"version"`
+	Encryption string `json:"encryption"`
+	Integrity  string `json:"integrity"`
+	DhGroup    string `json:"dh_group"`
+	Lifetime   int32  `json:"lifetime"`
+}
+
+type EspData struct {
+	Protocol   string `json:"protocol"`
+	Encryption string `json:"encryption"`
+	Integrity  string `json:"integrity"`
+	PfsGroup   string `json:"pfs_group"`
+	Lifetime   int32  `json:"lifetime"`
+}
+
+type VpnData struct {
+	ID           int64    `json:"id"`
+	LocalAddress string   `json:"local_address"`
+	PeerAddress  string   `json:"peer_address"`
+	LocalCidrs   []string `json:"local_cidrs"`
+	PeerCidrs    []string `json:"peer_cidrs"`
+	Psk          string   `json:"psk"`
+	Ike          *IkeData `json:"ike"`
+	Esp          *EspData `json:"esp"`
+}
+
+type VpnAdmin struct{}
+type VpnView struct{}
+
+func parseCidrs(cidrs string) (nets []*net.IPNet, err error) {
+	for _, c := range strings.FieldsFunc(cidrs, func(r rune) bool { return r == ',' || r == ' ' }) {
+		var ipNet *net.IPNet
+		_, ipNet, err = net.ParseCIDR(c)
+		if err != nil {
+			log.Println("Failed to parse cidr", c)
+			err = fmt.Errorf("Invalid cidr %s", c)
+			return
+		}
+		nets = append(nets, ipNet)
+	}
+	return
+}
+
+func cidrsOverlap(nets1, nets2 []*net.IPNet) (overlap bool) {
+	for _, n1 := range nets1 {
+		for _, n2 := range nets2 {
+			if n1.Contains(n2.IP) || n2.Contains(n1.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *VpnAdmin) getVpnData(vpn *model.VpnService) (vpnData *VpnData) {
+	vpnData = &VpnData{
+		ID:           vpn.ID,
+		LocalAddress: strings.Split(vpn.LocalAddress, "/")[0],
+		PeerAddress:  vpn.PeerAddress,
+		LocalCidrs:   strings.Split(vpn.LocalCidrs, ","),
+		PeerCidrs:    strings.Split(vpn.PeerCidrs, ","),
+		Psk:          vpn.Psk,
+	}
+	if vpn.IkePolicy != nil {
+		vpnData.Ike = &IkeData{
+			Version:    vpn.IkePolicy.Version,
+			Encryption: vpn.IkePolicy.Encryption,
+			Integrity:  vpn.IkePolicy.Integrity,
+			DhGroup:    vpn.IkePolicy.DhGroup,
+			Lifetime:   vpn.IkePolicy.Lifetime,
+		}
+	}
+	if vpn.IpsecPolicy != nil {
+		vpnData.Esp = &EspData{
+			Protocol:   vpn.IpsecPolicy.Protocol,
+			Encryption: vpn.IpsecPolicy.Encryption,
+			Integrity:  vpn.IpsecPolicy.Integrity,
+			PfsGroup:   vpn.IpsecPolicy.PfsGroup,
+			Lifetime:   vpn.IpsecPolicy.Lifetime,
+		}
+	}
+	return
+}
+
+var (
+	ikeVersions    = map[string]bool{"ikev1": true, "ikev2": true}
+	vpnEncryptions = map[string]bool{"aes128": true, "aes192": true, "aes256": true}
+	vpnIntegrities = map[string]bool{"sha1": true, "sha256": true, "sha384": true, "sha512": true}
+	vpnDhGroups    = map[string]bool{"modp1536": true, "modp2048": true, "modp3072": true, "modp4096": true}
+	minVpnLifetime = int32(60)
+	maxVpnLifetime = int32(86400)
+	pskPattern     = regexp.MustCompile(`^[A-Za-z0-9!#%*+,\-./:=?@^_~]{1,128}$`)
+)
+
+// checkPolicies only lets known algorithms and sane lifetimes into ipsec.conf, a zero lifetime takes the default
+func checkPolicies(ikePolicy *model.IkePolicy, ipsecPolicy *model.IpsecPolicy) (err error) {
+	if ikePolicy == nil || ipsecPolicy == nil {
+		err = fmt.Errorf("Both ike and ipsec policies are required")
+		return
+	}
+	if !ikeVersions[ikePolicy.Version] {
+		err = fmt.Errorf("Invalid ike version %q", ikePolicy.Version)
+	} else if !vpnEncryptions[ikePolicy.Encryption] || !vpnEncryptions[ipsecPolicy.Encryption] {
+		err = fmt.Errorf("Invalid encryption algorithm")
+	} else if !vpnIntegrities[ikePolicy.Integrity] || !vpnIntegrities[ipsecPolicy.Integrity] {
+		err = fmt.Errorf("Invalid integrity algorithm")
+	} else if !vpnDhGroups[ikePolicy.DhGroup] || !vpnDhGroups[ipsecPolicy.PfsGroup] {
+		err = fmt.Errorf("Invalid diffie-hellman group")
+	} else if ipsecPolicy.Protocol != "" && ipsecPolicy.Protocol != "esp" {
+		err = fmt.Errorf("Invalid ipsec protocol %q", ipsecPolicy.Protocol)
+	}
+	if err != nil {
+		return
+	}
+	for _, lifetime := range []int32{ikePolicy.Lifetime, ipsecPolicy.Lifetime} {
+		if lifetime != 0 && (lifetime < minVpnLifetime || lifetime > maxVpnLifetime) {
+			err = fmt.Errorf("Lifetime must be between %d and %d seconds", minVpnLifetime, maxVpnLifetime)
+			return
+		}
+	}
+	return
+}
+
+// checkPsk only lets characters into ipsec.secrets which can neither break out of the quoted secret nor be expanded by a shell
+func checkPsk(psk string) (err error) {
+	if psk == "" {
+		err = fmt.Errorf("Pre-shared key is required")
+	} else if !pskPattern.MatchString(psk) {
+		err = fmt.Errorf("Pre-shared key must be at most 128 letters, digits or !#%%*+,-./:=?@^_~")
+	}
+	return
+}
+
+func (a *VpnAdmin) checkCidrs(gateway *model.Gateway, localCidrs, peerCidrs string) (local, peer string, err error) {
+	localNets, err := parseCidrs(localCidrs)
+	if err != nil {
+		return
+	}
+	peerNets, err := parseCidrs(peerCidrs)
+	if err != nil {
+		return
+	}
+	if len(localNets) == 0 || len(peerNets) == 0 {
+		err = fmt.Errorf("Both local and peer cidrs are required")
+		return
+	}
+	if cidrsOverlap(localNets, peerNets) {
+		err = fmt.Errorf("Local cidrs overlap with peer cidrs")
+		return
+	}
+	for _, ln := range localNets {
+		found := false
+		for _, subnet := range gateway.Subnets {
+			inNet := &net.IPNet{
+				IP:   net.ParseIP(subnet.Network),
+				Mask: net.IPMask(net.ParseIP(subnet.Netmask).To4()),
+			}
+			if inNet.Contains(ln.IP) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err = fmt.Errorf("Local cidr %s is not attached to gateway", ln.String())
+			return
+		}
+	}
+	var cidrs []string
+	for _, n := range localNets {
+		cidrs = append(cidrs, n.String())
+	}
+	local = strings.Join(cidrs, ",")
+	cidrs = []string{}
+	for _, n := range peerNets {
+		cidrs = append(cidrs, n.String())
+	}
+	peer = strings.Join(cidrs, ",")
+	return
+}
+
+func (a *VpnAdmin) execVpn(ctx context.Context, vpn *model.VpnService) (err error) {
+	gateway := vpn.Gateway
+	jsonData, err := json.Marshal(a.getVpnData(vpn))
+	if err != nil {
+		log.Println("Failed to marshal vpn json data, %v", err)
+		return
+	}
+	control := fmt.Sprintf("toall=router-%d:%d,%d", gateway.ID, gateway.Hyper, gateway.Peer)
+	if gateway.Hyper == gateway.Peer {
+		control = fmt.Sprintf("inter=%d", gateway.Hyper)
+	}
+	command := fmt.Sprintf("/opt/cloudland/scripts/backend/create_vpn.sh '%d' '%d' <<EOF\n%s\nEOF", gateway.ID, vpn.ID, base64.StdEncoding.EncodeToString(jsonData))
+	err = hyperExecute(ctx, control, command)
+	if err != nil {
+		log.Println("Create vpn command execution failed", err)
+		return
+	}
+	return
+}
+
+func (a *VpnAdmin) Create(ctx context.Context, name string, gatewayID int64, peerAddress, localCidrs, peerCidrs, psk string, ikePolicy *model.IkePolicy, ipsecPolicy *model.IpsecPolicy) (vpn *model.VpnService, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	gateway := &model.Gateway{Model: model.Model{ID: gatewayID}}
+	if err = db.Set("gorm:auto_preload", true).Take(gateway).Error; err != nil {
+		log.Println("DB failed to query gateway", err)
+		return
+	}
+	if gateway.Hyper < 0 {
+		err = fmt.Errorf("Gateway is not active yet")
+		return
+	}
+	if net.ParseIP(peerAddress) == nil {
+		err = fmt.Errorf("Invalid peer address")
+		return
+	}
+	if err = checkPsk(psk); err != nil {
+		return
+	}
+	if err = checkPolicies(ikePolicy, ipsecPolicy); err != nil {
+		return
+	}
+	localCidrs, peerCidrs, err = a.checkCidrs(gateway, localCidrs, peerCidrs)
+	if err != nil {
+		log.Println("Invalid vpn cidrs", err)
+		return
+	}
+	localAddress := ""
+	for _, iface := range gateway.Interfaces {
+		if iface.Type == "gateway_public" && iface.Address != nil {
+			localAddress = iface.Address.Address
+			break
+		}
+	}
+	if localAddress == "" {
+		err = fmt.Errorf("Gateway has no public address")
+		return
+	}
+	ikePolicy.Model = model.Model{Creater: memberShip.UserID, Owner: gateway.Owner}
+	if err = db.Create(ikePolicy).Error; err != nil {
+		log.Println("DB failed to create ike policy", err)
+		return
+	}
+	ipsecPolicy.Model = model.Model{Creater: memberShip.UserID, Owner: gateway.Owner}
+	if err = db.Create(ipsecPolicy).Error; err != nil {
+		log.Println("DB failed to create ipsec policy", err)
+		return
+	}
+	vpn = &model.VpnService{
+		Model:         model.Model{Creater: memberShip.UserID, Owner: gateway.Owner},
+		Name:          name,
+		Status:        "pending",
+		GatewayID:     gateway.ID,
+		Gateway:       gateway,
+		LocalAddress:  localAddress,
+		PeerAddress:   peerAddress,
+		LocalCidrs:    localCidrs,
+		PeerCidrs:     peerCidrs,
+		Psk:           psk,
+		IkePolicyID:   ikePolicy.ID,
+		IkePolicy:     ikePolicy,
+		IpsecPolicyID: ipsecPolicy.ID,
+		IpsecPolicy:   ipsecPolicy,
+	}
+	if err = db.Create(vpn).Error; err != nil {
+		log.Println("DB failed to create vpn service", err)
+		return
+	}
+	err = a.execVpn(ctx, vpn)
+	if err != nil {
+		log.Println("Failed to execute vpn creation", err)
+		return
+	}
+	return
+}
+
+func (a *VpnAdmin) Update(ctx context.Context, id int64, name, peerAddress, localCidrs, peerCidrs, psk string) (vpn *model.VpnService, err error) {
+	db := DB()
+	vpn = &model.VpnService{Model: model.Model{ID: id}}
+	if err = db.Preload("Gateway").Preload("Gateway.Subnets").Preload("IkePolicy").Preload("IpsecPolicy").Take(vpn).Error; err != nil {
+		log.Println("DB failed to query vpn service", err)
+		return
+	}
+	if name != "" {
+		vpn.Name = name
+	}
+	if peerAddress != "" {
+		if net.ParseIP(peerAddress) == nil {
+			err = fmt.Errorf("Invalid peer address")
+			return
+		}
+		vpn.PeerAddress = peerAddress
+	}
+	if psk != "" {
+		if err = checkPsk(psk); err != nil {
+			return
+		}
+		vpn.Psk = psk
+	}
+	if err = checkPolicies(vpn.IkePolicy, vpn.IpsecPolicy); err != nil {
+		return
+	}
+	if localCidrs == "" {
+		localCidrs = vpn.LocalCidrs
+	}
+	if peerCidrs == "" {
+		peerCidrs = vpn.PeerCidrs
+	}
+	vpn.LocalCidrs, vpn.PeerCidrs, err = a.checkCidrs(vpn.Gateway, localCidrs, peerCidrs)
+	if err != nil {
+		log.Println("Invalid vpn cidrs", err)
+		return
+	}
+	vpn.Status = "pending"
+	if err = db.Save(vpn).Error; err != nil {
+		log.Println("DB failed to save vpn service", err)
+		return
+	}
+	err = a.execVpn(ctx, vpn)
+	if err != nil {
+		log.Println("Failed to execute vpn update", err)
+		return
+	}
+	return
+}
+
+func (a *VpnAdmin) Delete(ctx context.Context, id int64) (err error) {
+	db := DB()
+	db = db.Begin()
+	defer func() {
+		if err == nil {
+			db.Commit()
+		} else {
+			db.Rollback()
+		}
+	}()
+	vpn := &model.VpnService{Model: model.Model{ID: id}}
+	if err = db.Preload("Gateway").Take(vpn).Error; err != nil {
+		log.Println("DB failed to query vpn service", err)
+		return
+	}
+	if vpn.Gateway != nil {
+		control := fmt.Sprintf("toall=router-%d:%d,%d", vpn.Gateway.ID, vpn.Gateway.Hyper, vpn.Gateway.Peer)
+		if vpn.Gateway.Hyper == vpn.Gateway.Peer {
+			control = fmt.Sprintf("inter=%d", vpn.Gateway.Hyper)
+		}
+		command := fmt.Sprintf("/opt/cloudland/scripts/backend/clear_vpn.sh '%d' '%d'", vpn.Gateway.ID, vpn.ID)
+		err = hyperExecute(ctx, control, command)
+		if err != nil {
+			log.Println("Clear vpn command execution failed", err)
+			return
+		}
+	}
+	if err = db.Delete(&model.IkePolicy{Model: model.Model{ID: vpn.IkePolicyID}}).Error; err != nil {
+		log.Println("DB failed to delete ike policy", err)
+		return
+	}
+	if err = db.Delete(&model.IpsecPolicy{Model: model.Model{ID: vpn.IpsecPolicyID}}).Error; err != nil {
+		log.Println("DB failed to delete ipsec policy", err)
+		return
+	}
+	if err = db.Delete(vpn).Error; err != nil {
+		log.Println("DB failed to delete vpn service", err)
+		return
+	}
+	return
+}
+
+func (a *VpnAdmin) List(ctx context.Context, offset, limit int64, order, query string) (total int64, vpns []*model.VpnService, err error) {
+	memberShip := GetMemberShip(ctx)
+	db := DB()
+	if limit == 0 {
+		limit = 16
+	}
+
+	if order == "" {
+		order = "created_at"
+	}
+
+	if query != "" {
+		query = fmt.Sprintf("name like '%%%s%%'", query)
+	}
+	where := memberShip.GetWhere()
+	vpns = []*model.VpnService{}
+	if err = db.Model(&model.VpnService{}).Where(where).Where(query).Count(&total).Error; err != nil {
+		log.Println("DB failed to count vpn service(s), %v", err)
+		return
+	}
+	db = dbs.Sortby(db.Offset(offset).Limit(limit), order)
+	if err = db.Preload("Gateway").Preload("IkePolicy").Preload("IpsecPolicy").Where(where).Where(query).Find(&vpns).Error; err != nil {
+		log.Println("DB failed to query vpn service(s), %v", err)
+		return
+	}
+	permit := memberShip.CheckPermission(model.Admin)
+	if permit {
+		db = db.Offset(0).Limit(-1)
+		for _, vpn := range vpns {
+			vpn.OwnerInfo = &model.Organization{Model: model.Model{ID: vpn.Owner}}
+			if err = db.Take(vpn.OwnerInfo).Error; err != nil {
+				log.Println("Failed to query owner info", err)
+				return
+			}
+		}
+	}
+
+	return
+}
+
+func (v *VpnView) List(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Reader)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	offset := c.QueryInt64("offset")
+	limit := c.QueryInt64("limit")
+	if limit == 0 {
+		limit = 16
+	}
+	order := c.QueryTrim("order")
+	if order == "" {
+		order = "-created_at"
+	}
+	query := c.QueryTrim("q")
+	total, vpns, err := vpnAdmin.List(c.Req.Context(), offset, limit, order, query)
+	if err != nil {
+		log.Println("Failed to list vpn service(s), %v", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	pages := GetPages(total, limit)
+	c.Data["Vpns"] = vpns
+	c.Data["Total"] = total
+	c.Data["Pages"] = pages
+	c.Data["Query"] = query
+	if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, map[string]interface{}{
+			"vpns":  vpns,
+			"total": total,
+			"pages": pages,
+			"query": query,
+		})
+		return
+	}
+	c.HTML(200, "vpns")
+}
+
+func (v *VpnView) Delete(c *macaron.Context, store session.Store) (err error) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.Params("id")
+	if id == "" {
+		c.Data["ErrorMsg"] = "Id is Empty"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	vpnID, err := strconv.Atoi(id)
+	if err != nil {
+		log.Println("Invalid vpn ID", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	permit, err := memberShip.CheckOwner(model.Writer, "vpn_services", int64(vpnID))
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	err = vpnAdmin.Delete(c.Req.Context(), int64(vpnID))
+	if err != nil {
+		log.Println("Failed to delete vpn service", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.JSON(200, map[string]interface{}{
+		"redirect": "vpns",
+	})
+	return
+}
+
+func (v *VpnView) New(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	_, gateways, err := gatewayAdmin.List(c.Req.Context(), 0, -1, "", "")
+	if err != nil {
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(500, "500")
+		return
+	}
+	c.Data["Gateways"] = gateways
+	c.HTML(200, "vpns_new")
+}
+
+func (v *VpnView) Edit(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "vpn_services", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	vpn := &model.VpnService{Model: model.Model{ID: id}}
+	if err = DB().Preload("Gateway").Preload("IkePolicy").Preload("IpsecPolicy").Take(vpn).Error; err != nil {
+		log.Println("DB failed to query vpn service", err)
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	c.Data["Vpn"] = vpn
+	c.HTML(200, "vpns_patch")
+}
+
+func (v *VpnView) Patch(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	redirectTo := "../vpns"
+	id := c.ParamsInt64("id")
+	permit, err := memberShip.CheckOwner(model.Writer, "vpn_services", id)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	name := c.QueryTrim("name")
+	peerAddress := c.QueryTrim("peeraddress")
+	localCidrs := c.QueryTrim("localcidrs")
+	peerCidrs := c.QueryTrim("peercidrs")
+	psk := c.QueryTrim("psk")
+	vpn, err := vpnAdmin.Update(c.Req.Context(), id, name, peerAddress, localCidrs, peerCidrs, psk)
+	if err != nil {
+		log.Println("Failed to update vpn service", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, vpn)
+		return
+	}
+	c.Redirect(redirectTo)
+}
+
+func (v *VpnView) Create(c *macaron.Context, store session.Store) {
+	memberShip := GetMemberShip(c.Req.Context())
+	permit := memberShip.CheckPermission(model.Writer)
+	if !permit {
+		log.Println("Not authorized for this operation")
+		c.Data["ErrorMsg"] = "Not authorized for this operation"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	redirectTo := "../vpns"
+	name := c.QueryTrim("name")
+	gatewayID := c.QueryInt64("gateway")
+	permit, err := memberShip.CheckOwner(model.Writer, "gateways", gatewayID)
+	if !permit {
+		log.Println("Not authorized to access gateway")
+		c.Data["ErrorMsg"] = "Not authorized to access gateway"
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	}
+	peerAddress := c.QueryTrim("peeraddress")
+	localCidrs := c.QueryTrim("localcidrs")
+	peerCidrs := c.QueryTrim("peercidrs")
+	psk := c.QueryTrim("psk")
+	ikePolicy := &model.IkePolicy{
+		Version:    c.QueryTrim("ikeversion"),
+		Encryption: c.QueryTrim("ikeencryption"),
+		Integrity:  c.QueryTrim("ikeintegrity"),
+		DhGroup:    c.QueryTrim("ikedhgroup"),
+		Lifetime:   int32(c.QueryInt("ikelifetime")),
+	}
+	ipsecPolicy := &model.IpsecPolicy{
+		Protocol:   c.QueryTrim("espprotocol"),
+		Encryption: c.QueryTrim("espencryption"),
+		Integrity:  c.QueryTrim("espintegrity"),
+		PfsGroup:   c.QueryTrim("esppfsgroup"),
+		Lifetime:   int32(c.QueryInt("esplifetime")),
+	}
+	vpn, err := vpnAdmin.Create(c.Req.Context(), name, gatewayID, peerAddress, localCidrs, peerCidrs, psk, ikePolicy, ipsecPolicy)
+	if err != nil {
+		log.Println("Failed to create vpn service", err)
+		if c.Req.Header.Get("X-Json-Format") == "yes" {
+			c.JSON(500, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data["ErrorMsg"] = err.Error()
+		c.HTML(http.StatusBadRequest, "error")
+		return
+	} else if c.Req.Header.Get("X-Json-Format") == "yes" {
+		c.JSON(200, vpn)
+		return
+	}
+	c.Redirect(redirectTo)
+}
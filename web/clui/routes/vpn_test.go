@@ -0,0 +1,68 @@
+/*
+Copyright <holder> All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+
+*/
+
+package routes
+
+import (
+	"testing"
+
+	"github.com/IBM/cloudland/web/clui/model"
+)
+
+func TestParseCidrs(t *testing.T) {
+	nets, err := parseCidrs("192.168.1.0/24, 10.0.0.1/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 || nets[1].String() != "10.0.0.0/8" {
+		t.Fatal(nets)
+	}
+	if _, err = parseCidrs("192.168.1.0/33"); err == nil {
+		t.Fatal("invalid cidr accepted")
+	}
+}
+
+func TestCidrsOverlap(t *testing.T) {
+	nets1, _ := parseCidrs("192.168.1.0/24")
+	nets2, _ := parseCidrs("192.168.0.0/16")
+	nets3, _ := parseCidrs("10.0.0.0/8,172.16.0.0/12")
+	if !cidrsOverlap(nets1, nets2) {
+		t.Fatal("192.168.1.0/24 should overlap 192.168.0.0/16")
+	}
+	if cidrsOverlap(nets1, nets3) {
+		t.Fatal("192.168.1.0/24 should not overlap 10.0.0.0/8,172.16.0.0/12")
+	}
+}
+
+func TestCheckPolicies(t *testing.T) {
+	ike := &model.IkePolicy{Version: "ikev2", Encryption: "aes256", Integrity: "sha256", DhGroup: "modp2048", Lifetime: 3600}
+	esp := &model.IpsecPolicy{Protocol: "esp", Encryption: "aes128", Integrity: "sha1", PfsGroup: "modp4096"}
+	if err := checkPolicies(ike, esp); err != nil {
+		t.Fatal(err)
+	}
+	injected := *ike
+	injected.Encryption = "aes256\n    leftupdown=/tmp/x"
+	if err := checkPolicies(&injected, esp); err == nil {
+		t.Fatal("injected encryption accepted")
+	}
+	short := *esp
+	short.Lifetime = 10
+	if err := checkPolicies(ike, &short); err == nil {
+		t.Fatal("short lifetime accepted")
+	}
+	if err := checkPsk("secret\" : PSK \"x"); err == nil {
+		t.Fatal("quoted psk accepted")
+	}
+	for _, psk := range []string{"$(reboot)", "`reboot`", "key with spaces", "back\\slash"} {
+		if err := checkPsk(psk); err == nil {
+			t.Fatalf("psk %q accepted", psk)
+		}
+	}
+	if err := checkPsk("s3cr3t-key"); err != nil {
+		t.Fatal(err)
+	}
+}